@@ -1,18 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/cache"
 	"github.com/johnnynu/Coffeehaus/internal/claude"
 	"github.com/johnnynu/Coffeehaus/internal/config"
 	"github.com/johnnynu/Coffeehaus/internal/database"
 	handlers "github.com/johnnynu/Coffeehaus/internal/handlers"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
 	"github.com/johnnynu/Coffeehaus/internal/maps"
 	jwtauth "github.com/johnnynu/Coffeehaus/internal/middleware"
+	"github.com/johnnynu/Coffeehaus/internal/photos"
+	"github.com/johnnynu/Coffeehaus/internal/profanity"
+	"github.com/johnnynu/Coffeehaus/internal/ratelimit"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
 	"github.com/johnnynu/Coffeehaus/internal/search"
 	"github.com/johnnynu/Coffeehaus/internal/shop"
+	"github.com/johnnynu/Coffeehaus/internal/tags"
 	"github.com/joho/godotenv"
 
 	"github.com/go-chi/chi/v5"
@@ -31,6 +48,11 @@ func main() {
 		port = "8080"
 	}
 
+	// cancelled on SIGINT or SIGTERM, background work stops with it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
 	// Initialize database
 	dbConfig, err := config.NewDatabaseConfig()
 	if err != nil {
@@ -45,12 +67,51 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// initialize auth middleware
-	authMiddleware := jwtauth.NewAuthMiddleware(dbConfig.SupabaseURL, dbConfig.SupabaseKey)
+	// initialize auth middleware, tokens are verified locally against the
+	// project's JWT secret or published signing keys
+	authConfig, err := config.NewAuthConfig(dbConfig.SupabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to load auth config: %v", err)
+	}
 
+	verifier, err := auth.NewVerifier(auth.VerifierConfig{
+		HMACSecret: authConfig.JWTSecret,
+		JWKSURL:    authConfig.JWKSURL,
+		Issuer:     authConfig.Issuer,
+		Audience:   authConfig.Audience,
+		Leeway:     30 * time.Second,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize auth middleware: %v", err)
 	}
+	authMiddleware := jwtauth.NewAuthMiddleware(verifier)
+
+	// Initialize redis client
+	redisConfig, err := config.NewRedisConfig()
+	if err != nil {
+		log.Fatalf("Failed to load redis config: %v", err)
+	}
+	// the API runs degraded without redis, /health reports it down
+	redisClient := redis.Open(redisConfig)
+	defer redisClient.Close()
+	if err := redisClient.Ping(ctx); err != nil {
+		log.Printf("Redis unavailable, starting without it: %v", err)
+	} else if err := redisClient.MoveLegacyKeys(ctx); err != nil {
+		log.Printf("Failed to move legacy redis keys: %v", err)
+	}
+
+	// Initialize the cache. Calls to redis on request paths go through its
+	// breaker, so search and trending carry on while redis is down.
+	cacheConfig, err := config.NewCacheConfig()
+	if err != nil {
+		log.Fatalf("Failed to load cache config: %v", err)
+	}
+	redisBreaker := breaker.New("redis", breaker.Consecutive(cacheConfig.BreakerFailures, cacheConfig.BreakerCooldown, cacheConfig.Timeout))
+	redisCache := cache.NewRedis(redisClient, redisBreaker)
+	var resultCache cache.Cache = redisCache
+	if !cacheConfig.Enabled {
+		resultCache = cache.Noop{}
+	}
 
 	// Initialize maps client
 	mapsClient, err := maps.NewMapsClient()
@@ -61,16 +122,174 @@ func main() {
 	// Initialize claude service
 	claudeService := claude.NewService(os.Getenv("CLAUDE_API_KEY"))
 
-	// Initialize shop sync manager
+	// Initialize shop sync manager, synced shops are written to the shop
+	// index so search can answer from redis. Search falls back to the db
+	// while the index is missing.
+	if err := redisClient.InitializeShopIndex(); err != nil {
+		log.Printf("Shop index unavailable: %v", err)
+	}
 	shopSyncManager := shop.NewSyncManager(db)
+	shopSyncManager.SetIndex(redisClient)
+
+	// Initialize spend governor, paid providers are called through it so
+	// their cost is tracked against budgets
+	budgetConfig, err := config.NewBudgetConfig()
+	if err != nil {
+		log.Fatalf("Failed to load budget config: %v", err)
+	}
+	governor := budget.NewGovernor(redisClient, map[string]budget.Budget{
+		budget.ProviderPlaces: {DailyUSD: budgetConfig.PlacesDailyUSD, MonthlyUSD: budgetConfig.PlacesMonthlyUSD},
+		budget.ProviderClaude: {DailyUSD: budgetConfig.ClaudeDailyUSD, MonthlyUSD: budgetConfig.ClaudeMonthlyUSD},
+	})
+	governor.SetBreaker(redisBreaker)
+
+	// Initialize the job queue and its worker, shop syncs run through it so
+	// they are retried and survive restarts
+	jobConfig, err := config.NewJobConfig()
+	if err != nil {
+		log.Fatalf("Failed to load job config: %v", err)
+	}
+	// without redis jobs are queued in memory, so they still run but are
+	// lost on restart
+	var jobQueue jobs.Queue
+	jobQueueHealth := func(ctx context.Context) error { return nil }
+	closeJobQueue := func(ctx context.Context) error { return nil }
+	if streamQueue, err := redisClient.JobQueue(ctx, jobConfig.VisibilityTimeout); err != nil {
+		log.Printf("Job queue unavailable, queueing jobs in memory: %v", err)
+		jobQueue = jobs.NewMemoryQueue()
+		jobQueueHealth = func(ctx context.Context) error {
+			return fmt.Errorf("queueing in memory: %w", err)
+		}
+	} else {
+		jobQueue = streamQueue
+		closeJobQueue = streamQueue.Close
+	}
+	workerConfig := jobs.DefaultWorkerConfig
+	workerConfig.Concurrency = jobConfig.Concurrency
+	workerConfig.MaxAttempts = jobConfig.MaxAttempts
+	workerConfig.DrainTimeout = jobConfig.ShutdownTimeout
+	worker := jobs.NewWorker(jobQueue, workerConfig)
+	worker.Register(shop.SyncJobType, shopSyncManager.HandleSyncJob)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		worker.Run(ctx)
+	}()
 
 	// Initialize search service
-	searchService := search.NewSearchService(mapsClient, db, claudeService, shopSyncManager)
+	places := budget.NewPlaces(governor, mapsClient)
+	searchService := search.NewSearchService(places, db, budget.NewClaude(governor, claudeService), jobQueue)
+	searchConfig, err := config.NewSearchConfig()
+	if err != nil {
+		log.Fatalf("Failed to load search config: %v", err)
+	}
+	if searchConfig.MatchConfidence > 0 {
+		searchService.SetMatchConfidence(searchConfig.MatchConfidence)
+	}
+	searchService.SetCoverage(db, searchConfig.CoverageTTL)
+	searchService.SetRankWeights(search.RankWeights{
+		Distance:         searchConfig.RankDistance,
+		Rating:           searchConfig.RankRating,
+		CoffeehausRating: searchConfig.RankCoffeehausRating,
+		OpenNow:          searchConfig.RankOpenNow,
+		Filters:          searchConfig.RankFilters,
+		Personal:         searchConfig.RankPersonal,
+	})
+	searchService.SetIndex(redisClient)
+	searchService.SetCache(resultCache, cacheConfig.SearchTTL)
+	searchService.SetAutocompleteTTL(cacheConfig.AutocompleteTTL)
+	searchService.SetBreaker(redisBreaker)
+
+	// Initialize rate limits. Every search costs a Claude call and db misses
+	// also cost Places calls, so each gets its own budget per caller.
+	rateLimitConfig, err := config.NewRateLimitConfig()
+	if err != nil {
+		log.Fatalf("Failed to load rate limit config: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(redisClient)
+	limiter.SetBreaker(redisBreaker)
+	claudePolicy := ratelimit.Policy{Name: "claude", PerMinute: rateLimitConfig.ClaudePerMinute, Burst: rateLimitConfig.ClaudeBurst}
+	placesPolicy := ratelimit.Policy{Name: "places", PerMinute: rateLimitConfig.PlacesPerMinute, Burst: rateLimitConfig.PlacesBurst}
+	autocompletePolicy := ratelimit.Policy{Name: "autocomplete", PerMinute: rateLimitConfig.AutocompletePerMinute, Burst: rateLimitConfig.AutocompleteBurst}
+	searchService.SetPlacesLimit(func(ctx context.Context) error {
+		return limiter.Check(ctx, placesPolicy)
+	})
+
+	// Initialize photo storage
+	storageConfig, err := config.NewStorageConfig()
+	if err != nil {
+		log.Fatalf("Failed to load storage config: %v", err)
+	}
+
+	var photoStorage photos.Storage
+	switch storageConfig.Backend {
+	case "supabase":
+		photoStorage = photos.NewSupabaseStorage(dbConfig.SupabaseURL, dbConfig.ServiceRoleKey, storageConfig.Bucket)
+	default:
+		photoStorage, err = photos.NewLocalStorage(storageConfig.LocalDir, storageConfig.PublicURL)
+		if err != nil {
+			log.Fatalf("Failed to initialize local photo storage: %v", err)
+		}
+	}
+	photoService := photos.NewService(db, photoStorage)
+
+	// Initialize tag service and periodically flush its usage counters to the db
+	tagService := tags.NewService(db, redisClient)
+	tagService.SetBreaker(redisBreaker)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		tagService.RunFlusher(ctx, time.Minute)
+	}()
+
+	// Periodically refresh stale shops from Places, one replica at a time
+	resyncConfig, err := config.NewResyncConfig()
+	if err != nil {
+		log.Fatalf("Failed to load resync config: %v", err)
+	}
+	if resyncConfig.Enabled {
+		resyncer := shop.NewResyncer(db, places, shopSyncManager, shop.ResyncConfig{
+			Interval:   resyncConfig.Interval,
+			StaleAfter: resyncConfig.StaleAfter,
+			BatchSize:  resyncConfig.BatchSize,
+			PerMinute:  resyncConfig.PerMinute,
+			Halt: func(err error) bool {
+				return errors.Is(err, budget.ErrUnavailable)
+			},
+		})
+		resyncer.SetLock(func(ctx context.Context) (func(), bool, error) {
+			// a pass can't outlast its interval, so neither can the lock
+			lock, err := redisClient.TryLock(ctx, "shop-resync", resyncConfig.Interval)
+			if err != nil || lock == nil {
+				return nil, false, err
+			}
+			return func() { lock.Release(context.Background()) }, true, nil
+		})
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			resyncer.Run(ctx)
+		}()
+	}
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db)
+	moderationConfig, err := config.NewModerationConfig()
+	if err != nil {
+		log.Fatalf("Failed to load moderation config: %v", err)
+	}
 	userHandler := handlers.NewUserHandler(db)
+	userHandler.SetProfanityChecker(profanity.Default(moderationConfig.ProfanityWords...).Contains)
 	searchHandler := handlers.NewSearchHandler(searchService)
+	postHandler := handlers.NewPostHandler(db, tagService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	photoHandler := handlers.NewPhotoHandler(photoService)
+	shopHandler := handlers.NewShopHandler(shop.NewHistory(db))
+	healthHandler := handlers.NewHealthHandler(map[string]handlers.HealthCheck{
+		"redis":     redisCache.Health,
+		"job_queue": jobQueueHealth,
+	})
+	adminHandler := handlers.NewAdminHandler(governor, shop.NewCurator(db, places, shopSyncManager), jobQueue)
 
 	r := chi.NewRouter()
 
@@ -79,8 +298,9 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"}, // Vite's default port
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -90,22 +310,99 @@ func main() {
 		w.Write([]byte("Hello World"))
 	})
 
+	r.Get("/health", healthHandler.GetHealth)
+
+	// Serve locally stored uploads in development
+	if storageConfig.Backend == "local" {
+		r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir(storageConfig.LocalDir))))
+	}
+
+	// Shop routes
+	r.Route("/shops", func(r chi.Router) {
+		r.Get("/changes", shopHandler.GetRecentChanges)
+		r.Get("/{shopID}/rating-history", shopHandler.GetRatingHistory)
+	})
+
+	// Tag routes
+	r.Route("/tags", func(r chi.Router) {
+		r.Get("/trending", tagHandler.GetTrending)
+		r.Get("/{tag}/posts", tagHandler.GetTagPosts)
+	})
+
 	// protected routes
 	r.Group(func(r chi.Router) {
-		r.Use(authMiddleware.Authenticate)
+		r.Use(authMiddleware.RequireAuth)
 
 		// User routes
 		r.Route("/user", func(r chi.Router) {
 			r.Get("/", authHandler.GetUser)
+			r.Patch("/", userHandler.PatchProfile)
 			r.Put("/{username}", userHandler.UpdateProfile)
 		})
+		r.Get("/users/check-username", userHandler.CheckUsername)
+
+		// Photo routes
+		r.Post("/photos", photoHandler.UploadPhoto)
+
+		// Post routes
+		r.Post("/posts", postHandler.CreatePost)
+
+		// Admin routes
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(authMiddleware.RequireRole("admin"))
+			r.Get("/spend", adminHandler.GetSpend)
+			r.Get("/jobs/dead-letters", adminHandler.GetDeadLetters)
+
+			r.Route("/shops/{shopID}", func(r chi.Router) {
+				r.Get("/", adminHandler.GetShop)
+				r.Patch("/", adminHandler.PatchShop)
+				r.Post("/verify", adminHandler.VerifyShop)
+				r.Delete("/verify", adminHandler.UnverifyShop)
+				r.Post("/hide", adminHandler.HideShop)
+				r.Post("/unhide", adminHandler.UnhideShop)
+				r.Post("/merge", adminHandler.MergeShop)
+				r.Post("/resync", adminHandler.ResyncShop)
+				r.Get("/changes", shopHandler.GetChanges)
+			})
+		})
+	})
+
+	// public routes that personalize for logged in users
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware.OptionalAuth)
+
+		r.Get("/users/{username}", userHandler.GetPublicProfile)
 
 		// Search routes
-		r.Get("/search", searchHandler.HandleSearch)
+		r.With(limiter.Middleware(rateLimitConfig.TrustedProxies, claudePolicy)).Get("/search", searchHandler.HandleSearch)
+		r.With(limiter.Middleware(rateLimitConfig.TrustedProxies, autocompletePolicy)).Get("/autocomplete", searchHandler.HandleAutocomplete)
 	})
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatal(err)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	// stop taking requests and let background work finish. Jobs queued by
+	// requests still running stay in redis for the next worker to start.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), jobConfig.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server cleanly: %v", err)
+	}
+	background.Wait()
+	if err := closeJobQueue(shutdownCtx); err != nil {
+		log.Printf("Failed to close job queue: %v", err)
+	}
+	// spend is written in the background, what is left is written now
+	if err := governor.Flush(shutdownCtx); err != nil {
+		log.Printf("Failed to record spend: %v", err)
 	}
+	log.Println("Shutdown complete")
 } 
\ No newline at end of file
@@ -0,0 +1,134 @@
+// Command crawl sweeps an area with Places nearby searches ahead of users, so
+// searches there are answered from the db from the first one. Cells swept
+// within the coverage TTL are skipped, so an interrupted crawl can be rerun.
+//
+//	go run ./cmd/crawl -lat 33.6846 -lng -117.8265 -radius 20000
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/config"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+	"github.com/johnnynu/Coffeehaus/internal/search"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	lat := flag.Float64("lat", 0, "latitude of the center of the area")
+	lng := flag.Float64("lng", 0, "longitude of the center of the area")
+	radius := flag.Float64("radius", 15000, "radius of the area in meters")
+	depth := flag.Int("depth", 1, "times a cell with a full page of results is split and swept again")
+	perMinute := flag.Float64("per-minute", 30, "places searches per minute")
+	refresh := flag.Bool("refresh", false, "sweep cells that are still fresh too")
+	dryRun := flag.Bool("dry-run", false, "only count the cells that would be swept")
+	flag.Parse()
+
+	if *lat == 0 && *lng == 0 {
+		log.Fatal("-lat and -lng are required")
+	}
+	if *radius <= 0 || *perMinute <= 0 || *depth < 0 {
+		log.Fatal("-radius and -per-minute must be positive and -depth at least 0")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	// cancelled on SIGINT or SIGTERM, the crawl reports how far it got
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	dbConfig, err := config.NewDatabaseConfig()
+	if err != nil {
+		log.Fatalf("Failed to load database config: %v", err)
+	}
+	db, err := database.NewClient(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	redisConfig, err := config.NewRedisConfig()
+	if err != nil {
+		log.Fatalf("Failed to load redis config: %v", err)
+	}
+	redisClient, err := redis.NewClient(redisConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize redis client: %v", err)
+	}
+	defer redisClient.Close()
+
+	mapsClient, err := maps.NewMapsClient()
+	if err != nil {
+		log.Fatalf("Failed to initialize maps client: %v", err)
+	}
+
+	// the crawl spends from the same places budget as the api
+	budgetConfig, err := config.NewBudgetConfig()
+	if err != nil {
+		log.Fatalf("Failed to load budget config: %v", err)
+	}
+	governor := budget.NewGovernor(redisClient, map[string]budget.Budget{
+		budget.ProviderPlaces: {DailyUSD: budgetConfig.PlacesDailyUSD, MonthlyUSD: budgetConfig.PlacesMonthlyUSD},
+	})
+	places := budget.NewPlaces(governor, mapsClient)
+
+	// shops are saved straight away rather than queued, and indexed like
+	// any other sync
+	if err := redisClient.InitializeShopIndex(); err != nil {
+		log.Printf("Shop index unavailable: %v", err)
+	}
+	syncManager := shop.NewSyncManager(db)
+	syncManager.SetIndex(redisClient)
+
+	searchConfig, err := config.NewSearchConfig()
+	if err != nil {
+		log.Fatalf("Failed to load search config: %v", err)
+	}
+
+	crawler := search.NewCrawler(places, db, func(ctx context.Context, inputs []shop.SyncInput) error {
+		_, err := syncManager.BatchSyncShopData(ctx, inputs)
+		return err
+	}, searchConfig.CoverageTTL, search.CrawlConfig{
+		Lat:          *lat,
+		Lng:          *lng,
+		RadiusMeters: *radius,
+		MaxDepth:     *depth,
+		PerMinute:    *perMinute,
+		Refresh:      *refresh,
+		DryRun:       *dryRun,
+		Halt: func(err error) bool {
+			return errors.Is(err, budget.ErrUnavailable)
+		},
+	})
+
+	report, err := crawler.Run(ctx)
+	// spend is written in the background, what is left is written before
+	// exiting, even when the crawl was interrupted
+	flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := governor.Flush(flushCtx); err != nil {
+		log.Printf("Failed to record spend: %v", err)
+	}
+	cancel()
+	if err != nil {
+		log.Fatalf("Crawl failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Failed to print report: %v", err)
+	}
+}
@@ -2,29 +2,33 @@ module github.com/johnnynu/Coffeehaus
 
 go 1.22.3
 
-require github.com/supabase-community/auth-go v1.3.2
+require (
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0
+)
 
 require (
-	github.com/RediSearch/redisearch-go v1.1.1 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/gomodule/redigo v1.9.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
-	github.com/go-chi/chi/v5 v5.2.0 // indirect
-	github.com/go-chi/cors v1.2.1 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/liushuangls/go-anthropic/v2 v2.13.0 // indirect
+	github.com/go-chi/chi/v5 v5.2.0
+	github.com/go-chi/cors v1.2.1
+	github.com/google/uuid v1.3.0
+	github.com/joho/godotenv v1.5.1
+	github.com/liushuangls/go-anthropic/v2 v2.13.0
 	github.com/redis/go-redis/v9 v9.7.0
-	github.com/supabase-community/postgrest-go v0.0.11 // indirect
-	github.com/tomnomnom/linkheader v0.0.0-20180905144013-02ca5825eb80 // indirect
+	github.com/supabase-community/postgrest-go v0.0.11
 	go.opencensus.io v0.22.3 // indirect
 	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
-	googlemaps.github.io/maps v1.7.0 // indirect
+	googlemaps.github.io/maps v1.7.0
 )
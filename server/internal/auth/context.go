@@ -0,0 +1,18 @@
+package auth
+
+import "context"
+
+// contextKey is unexported so only this package can set or read the principal
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored in ctx, if the request was
+// authenticated
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
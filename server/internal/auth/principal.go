@@ -0,0 +1,17 @@
+package auth
+
+import "time"
+
+// Principal is the authenticated caller, built from the claims of a verified
+// Supabase access token
+type Principal struct {
+	UserID    string
+	Email     string
+	Role      string
+	ExpiresAt time.Time
+}
+
+// HasRole reports whether the principal has the given application role
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && p.Role == role
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testSecret   = "super-secret-jwt-token-with-at-least-32-characters"
+	testIssuer   = "https://example.supabase.co/auth/v1"
+	testAudience = "authenticated"
+)
+
+func testClaims(exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "7f1c2c1e-3b6a-4a47-9a1e-0d6c3c1b2a10",
+		"email": "johnny@example.com",
+		"role":  "authenticated",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   exp.Unix(),
+	}
+}
+
+func mintHS256(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func mintRS256(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestVerify_HS256(t *testing.T) {
+	verifier, err := NewVerifier(VerifierConfig{
+		HMACSecret: testSecret,
+		Issuer:     testIssuer,
+		Audience:   testAudience,
+	})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+
+	adminClaims := testClaims(time.Now().Add(time.Hour))
+	adminClaims["app_metadata"] = map[string]interface{}{"role": "admin"}
+
+	wrongIssuer := testClaims(time.Now().Add(time.Hour))
+	wrongIssuer["iss"] = "https://evil.example.com/auth/v1"
+
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims(time.Now().Add(time.Hour))).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name     string
+		token    string
+		wantErr  bool
+		wantRole string
+	}{
+		{
+			name:     "valid token",
+			token:    mintHS256(t, testClaims(time.Now().Add(time.Hour)), testSecret),
+			wantRole: "authenticated",
+		},
+		{
+			name:     "app metadata role wins",
+			token:    mintHS256(t, adminClaims, testSecret),
+			wantRole: "admin",
+		},
+		{
+			name:    "expired token",
+			token:   mintHS256(t, testClaims(time.Now().Add(-time.Minute)), testSecret),
+			wantErr: true,
+		},
+		{
+			name:    "wrong secret",
+			token:   mintHS256(t, testClaims(time.Now().Add(time.Hour)), "some-other-secret-that-is-long-enough"),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   mintHS256(t, wrongIssuer, testSecret),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned token",
+			token:   noneToken,
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			token:   "not.a.token",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("expected ErrInvalidToken but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if principal.UserID != "7f1c2c1e-3b6a-4a47-9a1e-0d6c3c1b2a10" {
+				t.Errorf("UserID = %q", principal.UserID)
+			}
+			if principal.Email != "johnny@example.com" {
+				t.Errorf("Email = %q", principal.Email)
+			}
+			if principal.Role != tt.wantRole {
+				t.Errorf("Role = %q, want %q", principal.Role, tt.wantRole)
+			}
+			if principal.ExpiresAt.IsZero() {
+				t.Error("ExpiresAt was not set")
+			}
+		})
+	}
+}
+
+// jwksServer serves whichever keys are currently set and counts fetches
+type jwksServer struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetches int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range s.keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func TestVerify_JWKSRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	jwks := &jwksServer{keys: map[string]*rsa.PublicKey{"old": &oldKey.PublicKey}}
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier, err := NewVerifier(VerifierConfig{JWKSURL: server.URL, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	ctx := context.Background()
+	claims := testClaims(time.Now().Add(time.Hour))
+
+	if _, err := verifier.Verify(ctx, mintRS256(t, claims, oldKey, "old")); err != nil {
+		t.Fatalf("unexpected error for old key: %v", err)
+	}
+	if _, err := verifier.Verify(ctx, mintRS256(t, claims, oldKey, "old")); err != nil {
+		t.Fatalf("unexpected error for cached key: %v", err)
+	}
+	if jwks.fetches != 1 {
+		t.Errorf("fetches = %d, want the key set to be cached after 1", jwks.fetches)
+	}
+
+	// rotate, and let the refetch throttle pass
+	jwks.mu.Lock()
+	jwks.keys = map[string]*rsa.PublicKey{"old": &oldKey.PublicKey, "new": &newKey.PublicKey}
+	jwks.mu.Unlock()
+	verifier.jwks.lastAttempt = time.Time{}
+
+	if _, err := verifier.Verify(ctx, mintRS256(t, claims, newKey, "new")); err != nil {
+		t.Fatalf("unexpected error for rotated key: %v", err)
+	}
+	if jwks.fetches != 2 {
+		t.Errorf("fetches = %d, want an unknown kid to trigger a refetch", jwks.fetches)
+	}
+
+	// a token signed by a key that isn't published is rejected
+	if _, err := verifier.Verify(ctx, mintRS256(t, claims, newKey, "old")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for mismatched key, got %v", err)
+	}
+
+	// HS256 tokens are refused when no secret is configured
+	if _, err := verifier.Verify(ctx, mintHS256(t, claims, testSecret)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for hmac token, got %v", err)
+	}
+}
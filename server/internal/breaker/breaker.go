@@ -0,0 +1,200 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Breaker.Do while the breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is whether calls through a breaker are let through
+type State string
+
+const (
+	// Closed lets every call through
+	Closed State = "closed"
+	// Open fails calls without making them until the cooldown is up
+	Open State = "open"
+	// HalfOpen lets a single probe call through, its outcome closes or
+	// reopens the breaker
+	HalfOpen State = "half_open"
+)
+
+// Config controls when a breaker trips. It trips once at least MinRequests
+// of the last Window calls were made and the share that failed reaches
+// FailureRate, then stays open for Cooldown before letting a single probe
+// call through. Calls made with Do are given Timeout to finish, 0 leaves
+// them to their caller's deadline.
+type Config struct {
+	Window      int
+	MinRequests int
+	FailureRate float64
+	Cooldown    time.Duration
+	Timeout     time.Duration
+}
+
+// Consecutive is a config that trips after threshold failures in a row
+func Consecutive(threshold int, cooldown, timeout time.Duration) Config {
+	return Config{
+		Window:      threshold,
+		MinRequests: threshold,
+		FailureRate: 1,
+		Cooldown:    cooldown,
+		Timeout:     timeout,
+	}
+}
+
+// Breaker stops calls to a dependency that is failing, so callers fail fast
+// instead of waiting on, or paying for, calls that won't succeed
+type Breaker struct {
+	name string
+	cfg  Config
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	outcomes []bool // ring of recent call results, true for failures
+	next     int
+	count    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New returns a closed breaker, name is what its state changes are logged as
+func New(name string, cfg Config) *Breaker {
+	return &Breaker{
+		name:     name,
+		cfg:      cfg,
+		now:      time.Now,
+		state:    Closed,
+		outcomes: make([]bool, cfg.Window),
+	}
+}
+
+// SetClock sets where the breaker reads the time from
+func (b *Breaker) SetClock(now func() time.Time) {
+	b.now = now
+}
+
+// Do calls fn unless the breaker is open. A call that errors or runs out of
+// time counts as a failure, one abandoned by its caller doesn't count.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.Allow() {
+		return ErrOpen
+	}
+
+	callCtx := ctx
+	if b.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.cfg.Timeout)
+		defer cancel()
+	}
+
+	err := fn(callCtx)
+	if ctx.Err() != nil {
+		b.Release()
+		return err
+	}
+	b.Record(err != nil)
+	return err
+}
+
+// Allow reports whether a call may be made
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		b.probing = true
+		return true
+	case HalfOpen:
+		// only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of an allowed call
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+		} else {
+			b.reset()
+		}
+		return
+	}
+
+	if b.count == len(b.outcomes) && b.outcomes[b.next] {
+		b.failures--
+	}
+	b.outcomes[b.next] = failed
+	b.next = (b.next + 1) % len(b.outcomes)
+	if b.count < len(b.outcomes) {
+		b.count++
+	}
+	if failed {
+		b.failures++
+	}
+
+	if b.state == Closed && b.count >= b.cfg.MinRequests &&
+		float64(b.failures)/float64(b.count) >= b.cfg.FailureRate {
+		b.trip()
+	}
+}
+
+// Release gives back an allowed call's probe slot without recording an
+// outcome, for calls that never finished so say nothing about the dependency
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) trip() {
+	if b.state != Open {
+		log.Printf("%s circuit opened", b.name)
+	}
+	b.state = Open
+	b.openedAt = b.now()
+}
+
+func (b *Breaker) reset() {
+	if b.state != Closed {
+		log.Printf("%s circuit closed", b.name)
+	}
+	b.state = Closed
+	b.next, b.count, b.failures = 0, 0, 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+}
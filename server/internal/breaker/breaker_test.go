@@ -0,0 +1,151 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(cfg Config) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	b := New("test", cfg)
+	b.SetClock(clock.now)
+	return b, clock
+}
+
+func TestBreaker(t *testing.T) {
+	b, clock := newTestBreaker(Config{Window: 4, MinRequests: 4, FailureRate: 0.5, Cooldown: time.Minute})
+
+	// not enough calls to judge yet
+	b.Record(true)
+	b.Record(true)
+	b.Record(true)
+	if b.State() != Closed {
+		t.Fatalf("state = %s, want closed below min requests", b.State())
+	}
+
+	b.Record(false)
+	if b.State() != Open || b.Allow() {
+		t.Fatalf("state = %s, want open at 75%% failures", b.State())
+	}
+
+	clock.advance(time.Minute)
+	if !b.Allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("expected only one probe at a time")
+	}
+
+	// a failed probe opens it again for another cooldown
+	b.Record(true)
+	if b.State() != Open {
+		t.Fatalf("state = %s, want open after a failed probe", b.State())
+	}
+
+	clock.advance(time.Minute)
+	if !b.Allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	b.Record(false)
+	if b.State() != Closed {
+		t.Fatalf("state = %s, want closed after a good probe", b.State())
+	}
+
+	// old failures fall out of the window
+	b.Record(true)
+	b.Record(false)
+	b.Record(false)
+	b.Record(false)
+	b.Record(true)
+	if b.State() != Closed {
+		t.Fatalf("state = %s, want closed at 25%% failures", b.State())
+	}
+}
+
+func TestBreakerDo(t *testing.T) {
+	ctx := context.Background()
+	b, clock := newTestBreaker(Consecutive(3, 30*time.Second, 50*time.Millisecond))
+	errDown := errors.New("connection refused")
+
+	calls := 0
+	fail := func(ctx context.Context) error { calls++; return errDown }
+	succeed := func(ctx context.Context) error { calls++; return nil }
+
+	// a success in between starts the count again
+	_ = b.Do(ctx, fail)
+	_ = b.Do(ctx, fail)
+	_ = b.Do(ctx, succeed)
+	for i := 0; i < 3; i++ {
+		if state := b.State(); state != Closed {
+			t.Fatalf("state = %s after %d failures in a row, want closed", state, i)
+		}
+		if err := b.Do(ctx, fail); !errors.Is(err, errDown) {
+			t.Fatalf("call %d: err = %v, want the call's error", i, err)
+		}
+	}
+	if state := b.State(); state != Open {
+		t.Fatalf("state = %s, want open after 3 failures in a row", state)
+	}
+
+	// open, calls aren't made
+	made := calls
+	if err := b.Do(ctx, succeed); !errors.Is(err, ErrOpen) || calls != made {
+		t.Fatalf("err = %v, want ErrOpen without a call", err)
+	}
+
+	// after the cooldown a successful probe closes it
+	clock.advance(30 * time.Second)
+	if err := b.Do(ctx, succeed); err != nil {
+		t.Fatalf("probe err = %v", err)
+	}
+	if state := b.State(); state != Closed {
+		t.Fatalf("state = %s, want closed", state)
+	}
+}
+
+func TestBreakerDoCountsTimeoutsNotCancellations(t *testing.T) {
+	b, clock := newTestBreaker(Consecutive(3, 30*time.Second, 50*time.Millisecond))
+	wait := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// callers giving up say nothing about the dependency
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = b.Do(ctx, wait)
+	}
+	if state := b.State(); state != Closed {
+		t.Fatalf("state = %s, want closed after cancelled calls", state)
+	}
+
+	// calls running out of time do
+	for i := 0; i < 3; i++ {
+		if err := b.Do(context.Background(), wait); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want the call timeout", err)
+		}
+	}
+	if state := b.State(); state != Open {
+		t.Fatalf("state = %s, want open after timeouts", state)
+	}
+
+	// a cancelled probe frees the probe slot without closing the breaker
+	clock.advance(30 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = b.Do(ctx, wait)
+	if state := b.State(); state != HalfOpen {
+		t.Fatalf("state = %s after a cancelled probe, want half open", state)
+	}
+	if !b.Allow() {
+		t.Error("expected another probe after a cancelled one")
+	}
+}
@@ -0,0 +1,226 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/claude"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestGovernor(t *testing.T, budgets map[string]Budget) (*Governor, *fakeClock) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+
+	clock := &fakeClock{t: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)}
+	g := NewGovernor(client, budgets)
+	g.now = clock.now
+	for _, b := range g.breakers {
+		b.SetClock(clock.now)
+	}
+	return g, clock
+}
+
+func TestGovernorBudgets(t *testing.T) {
+	ctx := context.Background()
+	g, clock := newTestGovernor(t, map[string]Budget{
+		ProviderPlaces: {DailyUSD: 0.1, MonthlyUSD: 0.2},
+	})
+	record := g.Recorder(ProviderPlaces)
+
+	if err := g.Allow(ctx, ProviderPlaces); err != nil {
+		t.Fatalf("unexpected error under budget: %v", err)
+	}
+
+	// 3 text searches cost $0.096, still under the $0.10 daily budget
+	for i := 0; i < 3; i++ {
+		record(ctx, maps.SKUTextSearch, 1)
+	}
+	if err := g.Allow(ctx, ProviderPlaces); err != nil {
+		t.Fatalf("unexpected error under budget: %v", err)
+	}
+
+	record(ctx, maps.SKUPlaceDetails, 1)
+	if err := g.Allow(ctx, ProviderPlaces); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable over the daily budget, got %v", err)
+	}
+
+	// the day rolls over but the month still counts it
+	clock.advance(25 * time.Hour)
+	if err := g.Allow(ctx, ProviderPlaces); err != nil {
+		t.Fatalf("unexpected error after the day rolled: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		record(ctx, maps.SKUTextSearch, 1)
+	}
+	clock.advance(spendCacheTTL)
+	if err := g.Allow(ctx, ProviderPlaces); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable over the monthly budget, got %v", err)
+	}
+
+	// providers without a budget aren't governed
+	if err := g.Allow(ctx, "other"); err != nil {
+		t.Errorf("unexpected error for ungoverned provider: %v", err)
+	}
+}
+
+func TestGovernorReport(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newTestGovernor(t, map[string]Budget{
+		ProviderPlaces: {DailyUSD: 10, MonthlyUSD: 100},
+		ProviderClaude: {DailyUSD: 1, MonthlyUSD: 20},
+	})
+
+	g.Recorder(ProviderClaude)(ctx, claude.SKUInputTokens, 1000)
+	g.Recorder(ProviderClaude)(ctx, claude.SKUOutputTokens, 200)
+	g.Recorder(ProviderPlaces)(ctx, maps.SKUGeocoding, 2)
+
+	report, err := g.Report(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report) != 2 || report[0].Provider != ProviderClaude || report[1].Provider != ProviderPlaces {
+		t.Fatalf("unexpected providers in report: %+v", report)
+	}
+
+	claudeSpend := report[0]
+	if got := fmt.Sprintf("%.3f", claudeSpend.Daily.SpentUSD); got != "0.006" {
+		t.Errorf("claude daily spend = %s, want 0.006", got)
+	}
+	if got := fmt.Sprintf("%.3f", claudeSpend.Monthly.BySKU[claude.SKUOutputTokens]); got != "0.003" {
+		t.Errorf("claude output token spend = %s, want 0.003", got)
+	}
+	if claudeSpend.Daily.BudgetUSD != 1 || !claudeSpend.Available || claudeSpend.Breaker != breaker.Closed {
+		t.Errorf("unexpected claude report: %+v", claudeSpend)
+	}
+
+	if got := fmt.Sprintf("%.3f", report[1].Daily.SpentUSD); got != "0.010" {
+		t.Errorf("places daily spend = %s, want 0.010", got)
+	}
+}
+
+func TestGovernorBreaker(t *testing.T) {
+	ctx := context.Background()
+	g, clock := newTestGovernor(t, map[string]Budget{
+		ProviderClaude: {DailyUSD: 10, MonthlyUSD: 100},
+	})
+
+	// empty searches and cancelled requests don't count as failures
+	for i := 0; i < defaultBreakerConfig.Window; i++ {
+		g.Done(ProviderClaude, maps.ErrNoResults)
+		g.Done(ProviderClaude, context.Canceled)
+	}
+	if err := g.Allow(ctx, ProviderClaude); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < defaultBreakerConfig.Window; i++ {
+		g.Done(ProviderClaude, errors.New("overloaded"))
+	}
+	if err := g.Allow(ctx, ProviderClaude); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable with the breaker open, got %v", err)
+	}
+
+	clock.advance(defaultBreakerConfig.Cooldown)
+	if err := g.Allow(ctx, ProviderClaude); err != nil {
+		t.Fatalf("expected a probe once the cooldown passed, got %v", err)
+	}
+	// a cancelled probe frees the probe slot but doesn't close the breaker
+	g.Done(ProviderClaude, context.Canceled)
+	if state := g.breakers[ProviderClaude].State(); state != breaker.HalfOpen {
+		t.Fatalf("state = %s after a cancelled probe, want half open", state)
+	}
+	if err := g.Allow(ctx, ProviderClaude); err != nil {
+		t.Fatalf("expected another probe after a cancelled one, got %v", err)
+	}
+	g.Done(ProviderClaude, nil)
+	if err := g.Allow(ctx, ProviderClaude); err != nil {
+		t.Fatalf("expected the breaker to close after a good probe, got %v", err)
+	}
+}
+
+func TestGovernorHungRedis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+
+	clock := &fakeClock{t: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)}
+	g := NewGovernor(client, map[string]Budget{ProviderPlaces: {DailyUSD: 10, MonthlyUSD: 100}})
+	g.now = clock.now
+	redisBreaker := breaker.New("redis", breaker.Consecutive(2, time.Minute, 50*time.Millisecond))
+	redisBreaker.SetClock(clock.now)
+	g.SetBreaker(redisBreaker)
+
+	// redis takes every command and never answers
+	hung := make(chan struct{})
+	mr.Server().SetPreHook(func(*server.Peer, string, ...string) bool {
+		<-hung
+		return false
+	})
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			mr.Server().SetPreHook(nil)
+			close(hung)
+		})
+	}
+	t.Cleanup(release)
+
+	// nearby searches, each a nearby search call and ten place details
+	start := time.Now()
+	record := g.Recorder(ProviderPlaces)
+	for i := 0; i < 3; i++ {
+		if err := g.Allow(ctx, ProviderPlaces); err != nil {
+			t.Fatalf("Allow() = %v, want it to fail open", err)
+		}
+		record(ctx, maps.SKUNearbySearch, 1)
+		for j := 0; j < 10; j++ {
+			record(ctx, maps.SKUPlaceDetails, 1)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("searches took %s with redis hung, want them not to wait on it", elapsed)
+	}
+	// the spend waits for redis
+	if err := g.Flush(ctx); err == nil {
+		t.Fatal("Flush() = nil with redis hung")
+	}
+	if state := redisBreaker.State(); state != breaker.Open {
+		t.Fatalf("redis breaker %s, want open", state)
+	}
+
+	// spend kept while redis was hung is written once it is back
+	release()
+	clock.advance(time.Minute)
+	if err := g.Flush(ctx); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	daily, err := client.Spend(ctx, ProviderPlaces, redis.SpendDay, clock.now())
+	if err != nil {
+		t.Fatalf("Spend() = %v", err)
+	}
+	want := 3 * (Costs[maps.SKUNearbySearch] + 10*Costs[maps.SKUPlaceDetails])
+	if got := sum(daily); got != want {
+		t.Errorf("recorded %d micros, want %d", got, want)
+	}
+}
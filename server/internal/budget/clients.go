@@ -0,0 +1,122 @@
+package budget
+
+import (
+	"context"
+
+	"github.com/johnnynu/Coffeehaus/internal/claude"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// Places is a maps client whose calls are charged to the places budget
+type Places struct {
+	governor *Governor
+	client   *maps.MapsClient
+}
+
+// NewPlaces wraps client, which from then on reports its usage to governor
+func NewPlaces(governor *Governor, client *maps.MapsClient) *Places {
+	client.SetUsageRecorder(governor.Recorder(ProviderPlaces))
+	return &Places{governor: governor, client: client}
+}
+
+func (p *Places) SearchCoffeeShops(ctx context.Context, lat, lng float64, radiusMeters uint) ([]*maps.CoffeeShopDetails, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	shops, err := p.client.SearchCoffeeShops(ctx, lat, lng, radiusMeters)
+	p.governor.Done(ProviderPlaces, err)
+	return shops, err
+}
+
+func (p *Places) SearchNearestCoffeeShops(ctx context.Context, lat, lng float64) (*maps.Nearby, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	nearby, err := p.client.SearchNearestCoffeeShops(ctx, lat, lng)
+	p.governor.Done(ProviderPlaces, err)
+	return nearby, err
+}
+
+func (p *Places) SearchSpecificCoffeeShop(ctx context.Context, shopName string, location string) ([]*maps.CoffeeShopDetails, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	shops, err := p.client.SearchSpecificCoffeeShop(ctx, shopName, location)
+	p.governor.Done(ProviderPlaces, err)
+	return shops, err
+}
+
+func (p *Places) SearchCoffeeShopsByArea(ctx context.Context, query string, bias *maps.Bias) ([]*maps.CoffeeShopDetails, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	shops, err := p.client.SearchCoffeeShopsByArea(ctx, query, bias)
+	p.governor.Done(ProviderPlaces, err)
+	return shops, err
+}
+
+func (p *Places) Geocode(ctx context.Context, address string) (*maps.Area, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	area, err := p.client.Geocode(ctx, address)
+	p.governor.Done(ProviderPlaces, err)
+	return area, err
+}
+
+func (p *Places) Autocomplete(ctx context.Context, input string, bias *maps.Bias, session string) ([]maps.Prediction, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	predictions, err := p.client.Autocomplete(ctx, input, bias, session)
+	p.governor.Done(ProviderPlaces, err)
+	return predictions, err
+}
+
+func (p *Places) GetSuggestedPlace(ctx context.Context, placeID string, session string) (*maps.CoffeeShopDetails, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	details, err := p.client.GetSuggestedPlace(ctx, placeID, session)
+	p.governor.Done(ProviderPlaces, err)
+	return details, err
+}
+
+func (p *Places) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return "", err
+	}
+	location, err := p.client.ReverseGeocode(ctx, lat, lng)
+	p.governor.Done(ProviderPlaces, err)
+	return location, err
+}
+
+// Claude is a claude service whose calls are charged to the claude budget
+type Claude struct {
+	governor *Governor
+	service  *claude.Service
+}
+
+// NewClaude wraps service, which from then on reports its usage to governor
+func NewClaude(governor *Governor, service *claude.Service) *Claude {
+	service.SetUsageRecorder(governor.Recorder(ProviderClaude))
+	return &Claude{governor: governor, service: service}
+}
+
+func (c *Claude) AnalyzeSearchQuery(ctx context.Context, query string, userLocation string) (*claude.SearchIntent, error) {
+	if err := c.governor.Allow(ctx, ProviderClaude); err != nil {
+		return nil, err
+	}
+	intent, err := c.service.AnalyzeSearchQuery(ctx, query, userLocation)
+	c.governor.Done(ProviderClaude, err)
+	return intent, err
+}
+
+func (p *Places) GetPlaceDetails(ctx context.Context, placeID string) (*maps.CoffeeShopDetails, error) {
+	if err := p.governor.Allow(ctx, ProviderPlaces); err != nil {
+		return nil, err
+	}
+	details, err := p.client.GetPlaceDetails(ctx, placeID)
+	p.governor.Done(ProviderPlaces, err)
+	return details, err
+}
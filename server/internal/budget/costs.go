@@ -0,0 +1,32 @@
+package budget
+
+import (
+	"github.com/johnnynu/Coffeehaus/internal/claude"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// Providers whose spend is governed
+const (
+	ProviderPlaces = "places"
+	ProviderClaude = "claude"
+)
+
+// Costs is the list price of one unit of each sku in micros, millionths of a
+// dollar. Places skus are billed per request, Claude per token.
+var Costs = map[string]int64{
+	maps.SKUNearbySearch:   32000,
+	maps.SKUTextSearch:     32000,
+	maps.SKUPlaceDetails:   17000,
+	maps.SKUAutocomplete:   2830,
+	maps.SKUGeocoding:      5000,
+	claude.SKUInputTokens:  3,
+	claude.SKUOutputTokens: 15,
+}
+
+func microsToUSD(micros int64) float64 {
+	return float64(micros) / 1e6
+}
+
+func usdToMicros(usd float64) int64 {
+	return int64(usd * 1e6)
+}
@@ -0,0 +1,299 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+// ErrUnavailable is returned instead of calling a provider that is over
+// budget or whose breaker is open. Callers should fall back to what they can
+// answer without it.
+var ErrUnavailable = errors.New("provider unavailable")
+
+// defaultBreakerConfig trips a provider's breaker once half of its last 20
+// calls failed, counting from 10 calls
+var defaultBreakerConfig = breaker.Config{
+	Window:      20,
+	MinRequests: 10,
+	FailureRate: 0.5,
+	Cooldown:    30 * time.Second,
+}
+
+const (
+	// spendCacheTTL bounds how stale the totals checked against budgets get,
+	// so every call doesn't read every spend bucket. A read that failed is
+	// retried no sooner either.
+	spendCacheTTL = 10 * time.Second
+	recordTimeout = 2 * time.Second
+)
+
+// Budget is how much a provider may spend over the rolling day and month
+type Budget struct {
+	DailyUSD   float64
+	MonthlyUSD float64
+}
+
+type spendTotals struct {
+	daily     int64
+	monthly   int64
+	fetchedAt time.Time
+}
+
+// spendKey groups spend waiting to be written, by the hour it was spent in
+type spendKey struct {
+	provider string
+	sku      string
+	hour     time.Time
+}
+
+// Governor tracks what calls to paid providers cost and refuses calls once a
+// provider is over budget or failing
+type Governor struct {
+	redis    *redis.RedisClient
+	budgets  map[string]Budget
+	breakers map[string]*breaker.Breaker
+	// redisBreaker guards spend reads and writes, it is shared with the
+	// other request path calls to redis
+	redisBreaker *breaker.Breaker
+	now          func() time.Time
+
+	mu     sync.Mutex
+	totals map[string]*spendTotals
+	// pending is spend not yet written to redis, inflight the batch being
+	// written. Both count towards budgets until written.
+	pending  map[spendKey]int64
+	inflight map[spendKey]int64
+	flushing bool
+	// flushMu lets one batch be written at a time
+	flushMu sync.Mutex
+}
+
+func NewGovernor(redis *redis.RedisClient, budgets map[string]Budget) *Governor {
+	breakers := make(map[string]*breaker.Breaker, len(budgets))
+	for provider := range budgets {
+		breakers[provider] = breaker.New(provider, defaultBreakerConfig)
+	}
+
+	return &Governor{
+		redis:    redis,
+		budgets:  budgets,
+		breakers: breakers,
+		now:      time.Now,
+		totals:   make(map[string]*spendTotals),
+		pending:  make(map[spendKey]int64),
+	}
+}
+
+// SetBreaker sets the breaker spend is read and written through, so calls
+// to providers aren't held up by a hung redis
+func (g *Governor) SetBreaker(b *breaker.Breaker) {
+	g.redisBreaker = b
+}
+
+// guarded calls fn through the redis breaker, if one is set
+func (g *Governor) guarded(ctx context.Context, fn func(ctx context.Context) error) error {
+	if g.redisBreaker == nil {
+		return fn(ctx)
+	}
+	return g.redisBreaker.Do(ctx, fn)
+}
+
+// Allow returns an error wrapping ErrUnavailable if the provider shouldn't be
+// called. Every allowed call must be followed by Done.
+func (g *Governor) Allow(ctx context.Context, provider string) error {
+	budget, ok := g.budgets[provider]
+	if !ok {
+		return nil
+	}
+
+	totals, err := g.spendTotals(ctx, provider)
+	if err != nil {
+		// fail open, losing redis shouldn't take search down with it
+		log.Printf("Failed to read %s spend: %v", provider, err)
+	} else {
+		if totals.daily >= usdToMicros(budget.DailyUSD) {
+			return fmt.Errorf("%w: %s daily budget exhausted", ErrUnavailable, provider)
+		}
+		if totals.monthly >= usdToMicros(budget.MonthlyUSD) {
+			return fmt.Errorf("%w: %s monthly budget exhausted", ErrUnavailable, provider)
+		}
+	}
+
+	if !g.breakers[provider].Allow() {
+		return fmt.Errorf("%w: %s circuit breaker is open", ErrUnavailable, provider)
+	}
+
+	return nil
+}
+
+// Done records the outcome of an allowed call with the provider's breaker.
+// Searches that found nothing and cancelled requests aren't failures.
+func (g *Governor) Done(provider string, err error) {
+	b, ok := g.breakers[provider]
+	if !ok {
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		// the call never finished, so it says nothing about the provider but
+		// a half open breaker still needs its probe slot back
+		b.Release()
+		return
+	}
+
+	b.Record(err != nil && !errors.Is(err, maps.ErrNoResults))
+}
+
+// Recorder returns a usage callback that charges the provider for each unit.
+// Spend counts towards the provider's budget at once and is written to redis
+// in the background, batched by sku and hour.
+func (g *Governor) Recorder(provider string) func(ctx context.Context, sku string, units int) {
+	return func(ctx context.Context, sku string, units int) {
+		cost, ok := Costs[sku]
+		if !ok {
+			log.Printf("No cost configured for sku %s", sku)
+			return
+		}
+		micros := cost * int64(units)
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if totals, ok := g.totals[provider]; ok {
+			totals.daily += micros
+			totals.monthly += micros
+		}
+		g.pending[spendKey{provider: provider, sku: sku, hour: g.now().Truncate(time.Hour)}] += micros
+		if !g.flushing {
+			g.flushing = true
+			go g.flushInBackground()
+		}
+	}
+}
+
+// flushInBackground writes pending spend until none is left or a write fails,
+// spend that failed to write waits for the next call to be recorded
+func (g *Governor) flushInBackground() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		err := g.Flush(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to record spend: %v", err)
+		}
+
+		g.mu.Lock()
+		if err != nil || len(g.pending) == 0 {
+			g.flushing = false
+			g.mu.Unlock()
+			return
+		}
+		g.mu.Unlock()
+	}
+}
+
+// Flush writes the spend recorded so far to redis. Spend that fails to write
+// is kept for the next flush.
+func (g *Governor) Flush(ctx context.Context) error {
+	g.flushMu.Lock()
+	defer g.flushMu.Unlock()
+
+	g.mu.Lock()
+	batch := g.pending
+	g.pending = make(map[spendKey]int64)
+	g.inflight = batch
+	g.mu.Unlock()
+
+	failed := make(map[spendKey]int64)
+	var errs []error
+	for key, micros := range batch {
+		err := g.guarded(ctx, func(ctx context.Context) error {
+			return g.redis.RecordSpend(ctx, key.provider, key.sku, micros, key.hour)
+		})
+		if err != nil {
+			failed[key] = micros
+			errs = append(errs, fmt.Errorf("%s %s: %w", key.provider, key.sku, err))
+		}
+	}
+
+	g.mu.Lock()
+	g.inflight = nil
+	for key, micros := range failed {
+		g.pending[key] += micros
+	}
+	g.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// unwritten is the provider's spend not yet in redis since a time, callers
+// hold g.mu
+func (g *Governor) unwritten(provider string, since time.Time) int64 {
+	var total int64
+	for _, batch := range []map[spendKey]int64{g.pending, g.inflight} {
+		for key, micros := range batch {
+			if key.provider == provider && key.hour.After(since) {
+				total += micros
+			}
+		}
+	}
+	return total
+}
+
+func (g *Governor) spendTotals(ctx context.Context, provider string) (spendTotals, error) {
+	g.mu.Lock()
+	cached, ok := g.totals[provider]
+	if ok && g.now().Sub(cached.fetchedAt) < spendCacheTTL {
+		totals := *cached
+		g.mu.Unlock()
+		return totals, nil
+	}
+	g.mu.Unlock()
+
+	now := g.now()
+	var daily, monthly map[string]int64
+	err := g.guarded(ctx, func(ctx context.Context) error {
+		var err error
+		if daily, err = g.redis.Spend(ctx, provider, redis.SpendDay, now); err != nil {
+			return err
+		}
+		monthly, err = g.redis.Spend(ctx, provider, redis.SpendMonth, now)
+		return err
+	})
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		// the totals known so far stand in until the next read is due, so a
+		// failing redis isn't waited on by every call
+		stale := spendTotals{fetchedAt: now}
+		if cached, ok := g.totals[provider]; ok {
+			stale.daily, stale.monthly = cached.daily, cached.monthly
+		}
+		g.totals[provider] = &stale
+		return spendTotals{}, err
+	}
+
+	totals := spendTotals{
+		daily:     sum(daily) + g.unwritten(provider, now.Add(-24*time.Hour)),
+		monthly:   sum(monthly) + g.unwritten(provider, now.Add(-30*24*time.Hour)),
+		fetchedAt: now,
+	}
+	g.totals[provider] = &totals
+	return totals, nil
+}
+
+func sum(bySKU map[string]int64) int64 {
+	var total int64
+	for _, micros := range bySKU {
+		total += micros
+	}
+	return total
+}
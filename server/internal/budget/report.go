@@ -0,0 +1,79 @@
+package budget
+
+import (
+	"context"
+	"sort"
+
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+type WindowSpend struct {
+	SpentUSD  float64            `json:"spent_usd"`
+	BudgetUSD float64            `json:"budget_usd"`
+	BySKU     map[string]float64 `json:"by_sku"`
+}
+
+type ProviderSpend struct {
+	Provider string        `json:"provider"`
+	Daily    WindowSpend   `json:"daily"`
+	Monthly  WindowSpend   `json:"monthly"`
+	Breaker  breaker.State `json:"breaker"`
+	// Available is false when calls to the provider are being refused
+	Available bool `json:"available"`
+}
+
+// Report returns the current spend of every governed provider, read fresh
+// from redis
+func (g *Governor) Report(ctx context.Context) ([]ProviderSpend, error) {
+	// spend still waiting to be written is reported too
+	if err := g.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	providers := make([]string, 0, len(g.budgets))
+	for provider := range g.budgets {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	now := g.now()
+	report := make([]ProviderSpend, 0, len(providers))
+	for _, provider := range providers {
+		budget := g.budgets[provider]
+
+		daily, err := g.redis.Spend(ctx, provider, redis.SpendDay, now)
+		if err != nil {
+			return nil, err
+		}
+		monthly, err := g.redis.Spend(ctx, provider, redis.SpendMonth, now)
+		if err != nil {
+			return nil, err
+		}
+
+		state := g.breakers[provider].State()
+		report = append(report, ProviderSpend{
+			Provider: provider,
+			Daily:    windowSpend(daily, budget.DailyUSD),
+			Monthly:  windowSpend(monthly, budget.MonthlyUSD),
+			Breaker:  state,
+			Available: state != breaker.Open &&
+				sum(daily) < usdToMicros(budget.DailyUSD) &&
+				sum(monthly) < usdToMicros(budget.MonthlyUSD),
+		})
+	}
+
+	return report, nil
+}
+
+func windowSpend(bySKU map[string]int64, budgetUSD float64) WindowSpend {
+	spend := WindowSpend{
+		SpentUSD:  microsToUSD(sum(bySKU)),
+		BudgetUSD: budgetUSD,
+		BySKU:     make(map[string]float64, len(bySKU)),
+	}
+	for sku, micros := range bySKU {
+		spend.BySKU[sku] = microsToUSD(micros)
+	}
+	return spend
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrMiss is returned by a Store for a key it doesn't hold
+var ErrMiss = errors.New("cache miss")
+
+// Cache holds values that can always be recomputed. It never fails, a value
+// that can't be read is a miss and one that can't be written is dropped, so
+// callers carry on with the primary path.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration)
+	Delete(ctx context.Context, keys ...string)
+}
+
+// Noop is a cache that holds nothing, for when caching is turned off
+type Noop struct{}
+
+func (Noop) Get(ctx context.Context, key string) ([]byte, bool)                   { return nil, false }
+func (Noop) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {}
+func (Noop) Delete(ctx context.Context, keys ...string)                           {}
+
+// GetJSON decodes the cached value of key into v. A value that doesn't
+// decode counts as a miss.
+func GetJSON(ctx context.Context, c Cache, key string, v interface{}) bool {
+	data, ok := c.Get(ctx, key)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("Dropping undecodable cache entry %s: %v", key, err)
+		c.Delete(ctx, key)
+		return false
+	}
+	return true
+}
+
+// SetJSON caches v encoded as JSON
+func SetJSON(ctx context.Context, c Cache, key string, v interface{}, ttl time.Duration) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode cache entry %s: %v", key, err)
+		return
+	}
+	c.Set(ctx, key, data, ttl)
+}
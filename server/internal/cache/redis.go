@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+)
+
+// Store is the redis side of the cache
+type Store interface {
+	// CacheGet returns ErrMiss for a key that isn't cached
+	CacheGet(ctx context.Context, key string) ([]byte, error)
+	CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	CacheDelete(ctx context.Context, keys ...string) error
+	Ping(ctx context.Context) error
+}
+
+// Redis is a cache in redis. Every call goes through a breaker, so while
+// redis is unreachable reads miss and writes are dropped straight away.
+type Redis struct {
+	store   Store
+	breaker *breaker.Breaker
+}
+
+func NewRedis(store Store, b *breaker.Breaker) *Redis {
+	return &Redis{store: store, breaker: b}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool) {
+	var value []byte
+	found := false
+	_ = c.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = c.store.CacheGet(ctx, key)
+		if errors.Is(err, ErrMiss) {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return value, found
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	_ = c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.store.CacheSet(ctx, key, value, ttl)
+	})
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) {
+	_ = c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.store.CacheDelete(ctx, keys...)
+	})
+}
+
+// Health pings redis, unless the breaker already knows it is down
+func (c *Redis) Health(ctx context.Context) error {
+	return c.breaker.Do(ctx, c.store.Ping)
+}
+
+// Breaker is the breaker guarding redis, other calls to redis on a request
+// path can go through it too
+func (c *Redis) Breaker() *breaker.Breaker {
+	return c.breaker
+}
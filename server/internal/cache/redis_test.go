@@ -0,0 +1,116 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/cache"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+func newTestCache(t *testing.T, cooldown time.Duration) (*cache.Redis, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return cache.NewRedis(client, breaker.New("redis", breaker.Consecutive(2, cooldown, time.Second))), mr
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestCache(t, time.Minute)
+
+	if _, ok := c.Get(ctx, "search:a"); ok {
+		t.Fatal("expected a miss before anything is cached")
+	}
+
+	c.Set(ctx, "search:a", []byte(`{"shops":[]}`), time.Minute)
+	if got, ok := c.Get(ctx, "search:a"); !ok || string(got) != `{"shops":[]}` {
+		t.Fatalf("Get() = %q, %v", got, ok)
+	}
+
+	// misses don't count against redis
+	if state := c.Breaker().State(); state != breaker.Closed {
+		t.Errorf("state = %s, want closed", state)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, ok := c.Get(ctx, "search:a"); ok {
+		t.Error("expected the entry to expire")
+	}
+
+	c.Set(ctx, "search:b", []byte("1"), time.Minute)
+	c.Delete(ctx, "search:b")
+	if _, ok := c.Get(ctx, "search:b"); ok {
+		t.Error("expected the entry to be deleted")
+	}
+}
+
+func TestRedisCacheJSON(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestCache(t, time.Minute)
+
+	type result struct {
+		Shops []string `json:"shops"`
+	}
+	cache.SetJSON(ctx, c, "search:a", result{Shops: []string{"Stereoscope"}}, time.Minute)
+
+	var got result
+	if !cache.GetJSON(ctx, c, "search:a", &got) || len(got.Shops) != 1 || got.Shops[0] != "Stereoscope" {
+		t.Fatalf("GetJSON() = %+v", got)
+	}
+
+	// entries that don't decode are dropped
+	c.Set(ctx, "search:bad", []byte("not json"), time.Minute)
+	if cache.GetJSON(ctx, c, "search:bad", &got) {
+		t.Error("expected a miss for an entry that doesn't decode")
+	}
+	if mr.Exists("cache:search:bad") {
+		t.Error("expected the undecodable entry to be deleted")
+	}
+}
+
+func TestRedisCacheDegrades(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestCache(t, 100*time.Millisecond)
+	c.Set(ctx, "search:a", []byte("1"), time.Hour)
+
+	mr.Close()
+
+	// reads miss and writes are dropped, neither fails
+	for i := 0; i < 2; i++ {
+		if _, ok := c.Get(ctx, "search:a"); ok {
+			t.Fatal("expected a miss while redis is down")
+		}
+	}
+	c.Set(ctx, "search:b", []byte("1"), time.Hour)
+
+	if state := c.Breaker().State(); state != breaker.Open {
+		t.Fatalf("state = %s, want open", state)
+	}
+	if err := c.Health(ctx); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Health() = %v, want ErrOpen", err)
+	}
+
+	// once redis is back the next trial closes the breaker
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("failed to restart redis: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if err := c.Health(ctx); err != nil {
+		t.Fatalf("Health() = %v after redis came back", err)
+	}
+	if got, ok := c.Get(ctx, "search:a"); !ok || string(got) != "1" {
+		t.Errorf("Get() = %q, %v, want the entry cached before the outage", got, ok)
+	}
+}
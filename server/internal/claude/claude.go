@@ -17,6 +17,21 @@ type ClaudeConfig struct {
 
 type Service struct {
 	client *anthropic.Client
+	usage  UsageFunc
+}
+
+// SKUs Anthropic bills by, used for cost accounting
+const (
+	SKUInputTokens  = "claude_input_tokens"
+	SKUOutputTokens = "claude_output_tokens"
+)
+
+// UsageFunc is called with the tokens each request used
+type UsageFunc func(ctx context.Context, sku string, units int)
+
+// SetUsageRecorder sets the function told about the tokens each request uses
+func (s *Service) SetUsageRecorder(record UsageFunc) {
+	s.usage = record
 }
 
 func NewClaudeConfig(apiKey string) *ClaudeConfig {
@@ -97,6 +112,11 @@ func (s* Service) AnalyzeSearchQuery(ctx context.Context, query string, userLoca
 		return nil, fmt.Errorf("failed to analyze search query: %w", err)
 	}
 
+	if s.usage != nil {
+		s.usage(ctx, SKUInputTokens, resp.Usage.InputTokens)
+		s.usage(ctx, SKUOutputTokens, resp.Usage.OutputTokens)
+	}
+
 	// extract the response text
 	responseText := resp.Content[0].Text
 
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type AuthConfig struct {
+	JWTSecret string
+	JWKSURL   string
+	Issuer    string
+	Audience  string
+}
+
+// NewAuthConfig reads how Supabase access tokens are verified. The JWKS url
+// and issuer default to the project's auth endpoints.
+func NewAuthConfig(supabaseURL string) (*AuthConfig, error) {
+	if supabaseURL == "" {
+		return nil, fmt.Errorf("supabase url is required")
+	}
+
+	// Ensure URL is properly formatted
+	if !strings.HasPrefix(supabaseURL, "https://") && !strings.HasPrefix(supabaseURL, "http://") {
+		supabaseURL = fmt.Sprintf("https://%s", supabaseURL)
+	}
+	authURL := strings.TrimSuffix(supabaseURL, "/") + "/auth/v1"
+
+	cfg := &AuthConfig{
+		JWTSecret: os.Getenv("SUPABASE_JWT_SECRET"),
+		JWKSURL:   os.Getenv("SUPABASE_JWKS_URL"),
+		Issuer:    os.Getenv("SUPABASE_JWT_ISSUER"),
+		Audience:  os.Getenv("SUPABASE_JWT_AUDIENCE"),
+	}
+
+	if cfg.JWKSURL == "" {
+		cfg.JWKSURL = authURL + "/.well-known/jwks.json"
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = authURL
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = "authenticated"
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+// BudgetConfig is how much each paid provider may spend, in US dollars, over
+// a rolling day and a rolling 30 days
+type BudgetConfig struct {
+	PlacesDailyUSD   float64
+	PlacesMonthlyUSD float64
+	ClaudeDailyUSD   float64
+	ClaudeMonthlyUSD float64
+}
+
+func NewBudgetConfig() (*BudgetConfig, error) {
+	cfg := &BudgetConfig{}
+
+	var err error
+	if cfg.PlacesDailyUSD, err = envFloat("BUDGET_PLACES_DAILY_USD", 20); err != nil {
+		return nil, err
+	}
+	if cfg.PlacesMonthlyUSD, err = envFloat("BUDGET_PLACES_MONTHLY_USD", 300); err != nil {
+		return nil, err
+	}
+	if cfg.ClaudeDailyUSD, err = envFloat("BUDGET_CLAUDE_DAILY_USD", 5); err != nil {
+		return nil, err
+	}
+	if cfg.ClaudeMonthlyUSD, err = envFloat("BUDGET_CLAUDE_MONTHLY_USD", 100); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import "time"
+
+// CacheConfig controls the redis cache and the breaker that stops calls to
+// redis while it is unreachable
+type CacheConfig struct {
+	Enabled bool
+	// Timeout bounds each call to redis on a request path
+	Timeout time.Duration
+	// BreakerFailures in a row open the breaker, it lets a call through
+	// again after BreakerCooldown
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// SearchTTL is how long search results are cached
+	SearchTTL time.Duration
+	// AutocompleteTTL is how long search box suggestions are cached, long
+	// enough to answer the same prefix typed twice
+	AutocompleteTTL time.Duration
+}
+
+func NewCacheConfig() (*CacheConfig, error) {
+	cfg := &CacheConfig{}
+
+	var err error
+	if cfg.Enabled, err = envBool("CACHE_ENABLED", true); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout, err = envDuration("CACHE_TIMEOUT", 150*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.BreakerFailures, err = envInt("CACHE_BREAKER_FAILURES", 5); err != nil {
+		return nil, err
+	}
+	if cfg.BreakerCooldown, err = envDuration("CACHE_BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.SearchTTL, err = envDuration("SEARCH_CACHE_TTL", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.AutocompleteTTL, err = envDuration("AUTOCOMPLETE_CACHE_TTL", 2*time.Minute); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
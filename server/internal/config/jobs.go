@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// JobConfig controls the background job worker
+type JobConfig struct {
+	Concurrency int
+	MaxAttempts int
+	// VisibilityTimeout is how long a job can go unacked before another
+	// worker takes it over
+	VisibilityTimeout time.Duration
+	// ShutdownTimeout bounds how long shutdown waits for requests and jobs
+	// in flight
+	ShutdownTimeout time.Duration
+}
+
+func NewJobConfig() (*JobConfig, error) {
+	cfg := &JobConfig{}
+
+	var err error
+	if cfg.Concurrency, err = envInt("JOB_WORKER_CONCURRENCY", 4); err != nil {
+		return nil, err
+	}
+	if cfg.MaxAttempts, err = envInt("JOB_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.VisibilityTimeout, err = envDuration("JOB_VISIBILITY_TIMEOUT", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
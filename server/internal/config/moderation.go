@@ -0,0 +1,16 @@
+package config
+
+import "os"
+
+// ModerationConfig controls what user text is rejected
+type ModerationConfig struct {
+	// ProfanityWords are blocked in display names and bios on top of the
+	// built in list
+	ProfanityWords []string
+}
+
+func NewModerationConfig() (*ModerationConfig, error) {
+	return &ModerationConfig{
+		ProfanityWords: splitList(os.Getenv("PROFANITY_WORDS")),
+	}, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type RateLimitConfig struct {
+	TrustedProxies []*net.IPNet
+	// Claude is charged on every search, Places only when the db can't answer
+	ClaudePerMinute float64
+	ClaudeBurst     int
+	PlacesPerMinute float64
+	PlacesBurst     int
+	// Autocomplete is charged on every keystroke sent, its Places lookups
+	// aren't charged to Places so typing doesn't use up searches
+	AutocompletePerMinute float64
+	AutocompleteBurst     int
+}
+
+// NewRateLimitConfig reads the search rate limits. TRUSTED_PROXIES is a comma
+// separated list of CIDRs or IPs whose X-Forwarded-For headers are believed.
+func NewRateLimitConfig() (*RateLimitConfig, error) {
+	trusted, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	cfg := &RateLimitConfig{TrustedProxies: trusted}
+
+	if cfg.ClaudePerMinute, err = envFloat("RATE_LIMIT_CLAUDE_PER_MINUTE", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ClaudeBurst, err = envInt("RATE_LIMIT_CLAUDE_BURST", 5); err != nil {
+		return nil, err
+	}
+	if cfg.PlacesPerMinute, err = envFloat("RATE_LIMIT_PLACES_PER_MINUTE", 5); err != nil {
+		return nil, err
+	}
+	if cfg.PlacesBurst, err = envInt("RATE_LIMIT_PLACES_BURST", 3); err != nil {
+		return nil, err
+	}
+	if cfg.AutocompletePerMinute, err = envFloat("RATE_LIMIT_AUTOCOMPLETE_PER_MINUTE", 60); err != nil {
+		return nil, err
+	}
+	if cfg.AutocompleteBurst, err = envInt("RATE_LIMIT_AUTOCOMPLETE_BURST", 20); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// a bare IP trusts just that address
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func envFloat(name string, fallback float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", name, v)
+	}
+	return f, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", name, v)
+	}
+	return i, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig picks the redis deployment to connect to. With a sentinel
+// master name Addrs are the sentinels. With Cluster, or more than one
+// address, Addrs seed a cluster. Otherwise Addrs is a single server.
+//
+// In cluster mode the job queue's and tag counts' keys are hash tagged into
+// one slot each, so their scripts and transactions work.
+type RedisConfig struct {
+	Addrs      []string
+	Username   string
+	Password   string
+	DB         int
+	MasterName string
+	Cluster    bool
+
+	// PoolSize caps connections per node, MinIdleConns are kept open and
+	// PoolTimeout is how long a command waits for a free connection
+	PoolSize     int
+	MinIdleConns int
+	PoolTimeout  time.Duration
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// TLS connects over TLS, verifying the server as TLSServerName if set
+	TLS           bool
+	TLSServerName string
+}
+
+func NewRedisConfig() (*RedisConfig, error) {
+	cfg := &RedisConfig{
+		Addrs:         splitList(os.Getenv("REDIS_ADDR")),
+		Username:      os.Getenv("REDIS_USERNAME"),
+		Password:      os.Getenv("REDIS_PASSWORD"),
+		MasterName:    os.Getenv("REDIS_SENTINEL_MASTER"),
+		TLSServerName: os.Getenv("REDIS_TLS_SERVER_NAME"),
+	}
+	if len(cfg.Addrs) == 0 {
+		cfg.Addrs = []string{"localhost:6379"}
+	}
+
+	var err error
+	if v := os.Getenv("REDIS_DB"); v != "" {
+		if cfg.DB, err = strconv.Atoi(v); err != nil || cfg.DB < 0 {
+			return nil, fmt.Errorf("REDIS_DB must be a database number, got %q", v)
+		}
+	}
+	if cfg.Cluster, err = envBool("REDIS_CLUSTER", false); err != nil {
+		return nil, err
+	}
+	if cfg.TLS, err = envBool("REDIS_TLS", false); err != nil {
+		return nil, err
+	}
+	if cfg.PoolSize, err = envInt("REDIS_POOL_SIZE", 20); err != nil {
+		return nil, err
+	}
+	if cfg.MinIdleConns, err = envInt("REDIS_MIN_IDLE_CONNS", 2); err != nil {
+		return nil, err
+	}
+	if cfg.PoolTimeout, err = envDuration("REDIS_POOL_TIMEOUT", 4*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.DialTimeout, err = envDuration("REDIS_DIAL_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ReadTimeout, err = envDuration("REDIS_READ_TIMEOUT", 3*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WriteTimeout, err = envDuration("REDIS_WRITE_TIMEOUT", 3*time.Second); err != nil {
+		return nil, err
+	}
+
+	if cfg.MasterName != "" && cfg.Cluster {
+		return nil, fmt.Errorf("REDIS_SENTINEL_MASTER and REDIS_CLUSTER can't both be set")
+	}
+	if cfg.DB != 0 && (cfg.Cluster || (cfg.MasterName == "" && len(cfg.Addrs) > 1)) {
+		return nil, fmt.Errorf("REDIS_DB must be 0 in cluster mode")
+	}
+
+	return cfg, nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", name, v)
+	}
+	return b, nil
+}
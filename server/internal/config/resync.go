@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ResyncConfig controls the scheduled refresh of stale shops
+type ResyncConfig struct {
+	Enabled    bool
+	Interval   time.Duration
+	StaleAfter time.Duration
+	BatchSize  int
+	PerMinute  float64
+}
+
+func NewResyncConfig() (*ResyncConfig, error) {
+	cfg := &ResyncConfig{Enabled: os.Getenv("SHOP_RESYNC_ENABLED") != "false"}
+
+	var err error
+	if cfg.Interval, err = envDuration("SHOP_RESYNC_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.StaleAfter, err = envDuration("SHOP_RESYNC_STALE_AFTER", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize, err = envInt("SHOP_RESYNC_BATCH_SIZE", 50); err != nil {
+		return nil, err
+	}
+	if cfg.PerMinute, err = envFloat("SHOP_RESYNC_PER_MINUTE", 30); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 1h, got %q", name, v)
+	}
+	return d, nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SearchConfig tunes how searches are answered
+type SearchConfig struct {
+	// MatchConfidence is the name match score, from 0 to 1, at which a
+	// search for a specific shop is answered from the db without Places.
+	// Left unset it is 0 and search's own default applies.
+	MatchConfidence float64
+	// CoverageTTL is how long after Places was searched in an area searches
+	// there are answered from the db
+	CoverageTTL time.Duration
+	// Rank weights are how much each signal counts when ordering results,
+	// 0 ignores a signal
+	RankDistance         float64
+	RankRating           float64
+	RankCoffeehausRating float64
+	RankOpenNow          float64
+	RankFilters          float64
+	RankPersonal         float64
+}
+
+func NewSearchConfig() (*SearchConfig, error) {
+	cfg := &SearchConfig{}
+
+	var err error
+	if cfg.MatchConfidence, err = envFloat("SEARCH_MATCH_CONFIDENCE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MatchConfidence > 1 {
+		return nil, fmt.Errorf("SEARCH_MATCH_CONFIDENCE must be at most 1, got %g", cfg.MatchConfidence)
+	}
+	if cfg.CoverageTTL, err = envDuration("SEARCH_COVERAGE_TTL", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+
+	weights := []struct {
+		name   string
+		weight *float64
+		value  float64
+	}{
+		{"SEARCH_RANK_DISTANCE", &cfg.RankDistance, 3},
+		{"SEARCH_RANK_RATING", &cfg.RankRating, 2},
+		{"SEARCH_RANK_COFFEEHAUS_RATING", &cfg.RankCoffeehausRating, 1.5},
+		{"SEARCH_RANK_OPEN_NOW", &cfg.RankOpenNow, 1},
+		{"SEARCH_RANK_FILTERS", &cfg.RankFilters, 1.5},
+		{"SEARCH_RANK_PERSONAL", &cfg.RankPersonal, 1},
+	}
+	for _, w := range weights {
+		if *w.weight, err = envWeight(w.name, w.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// envWeight is like envFloat but allows 0
+func envWeight(name string, fallback float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be a number of at least 0, got %q", name, v)
+	}
+	return f, nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+type StorageConfig struct {
+	Backend   string // "local" or "supabase"
+	LocalDir  string
+	PublicURL string
+	Bucket    string
+}
+
+func NewStorageConfig() (*StorageConfig, error) {
+	cfg := &StorageConfig{
+		Backend:   os.Getenv("STORAGE_BACKEND"),
+		LocalDir:  os.Getenv("STORAGE_LOCAL_DIR"),
+		PublicURL: os.Getenv("STORAGE_PUBLIC_URL"),
+		Bucket:    os.Getenv("STORAGE_BUCKET"),
+	}
+
+	if cfg.Backend == "" {
+		cfg.Backend = "local"
+	}
+
+	switch cfg.Backend {
+	case "local":
+		if cfg.LocalDir == "" {
+			cfg.LocalDir = "./uploads"
+		}
+		if cfg.PublicURL == "" {
+			cfg.PublicURL = "http://localhost:8080/uploads"
+		}
+	case "supabase":
+		if cfg.Bucket == "" {
+			cfg.Bucket = "photos"
+		}
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND must be local or supabase, got %q", cfg.Backend)
+	}
+
+	return cfg, nil
+}
@@ -1,5 +0,0 @@
-package constants
-
-type ContextKey string
-
-const UserKey ContextKey = "user"
\ No newline at end of file
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// AuditEntry records a change made through the admin API
+type AuditEntry struct {
+	ActorID    string                 `json:"actor_id"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Details    map[string]interface{} `json:"details"`
+}
+
+// RecordAudit appends an entry to the admin audit log
+func (c *Client) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	_ = ctx
+	if entry.Details == nil {
+		entry.Details = map[string]interface{}{}
+	}
+
+	_, _, err := c.From("admin_audit_log").Insert(entry, false, "", "minimal", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Coverage is when Places was last searched in a geohash cell and how many
+// shops it found there
+type Coverage struct {
+	Cell string `json:"cell"`
+	// Query is empty for nearby searches and the shop name otherwise
+	Query     string    `json:"query"`
+	SweptAt   time.Time `json:"swept_at"`
+	ShopCount int       `json:"shop_count"`
+}
+
+// FindCoverage returns the coverage of the cells for query, keyed by cell.
+// Cells never searched are left out.
+func (c *Client) FindCoverage(ctx context.Context, query string, cells []string) (map[string]Coverage, error) {
+	_ = ctx
+	coverage := make(map[string]Coverage)
+	if len(cells) == 0 {
+		return coverage, nil
+	}
+
+	builder := c.From("search_coverage").Select("cell, query, swept_at, shop_count", "", false)
+	resp, _, err := In(builder, "cell", cells).
+		Eq("query", query).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find search coverage: %w", err)
+	}
+
+	var rows []Coverage
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse search coverage: %w", err)
+	}
+
+	for _, row := range rows {
+		coverage[row.Cell] = row
+	}
+	return coverage, nil
+}
+
+// RecordCoverage saves the coverage of cells, replacing what was recorded
+// for them before
+func (c *Client) RecordCoverage(ctx context.Context, coverage []Coverage) error {
+	_ = ctx
+	if len(coverage) == 0 {
+		return nil
+	}
+
+	_, _, err := c.From("search_coverage").Upsert(coverage, "cell,query", "minimal", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to record search coverage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package databasetest serves a fake PostgREST API, for testing code that
+// talks to the db through a database.Client
+package databasetest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	// Path is the table or function, like "users" or "rpc/stale_shops"
+	Path  string
+	Query url.Values
+	Body  []byte
+}
+
+// Server answers each request with the handler of its route, a method and
+// path like "GET users" or "POST rpc/stale_shops". Requests without one get
+// an empty list.
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []Request
+}
+
+// NewServer starts a server that is closed when the test ends
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+	s := &Server{handlers: make(map[string]http.HandlerFunc)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Client returns a database client of the server
+func (s *Server) Client() *database.Client {
+	return &database.Client{Client: postgrest.NewClient(s.server.URL, "public", nil)}
+}
+
+// Handle sets the handler of route
+func (s *Server) Handle(route string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[route] = handler
+}
+
+// Respond answers route with body, a JSON document
+func (s *Server) Respond(route string, body string) {
+	s.Handle(route, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+}
+
+// Requests returns the requests received for route
+func (s *Server) Requests(route string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []Request
+	for _, r := range s.requests {
+		if r.Method+" "+r.Path == route {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	request := Request{
+		Method: r.Method,
+		Path:   strings.TrimPrefix(r.URL.Path, "/"),
+		Query:  r.URL.Query(),
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	handler, ok := s.handlers[request.Method+" "+request.Path]
+	s.mu.Unlock()
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "[]")
+		return
+	}
+	handler(w, r)
+}
+
+// Count answers a count query, like one made with Select("*", "exact", true),
+// with count rows
+func Count(count int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", fmt.Sprintf("*/%d", count))
+	}
+}
@@ -0,0 +1,15 @@
+package database
+
+import "strings"
+
+// IsUniqueViolation reports whether err is a PostgREST error caused by a
+// unique constraint (Postgres error code 23505)
+func IsUniqueViolation(err error) bool {
+	return HasCode(err, "23505")
+}
+
+// HasCode reports whether err is a PostgREST error with the Postgres error
+// code, including codes raised by our own functions
+func HasCode(err error, code string) bool {
+	return err != nil && strings.Contains(err.Error(), "("+code+")")
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// PostgREST parses filter values, so values taken from users or Places need
+// escaping before they go into a filter. Commas and parentheses end values in
+// lists, and %, _ and * are wildcards in LIKE patterns.
+
+// Quote returns v as a double quoted PostgREST value, so reserved characters
+// such as , . : ( ) are taken literally
+func Quote(v string) string {
+	var b strings.Builder
+	b.Grow(len(v) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if v[i] == '"' || v[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// List returns values as a PostgREST list for the in operator, e.g. ("a","b")
+func List(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = Quote(v)
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
+
+// In filters column to any of values. Unlike postgrest-go's In, values with
+// quotes or backslashes are escaped.
+func In(query *postgrest.FilterBuilder, column string, values []string) *postgrest.FilterBuilder {
+	return query.Filter(column, "in", List(values))
+}
+
+// EscapeLike escapes v so a LIKE pattern matches it literally. PostgREST
+// turns * into % and has no escape for it, so a * in v matches any single
+// character instead.
+func EscapeLike(v string) string {
+	var b strings.Builder
+	b.Grow(len(v))
+	// the special characters are all ascii, so bytes of multi-byte runes
+	// pass through untouched
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\', '%', '_':
+			b.WriteByte('\\')
+			b.WriteByte(v[i])
+		case '*':
+			b.WriteByte('_')
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// Contains returns a LIKE pattern matching values that contain v
+func Contains(v string) string {
+	return "%" + EscapeLike(v) + "%"
+}
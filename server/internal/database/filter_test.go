@@ -0,0 +1,205 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hostileNames are shop names that break or widen unescaped filters
+var hostileNames = []string{
+	"",
+	"Blue Bottle Coffee",
+	"Coffee, Tea & Me",
+	"Cafe (Downtown)",
+	`Joe's "Famous" Coffee`,
+	`Back\slash Beans`,
+	"100% Kona",
+	"Bean_Counter",
+	"Cafe*Star",
+	"Brew.Bar",
+	"Roast:Lab",
+	"a,b),eq.x,(c",
+	"%",
+	"_",
+	`\`,
+	`"`,
+	"Café Ñandú ☕",
+}
+
+// parseList reads a PostgREST in list the way PostgREST does: items are
+// separated by commas and double quoted items may escape characters with a
+// backslash
+func parseList(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, errors.New("list is not parenthesized")
+	}
+	body := s[1 : len(s)-1]
+	if body == "" {
+		return []string{}, nil
+	}
+
+	var items []string
+	for i := 0; ; {
+		var item strings.Builder
+		if i < len(body) && body[i] == '"' {
+			i++
+			for {
+				if i >= len(body) {
+					return nil, errors.New("unterminated quote")
+				}
+				if body[i] == '\\' && i+1 < len(body) {
+					item.WriteByte(body[i+1])
+					i += 2
+					continue
+				}
+				if body[i] == '"' {
+					i++
+					break
+				}
+				item.WriteByte(body[i])
+				i++
+			}
+		} else {
+			for i < len(body) && body[i] != ',' {
+				if body[i] == '(' || body[i] == ')' || body[i] == '"' {
+					return nil, errors.New("reserved character in unquoted item")
+				}
+				item.WriteByte(body[i])
+				i++
+			}
+		}
+		items = append(items, item.String())
+
+		if i == len(body) {
+			return items, nil
+		}
+		if body[i] != ',' {
+			return nil, errors.New("junk after quoted item")
+		}
+		i++
+	}
+}
+
+// likeMatch matches s against pattern as PostgREST and Postgres would: *
+// becomes %, then % and _ are wildcards unless escaped with a backslash
+func likeMatch(pattern, s string) bool {
+	pattern = strings.ReplaceAll(pattern, "*", "%")
+
+	// tokens of the pattern, wildcards are -1 (%) and -2 (_)
+	var tokens []int
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			tokens = append(tokens, int(pattern[i]))
+		case pattern[i] == '%':
+			tokens = append(tokens, -1)
+		case pattern[i] == '_':
+			tokens = append(tokens, -2)
+		default:
+			tokens = append(tokens, int(pattern[i]))
+		}
+	}
+
+	// match[i][j]: tokens[i:] match s[j:]
+	match := make([][]bool, len(tokens)+1)
+	for i := range match {
+		match[i] = make([]bool, len(s)+1)
+	}
+	match[len(tokens)][len(s)] = true
+	for i := len(tokens) - 1; i >= 0; i-- {
+		for j := len(s); j >= 0; j-- {
+			switch tokens[i] {
+			case -1:
+				match[i][j] = match[i+1][j] || (j < len(s) && match[i][j+1])
+			case -2:
+				match[i][j] = j < len(s) && match[i+1][j+1]
+			default:
+				match[i][j] = j < len(s) && int(s[j]) == tokens[i] && match[i+1][j+1]
+			}
+		}
+	}
+	return match[0][0]
+}
+
+func TestList_HostileNames(t *testing.T) {
+	got, err := parseList(List(hostileNames))
+	if err != nil {
+		t.Fatalf("List() = %s does not parse: %v", List(hostileNames), err)
+	}
+	if !reflect.DeepEqual(got, hostileNames) {
+		t.Errorf("parsed %q, want %q", got, hostileNames)
+	}
+}
+
+func TestContains_HostileNames(t *testing.T) {
+	for _, name := range hostileNames {
+		t.Run(name, func(t *testing.T) {
+			pattern := Contains(name)
+			if !likeMatch(pattern, "The "+name+" Shop") {
+				t.Errorf("Contains(%q) = %q doesn't match a name containing it", name, pattern)
+			}
+			if name != "" && !strings.Contains(name, "*") && likeMatch(pattern, "Some Other Cafe") {
+				t.Errorf("Contains(%q) = %q matches an unrelated name", name, pattern)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Blue Bottle", want: "Blue Bottle"},
+		{in: "100% Kona", want: `100\% Kona`},
+		{in: "Bean_Counter", want: `Bean\_Counter`},
+		{in: `a\b`, want: `a\\b`},
+		{in: "Cafe*Star", want: "Cafe_Star"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeLike(tt.in); got != tt.want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func FuzzList(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name, "ChIJN1t_tDeuEmsRUsoyG83frY4")
+	}
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		values := []string{a, b}
+		got, err := parseList(List(values))
+		if err != nil {
+			t.Fatalf("List(%q) = %s does not parse: %v", values, List(values), err)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("List(%q) parsed as %q", values, got)
+		}
+	})
+}
+
+func FuzzContains(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name, "Some Other Cafe")
+	}
+
+	f.Fuzz(func(t *testing.T, name, other string) {
+		pattern := Contains(name)
+		if !likeMatch(pattern, "x"+name+"y") {
+			t.Fatalf("Contains(%q) = %q doesn't match a value containing it", name, pattern)
+		}
+
+		// without a * the pattern matches exactly the values containing name
+		if !strings.Contains(name, "*") {
+			if got, want := likeMatch(pattern, other), strings.Contains(other, name); got != want {
+				t.Errorf("Contains(%q) = %q matching %q = %v, want %v", name, pattern, other, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// CallFunction invokes a Postgres function through PostgREST's /rpc endpoint.
+// postgrest-go's Rpc stores failures in the shared ClientError, which would
+// poison every later query, so the call is made as a POST on the rpc path.
+func (c *Client) CallFunction(ctx context.Context, name string, params interface{}) ([]byte, error) {
+	_ = ctx
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	res, _, err := c.From("rpc/"+name).Insert(params, false, "", "", "").Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", name, err)
+	}
+
+	return res, nil
+}
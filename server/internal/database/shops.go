@@ -9,23 +9,19 @@ import (
 	"github.com/supabase-community/postgrest-go"
 )
 
-// FindShopsByName searches for coffee shops by name in the database
+// FindShopsByName searches for coffee shops by name in the database. Names
+// are matched loosely, see SearchShopsByName.
 func (c *Client) FindShopsByName(ctx context.Context, name string) ([]*maps.CoffeeShopDetails, error) {
-	resp, _, err := c.From("shops").
-		Select("*", "", false).
-		Like("name", "%"+name+"%").
-		Execute()
-	
+	matches, err := c.SearchShopsByName(ctx, NameSearch{Query: name})
 	if err != nil {
-		return nil, fmt.Errorf("failed to find shops by name: %w", err)
+		return nil, err
 	}
 
-	var shop []*maps.CoffeeShopDetails
-	if err := json.Unmarshal(resp, &shop); err != nil {
-		return nil, fmt.Errorf("failed to parse shops: %w", err)
+	shops := make([]*maps.CoffeeShopDetails, len(matches))
+	for i, match := range matches {
+		shops[i] = match.Shop
 	}
-
-	return shop, nil
+	return shops, nil
 }
 
 // FindShopsByLocation searches for coffee shops within a radius of a point
@@ -36,6 +32,7 @@ func (c *Client) FindShopsByLocation(ctx context.Context, lat, lng float64, radi
 	resp, _, err := c.From("shops").
 		Select("*, ST_Distance(location::geometry, ST_SetSRID(ST_MakePoint(" + fmt.Sprintf("%f, %f", lng, lat) + "), 4326)::geometry) as distance", "", false).
 		Filter(query, "eq", "true").
+		Eq("hidden", "false").
 		Order("distance", &postgrest.OrderOpts{Ascending: true}).
 		Execute()
 	
@@ -63,4 +60,131 @@ func (c *Client) FindShopByPlaceID(ctx context.Context, placeID string) (*maps.C
 	}
 
 	return shop, nil
-}
\ No newline at end of file
+}
+
+// HiddenPlaceIDs returns which of the given place IDs belong to shops an admin
+// has hidden, so results straight from Places can leave them out too
+func (c *Client) HiddenPlaceIDs(ctx context.Context, placeIDs []string) (map[string]bool, error) {
+	_ = ctx
+	hidden := make(map[string]bool)
+	if len(placeIDs) == 0 {
+		return hidden, nil
+	}
+
+	query := c.From("shops").Select("google_place_id", "", false)
+	resp, _, err := In(query, "google_place_id", placeIDs).
+		Eq("hidden", "true").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find hidden shops: %w", err)
+	}
+
+	var rows []struct {
+		PlaceID string `json:"google_place_id"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse hidden shops: %w", err)
+	}
+
+	for _, row := range rows {
+		hidden[row.PlaceID] = true
+	}
+	return hidden, nil
+}
+
+// CoffeehausRatings returns the Coffeehaus ratings of the shops with the
+// given place IDs. Shops that aren't rated are left out.
+func (c *Client) CoffeehausRatings(ctx context.Context, placeIDs []string) (map[string]float64, error) {
+	_ = ctx
+	ratings := make(map[string]float64)
+	if len(placeIDs) == 0 {
+		return ratings, nil
+	}
+
+	query := c.From("shops").Select("google_place_id, coffeehaus_rating", "", false)
+	resp, _, err := In(query, "google_place_id", placeIDs).
+		Not("coffeehaus_rating", "is", "null").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find coffeehaus ratings: %w", err)
+	}
+
+	var rows []struct {
+		PlaceID string  `json:"google_place_id"`
+		Rating  float64 `json:"coffeehaus_rating"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse coffeehaus ratings: %w", err)
+	}
+
+	for _, row := range rows {
+		ratings[row.PlaceID] = row.Rating
+	}
+	return ratings, nil
+}
+
+// NameSearch is a typo tolerant search for shops by name
+type NameSearch struct {
+	Query string
+	// Lat and Lng bias results towards nearby shops when set
+	Lat, Lng float64
+	Limit    int
+	// MinSimilarity drops matches scoring lower, from 0 to 1
+	MinSimilarity float64
+}
+
+// ShopMatch is a shop found by name and how well it matched
+type ShopMatch struct {
+	Shop *maps.CoffeeShopDetails
+	// Similarity is how closely the name matched, from 0 to 1
+	Similarity float64
+	// DistanceMeters is nil when the search had no location
+	DistanceMeters *float64
+	// Score is the similarity less a penalty for distance
+	Score float64
+}
+
+// SearchShopsByName finds visible shops whose name is similar to the query,
+// ignoring case and accents, best match first
+func (c *Client) SearchShopsByName(ctx context.Context, search NameSearch) ([]ShopMatch, error) {
+	params := map[string]interface{}{
+		"query":       search.Query,
+		"max_results": search.Limit,
+	}
+	if search.Limit <= 0 {
+		params["max_results"] = 10
+	}
+	if search.MinSimilarity > 0 {
+		params["min_similarity"] = search.MinSimilarity
+	}
+	if search.Lat != 0 && search.Lng != 0 {
+		params["lat"] = search.Lat
+		params["lng"] = search.Lng
+	}
+
+	resp, err := c.CallFunction(ctx, "search_shops_by_name", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search shops by name: %w", err)
+	}
+
+	var rows []struct {
+		Shop           *maps.CoffeeShopDetails `json:"shop"`
+		Similarity     float64                 `json:"similarity"`
+		DistanceMeters *float64                `json:"distance_meters"`
+		Score          float64                 `json:"score"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse shop matches: %w", err)
+	}
+
+	matches := make([]ShopMatch, len(rows))
+	for i, row := range rows {
+		matches[i] = ShopMatch{
+			Shop:           row.Shop,
+			Similarity:     row.Similarity,
+			DistanceMeters: row.DistanceMeters,
+			Score:          row.Score,
+		}
+	}
+	return matches, nil
+}
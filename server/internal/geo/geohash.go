@@ -0,0 +1,183 @@
+// Package geo buckets locations into geohash cells, so areas can be
+// bookkept by a short string key
+package geo
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// MaxPrecision is the longest geohash handled, cells under 5cm across
+	MaxPrecision = 12
+
+	metersPerDegree = 111320
+)
+
+// Box is the area a geohash cell covers, in degrees
+type Box struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// Encode returns the geohash of a point with precision characters
+func Encode(lat, lng float64, precision int) string {
+	precision = clampPrecision(precision)
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+
+	var hash strings.Builder
+	hash.Grow(precision)
+	even := true
+	bit, ch := 0, 0
+	for hash.Len() < precision {
+		// bits alternate between longitude and latitude, longitude first
+		if even {
+			mid := (minLng + maxLng) / 2
+			if lng >= mid {
+				ch = ch<<1 | 1
+				minLng = mid
+			} else {
+				ch <<= 1
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch <<= 1
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			hash.WriteByte(base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// Bounds returns the area a geohash covers. ok is false for a hash with
+// characters outside the geohash alphabet.
+func Bounds(hash string) (box Box, ok bool) {
+	box = Box{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(base32, hash[i])
+		if ch < 0 {
+			return Box{}, false
+		}
+		for mask := 16; mask > 0; mask >>= 1 {
+			if even {
+				mid := (box.MinLng + box.MaxLng) / 2
+				if ch&mask != 0 {
+					box.MinLng = mid
+				} else {
+					box.MaxLng = mid
+				}
+			} else {
+				mid := (box.MinLat + box.MaxLat) / 2
+				if ch&mask != 0 {
+					box.MinLat = mid
+				} else {
+					box.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return box, true
+}
+
+// Center is the middle of a geohash cell
+func (b Box) Center() (lat, lng float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLng + b.MaxLng) / 2
+}
+
+// CellsIntersecting returns the geohash cells with precision characters that
+// overlap a circle of radiusMeters around a point
+func CellsIntersecting(lat, lng, radiusMeters float64, precision int) []string {
+	precision = clampPrecision(precision)
+	bits := 5 * precision
+	latStep := 180 / math.Pow(2, float64(bits/2))
+	lngStep := 360 / math.Pow(2, float64((bits+1)/2))
+
+	dLat := radiusMeters / metersPerDegree
+	dLng := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0 {
+		dLng = math.Min(180, dLat/cos)
+	}
+
+	minRow := int(math.Floor((math.Max(-90, lat-dLat) + 90) / latStep))
+	maxRow := int(math.Floor((math.Min(90, lat+dLat) + 90) / latStep))
+	maxRow = min(maxRow, int(180/latStep)-1)
+	minCol := int(math.Floor((lng - dLng + 180) / lngStep))
+	maxCol := int(math.Floor((lng + dLng + 180) / lngStep))
+
+	var cells []string
+	seen := make(map[string]bool)
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			box := Box{
+				MinLat: -90 + float64(row)*latStep,
+				MaxLat: -90 + float64(row+1)*latStep,
+				MinLng: -180 + float64(col)*lngStep,
+				MaxLng: -180 + float64(col+1)*lngStep,
+			}
+			if distanceToBox(lat, lng, box) > radiusMeters {
+				continue
+			}
+
+			// columns past the antimeridian wrap around to the other side
+			centerLat, centerLng := box.Center()
+			centerLng = math.Mod(centerLng+540, 360) - 180
+			if hash := Encode(centerLat, centerLng, precision); !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+			}
+		}
+	}
+	return cells
+}
+
+// CellWithin reports whether all of a geohash cell lies inside a circle of
+// radiusMeters around a point
+func CellWithin(hash string, lat, lng, radiusMeters float64) bool {
+	box, ok := Bounds(hash)
+	if !ok {
+		return false
+	}
+	return distanceToFarCorner(lat, lng, box) <= radiusMeters
+}
+
+// distanceToFarCorner is roughly how far a point is from the furthest corner
+// of a box, treating degrees as flat like distanceToBox
+func distanceToFarCorner(lat, lng float64, box Box) float64 {
+	dLat := math.Max(math.Abs(lat-box.MinLat), math.Abs(lat-box.MaxLat))
+	dLng := math.Max(math.Abs(lng-box.MinLng), math.Abs(lng-box.MaxLng))
+	return math.Hypot(dLat*metersPerDegree, dLng*metersPerDegree*math.Cos(lat*math.Pi/180))
+}
+
+// distanceToBox is roughly how far a point is from the nearest edge of a
+// box, 0 inside it. Degrees are treated as flat, which is close enough at
+// city scale.
+func distanceToBox(lat, lng float64, box Box) float64 {
+	dLat := math.Max(0, math.Max(box.MinLat-lat, lat-box.MaxLat))
+	dLng := math.Max(0, math.Max(box.MinLng-lng, lng-box.MaxLng))
+	return math.Hypot(dLat*metersPerDegree, dLng*metersPerDegree*math.Cos(lat*math.Pi/180))
+}
+
+func clampPrecision(precision int) int {
+	if precision < 1 {
+		return 1
+	}
+	if precision > MaxPrecision {
+		return MaxPrecision
+	}
+	return precision
+}
@@ -0,0 +1,138 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{name: "jutland", lat: 57.64911, lng: 10.40744, precision: 11, want: "u4pruydqqvj"},
+		{name: "newport beach", lat: 33.6186, lng: -117.9294, precision: 6, want: "9mupk2"},
+		{name: "origin", lat: 0, lng: 0, precision: 5, want: "s0000"},
+		{name: "precision is clamped", lat: 57.64911, lng: 10.40744, precision: 0, want: "u"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Encode(tt.lat, tt.lng, tt.precision); got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBounds(t *testing.T) {
+	lat, lng := 33.6186, -117.9294
+	box, ok := Bounds(Encode(lat, lng, 7))
+	if !ok {
+		t.Fatal("Bounds() not ok for a valid hash")
+	}
+	if lat < box.MinLat || lat > box.MaxLat || lng < box.MinLng || lng > box.MaxLng {
+		t.Errorf("Bounds() = %+v, doesn't hold the point it was encoded from", box)
+	}
+
+	if _, ok := Bounds("9mua"); ok {
+		t.Error("Bounds() ok for a hash with an 'a'")
+	}
+}
+
+func TestCellsIntersecting(t *testing.T) {
+	lat, lng := 33.6186, -117.9294
+	home := Encode(lat, lng, 5)
+
+	tests := []struct {
+		name     string
+		radius   float64
+		minCells int
+		maxCells int
+	}{
+		// the cell is about 4.9km by 4.1km here
+		{name: "small radius stays near the point", radius: 100, minCells: 1, maxCells: 2},
+		{name: "radius a few cells wide", radius: 10000, minCells: 16, maxCells: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells := CellsIntersecting(lat, lng, tt.radius, 5)
+			if len(cells) < tt.minCells || len(cells) > tt.maxCells {
+				t.Fatalf("got %d cells, want %d to %d: %v", len(cells), tt.minCells, tt.maxCells, cells)
+			}
+
+			found := false
+			seen := make(map[string]bool)
+			for _, cell := range cells {
+				if len(cell) != 5 {
+					t.Errorf("cell %q doesn't have precision 5", cell)
+				}
+				if seen[cell] {
+					t.Errorf("cell %q returned twice", cell)
+				}
+				seen[cell] = true
+				found = found || cell == home
+			}
+			if !found {
+				t.Errorf("cells %v don't include %q around the point", cells, home)
+			}
+		})
+	}
+
+	// every point on the circle falls in one of the cells
+	cells := CellsIntersecting(lat, lng, 10000, 5)
+	inCells := make(map[string]bool)
+	for _, cell := range cells {
+		inCells[cell] = true
+	}
+	for deg := 0; deg < 360; deg += 15 {
+		rad := float64(deg) * math.Pi / 180
+		pLat := lat + 9900*math.Sin(rad)/metersPerDegree
+		pLng := lng + 9900*math.Cos(rad)/(metersPerDegree*math.Cos(lat*math.Pi/180))
+		if cell := Encode(pLat, pLng, 5); !inCells[cell] {
+			t.Errorf("point at %d degrees is in %q, not one of the cells", deg, cell)
+		}
+	}
+}
+
+func TestCellWithin(t *testing.T) {
+	lat, lng := 33.6186, -117.9294
+	home := Encode(lat, lng, 5)
+
+	// the cell is about 4.9km by 4.1km, so a circle around a point in it
+	// holds all of it once the radius reaches past its far corner
+	if CellWithin(home, lat, lng, 1000) {
+		t.Errorf("%q within 1km, want it reaching outside", home)
+	}
+	if !CellWithin(home, lat, lng, 10000) {
+		t.Errorf("%q not within 10km", home)
+	}
+
+	within := 0
+	cells := CellsIntersecting(lat, lng, 10000, 5)
+	for _, cell := range cells {
+		if CellWithin(cell, lat, lng, 10000) {
+			within++
+		}
+	}
+	if within == 0 || within == len(cells) {
+		t.Errorf("%d of %d cells within 10km, want the inner ones only", within, len(cells))
+	}
+}
+
+func TestCellsIntersecting_Antimeridian(t *testing.T) {
+	cells := CellsIntersecting(0, 179.99, 5000, 4)
+
+	east, west := false, false
+	for _, cell := range cells {
+		box, _ := Bounds(cell)
+		east = east || box.MaxLng > 179
+		west = west || box.MinLng < -179
+	}
+	if !east || !west {
+		t.Errorf("cells %v should cross the antimeridian", cells)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+type AdminHandler struct {
+	governor *budget.Governor
+	curator  *shop.Curator
+	jobs     jobs.Queue
+}
+
+func NewAdminHandler(governor *budget.Governor, curator *shop.Curator, queue jobs.Queue) *AdminHandler {
+	return &AdminHandler{governor: governor, curator: curator, jobs: queue}
+}
+
+// GetSpend returns what each paid provider has cost over the rolling day and
+// month against its budget
+func (h *AdminHandler) GetSpend(w http.ResponseWriter, r *http.Request) {
+	report, err := h.governor.Report(r.Context())
+	if err != nil {
+		log.Printf("Failed to build spend report: %v", err)
+		http.Error(w, "Failed to fetch spend", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": report,
+	})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetDeadLetters returns the most recent jobs that failed for good, newest
+// first
+func (h *AdminHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	dead, err := h.jobs.DeadLetters(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to fetch dead letters: %v", err)
+		http.Error(w, "Failed to fetch dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs": dead,
+	})
+}
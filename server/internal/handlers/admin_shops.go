@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+const (
+	maxShopDescriptionLength = 1000
+	maxHiddenReasonLength    = 200
+	maxAdminBodySize         = 16 << 10
+)
+
+// GetShop returns a shop, including hidden ones
+func (h *AdminHandler) GetShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.curator.Get(r.Context(), shopID)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// VerifyShop marks a shop as verified by Coffeehaus
+func (h *AdminHandler) VerifyShop(w http.ResponseWriter, r *http.Request) {
+	h.setVerified(w, r, true)
+}
+
+// UnverifyShop removes a shop's verified mark
+func (h *AdminHandler) UnverifyShop(w http.ResponseWriter, r *http.Request) {
+	h.setVerified(w, r, false)
+}
+
+func (h *AdminHandler) setVerified(w http.ResponseWriter, r *http.Request, verified bool) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	res, err := h.curator.SetVerified(r.Context(), principal.UserID, shopID, verified)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// PatchShop applies a JSON Merge Patch to a shop's Coffeehaus specific
+// fields. Places data can't be edited, it is overwritten on the next sync.
+func (h *AdminHandler) PatchShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&patch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Request body must be a JSON object")
+		return
+	}
+
+	updates, fieldErrs := validateShopPatch(patch)
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	res, err := h.curator.Update(r.Context(), principal.UserID, shopID, updates)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+type hideShopRequest struct {
+	Reason string `json:"reason"`
+}
+
+// HideShop hides a shop from search, with an optional reason such as
+// "closed" or "not a coffee shop"
+func (h *AdminHandler) HideShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	var req hideShopRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_body", "Request body must be a JSON object")
+			return
+		}
+	}
+	if utf8.RuneCountInString(req.Reason) > maxHiddenReasonLength {
+		writeValidationErrors(w, []FieldError{{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", maxHiddenReasonLength)}})
+		return
+	}
+
+	res, err := h.curator.SetHidden(r.Context(), principal.UserID, shopID, true, req.Reason)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// UnhideShop makes a hidden shop searchable again
+func (h *AdminHandler) UnhideShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	res, err := h.curator.SetHidden(r.Context(), principal.UserID, shopID, false, "")
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+type mergeShopRequest struct {
+	Into string `json:"into"`
+}
+
+// MergeShop merges the shop in the URL into the shop named in the body and
+// returns the shop that remains
+func (h *AdminHandler) MergeShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	var req mergeShopRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodySize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Request body must be a JSON object")
+		return
+	}
+	if _, err := uuid.Parse(req.Into); err != nil {
+		writeValidationErrors(w, []FieldError{{Field: "into", Message: "must be a shop id"}})
+		return
+	}
+
+	res, err := h.curator.Merge(r.Context(), principal.UserID, shopID, req.Into)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// ResyncShop refreshes a shop's Places data immediately
+func (h *AdminHandler) ResyncShop(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+
+	res, err := h.curator.Resync(r.Context(), principal.UserID, shopID)
+	if err != nil {
+		writeCurationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// shopIDParam reads the shop ID from the URL, writing a 404 if it can't be one
+func shopIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	shopID := chi.URLParam(r, "shopID")
+	if _, err := uuid.Parse(shopID); err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Shop not found")
+		return "", false
+	}
+	return shopID, true
+}
+
+func writeCurationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, shop.ErrShopNotFound):
+		writeJSONError(w, http.StatusNotFound, "not_found", "Shop not found")
+	case errors.Is(err, shop.ErrShopMerged):
+		writeJSONError(w, http.StatusConflict, "shop_merged", err.Error())
+	case errors.Is(err, shop.ErrInvalidMerge):
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid_merge", err.Error())
+	case errors.Is(err, budget.ErrUnavailable):
+		writeJSONError(w, http.StatusServiceUnavailable, "places_unavailable", "Places is unavailable, try again later")
+	default:
+		log.Printf("Shop curation failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update shop")
+	}
+}
+
+// validateShopPatch turns a merge patch of a shop into the column updates to
+// apply, collecting every field error rather than stopping at the first
+func validateShopPatch(patch map[string]json.RawMessage) (map[string]interface{}, []FieldError) {
+	updates := make(map[string]interface{})
+	var errs []FieldError
+
+	if len(patch) == 0 {
+		return nil, []FieldError{{Field: "", Message: "no fields to update"}}
+	}
+
+	for field, raw := range patch {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch field {
+		case "coffeehaus_rating":
+			if isNull {
+				updates[field] = nil
+				continue
+			}
+			var rating float64
+			if json.Unmarshal(raw, &rating) != nil || rating < 0 || rating > 5 {
+				errs = append(errs, FieldError{Field: field, Message: "must be a number from 0 to 5 or null"})
+				continue
+			}
+			updates[field] = rating
+
+		case "description":
+			if isNull {
+				updates[field] = nil
+				continue
+			}
+			var description string
+			if json.Unmarshal(raw, &description) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a string or null"})
+				continue
+			}
+			if utf8.RuneCountInString(description) > maxShopDescriptionLength {
+				errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", maxShopDescriptionLength)})
+				continue
+			}
+			updates[field] = description
+
+		case "verified":
+			var verified bool
+			if isNull || json.Unmarshal(raw, &verified) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a boolean"})
+				continue
+			}
+			updates[field] = verified
+
+		default:
+			errs = append(errs, FieldError{Field: field, Message: "is not editable"})
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return updates, errs
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateShopPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantUpdates map[string]interface{}
+		wantFields  []string
+	}{
+		{
+			name:        "coffeehaus fields",
+			body:        `{"coffeehaus_rating": 4.5, "description": "Natural process pour-overs", "verified": true}`,
+			wantUpdates: map[string]interface{}{"coffeehaus_rating": 4.5, "description": "Natural process pour-overs", "verified": true},
+		},
+		{
+			name:        "null clears a field",
+			body:        `{"coffeehaus_rating": null, "description": null}`,
+			wantUpdates: map[string]interface{}{"coffeehaus_rating": nil, "description": nil},
+		},
+		{
+			name:       "rating out of range",
+			body:       `{"coffeehaus_rating": 6}`,
+			wantFields: []string{"coffeehaus_rating"},
+		},
+		{
+			name:       "places fields aren't editable",
+			body:       `{"name": "Better Name", "google_rating": 5, "description": "` + strings.Repeat("a", 1001) + `", "verified": null}`,
+			wantFields: []string{"description", "google_rating", "name", "verified"},
+		},
+		{
+			name:       "empty patch",
+			body:       `{}`,
+			wantFields: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+				t.Fatalf("bad test body: %v", err)
+			}
+
+			updates, errs := validateShopPatch(patch)
+
+			var gotFields []string
+			for _, e := range errs {
+				gotFields = append(gotFields, e.Field)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Fatalf("field errors = %v, want %v", gotFields, tt.wantFields)
+			}
+
+			if tt.wantFields == nil && !reflect.DeepEqual(updates, tt.wantUpdates) {
+				t.Errorf("updates = %v, want %v", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
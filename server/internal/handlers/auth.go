@@ -4,9 +4,8 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/johnnynu/Coffeehaus/internal/constants"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
 	"github.com/johnnynu/Coffeehaus/internal/database"
-	"github.com/supabase-community/auth-go/types"
 )
 
 type AuthHandler struct {
@@ -19,23 +18,14 @@ func NewAuthHandler(db *database.Client) *AuthHandler {
 
 func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
-	// get user from context
-	val := r.Context().Value(constants.UserKey)
-	if val == nil {
-		log.Println("Context value is nil")
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
-		return
-	}
-
-	userResp, ok := val.(*types.UserResponse)
+	principal, ok := auth.PrincipalFrom(r.Context())
 	if !ok {
-		log.Printf("Type assertion failed. Got type: %T, want: *types.UserResponse", val)
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 
 		query := `username, display_name, bio, profile_photo_id, photos!profile_photo_id(versions)`
-	res, status, err := h.db.From("users").Select(query, "", false).Eq("id", userResp.User.ID.String()).Single().Execute()
+	res, status, err := h.db.From("users").Select(query, "", false).Eq("id", principal.UserID).Single().Execute()
 
 	log.Printf("Query result - Status: %d, Error: %v, Response: %s", status, err, string(res))
 
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HealthCheck checks a dependency the API can run without, returning nil
+// when it is up
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of one health check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthResponse is "ok" when every check passes and "degraded" otherwise.
+// A degraded API still serves requests, so both are a 200.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type HealthHandler struct {
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+func NewHealthHandler(checks map[string]HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: 2 * time.Second}
+}
+
+// GetHealth runs every check and reports which dependencies are down
+func (h *HealthHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := HealthResponse{Status: "ok", Checks: make(map[string]CheckResult, len(names))}
+	for _, name := range names {
+		if err := h.checks[name](ctx); err != nil {
+			resp.Status = "degraded"
+			resp.Checks[name] = CheckResult{Status: "down", Error: err.Error()}
+			continue
+		}
+		resp.Checks[name] = CheckResult{Status: "ok"}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
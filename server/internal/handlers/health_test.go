@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHealth(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("circuit breaker open") }
+
+	tests := []struct {
+		name       string
+		checks     map[string]HealthCheck
+		wantStatus string
+		wantRedis  CheckResult
+	}{
+		{
+			name:       "all up",
+			checks:     map[string]HealthCheck{"redis": up},
+			wantStatus: "ok",
+			wantRedis:  CheckResult{Status: "ok"},
+		},
+		{
+			name:       "redis down",
+			checks:     map[string]HealthCheck{"redis": down},
+			wantStatus: "degraded",
+			wantRedis:  CheckResult{Status: "down", Error: "circuit breaker open"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewHealthHandler(tt.checks).GetHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			// a degraded API is still serving
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status code = %d, want 200", rec.Code)
+			}
+			var resp HealthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if resp.Checks["redis"] != tt.wantRedis {
+				t.Errorf("redis check = %+v, want %+v", resp.Checks["redis"], tt.wantRedis)
+			}
+		})
+	}
+}
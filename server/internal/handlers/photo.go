@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/photos"
+)
+
+type PhotoHandler struct {
+	service *photos.Service
+}
+
+func NewPhotoHandler(service *photos.Service) *PhotoHandler {
+	return &PhotoHandler{service: service}
+}
+
+// UploadPhoto accepts a multipart upload with the image in the "photo" field.
+// When the "purpose" field is "profile" the photo also becomes the user's
+// profile photo.
+func (h *PhotoHandler) UploadPhoto(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	userID := principal.UserID
+
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, photos.MaxUploadSize+(1<<20))
+	if err := r.ParseMultipartForm(photos.MaxUploadSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Photo is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	purpose := r.FormValue("purpose")
+	if purpose != "" && purpose != "post" && purpose != "profile" {
+		http.Error(w, "purpose must be post or profile", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		http.Error(w, "Form field 'photo' is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, photos.MaxUploadSize+1))
+	if err != nil {
+		log.Printf("Failed to read upload: %v", err)
+		http.Error(w, "Failed to read photo", http.StatusBadRequest)
+		return
+	}
+
+	photo, err := h.service.Upload(r.Context(), userID, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, photos.ErrUnsupportedType):
+			http.Error(w, "Photo must be a JPEG, PNG or WebP image", http.StatusUnsupportedMediaType)
+		case errors.Is(err, photos.ErrImageTooLarge):
+			http.Error(w, "Photo is too large", http.StatusRequestEntityTooLarge)
+		default:
+			log.Printf("Failed to upload photo: %v", err)
+			http.Error(w, "Failed to upload photo", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if purpose == "profile" {
+		if err := h.service.SetProfilePhoto(r.Context(), userID, photo.ID); err != nil {
+			log.Printf("Failed to set profile photo: %v", err)
+			http.Error(w, "Failed to set profile photo", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(photo)
+}
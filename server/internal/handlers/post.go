@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/tags"
+)
+
+type PostHandler struct {
+	db   *database.Client
+	tags *tags.Service
+}
+
+type CreatePostRequest struct {
+	ShopID     string   `json:"shop_id"`
+	PhotoID    string   `json:"photo_id,omitempty"`
+	Caption    string   `json:"caption"`
+	DrinkName  string   `json:"drink_name,omitempty"`
+	DrinkPrice *float64 `json:"drink_price,omitempty"`
+	Rating     *float32 `json:"rating,omitempty"`
+}
+
+func NewPostHandler(db *database.Client, tags *tags.Service) *PostHandler {
+	return &PostHandler{db: db, tags: tags}
+}
+
+// CreatePost creates a post for the authenticated user and indexes the
+// hashtags in its caption
+func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ShopID == "" {
+		http.Error(w, "shop_id is required", http.StatusBadRequest)
+		return
+	}
+
+	postData := map[string]interface{}{
+		"user_id":     principal.UserID,
+		"shop_id":     req.ShopID,
+		"caption":     req.Caption,
+		"drink_name":  req.DrinkName,
+		"drink_price": req.DrinkPrice,
+		"rating":      req.Rating,
+	}
+	if req.PhotoID != "" {
+		postData["photo_id"] = req.PhotoID
+	}
+
+	res, _, err := h.db.From("posts").Insert(postData, false, "", "", "").Single().Execute()
+	if err != nil {
+		log.Printf("Failed to create post: %v", err)
+		http.Error(w, "Failed to create post", http.StatusInternalServerError)
+		return
+	}
+
+	var post map[string]interface{}
+	if err := json.Unmarshal(res, &post); err != nil {
+		log.Printf("Failed to parse created post: %v", err)
+		http.Error(w, "Failed to create post", http.StatusInternalServerError)
+		return
+	}
+
+	postID, _ := post["id"].(string)
+	postTags, err := h.tags.IndexPost(r.Context(), postID, req.Caption)
+	if err != nil {
+		// the post exists, tags can be re-indexed later
+		log.Printf("Failed to index tags for post %s: %v", postID, err)
+	}
+	post["tags"] = postTags
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(post)
+}
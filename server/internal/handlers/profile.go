@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	usernamepolicy "github.com/johnnynu/Coffeehaus/internal/username"
+	"github.com/supabase-community/postgrest-go"
+)
+
+const recentPostsLimit = 12
+
+// PublicProfile is what other users see of a profile
+type PublicProfile struct {
+	ID             string            `json:"id"`
+	Username       string            `json:"username"`
+	DisplayName    string            `json:"display_name"`
+	Bio            *string           `json:"bio"`
+	Avatar         map[string]string `json:"avatar"`
+	IsPrivate      bool              `json:"is_private"`
+	FollowerCount  int64             `json:"follower_count"`
+	FollowingCount int64             `json:"following_count"`
+	PostCount      int64             `json:"post_count"`
+	// RecentPosts is omitted for private profiles the viewer doesn't follow
+	RecentPosts json.RawMessage `json:"recent_posts,omitempty"`
+}
+
+// GetPublicProfile returns the public profile for the username in the URL
+func (h *UserHandler) GetPublicProfile(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_username", "Username is required")
+		return
+	}
+
+	query := `id, username, display_name, bio, is_private, photos!profile_photo_id(versions)`
+	res, _, err := h.db.From("users").Select(query, "", false).Eq("username_key", usernamepolicy.Key(username)).Execute()
+	if err != nil {
+		log.Printf("Failed to fetch profile for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+
+	var users []struct {
+		ID          string  `json:"id"`
+		Username    string  `json:"username"`
+		DisplayName string  `json:"display_name"`
+		Bio         *string `json:"bio"`
+		IsPrivate   bool    `json:"is_private"`
+		Photos      *struct {
+			Versions map[string]string `json:"versions"`
+		} `json:"photos"`
+	}
+	if err := json.Unmarshal(res, &users); err != nil {
+		log.Printf("Failed to parse profile for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+
+	if len(users) == 0 {
+		h.redirectRenamedProfile(w, r, username)
+		return
+	}
+	user := users[0]
+
+	// send case and lookalike variants to the canonical profile url
+	if user.Username != username {
+		http.Redirect(w, r, "/users/"+url.PathEscape(user.Username), http.StatusMovedPermanently)
+		return
+	}
+
+	profile := PublicProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsPrivate:   user.IsPrivate,
+	}
+	if user.Photos != nil {
+		profile.Avatar = user.Photos.Versions
+	}
+
+	if profile.FollowerCount, err = h.count("follows", "following_id", user.ID); err != nil {
+		log.Printf("Failed to count followers for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+	if profile.FollowingCount, err = h.count("follows", "follower_id", user.ID); err != nil {
+		log.Printf("Failed to count following for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+	if profile.PostCount, err = h.count("posts", "user_id", user.ID); err != nil {
+		log.Printf("Failed to count posts for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+
+	canSeePosts := !user.IsPrivate
+	if user.IsPrivate {
+		canSeePosts, err = h.canViewPrivate(r, user.ID)
+		if err != nil {
+			log.Printf("Failed to check follow status for %s: %v", username, err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+			return
+		}
+	}
+
+	if canSeePosts {
+		posts, _, err := h.db.From("posts").
+			Select("*", "", false).
+			Eq("user_id", user.ID).
+			Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+			Limit(recentPostsLimit, "").
+			Execute()
+		if err != nil {
+			log.Printf("Failed to fetch posts for %s: %v", username, err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+			return
+		}
+		profile.RecentPosts = posts
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// redirectRenamedProfile sends requests for a username that was changed
+// within the grace period to the owner's current profile
+func (h *UserHandler) redirectRenamedProfile(w http.ResponseWriter, r *http.Request, username string) {
+	ownerID, err := h.recentUsernameOwner(username)
+	if err != nil {
+		log.Printf("Failed to check username history for %s: %v", username, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch profile")
+		return
+	}
+
+	if ownerID == "" {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Profile not found")
+		return
+	}
+
+	res, _, err := h.db.From("users").Select("username", "", false).Eq("id", ownerID).Single().Execute()
+	if err != nil {
+		log.Printf("Failed to fetch current username for %s: %v", ownerID, err)
+		writeJSONError(w, http.StatusNotFound, "not_found", "Profile not found")
+		return
+	}
+
+	var current struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(res, &current); err != nil || current.Username == "" {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Profile not found")
+		return
+	}
+
+	http.Redirect(w, r, "/users/"+url.PathEscape(current.Username), http.StatusMovedPermanently)
+}
+
+// canViewPrivate reports whether the authenticated viewer may see the posts
+// of a private profile, either because it is theirs or because they follow it
+func (h *UserHandler) canViewPrivate(r *http.Request, profileID string) (bool, error) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		return false, nil
+	}
+
+	viewerID := principal.UserID
+	if viewerID == profileID {
+		return true, nil
+	}
+
+	following, err := h.countWhere("follows", map[string]string{
+		"follower_id":  viewerID,
+		"following_id": profileID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return following > 0, nil
+}
+
+func (h *UserHandler) count(table, column, value string) (int64, error) {
+	return h.countWhere(table, map[string]string{column: value})
+}
+
+// countWhere returns the number of rows in table matching every column=value
+func (h *UserHandler) countWhere(table string, match map[string]string) (int64, error) {
+	_, count, err := h.db.From(table).Select("*", "exact", true).Match(match).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+	return count, nil
+}
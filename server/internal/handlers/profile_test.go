@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/database/databasetest"
+)
+
+const (
+	ownerID    = "6d0a4e3c-1f2b-4a5c-9e8d-7b6a5c4d3e2f"
+	followerID = "2b3c4d5e-6f7a-4b8c-9d0e-1f2a3b4c5d6e"
+	strangerID = "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"
+)
+
+// withViewer authenticates r as the user viewerID, or leaves it anonymous
+func withViewer(r *http.Request, viewerID string) *http.Request {
+	if viewerID == "" {
+		return r
+	}
+	return r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{UserID: viewerID}))
+}
+
+func TestGetPublicProfile_Private(t *testing.T) {
+	tests := []struct {
+		name      string
+		private   bool
+		viewerID  string
+		wantPosts bool
+	}{
+		{name: "public profile, anonymous viewer", viewerID: "", wantPosts: true},
+		{name: "owner", private: true, viewerID: ownerID, wantPosts: true},
+		{name: "follower", private: true, viewerID: followerID, wantPosts: true},
+		{name: "stranger", private: true, viewerID: strangerID, wantPosts: false},
+		{name: "anonymous viewer", private: true, viewerID: "", wantPosts: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := databasetest.NewServer(t)
+			user, _ := json.Marshal([]map[string]interface{}{{
+				"id":           ownerID,
+				"username":     "bean.counter",
+				"display_name": "Bean Counter",
+				"is_private":   tt.private,
+			}})
+			server.Respond("GET users", string(user))
+			server.Respond("GET posts", `[{"id": "post-1"}]`)
+			server.Handle("HEAD follows", func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("follower_id") == "eq."+followerID && query.Get("following_id") == "eq."+ownerID {
+					databasetest.Count(1)(w, r)
+					return
+				}
+				databasetest.Count(0)(w, r)
+			})
+
+			router := chi.NewRouter()
+			router.Get("/users/{username}", NewUserHandler(server.Client()).GetPublicProfile)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, withViewer(httptest.NewRequest(http.MethodGet, "/users/bean.counter", nil), tt.viewerID))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			var profile PublicProfile
+			if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+				t.Fatalf("failed to parse profile: %v", err)
+			}
+			if profile.IsPrivate != tt.private {
+				t.Errorf("IsPrivate = %v, want %v", profile.IsPrivate, tt.private)
+			}
+			if gotPosts := profile.RecentPosts != nil; gotPosts != tt.wantPosts {
+				t.Errorf("got recent posts %s, want posts %v", profile.RecentPosts, tt.wantPosts)
+			}
+			if fetched := len(server.Requests("GET posts")) > 0; fetched != tt.wantPosts {
+				t.Errorf("fetched posts = %v, want %v", fetched, tt.wantPosts)
+			}
+		})
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		name          string
+		username      string
+		viewerID      string
+		users         string
+		history       string
+		wantStatus    int
+		wantAvailable bool
+		wantReason    string
+	}{
+		{
+			name:       "missing",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid",
+			username:   "latte lover",
+			wantStatus: http.StatusOK,
+			wantReason: "username may only contain letters, numbers, periods and underscores",
+		},
+		{
+			name:          "free",
+			username:      "latte.lover",
+			wantStatus:    http.StatusOK,
+			wantAvailable: true,
+		},
+		{
+			name:       "taken",
+			username:   "latte.lover",
+			viewerID:   strangerID,
+			users:      `[{"id": "` + ownerID + `"}]`,
+			wantStatus: http.StatusOK,
+			wantReason: "username already taken",
+		},
+		{
+			// renaming to a case or lookalike variant of their own username
+			name:          "taken by the viewer",
+			username:      "Latte.Lover",
+			viewerID:      ownerID,
+			users:         `[{"id": "` + ownerID + `"}]`,
+			wantStatus:    http.StatusOK,
+			wantAvailable: true,
+		},
+		{
+			name:       "recently given up by another user",
+			username:   "latte.lover",
+			viewerID:   strangerID,
+			history:    `[{"user_id": "` + ownerID + `"}]`,
+			wantStatus: http.StatusOK,
+			wantReason: "username already taken",
+		},
+		{
+			name:          "recently given up by the viewer",
+			username:      "latte.lover",
+			viewerID:      ownerID,
+			history:       `[{"user_id": "` + ownerID + `"}]`,
+			wantStatus:    http.StatusOK,
+			wantAvailable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := databasetest.NewServer(t)
+			if tt.users != "" {
+				server.Respond("GET users", tt.users)
+			}
+			if tt.history != "" {
+				server.Respond("GET username_history", tt.history)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/users/check-username", nil)
+			if tt.username != "" {
+				r.URL.RawQuery = url.Values{"username": {tt.username}}.Encode()
+			}
+
+			rec := httptest.NewRecorder()
+			NewUserHandler(server.Client()).CheckUsername(rec, withViewer(r, tt.viewerID))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got struct {
+				Available bool   `json:"available"`
+				Reason    string `json:"reason"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if got.Available != tt.wantAvailable || got.Reason != tt.wantReason {
+				t.Errorf("got available %v (%q), want %v (%q)", got.Available, got.Reason, tt.wantAvailable, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the JSON body of an error response
+type ErrorResponse struct {
+	Error   string       `json:"error"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an error with a machine readable code, e.g.
+// "not_found", and a human readable message
+func writeJSONError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, ErrorResponse{Error: code, Message: message})
+}
+
+// writeValidationErrors writes a 422 listing every rejected field
+func writeValidationErrors(w http.ResponseWriter, fields []FieldError) {
+	writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{
+		Error:   "validation_failed",
+		Message: "One or more fields are invalid",
+		Fields:  fields,
+	})
+}
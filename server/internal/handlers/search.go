@@ -5,9 +5,15 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/google/uuid"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/ratelimit"
 	"github.com/johnnynu/Coffeehaus/internal/search"
 )
 
+// maxSuggestions is the most autocomplete suggestions a request can ask for
+const maxSuggestions = 20
+
 type SearchHandler struct {
 	service *search.SearchService
 }
@@ -24,15 +30,26 @@ func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// parse query params
+	// parse query params, a picked autocomplete suggestion is looked up by
+	// its place ID instead of searched for
 	userQuery := r.URL.Query().Get("q")
-	if userQuery == "" {
-		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+	placeID := r.URL.Query().Get("place_id")
+	if userQuery == "" && placeID == "" {
+		http.Error(w, "Query parameter 'q' or 'place_id' is required", http.StatusBadRequest)
 		return
 	}
 
 	opts := search.SearchOptions{
-		Query: userQuery,
+		Query:   userQuery,
+		PlaceID: placeID,
+	}
+	// the suggestion's autocomplete session, which fetching it ends
+	if session := r.URL.Query().Get("session"); session != "" {
+		if _, err := uuid.Parse(session); err != nil {
+			http.Error(w, "Query parameter 'session' must be a UUID", http.StatusBadRequest)
+			return
+		}
+		opts.Session = session
 	}
 
 	// parse other optional params
@@ -61,9 +78,23 @@ func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 			opts.Offset = parsedOffset
 		}
 	}
+	// logged in users also get personalized extras and ranking, and admins
+	// can ask how results were ranked
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		opts.UserID = principal.UserID
+		if debug := r.URL.Query().Get("debug"); debug != "" && principal.HasRole("admin") {
+			if parsedDebug, err := strconv.ParseBool(debug); err == nil {
+				opts.Debug = parsedDebug
+			}
+		}
+	}
 
 	// perform search
 	results, err := h.service.Search(r.Context(), opts)
+	if limitErr, ok := ratelimit.IsLimited(err); ok {
+		ratelimit.WriteLimited(w, limitErr)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -75,4 +106,46 @@ func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to encode results", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// HandleAutocomplete suggests shops and areas as the user types. Clients send
+// the same session token with every keystroke until a suggestion is picked,
+// then pass it to /search along with the picked suggestion's place_id.
+func (h *SearchHandler) HandleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	userQuery := r.URL.Query().Get("q")
+	if userQuery == "" {
+		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		return
+	}
+
+	opts := search.AutocompleteOptions{
+		Query: userQuery,
+		Limit: limitParam(r, 0, maxSuggestions),
+	}
+
+	if lat := r.URL.Query().Get("lat"); lat != "" {
+		if parsedLat, err := strconv.ParseFloat(lat, 64); err == nil {
+			opts.Lat = parsedLat
+		}
+	}
+	if lng := r.URL.Query().Get("lng"); lng != "" {
+		if parsedLng, err := strconv.ParseFloat(lng, 64); err == nil {
+			opts.Lng = parsedLng
+		}
+	}
+	if session := r.URL.Query().Get("session"); session != "" {
+		if _, err := uuid.Parse(session); err != nil {
+			http.Error(w, "Query parameter 'session' must be a UUID", http.StatusBadRequest)
+			return
+		}
+		opts.Session = session
+	}
+
+	results, err := h.service.Autocomplete(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+type ShopHandler struct {
+	history *shop.History
+}
+
+func NewShopHandler(history *shop.History) *ShopHandler {
+	return &ShopHandler{history: history}
+}
+
+// GetRatingHistory returns how a shop's Google rating has moved over the
+// number of days given in the "days" query param (default 365)
+func (h *ShopHandler) GetRatingHistory(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	days := 365
+	if d := r.URL.Query().Get("days"); d != "" {
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed < 1 || parsed > 3650 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_days", "days must be between 1 and 3650")
+			return
+		}
+		days = parsed
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	history, err := h.history.RatingHistory(r.Context(), shopID, since)
+	if errors.Is(err, shop.ErrShopNotFound) {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Shop not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get rating history for shop %s: %v", shopID, err)
+		http.Error(w, "Failed to fetch rating history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// GetRecentChanges lists shops recently renamed or closed, picked by the
+// "kind" query param
+func (h *ShopHandler) GetRecentChanges(w http.ResponseWriter, r *http.Request) {
+	kind := shop.ChangeKind(r.URL.Query().Get("kind"))
+	if !kind.IsValid() {
+		writeJSONError(w, http.StatusBadRequest, "invalid_kind", "kind must be one of renamed, closed")
+		return
+	}
+
+	changes, err := h.history.Recent(r.Context(), kind, limitParam(r, 20, 100))
+	if err != nil {
+		log.Printf("Failed to get recent %s shops: %v", kind, err)
+		http.Error(w, "Failed to fetch recent changes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind":    kind,
+		"changes": changes,
+	})
+}
+
+// GetChanges returns a shop's full change history, for tracking down bad
+// syncs
+func (h *ShopHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	shopID, ok := shopIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := h.history.Changes(r.Context(), shopID, limitParam(r, 100, 1000))
+	if err != nil {
+		log.Printf("Failed to get changes for shop %s: %v", shopID, err)
+		http.Error(w, "Failed to fetch shop changes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"changes": changes,
+	})
+}
+
+// limitParam reads the "limit" query param, falling back to def when it is
+// missing or out of range
+func limitParam(r *http.Request, def, max int) int {
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= max {
+			return parsed
+		}
+	}
+	return def
+}
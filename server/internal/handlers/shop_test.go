@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestShopHandler_RejectsBadParams(t *testing.T) {
+	h := NewShopHandler(nil)
+	r := chi.NewRouter()
+	r.Get("/shops/changes", h.GetRecentChanges)
+	r.Get("/shops/{shopID}/rating-history", h.GetRatingHistory)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{name: "missing kind", url: "/shops/changes", wantStatus: http.StatusBadRequest},
+		{name: "unknown kind", url: "/shops/changes?kind=reopened", wantStatus: http.StatusBadRequest},
+		{name: "bad shop id", url: "/shops/not-a-uuid/rating-history", wantStatus: http.StatusNotFound},
+		{name: "bad days", url: "/shops/7f1c2c1e-3b6a-4a47-9a1e-0d6c3c1b2a10/rating-history?days=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
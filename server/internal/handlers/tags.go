@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+	"github.com/johnnynu/Coffeehaus/internal/tags"
+)
+
+type TagHandler struct {
+	service *tags.Service
+}
+
+func NewTagHandler(service *tags.Service) *TagHandler {
+	return &TagHandler{service: service}
+}
+
+// GetTagPosts returns the newest posts for a hashtag
+func (h *TagHandler) GetTagPosts(w http.ResponseWriter, r *http.Request) {
+	tag, ok := tags.Normalize(chi.URLParam(r, "tag"))
+	if !ok {
+		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsedOffset, err := strconv.Atoi(o); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	posts, err := h.service.PostsForTag(r.Context(), tag, limit, offset)
+	if err != nil {
+		log.Printf("Failed to get posts for tag %s: %v", tag, err)
+		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(posts)
+}
+
+// GetTrending returns the trending hashtags for the window given in the
+// "window" query param (1h, 24h or 7d, default 24h)
+func (h *TagHandler) GetTrending(w http.ResponseWriter, r *http.Request) {
+	window := redis.TrendingDay
+	if wParam := r.URL.Query().Get("window"); wParam != "" {
+		window = redis.TrendingWindow(wParam)
+	}
+	if !window.IsValid() {
+		http.Error(w, "Query parameter 'window' must be one of 1h, 24h, 7d", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
+			limit = parsedLimit
+		}
+	}
+
+	trending, err := h.service.Trending(r.Context(), window, limit)
+	if err != nil {
+		log.Printf("Failed to get trending tags: %v", err)
+		http.Error(w, "Failed to fetch trending tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(trending); err != nil {
+		http.Error(w, "failed to encode results", http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,17 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/johnnynu/Coffeehaus/internal/constants"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
 	"github.com/johnnynu/Coffeehaus/internal/database"
-	"github.com/supabase-community/auth-go/types"
+	usernamepolicy "github.com/johnnynu/Coffeehaus/internal/username"
+	"github.com/supabase-community/postgrest-go"
 )
 
 type UserHandler struct {
-	db *database.Client
+	db        *database.Client
+	profanity ProfanityChecker
 }
 
 type UpdateProfileRequest struct {
@@ -33,35 +37,46 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	
 	if username == "" {
 		log.Println("Username parameter is empty")
-		http.Error(w, "Username is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_username", "Username is required")
 		return
 	}
 
-	// Get user from context
-	val := r.Context().Value(constants.UserKey)
-	if val == nil {
-		log.Println("Context value is nil")
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
-		return
-	}
-
-	userResp, ok := val.(*types.UserResponse)
+	principal, ok := auth.PrincipalFrom(r.Context())
 	if !ok {
-		log.Printf("Type assertion failed. Got type: %T, want: *types.UserResponse", val)
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
 		return
 	}
-	log.Printf("Authenticated user ID: %s", userResp.User.ID.String())
+	log.Printf("Authenticated user ID: %s", principal.UserID)
 
 	// Parse request body
 	var req UpdateProfileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Invalid request body")
 		return
 	}
 	log.Printf("Update request data: %+v", req)
 
+	normalized, err := usernamepolicy.Normalize(req.Username)
+	if err != nil {
+		log.Printf("Rejected username '%s': %v", req.Username, err)
+		writeValidationErrors(w, []FieldError{{Field: "username", Message: err.Error()}})
+		return
+	}
+	req.Username = normalized
+
+	var fieldErrs []FieldError
+	if h.profanity != nil && h.profanity(req.DisplayName) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "display_name", Message: "contains language that isn't allowed"})
+	}
+	if h.profanity != nil && h.profanity(req.Bio) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "bio", Message: "contains language that isn't allowed"})
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
 	// Verify user owns this profile
 	log.Printf("Verifying ownership - Querying user with username: %s", username)
 	
@@ -79,13 +94,13 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	
 	if err != nil {
 		log.Printf("Database error: %v", err)
-		http.Error(w, "Failed to fetch user profile", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch user profile")
 		return
 	}
 	
 	if len(res) == 0 || string(res) == "null" {
 		log.Printf("No user found with username: %s", username)
-		http.Error(w, "Profile not found", http.StatusNotFound)
+		writeJSONError(w, http.StatusNotFound, "not_found", "Profile not found")
 		return
 	}
 
@@ -95,50 +110,31 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := json.Unmarshal(res, &userData); err != nil {
 		log.Printf("Failed to unmarshal user data: %v. Raw response: %s", err, string(res))
-		http.Error(w, "Failed to parse user data", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to parse user data")
 		return
 	}
 	log.Printf("Found user - ID: %s, Username: %s", userData.ID, userData.Username)
 
-	if userData.ID != userResp.User.ID.String() {
-		log.Printf("Unauthorized - Profile ID: %s, User ID: %s", userData.ID, userResp.User.ID.String())
-		http.Error(w, "Unauthorized to update this profile", http.StatusForbidden)
+	if userData.ID != principal.UserID {
+		log.Printf("Unauthorized - Profile ID: %s, User ID: %s", userData.ID, principal.UserID)
+		writeJSONError(w, http.StatusForbidden, "forbidden", "Unauthorized to update this profile")
 		return
 	}
 
 	// Check if new username is available (if username is being changed)
 	if req.Username != username {
 		log.Printf("Checking availability for new username: %s", req.Username)
-		
-		// Only select the username column for the check
-		checkRes, status, err := h.db.From("users").
-			Select("username", "", false).
-			Eq("username", req.Username).
-			Execute()
-		
+
+		available, err := h.usernameAvailable(req.Username, principal.UserID)
 		if err != nil {
 			log.Printf("Failed to check username availability: %v", err)
-			http.Error(w, "Failed to check username availability", http.StatusInternalServerError)
-			return
-		}
-
-		// Log the full response and status for debugging
-		log.Printf("Username check response - Status: %d, Response: %s", status, string(checkRes))
-
-		// Parse the response into a slice of user objects
-		var users []struct {
-			Username string `json:"username"`
-		}
-		if err := json.Unmarshal(checkRes, &users); err != nil {
-			log.Printf("Failed to parse username check response: %v", err)
-			http.Error(w, "Failed to check username availability", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to check username availability")
 			return
 		}
 
-		// If we found any users with this username, it's taken
-		if len(users) > 0 {
-			log.Printf("Username '%s' is already taken (found %d matches)", req.Username, len(users))
-			http.Error(w, "Username already taken", http.StatusConflict)
+		if !available {
+			log.Printf("Username '%s' is already taken", req.Username)
+			writeJSONError(w, http.StatusConflict, "username_taken", "Username already taken")
 			return
 		}
 
@@ -148,21 +144,29 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	// Update profile
 	updateData := map[string]interface{}{
 		"username":     req.Username,
+		"username_key": usernamepolicy.Key(req.Username),
 		"display_name": req.DisplayName,
 		"bio":         req.Bio,
 	}
 	log.Printf("Updating profile with data: %+v", updateData)
 
-	updateRes, _, err := h.db.From("users").Update(updateData, "", "").Eq("id", userResp.User.ID.String()).Execute()
+	updateRes, _, err := h.db.From("users").Update(updateData, "", "").Eq("id", principal.UserID).Execute()
 	if err != nil {
+		// the unique index on username_key catches a username claimed
+		// between the availability check and the update
+		if database.IsUniqueViolation(err) {
+			log.Printf("Username '%s' was taken during update", req.Username)
+			writeJSONError(w, http.StatusConflict, "username_taken", "Username already taken")
+			return
+		}
 		log.Printf("Failed to update profile - Error: %v", err)
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update profile")
 		return
 	}
 
 	if len(updateRes) == 0 || string(updateRes) == "null" {
 		log.Printf("Update returned no data")
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update profile")
 		return
 	}
 
@@ -171,4 +175,113 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	// Return updated profile
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(updateRes)
-} 
\ No newline at end of file
+} 
+
+// usernameAvailable reports whether a valid username can be claimed by the
+// user. A name is unavailable if another user has a name with the same key,
+// or gave it up recently enough that it still redirects to them.
+func (h *UserHandler) usernameAvailable(username string, userID string) (bool, error) {
+	key := usernamepolicy.Key(username)
+
+	// Only select the id column for the check
+	res, _, err := h.db.From("users").
+		Select("id", "", false).
+		Eq("username_key", key).
+		Execute()
+
+	if err != nil {
+		return false, fmt.Errorf("failed to query username: %w", err)
+	}
+
+	var users []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(res, &users); err != nil {
+		return false, fmt.Errorf("failed to parse username check response: %w", err)
+	}
+
+	// If we found any other user with this username, it's taken
+	for _, user := range users {
+		if user.ID != userID {
+			return false, nil
+		}
+	}
+
+	previousOwner, err := h.recentUsernameOwner(username)
+	if err != nil {
+		return false, err
+	}
+
+	return previousOwner == "" || previousOwner == userID, nil
+}
+
+// recentUsernameOwner returns the ID of the user who gave up the username
+// within the redirect grace period, or "" if nobody did
+func (h *UserHandler) recentUsernameOwner(username string) (string, error) {
+	res, _, err := h.db.From("username_history").
+		Select("user_id", "", false).
+		Eq("username_key", usernamepolicy.Key(username)).
+		Gt("expires_at", time.Now().UTC().Format(time.RFC3339)).
+		Order("changed_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(1, "").
+		Execute()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to query username history: %w", err)
+	}
+
+	var history []struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(res, &history); err != nil {
+		return "", fmt.Errorf("failed to parse username history: %w", err)
+	}
+
+	if len(history) == 0 {
+		return "", nil
+	}
+	return history[0].UserID, nil
+}
+
+// CheckUsername reports whether the username in the "username" query param
+// is valid and available, with the reason when it isn't
+func (h *UserHandler) CheckUsername(w http.ResponseWriter, r *http.Request) {
+	requested := r.URL.Query().Get("username")
+	if requested == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_username", "Query parameter 'username' is required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	username, err := usernamepolicy.Normalize(requested)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"username":  requested,
+			"available": false,
+			"reason":    err.Error(),
+		})
+		return
+	}
+
+	var userID string
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		userID = principal.UserID
+	}
+
+	available, err := h.usernameAvailable(username, userID)
+	if err != nil {
+		log.Printf("Failed to check username availability: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to check username availability")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"username":  username,
+		"available": available,
+	}
+	if !available {
+		resp["reason"] = "username already taken"
+	}
+	json.NewEncoder(w).Encode(resp)
+}
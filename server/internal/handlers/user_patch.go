@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	usernamepolicy "github.com/johnnynu/Coffeehaus/internal/username"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxPatchBodySize     = 16 << 10
+)
+
+// ProfanityChecker reports whether text should be rejected as profane
+type ProfanityChecker func(text string) bool
+
+// SetProfanityChecker installs the check run on display names and bios.
+// Without one, no text is rejected as profane.
+func (h *UserHandler) SetProfanityChecker(check ProfanityChecker) {
+	h.profanity = check
+}
+
+// PatchProfile applies a JSON Merge Patch (RFC 7396) to the authenticated
+// user's profile. Fields missing from the body are left alone and null clears
+// a field, so clients only send what changed.
+func (h *UserHandler) PatchProfile(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	userID := principal.UserID
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPatchBodySize)).Decode(&patch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Request body must be a JSON object")
+		return
+	}
+
+	updates, fieldErrs := validateProfilePatch(patch, h.profanity)
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	if name, ok := updates["username"].(string); ok {
+		available, err := h.usernameAvailable(name, userID)
+		if err != nil {
+			log.Printf("Failed to check username availability: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to check username availability")
+			return
+		}
+		if !available {
+			writeJSONError(w, http.StatusConflict, "username_taken", "Username already taken")
+			return
+		}
+	}
+
+	if photoID, ok := updates["profile_photo_id"].(string); ok {
+		owned, err := h.countWhere("photos", map[string]string{"id": photoID, "user_id": userID})
+		if err != nil {
+			log.Printf("Failed to check photo ownership: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to check photo")
+			return
+		}
+		if owned == 0 {
+			writeValidationErrors(w, []FieldError{{Field: "profile_photo_id", Message: "must be one of your uploaded photos"}})
+			return
+		}
+	}
+
+	_, _, err := h.db.From("users").Update(updates, "minimal", "").Eq("id", userID).Execute()
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			writeJSONError(w, http.StatusConflict, "username_taken", "Username already taken")
+			return
+		}
+		log.Printf("Failed to patch profile: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update profile")
+		return
+	}
+
+	query := `username, display_name, bio, is_private, profile_photo_id, photos!profile_photo_id(versions)`
+	res, _, err := h.db.From("users").Select(query, "", false).Eq("id", userID).Single().Execute()
+	if err != nil {
+		log.Printf("Failed to fetch patched profile: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to fetch updated profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+// validateProfilePatch turns a merge patch into the column updates to apply,
+// collecting every field error rather than stopping at the first
+func validateProfilePatch(patch map[string]json.RawMessage, profane ProfanityChecker) (map[string]interface{}, []FieldError) {
+	updates := make(map[string]interface{})
+	var errs []FieldError
+
+	if len(patch) == 0 {
+		return nil, []FieldError{{Field: "", Message: "no fields to update"}}
+	}
+
+	for field, raw := range patch {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch field {
+		case "username":
+			var name string
+			if isNull || json.Unmarshal(raw, &name) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a string"})
+				continue
+			}
+			normalized, err := usernamepolicy.Normalize(name)
+			if err != nil {
+				errs = append(errs, FieldError{Field: field, Message: err.Error()})
+				continue
+			}
+			updates["username"] = normalized
+			updates["username_key"] = usernamepolicy.Key(normalized)
+
+		case "display_name":
+			if isNull {
+				updates[field] = nil
+				continue
+			}
+			var name string
+			if json.Unmarshal(raw, &name) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a string or null"})
+				continue
+			}
+			// trim and collapse runs of whitespace
+			name = strings.Join(strings.Fields(name), " ")
+			switch {
+			case name == "":
+				updates[field] = nil
+			case utf8.RuneCountInString(name) > maxDisplayNameLength:
+				errs = append(errs, FieldError{Field: field, Message: "must be at most 50 characters"})
+			case profane != nil && profane(name):
+				errs = append(errs, FieldError{Field: field, Message: "contains language that isn't allowed"})
+			default:
+				updates[field] = name
+			}
+
+		case "bio":
+			if isNull {
+				updates[field] = nil
+				continue
+			}
+			var bio string
+			if json.Unmarshal(raw, &bio) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a string or null"})
+				continue
+			}
+			bio = strings.TrimSpace(bio)
+			switch {
+			case bio == "":
+				updates[field] = nil
+			case utf8.RuneCountInString(bio) > maxBioLength:
+				errs = append(errs, FieldError{Field: field, Message: "must be at most 160 characters"})
+			case profane != nil && profane(bio):
+				errs = append(errs, FieldError{Field: field, Message: "contains language that isn't allowed"})
+			default:
+				updates[field] = bio
+			}
+
+		case "profile_photo_id":
+			if isNull {
+				updates[field] = nil
+				continue
+			}
+			var photoID string
+			if json.Unmarshal(raw, &photoID) != nil || photoID == "" {
+				errs = append(errs, FieldError{Field: field, Message: "must be a photo id or null"})
+				continue
+			}
+			updates[field] = photoID
+
+		case "is_private":
+			var private bool
+			if isNull || json.Unmarshal(raw, &private) != nil {
+				errs = append(errs, FieldError{Field: field, Message: "must be a boolean"})
+				continue
+			}
+			updates[field] = private
+
+		default:
+			errs = append(errs, FieldError{Field: field, Message: "is not an editable field"})
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return updates, errs
+}
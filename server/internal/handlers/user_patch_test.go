@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateProfilePatch(t *testing.T) {
+	profane := func(text string) bool {
+		return strings.Contains(strings.ToLower(text), "decaf")
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantUpdates map[string]interface{}
+		wantFields  []string
+	}{
+		{
+			name:        "only sent fields are updated",
+			body:        `{"bio": "  pour-over person  "}`,
+			wantUpdates: map[string]interface{}{"bio": "pour-over person"},
+		},
+		{
+			name:        "null clears a field",
+			body:        `{"bio": null, "profile_photo_id": null}`,
+			wantUpdates: map[string]interface{}{"bio": nil, "profile_photo_id": nil},
+		},
+		{
+			name:        "display name is trimmed and collapsed",
+			body:        `{"display_name": "  Johnny   Nu "}`,
+			wantUpdates: map[string]interface{}{"display_name": "Johnny Nu"},
+		},
+		{
+			name: "username is normalized and keyed",
+			body: `{"username": "Latte.Lover"}`,
+			wantUpdates: map[string]interface{}{
+				"username":     "Latte.Lover",
+				"username_key": "latte_lover",
+			},
+		},
+		{
+			name:        "private flag",
+			body:        `{"is_private": true}`,
+			wantUpdates: map[string]interface{}{"is_private": true},
+		},
+		{
+			name:       "every invalid field is reported",
+			body:       `{"username": null, "bio": "` + strings.Repeat("a", 161) + `", "display_name": 7, "email": "x@y.z"}`,
+			wantFields: []string{"bio", "display_name", "email", "username"},
+		},
+		{
+			name:       "profanity hook",
+			body:       `{"display_name": "Decaf Fan"}`,
+			wantFields: []string{"display_name"},
+		},
+		{
+			name:       "reserved username",
+			body:       `{"username": "admin"}`,
+			wantFields: []string{"username"},
+		},
+		{
+			name:       "empty patch",
+			body:       `{}`,
+			wantFields: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+				t.Fatalf("bad test body: %v", err)
+			}
+
+			updates, errs := validateProfilePatch(patch, profane)
+
+			var gotFields []string
+			for _, e := range errs {
+				gotFields = append(gotFields, e.Field)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Fatalf("field errors = %v, want %v", gotFields, tt.wantFields)
+			}
+
+			if tt.wantFields == nil && !reflect.DeepEqual(updates, tt.wantUpdates) {
+				t.Errorf("updates = %v, want %v", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
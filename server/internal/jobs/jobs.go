@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job is a unit of background work. Payload is decoded by the handler
+// registered for its Type.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+	// LastError is set on jobs that failed, including dead letters
+	LastError string `json:"last_error,omitempty"`
+
+	// Receipt identifies this delivery of the job to the queue it came from
+	Receipt string `json:"-"`
+}
+
+// NewJob builds a job of the given type with payload encoded as JSON
+func NewJob(jobType string, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", jobType, err)
+	}
+
+	return &Job{
+		ID:         uuid.NewString(),
+		Type:       jobType,
+		Payload:    data,
+		EnqueuedAt: time.Now(),
+	}, nil
+}
+
+// Queue stores jobs until a worker has handled them. A dequeued job is
+// invisible to other workers until it is acked, retried or dead lettered;
+// jobs a crashed worker never finished are delivered again.
+type Queue interface {
+	Enqueue(ctx context.Context, job *Job) error
+	// Dequeue waits up to wait for a job, returning nil if none arrived
+	Dequeue(ctx context.Context, wait time.Duration) (*Job, error)
+	// Ack removes a handled job
+	Ack(ctx context.Context, job *Job) error
+	// Retry makes the job available again at the given time
+	Retry(ctx context.Context, job *Job, at time.Time) error
+	// DeadLetter sets aside a job that won't succeed
+	DeadLetter(ctx context.Context, job *Job) error
+	// DeadLetters returns the most recent dead letters, newest first
+	DeadLetters(ctx context.Context, limit int) ([]*Job, error)
+}
+
+// Enqueue builds a job and adds it to the queue
+func Enqueue(ctx context.Context, queue Queue, jobType string, payload interface{}) error {
+	job, err := NewJob(jobType, payload)
+	if err != nil {
+		return err
+	}
+	return queue.Enqueue(ctx, job)
+}
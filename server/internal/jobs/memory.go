@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps jobs in process. Jobs are lost when the process exits, so
+// it is meant for tests and local development.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	ready    []*Job
+	delayed  []delayedJob
+	inflight map[string]*Job
+	dead     []*Job
+	next     int
+	notify   chan struct{}
+}
+
+type delayedJob struct {
+	job *Job
+	at  time.Time
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		inflight: make(map[string]*Job),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	q.ready = append(q.ready, job)
+	q.mu.Unlock()
+	q.wake()
+	return nil
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context, wait time.Duration) (*Job, error) {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		job, nextDue := q.take()
+		if job != nil {
+			return job, nil
+		}
+
+		// wake up for new jobs, the next delayed job coming due or the deadline
+		var due <-chan time.Time
+		var timer *time.Timer
+		if !nextDue.IsZero() {
+			timer = time.NewTimer(time.Until(nextDue))
+			due = timer.C
+		}
+
+		var err error
+		expired := false
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-deadline.C:
+			expired = true
+		case <-q.notify:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil || expired {
+			return nil, err
+		}
+	}
+}
+
+// take pops the next ready job, promoting delayed jobs that are due. With no
+// job ready it returns when the next delayed job is due.
+func (q *MemoryQueue) take() (*Job, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	remaining := q.delayed[:0]
+	for _, d := range q.delayed {
+		if !d.at.After(now) {
+			q.ready = append(q.ready, d.job)
+		} else {
+			remaining = append(remaining, d)
+		}
+	}
+	q.delayed = remaining
+
+	if len(q.ready) == 0 {
+		var nextDue time.Time
+		for _, d := range q.delayed {
+			if nextDue.IsZero() || d.at.Before(nextDue) {
+				nextDue = d.at
+			}
+		}
+		return nil, nextDue
+	}
+
+	job := q.ready[0]
+	q.ready = q.ready[1:]
+	q.next++
+	job.Receipt = strconv.Itoa(q.next)
+	q.inflight[job.Receipt] = job
+	return job, time.Time{}
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	delete(q.inflight, job.Receipt)
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *MemoryQueue) Retry(ctx context.Context, job *Job, at time.Time) error {
+	q.mu.Lock()
+	delete(q.inflight, job.Receipt)
+	q.delayed = append(q.delayed, delayedJob{job: job, at: at})
+	q.mu.Unlock()
+	q.wake()
+	return nil
+}
+
+func (q *MemoryQueue) DeadLetter(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	delete(q.inflight, job.Receipt)
+	q.dead = append(q.dead, job)
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *MemoryQueue) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dead := make([]*Job, len(q.dead))
+	copy(dead, q.dead)
+	for i, j := 0, len(dead)-1; i < j; i, j = i+1, j-1 {
+		dead[i], dead[j] = dead[j], dead[i]
+	}
+	if limit > 0 && len(dead) > limit {
+		dead = dead[:limit]
+	}
+	return dead, nil
+}
+
+// Len returns the number of jobs waiting, delayed or in flight
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ready) + len(q.delayed) + len(q.inflight)
+}
+
+func (q *MemoryQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
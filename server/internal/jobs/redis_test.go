@@ -0,0 +1,279 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestRedisQueue(t *testing.T, mr *miniredis.Miniredis, visibility time.Duration) *redis.JobQueue {
+	t.Helper()
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+	queue, err := client.JobQueue(context.Background(), visibility)
+	if err != nil {
+		t.Fatalf("failed to create job queue: %v", err)
+	}
+	return queue
+}
+
+func TestRedisQueue(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := newTestRedisQueue(t, mr, time.Minute)
+	ctx := context.Background()
+
+	if err := jobs.Enqueue(ctx, queue, "greet", "ada"); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	job, err := queue.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil || job == nil {
+		t.Fatalf("Dequeue = %v, %v", job, err)
+	}
+	if job.Type != "greet" || string(job.Payload) != `"ada"` {
+		t.Errorf("got %s %s", job.Type, job.Payload)
+	}
+
+	// a delivered job isn't handed to anyone else until it is released
+	if next, err := queue.Dequeue(ctx, 10*time.Millisecond); err != nil || next != nil {
+		t.Fatalf("Dequeue = %v, %v, want nothing while in flight", next, err)
+	}
+
+	// a retry waits until it is due
+	job.Attempts++
+	if err := queue.Retry(ctx, job, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("failed to retry: %v", err)
+	}
+	job, err = queue.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil || job == nil {
+		t.Fatalf("expected the due retry, got %v, %v", job, err)
+	}
+	if job.Attempts != 1 {
+		t.Errorf("Attempts = %d, want it kept across the retry", job.Attempts)
+	}
+
+	job.LastError = "broken"
+	if err := queue.DeadLetter(ctx, job); err != nil {
+		t.Fatalf("failed to dead letter: %v", err)
+	}
+	dead, err := queue.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to get dead letters: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != job.ID || dead[0].LastError != "broken" {
+		t.Errorf("dead letters = %+v", dead)
+	}
+
+	if next, err := queue.Dequeue(ctx, 10*time.Millisecond); err != nil || next != nil {
+		t.Errorf("Dequeue = %v, %v, want the queue empty", next, err)
+	}
+}
+
+func TestRedisQueue_FutureRetry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := newTestRedisQueue(t, mr, time.Minute)
+	ctx := context.Background()
+
+	jobs.Enqueue(ctx, queue, "later", nil)
+	job, _ := queue.Dequeue(ctx, 10*time.Millisecond)
+	if err := queue.Retry(ctx, job, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to retry: %v", err)
+	}
+
+	if next, err := queue.Dequeue(ctx, 10*time.Millisecond); err != nil || next != nil {
+		t.Errorf("Dequeue = %v, %v, want the retry held back", next, err)
+	}
+}
+
+func TestRedisQueue_ReclaimsAbandoned(t *testing.T) {
+	mr := miniredis.RunT(t)
+	crashed := newTestRedisQueue(t, mr, 50*time.Millisecond)
+	survivor := newTestRedisQueue(t, mr, 50*time.Millisecond)
+	ctx := context.Background()
+
+	jobs.Enqueue(ctx, crashed, "sync", nil)
+	job, err := crashed.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil || job == nil {
+		t.Fatalf("Dequeue = %v, %v", job, err)
+	}
+
+	// the first worker never acks, once the visibility timeout passes the
+	// job goes to another
+	time.Sleep(60 * time.Millisecond)
+	reclaimed, err := survivor.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil || reclaimed == nil {
+		t.Fatalf("expected the abandoned job, got %v, %v", reclaimed, err)
+	}
+	if reclaimed.ID != job.ID {
+		t.Errorf("reclaimed %s, want %s", reclaimed.ID, job.ID)
+	}
+
+	if err := survivor.Ack(ctx, reclaimed); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if next, err := crashed.Dequeue(ctx, 10*time.Millisecond); err != nil || next != nil {
+		t.Errorf("Dequeue = %v, %v, want nothing after the ack", next, err)
+	}
+}
+
+func TestRedisQueue_WithWorker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := newTestRedisQueue(t, mr, time.Minute)
+
+	worker := jobs.NewWorker(queue, jobs.WorkerConfig{
+		Concurrency:  2,
+		MaxAttempts:  2,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		DrainTimeout: time.Second,
+		PollWait:     10 * time.Millisecond,
+	})
+	handled := make(chan string, 1)
+	worker.Register("greet", func(ctx context.Context, job *jobs.Job) error {
+		handled <- string(job.Payload)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	jobs.Enqueue(context.Background(), queue, "greet", "grace")
+	select {
+	case got := <-handled:
+		if got != `"grace"` {
+			t.Errorf("handled %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the job")
+	}
+}
+
+func TestRedisQueue_CountsAbandonedDeliveries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := newTestRedisQueue(t, mr, 20*time.Millisecond)
+	ctx := context.Background()
+
+	jobs.Enqueue(ctx, queue, "hang", nil)
+
+	// every delivery is abandoned, each one counts as an attempt
+	for want := 0; want < 3; want++ {
+		job, err := queue.Dequeue(ctx, 10*time.Millisecond)
+		if err != nil || job == nil {
+			t.Fatalf("Dequeue = %v, %v", job, err)
+		}
+		if job.Attempts != want {
+			t.Errorf("delivery %d has %d attempts, want %d", want+1, job.Attempts, want)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+}
+
+func TestRedisQueue_DeadLettersAbandoned(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := newTestRedisQueue(t, mr, 20*time.Millisecond)
+	ctx := context.Background()
+
+	jobs.Enqueue(ctx, queue, "hang", nil)
+	// two workers crashed mid job
+	for i := 0; i < 2; i++ {
+		if job, err := queue.Dequeue(ctx, 10*time.Millisecond); err != nil || job == nil {
+			t.Fatalf("Dequeue = %v, %v", job, err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	worker := jobs.NewWorker(queue, jobs.WorkerConfig{
+		Concurrency:  1,
+		MaxAttempts:  2,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		DrainTimeout: time.Second,
+		PollWait:     10 * time.Millisecond,
+	})
+	ran := make(chan struct{}, 1)
+	worker.Register("hang", func(ctx context.Context, job *jobs.Job) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		worker.Run(runCtx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	var dead []*jobs.Job
+	for len(dead) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		dead, _ = queue.DeadLetters(ctx, 10)
+	}
+	cancel()
+	<-done
+
+	if len(dead) != 1 {
+		t.Fatalf("expected the abandoned job to be dead lettered, got %d dead letters", len(dead))
+	}
+	select {
+	case <-ran:
+		t.Error("handler ran a job that was out of attempts")
+	default:
+	}
+}
+
+func TestRedisQueue_Close(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	consumers := func() int {
+		t.Helper()
+		client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+		defer client.Close()
+		found, err := client.XInfoConsumers(ctx, "{jobs}:stream", "workers").Result()
+		if err != nil {
+			t.Fatalf("failed to list consumers: %v", err)
+		}
+		return len(found)
+	}
+
+	busy := newTestRedisQueue(t, mr, time.Minute)
+	idle := newTestRedisQueue(t, mr, time.Minute)
+	for _, queue := range []*redis.JobQueue{busy, idle} {
+		jobs.Enqueue(ctx, queue, "sync", nil)
+		job, err := queue.Dequeue(ctx, 10*time.Millisecond)
+		if err != nil || job == nil {
+			t.Fatalf("Dequeue = %v, %v", job, err)
+		}
+		if queue == idle {
+			queue.Ack(ctx, job)
+		}
+	}
+
+	// a closed queue leaves the group, one still holding a job stays so the
+	// job can be claimed
+	for _, queue := range []*redis.JobQueue{busy, idle} {
+		if err := queue.Close(ctx); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+	}
+	if got := consumers(); got != 1 {
+		t.Errorf("%d consumers left, want only the busy one", got)
+	}
+}
@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Handler does the work of a job. Returning an error retries the job with
+// backoff until it runs out of attempts; wrap the error with Permanent to dead
+// letter it straight away.
+type Handler func(ctx context.Context, job *Job) error
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as one retrying won't fix
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type WorkerConfig struct {
+	// Concurrency is how many jobs are handled at once
+	Concurrency int
+	// MaxAttempts is how many times a job is tried before it is dead lettered
+	MaxAttempts int
+	// retries wait BaseBackoff, doubling per attempt up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// DrainTimeout is how long Run waits for jobs in flight once stopped
+	// before cancelling them
+	DrainTimeout time.Duration
+	// PollWait is how long each dequeue waits for a job
+	PollWait time.Duration
+}
+
+var DefaultWorkerConfig = WorkerConfig{
+	Concurrency:  4,
+	MaxAttempts:  5,
+	BaseBackoff:  5 * time.Second,
+	MaxBackoff:   5 * time.Minute,
+	DrainTimeout: 30 * time.Second,
+	PollWait:     2 * time.Second,
+}
+
+// Worker takes jobs off a queue and runs the handler registered for each
+type Worker struct {
+	queue    Queue
+	cfg      WorkerConfig
+	handlers map[string]Handler
+}
+
+func NewWorker(queue Queue, cfg WorkerConfig) *Worker {
+	return &Worker{
+		queue:    queue,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for a job type. It must be called before Run.
+func (w *Worker) Register(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Run handles jobs until ctx is cancelled, then stops taking new jobs and
+// waits for the ones in flight to finish. Jobs still running after the drain
+// timeout are cancelled and left for the queue to deliver again.
+func (w *Worker) Run(ctx context.Context) {
+	// handlers get their own context so stopping doesn't cut them off
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, handlerCtx)
+		}()
+	}
+
+	<-ctx.Done()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Println("Job worker drained")
+	case <-time.After(w.cfg.DrainTimeout):
+		log.Println("Job worker drain timed out, cancelling jobs in flight")
+		cancelHandlers()
+		<-drained
+	}
+}
+
+func (w *Worker) loop(ctx, handlerCtx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.queue.Dequeue(ctx, w.cfg.PollWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to dequeue job: %v", err)
+			// don't spin on a queue that is down
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.cfg.PollWait):
+			}
+			continue
+		}
+		if job == nil {
+			continue
+		}
+
+		w.handle(handlerCtx, job)
+	}
+}
+
+// handle runs one job and acks, retries or dead letters it
+func (w *Worker) handle(ctx context.Context, job *Job) {
+	job.Attempts++
+
+	// earlier deliveries that never finished count as attempts, so a job
+	// that crashes or hangs its worker isn't tried forever
+	if job.Attempts > w.cfg.MaxAttempts {
+		log.Printf("Job %s (%s) abandoned after %d attempts, dead lettering", job.ID, job.Type, job.Attempts-1)
+		job.LastError = "abandoned by its worker"
+		if err := w.queue.DeadLetter(ctx, job); err != nil {
+			log.Printf("Failed to dead letter job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	err := w.run(ctx, job)
+	if err == nil {
+		if err := w.queue.Ack(ctx, job); err != nil {
+			log.Printf("Failed to ack job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// cancelled while draining, the queue delivers it again
+		log.Printf("Job %s (%s) cancelled on shutdown: %v", job.ID, job.Type, err)
+		return
+	}
+
+	job.LastError = err.Error()
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= w.cfg.MaxAttempts {
+		log.Printf("Job %s (%s) failed after %d attempts, dead lettering: %v", job.ID, job.Type, job.Attempts, err)
+		if err := w.queue.DeadLetter(ctx, job); err != nil {
+			log.Printf("Failed to dead letter job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	delay := w.backoff(job.Attempts)
+	log.Printf("Job %s (%s) failed on attempt %d, retrying in %s: %v", job.ID, job.Type, job.Attempts, delay, err)
+	if err := w.queue.Retry(ctx, job, time.Now().Add(delay)); err != nil {
+		log.Printf("Failed to retry job %s: %v", job.ID, err)
+	}
+}
+
+// run calls the job's handler, turning panics into errors
+func (w *Worker) run(ctx context.Context, job *Job) (err error) {
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %s", job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// backoff doubles per attempt with up to 20% jitter so retries spread out
+func (w *Worker) backoff(attempt int) time.Duration {
+	delay := w.cfg.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > w.cfg.MaxBackoff {
+		delay = w.cfg.MaxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay - jitter
+}
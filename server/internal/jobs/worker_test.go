@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		Concurrency:  2,
+		MaxAttempts:  3,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+		DrainTimeout: time.Second,
+		PollWait:     10 * time.Millisecond,
+	}
+}
+
+// runWorker runs the worker until stop is called
+func runWorker(w *Worker) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorker_Handles(t *testing.T) {
+	queue := NewMemoryQueue()
+	worker := NewWorker(queue, testWorkerConfig())
+
+	var mu sync.Mutex
+	var got []string
+	worker.Register("greet", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(job.Payload))
+		return nil
+	})
+	stop := runWorker(worker)
+	defer stop()
+
+	ctx := context.Background()
+	for _, name := range []string{"ada", "grace"} {
+		if err := Enqueue(ctx, queue, "greet", name); err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+	}
+
+	waitFor(t, "jobs to be handled", func() bool { return queue.Len() == 0 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 {
+		t.Errorf("handled %v, want both jobs", got)
+	}
+}
+
+func TestWorker_RetriesThenSucceeds(t *testing.T) {
+	queue := NewMemoryQueue()
+	worker := NewWorker(queue, testWorkerConfig())
+
+	var calls int32
+	worker.Register("flaky", func(ctx context.Context, job *Job) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	stop := runWorker(worker)
+	defer stop()
+
+	Enqueue(context.Background(), queue, "flaky", nil)
+	waitFor(t, "job to succeed", func() bool { return atomic.LoadInt32(&calls) == 3 && queue.Len() == 0 })
+
+	dead, _ := queue.DeadLetters(context.Background(), 10)
+	if len(dead) != 0 {
+		t.Errorf("got %d dead letters, want none", len(dead))
+	}
+}
+
+func TestWorker_DeadLetters(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobType   string
+		err       error
+		wantCalls int32
+	}{
+		{name: "out of attempts", jobType: "broken", err: errors.New("still broken"), wantCalls: 3},
+		{name: "permanent error", jobType: "broken", err: Permanent(errors.New("bad payload")), wantCalls: 1},
+		{name: "unknown type", jobType: "unknown", wantCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := NewMemoryQueue()
+			worker := NewWorker(queue, testWorkerConfig())
+
+			var calls int32
+			worker.Register("broken", func(ctx context.Context, job *Job) error {
+				atomic.AddInt32(&calls, 1)
+				return tt.err
+			})
+			stop := runWorker(worker)
+			defer stop()
+
+			ctx := context.Background()
+			Enqueue(ctx, queue, tt.jobType, nil)
+			waitFor(t, "job to be dead lettered", func() bool { return queue.Len() == 0 })
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", got, tt.wantCalls)
+			}
+			dead, _ := queue.DeadLetters(ctx, 10)
+			if len(dead) != 1 {
+				t.Fatalf("got %d dead letters, want 1", len(dead))
+			}
+			if dead[0].LastError == "" {
+				t.Error("dead letter has no LastError")
+			}
+		})
+	}
+}
+
+func TestWorker_Concurrency(t *testing.T) {
+	queue := NewMemoryQueue()
+	worker := NewWorker(queue, testWorkerConfig())
+
+	var running, peak int32
+	worker.Register("slow", func(ctx context.Context, job *Job) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	stop := runWorker(worker)
+	defer stop()
+
+	for i := 0; i < 6; i++ {
+		Enqueue(context.Background(), queue, "slow", i)
+	}
+	waitFor(t, "jobs to be handled", func() bool { return queue.Len() == 0 })
+
+	if got := atomic.LoadInt32(&peak); got != 2 {
+		t.Errorf("peak concurrency = %d, want 2", got)
+	}
+}
+
+func TestWorker_DrainsOnStop(t *testing.T) {
+	queue := NewMemoryQueue()
+	worker := NewWorker(queue, testWorkerConfig())
+
+	started := make(chan struct{})
+	var finished int32
+	worker.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			atomic.StoreInt32(&finished, 1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	stop := runWorker(worker)
+
+	Enqueue(context.Background(), queue, "slow", nil)
+	<-started
+	stop()
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("job in flight was cut off instead of drained")
+	}
+	if queue.Len() != 0 {
+		t.Errorf("queue has %d jobs left, want the drained job acked", queue.Len())
+	}
+}
+
+func TestWorker_CancelsAfterDrainTimeout(t *testing.T) {
+	queue := NewMemoryQueue()
+	cfg := testWorkerConfig()
+	cfg.DrainTimeout = 10 * time.Millisecond
+	worker := NewWorker(queue, cfg)
+
+	started := make(chan struct{})
+	worker.Register("stuck", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	stop := runWorker(worker)
+
+	Enqueue(context.Background(), queue, "stuck", nil)
+	<-started
+	stop()
+
+	// the job is neither retried nor dead lettered, it is left in flight to
+	// be delivered again
+	dead, _ := queue.DeadLetters(context.Background(), 10)
+	if len(dead) != 0 {
+		t.Errorf("got %d dead letters, want none", len(dead))
+	}
+	if queue.Len() != 1 {
+		t.Errorf("queue has %d jobs, want the cancelled job still in flight", queue.Len())
+	}
+}
+
+func TestMemoryQueue_Retry(t *testing.T) {
+	queue := NewMemoryQueue()
+	ctx := context.Background()
+
+	Enqueue(ctx, queue, "later", nil)
+	job, err := queue.Dequeue(ctx, time.Millisecond)
+	if err != nil || job == nil {
+		t.Fatalf("Dequeue = %v, %v", job, err)
+	}
+
+	queue.Retry(ctx, job, time.Now().Add(30*time.Millisecond))
+	if job, _ := queue.Dequeue(ctx, time.Millisecond); job != nil {
+		t.Fatal("retried job was delivered before it was due")
+	}
+
+	job, err = queue.Dequeue(ctx, time.Second)
+	if err != nil || job == nil {
+		t.Fatalf("expected the retried job once due, got %v, %v", job, err)
+	}
+}
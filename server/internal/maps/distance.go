@@ -0,0 +1,14 @@
+package maps
+
+import "math"
+
+// DistanceMeters is the great circle distance between two points
+func DistanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371000
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -7,11 +7,27 @@ import (
 	"os"
 	"strings"
 
+	"github.com/google/uuid"
 	"googlemaps.github.io/maps"
 )
 
+// NearbyResultLimit is the most shops a nearby search returns
+const NearbyResultLimit = 10
+
+// NearbyReach is how far out Places looks for the shops nearest a point
+const NearbyReach = 50000
+
+// Nearby is what a search for the shops nearest a point found
+type Nearby struct {
+	Shops []*CoffeeShopDetails
+	// SweptMeters is how far from the point every shop Places knows of was
+	// returned
+	SweptMeters float64
+}
+
 type MapsClient struct {
 	client *maps.Client
+	usage  UsageFunc
 }
 
 func NewMapsClient() (*MapsClient, error) {
@@ -53,51 +69,107 @@ func (m *MapsClient) SearchCoffeeShops(ctx context.Context, lat, lng float64, ra
 		Keyword:  "coffee shop",
 	}
 
+	m.recordUsage(ctx, SKUNearbySearch)
 	response, err := m.client.NearbySearch(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for coffee shops: %w", err)
 	}
 
-	// Limit results to 10
-	maxResults := 10
-	if len(response.Results) > maxResults {
-		response.Results = response.Results[:maxResults]
+	// Limit results, each costs a details call
+	if len(response.Results) > NearbyResultLimit {
+		response.Results = response.Results[:NearbyResultLimit]
 	}
 
 	var results []*CoffeeShopDetails
 	for _, place := range response.Results {
-		// Get additional details for each place
-		detailsRequest := &maps.PlaceDetailsRequest{
-			PlaceID: place.PlaceID,
+		result, err := m.nearbyDetails(ctx, place)
+		if err != nil {
+			log.Printf("Warning: failed to get details for place %s: %v", place.Name, err)
+			continue
 		}
+		results = append(results, result)
+	}
 
-		details, err := m.client.PlaceDetails(ctx, detailsRequest)
+	return results, nil
+}
+
+// SearchNearestCoffeeShops searches for the coffee shops nearest the given
+// coordinates, nearest first, and how far out Places found all of them
+func (m *MapsClient) SearchNearestCoffeeShops(ctx context.Context, lat, lng float64) (*Nearby, error) {
+	request := &maps.NearbySearchRequest{
+		Location: &maps.LatLng{Lat: lat, Lng: lng},
+		RankBy:   maps.RankByDistance,
+		Type:     "cafe",
+		Keyword:  "coffee shop",
+	}
+
+	m.recordUsage(ctx, SKUNearbySearch)
+	response, err := m.client.NearbySearch(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for coffee shops: %w", err)
+	}
+
+	nearby := &Nearby{SweptMeters: sweptMeters(lat, lng, response.Results)}
+	// Limit results, each costs a details call
+	if len(response.Results) > NearbyResultLimit {
+		response.Results = response.Results[:NearbyResultLimit]
+	}
+
+	for _, place := range response.Results {
+		result, err := m.nearbyDetails(ctx, place)
 		if err != nil {
+			// the shops from this one out may be missing
 			log.Printf("Warning: failed to get details for place %s: %v", place.Name, err)
+			location := place.Geometry.Location
+			nearby.SweptMeters = min(nearby.SweptMeters, DistanceMeters(lat, lng, location.Lat, location.Lng))
 			continue
 		}
+		nearby.Shops = append(nearby.Shops, result)
+	}
 
-		result := &CoffeeShopDetails{
-			PlaceID:          details.PlaceID,
-			Name:             details.Name,
-			FormattedAddress: details.FormattedAddress,
-			Vicinity:         details.Vicinity,
-			Location:         details.Geometry.Location,
-			Rating:           details.Rating,
-			UserRatingsTotal: details.UserRatingsTotal,
-			PriceLevel:       details.PriceLevel,
-			Types:            details.Types,
-			Photos:           details.Photos,
-			OpeningHours:     details.OpeningHours,
-			Website:          details.Website,
-			FormattedPhone:   details.InternationalPhoneNumber,
-			BusinessStatus:   details.BusinessStatus,
-		}
+	return nearby, nil
+}
 
-		results = append(results, result)
+// sweptMeters is how far from a point a nearest first page of results has
+// every shop. A full page may have left out shops past its furthest one, a
+// shorter page has every shop Places reaches.
+func sweptMeters(lat, lng float64, page []maps.PlacesSearchResult) float64 {
+	if len(page) < NearbyResultLimit {
+		return NearbyReach
+	}
+	furthest := page[NearbyResultLimit-1].Geometry.Location
+	return DistanceMeters(lat, lng, furthest.Lat, furthest.Lng)
+}
+
+// nearbyDetails gets the details of a nearby search result
+func (m *MapsClient) nearbyDetails(ctx context.Context, place maps.PlacesSearchResult) (*CoffeeShopDetails, error) {
+	detailsRequest := &maps.PlaceDetailsRequest{
+		PlaceID: place.PlaceID,
 	}
 
-	return results, nil
+	m.recordUsage(ctx, SKUPlaceDetails)
+	details, err := m.client.PlaceDetails(ctx, detailsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CoffeeShopDetails{
+		PlaceID:          details.PlaceID,
+		Name:             details.Name,
+		FormattedAddress: details.FormattedAddress,
+		Vicinity:         details.Vicinity,
+		Location:         details.Geometry.Location,
+		Rating:           details.Rating,
+		UserRatingsTotal: details.UserRatingsTotal,
+		PriceLevel:       details.PriceLevel,
+		Types:            details.Types,
+		Photos:           details.Photos,
+		OpeningHours:     details.OpeningHours,
+		Website:          details.Website,
+		FormattedPhone:   details.InternationalPhoneNumber,
+		BusinessStatus:   details.BusinessStatus,
+		UTCOffset:        details.UTCOffset,
+	}, nil
 }
 
 // SearchSpecificCoffeeShop searches for a specific coffee shop by name and returns all matching locations
@@ -108,6 +180,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 		Types: maps.AutocompletePlaceTypeEstablishment,
 	}
 
+	m.recordUsage(ctx, SKUAutocomplete)
 	predictions, err := m.client.PlaceAutocomplete(ctx, autoCompleteRequest)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get autocomplete predictions: %w", err)
@@ -128,6 +201,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 					PlaceID: prediction.PlaceID,
 				}
 
+				m.recordUsage(ctx, SKUPlaceDetails)
 				details, err := m.client.PlaceDetails(ctx, detailsRequest)
 				if err != nil {
 					log.Printf("Warning: failed to get details for place %s: %v", prediction.Description, err)
@@ -155,6 +229,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 					Website:          details.Website,
 					FormattedPhone:   details.InternationalPhoneNumber,
 					BusinessStatus:   details.BusinessStatus,
+					UTCOffset:        details.UTCOffset,
 				}
 
 				results = append(results, result)
@@ -168,6 +243,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 		Query: query,
 	}
 
+	m.recordUsage(ctx, SKUTextSearch)
 	response, err := m.client.TextSearch(ctx, request)
 	if err != nil {
 		if len(results) > 0 {
@@ -196,6 +272,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 				PlaceID: place.PlaceID,
 			}
 
+			m.recordUsage(ctx, SKUPlaceDetails)
 			details, err := m.client.PlaceDetails(ctx, detailsRequest)
 			if err != nil {
 				log.Printf("Warning: failed to get details for place %s: %v", place.Name, err)
@@ -219,6 +296,7 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 				Website:          details.Website,
 				FormattedPhone:   details.InternationalPhoneNumber,
 				BusinessStatus:   details.BusinessStatus,
+				UTCOffset:        details.UTCOffset,
 			}
 
 			results = append(results, result)
@@ -226,27 +304,33 @@ func (m *MapsClient) SearchSpecificCoffeeShop(ctx context.Context, shopName stri
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no locations found for: %s in %s", shopName, location)
+		return nil, fmt.Errorf("%w for: %s in %s", ErrNoResults, shopName, location)
 	}
 
 	return results, nil
 }
 
-// SearchCoffeeShopsByArea searches for coffee shops or related places in a specific area using Text Search
-func (m *MapsClient) SearchCoffeeShopsByArea(ctx context.Context, query string) ([]*CoffeeShopDetails, error) {
+// SearchCoffeeShopsByArea searches for coffee shops or related places in a specific area using Text Search.
+// Results are preferred from bias when it is set, but can come from elsewhere.
+func (m *MapsClient) SearchCoffeeShopsByArea(ctx context.Context, query string, bias *Bias) ([]*CoffeeShopDetails, error) {
 	// Use the query directly instead of formatting it
 	request := &maps.TextSearchRequest{
 		Query: query,
 		Type:  "cafe",
 	}
+	if bias != nil {
+		request.Location = &bias.Location
+		request.Radius = bias.RadiusMeters
+	}
 
+	m.recordUsage(ctx, SKUTextSearch)
 	response, err := m.client.TextSearch(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for places: %w", err)
 	}
 
 	if len(response.Results) == 0 {
-		return nil, fmt.Errorf("no places found for query: %s", query)
+		return nil, fmt.Errorf("%w for query: %s", ErrNoResults, query)
 	}
 
 	// Limit results to 10
@@ -263,6 +347,7 @@ func (m *MapsClient) SearchCoffeeShopsByArea(ctx context.Context, query string)
 			PlaceID: place.PlaceID,
 		}
 
+		m.recordUsage(ctx, SKUPlaceDetails)
 		details, err := m.client.PlaceDetails(ctx, detailsRequest)
 		if err != nil {
 			log.Printf("Warning: failed to get details for place %s: %v", place.Name, err)
@@ -285,6 +370,7 @@ func (m *MapsClient) SearchCoffeeShopsByArea(ctx context.Context, query string)
 			Website:          details.Website,
 			FormattedPhone:   details.InternationalPhoneNumber,
 			BusinessStatus:   details.BusinessStatus,
+			UTCOffset:        details.UTCOffset,
 		}
 
 		results = append(results, result)
@@ -293,12 +379,76 @@ func (m *MapsClient) SearchCoffeeShopsByArea(ctx context.Context, query string)
 	return results, nil
 }
 
+// Autocomplete suggests places for partly typed text, near bias when it is
+// set. Requests sent with the same session token, from the first keystroke
+// until a place is picked, are one autocomplete session for billing. Google
+// still bills a session that ends without a place being fetched per request,
+// so each request is recorded.
+func (m *MapsClient) Autocomplete(ctx context.Context, input string, bias *Bias, session string) ([]Prediction, error) {
+	request := &maps.PlaceAutocompleteRequest{
+		Input: input,
+	}
+	if bias != nil {
+		location := bias.Location
+		request.Location = &location
+		request.Radius = bias.RadiusMeters
+	}
+	if session != "" {
+		token, err := uuid.Parse(session)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session token: %w", err)
+		}
+		request.SessionToken = maps.PlaceAutocompleteSessionToken(token)
+	}
+
+	m.recordUsage(ctx, SKUAutocomplete)
+	resp, err := m.client.PlaceAutocomplete(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get autocomplete predictions: %w", err)
+	}
+
+	predictions := make([]Prediction, len(resp.Predictions))
+	for i, prediction := range resp.Predictions {
+		predictions[i] = Prediction{
+			PlaceID:       prediction.PlaceID,
+			MainText:      prediction.StructuredFormatting.MainText,
+			SecondaryText: prediction.StructuredFormatting.SecondaryText,
+			Types:         prediction.Types,
+		}
+	}
+	return predictions, nil
+}
+
+// Geocode finds a named place, such as a neighborhood or city
+func (m *MapsClient) Geocode(ctx context.Context, address string) (*Area, error) {
+	m.recordUsage(ctx, SKUGeocoding)
+	resp, err := m.client.Geocode(ctx, &maps.GeocodingRequest{
+		Address: address,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to geocode: %w", err)
+	}
+
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%w for address: %s", ErrNoResults, address)
+	}
+
+	result := resp[0]
+	return &Area{
+		Name:      result.FormattedAddress,
+		Location:  result.Geometry.Location,
+		Northeast: result.Geometry.Viewport.NorthEast,
+		Southwest: result.Geometry.Viewport.SouthWest,
+	}, nil
+}
+
 func (m* MapsClient) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
 	location := &maps.LatLng{
 		Lat: lat,
 		Lng: lng,
 	}
 
+	m.recordUsage(ctx, SKUGeocoding)
 	resp, err := m.client.ReverseGeocode(ctx, &maps.GeocodingRequest{
 		LatLng: location,
 	})
@@ -308,7 +458,7 @@ func (m* MapsClient) ReverseGeocode(ctx context.Context, lat, lng float64) (stri
 	}
 
 	if len(resp) == 0 {
-		return "", fmt.Errorf("no results found for location: %f,%f", lat, lng)
+		return "", fmt.Errorf("%w for location: %f,%f", ErrNoResults, lat, lng)
 	}
 
 	// format the location string
@@ -333,3 +483,57 @@ func (m* MapsClient) ReverseGeocode(ctx context.Context, lat, lng float64) (stri
 	// fallback to formatted address if components not found
 	return resp[0].FormattedAddress, nil
 }
+
+// GetPlaceDetails fetches the current details of a single place
+func (m *MapsClient) GetPlaceDetails(ctx context.Context, placeID string) (*CoffeeShopDetails, error) {
+	return m.placeDetails(ctx, &maps.PlaceDetailsRequest{
+		PlaceID: placeID,
+	})
+}
+
+// GetSuggestedPlace fetches the details of a place picked from autocomplete
+// suggestions. Sent with the suggestions' session token it ends the session,
+// which is then billed as a whole rather than per keystroke.
+func (m *MapsClient) GetSuggestedPlace(ctx context.Context, placeID string, session string) (*CoffeeShopDetails, error) {
+	request := &maps.PlaceDetailsRequest{
+		PlaceID: placeID,
+	}
+	if session != "" {
+		token, err := uuid.Parse(session)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session token: %w", err)
+		}
+		request.SessionToken = maps.PlaceAutocompleteSessionToken(token)
+	}
+	return m.placeDetails(ctx, request)
+}
+
+func (m *MapsClient) placeDetails(ctx context.Context, request *maps.PlaceDetailsRequest) (*CoffeeShopDetails, error) {
+	m.recordUsage(ctx, SKUPlaceDetails)
+	details, err := m.client.PlaceDetails(ctx, request)
+	if err != nil {
+		// place IDs can go away, e.g. when a listing is removed
+		if strings.Contains(err.Error(), "NOT_FOUND") {
+			return nil, fmt.Errorf("%w for place: %s", ErrNoResults, request.PlaceID)
+		}
+		return nil, fmt.Errorf("failed to get place details: %w", err)
+	}
+
+	return &CoffeeShopDetails{
+		PlaceID:          details.PlaceID,
+		Name:             details.Name,
+		FormattedAddress: details.FormattedAddress,
+		Vicinity:         details.Vicinity,
+		Location:         details.Geometry.Location,
+		Rating:           details.Rating,
+		UserRatingsTotal: details.UserRatingsTotal,
+		PriceLevel:       details.PriceLevel,
+		Types:            details.Types,
+		Photos:           details.Photos,
+		OpeningHours:     details.OpeningHours,
+		Website:          details.Website,
+		FormattedPhone:   details.InternationalPhoneNumber,
+		BusinessStatus:   details.BusinessStatus,
+		UTCOffset:        details.UTCOffset,
+	}, nil
+}
@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"googlemaps.github.io/maps"
 )
 
 func init() {
@@ -332,7 +334,7 @@ func TestMapsClient_SearchCoffeeShopsByArea(t *testing.T) {
 			// Add a small delay between tests to avoid rate limiting
 			time.Sleep(time.Second)
 			
-			results, err := client.SearchCoffeeShopsByArea(ctx, tt.query)
+			results, err := client.SearchCoffeeShopsByArea(ctx, tt.query, nil)
 			
 			if tt.expectError {
 				if err == nil {
@@ -474,4 +476,127 @@ func TestMapsClient_ReverseGeocode(t *testing.T) {
 			t.Logf("Formatted address: %s", result)
 		})
 	}
-}
\ No newline at end of file
+}
+func TestMapsClient_Geocode(t *testing.T) {
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	if apiKey == "" {
+		t.Skip("Skipping test because GOOGLE_MAPS_API_KEY is not set")
+	}
+
+	client, err := NewMapsClient()
+	if err != nil {
+		t.Fatalf("Failed to create maps client: %v", err)
+	}
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		address   string
+		lat, lng  float64 // roughly where the area is
+		maxRadius float64 // how far its box may reach in meters
+	}{
+		{
+			name:      "neighborhood",
+			address:   "Little Tokyo, Los Angeles",
+			lat:       34.05,
+			lng:       -118.24,
+			maxRadius: 3000,
+		},
+		{
+			name:      "city",
+			address:   "Newport Beach, CA",
+			lat:       33.62,
+			lng:       -117.93,
+			maxRadius: 20000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(time.Second)
+
+			area, err := client.Geocode(ctx, tt.address)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if d := DistanceMeters(area.Location.Lat, area.Location.Lng, tt.lat, tt.lng); d > 5000 {
+				t.Errorf("%s geocoded to %+v, %.0fm from where it should be", tt.address, area.Location, d)
+			}
+			if r := area.RadiusMeters(); r <= 0 || r > tt.maxRadius {
+				t.Errorf("%s reaches %.0fm, want up to %.0fm", tt.address, r, tt.maxRadius)
+			}
+
+			t.Logf("Geocoded %s to %s at (%.4f, %.4f), %.0fm across", tt.address, area.Name, area.Location.Lat, area.Location.Lng, 2*area.RadiusMeters())
+		})
+	}
+}
+
+func TestMapsClient_Autocomplete(t *testing.T) {
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	if apiKey == "" {
+		t.Skip("Skipping test because GOOGLE_MAPS_API_KEY is not set")
+	}
+
+	client, err := NewMapsClient()
+	if err != nil {
+		t.Fatalf("Failed to create maps client: %v", err)
+	}
+
+	ctx := context.Background()
+	bias := &Bias{Location: maps.LatLng{Lat: 34.05, Lng: -118.24}, RadiusMeters: 10000}
+	session := uuid.NewString()
+
+	// keystrokes of one session
+	var picked string
+	for _, input := range []string{"Little Tok", "Little Toky"} {
+		predictions, err := client.Autocomplete(ctx, input, bias, session)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(predictions) == 0 {
+			t.Fatalf("no predictions for %q", input)
+		}
+		for _, prediction := range predictions {
+			if prediction.PlaceID == "" || prediction.MainText == "" {
+				t.Errorf("incomplete prediction %+v", prediction)
+			}
+			t.Logf("%q: %s, %s %v", input, prediction.MainText, prediction.SecondaryText, prediction.Types)
+		}
+		picked = predictions[0].PlaceID
+	}
+
+	// picking a suggestion ends the session
+	place, err := client.GetSuggestedPlace(ctx, picked, session)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if place.PlaceID != picked {
+		t.Errorf("got place %s, want %s", place.PlaceID, picked)
+	}
+
+	if _, err := client.Autocomplete(ctx, "Little Tok", bias, "not-a-uuid"); err == nil {
+		t.Error("expected an error for an invalid session token")
+	}
+	if _, err := client.GetSuggestedPlace(ctx, picked, "not-a-uuid"); err == nil {
+		t.Error("expected an error for an invalid session token")
+	}
+}
+
+func TestSweptMeters(t *testing.T) {
+	lat, lng := 33.6186, -117.9294
+	page := make([]maps.PlacesSearchResult, NearbyResultLimit)
+	for i := range page {
+		page[i].Geometry.Location = maps.LatLng{Lat: lat + float64(i)*0.001, Lng: lng}
+	}
+
+	// a full page only reaches its furthest shop
+	furthest := page[NearbyResultLimit-1].Geometry.Location
+	if got, want := sweptMeters(lat, lng, page), DistanceMeters(lat, lng, furthest.Lat, furthest.Lng); got != want {
+		t.Errorf("full page swept %.0fm, want %.0fm", got, want)
+	}
+	if got := sweptMeters(lat, lng, page[:3]); got != NearbyReach {
+		t.Errorf("short page swept %.0fm, want %dm", got, NearbyReach)
+	}
+}
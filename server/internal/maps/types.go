@@ -49,4 +49,37 @@ type CoffeeShopDetails struct {
 	Website          string
 	FormattedPhone   string
 	BusinessStatus   string
-}
\ No newline at end of file
+	// UTCOffset is how many minutes the place's time zone is ahead of UTC,
+	// nil if Places didn't say
+	UTCOffset *int
+}
+
+// Area is a named place found by geocoding
+type Area struct {
+	Name     string
+	Location maps.LatLng
+	// Northeast and Southwest are the corners of the box that frames it
+	Northeast maps.LatLng
+	Southwest maps.LatLng
+}
+
+// RadiusMeters is how far the area reaches from its center, to the corners
+// of its box
+func (a *Area) RadiusMeters() float64 {
+	return DistanceMeters(a.Location.Lat, a.Location.Lng, a.Northeast.Lat, a.Northeast.Lng)
+}
+
+// Bias is a circle search results are preferred from
+type Bias struct {
+	Location     maps.LatLng
+	RadiusMeters uint
+}
+
+// Prediction is a place Places suggests for partly typed text
+type Prediction struct {
+	PlaceID string
+	// MainText is the place's name, SecondaryText where it is
+	MainText      string
+	SecondaryText string
+	Types         []string
+}
@@ -0,0 +1,33 @@
+package maps
+
+import (
+	"context"
+	"errors"
+)
+
+// SKUs of the Google APIs the client calls, used for cost accounting
+const (
+	SKUNearbySearch = "places_nearby_search"
+	SKUTextSearch   = "places_text_search"
+	SKUPlaceDetails = "places_details"
+	SKUAutocomplete = "places_autocomplete"
+	SKUGeocoding    = "geocoding"
+)
+
+// ErrNoResults is returned when a search succeeded but found nothing, so it
+// isn't mistaken for the API failing
+var ErrNoResults = errors.New("no results found")
+
+// UsageFunc is called once per billable API request
+type UsageFunc func(ctx context.Context, sku string, units int)
+
+// SetUsageRecorder sets the function told about every billable request
+func (m *MapsClient) SetUsageRecorder(record UsageFunc) {
+	m.usage = record
+}
+
+func (m *MapsClient) recordUsage(ctx context.Context, sku string) {
+	if m.usage != nil {
+		m.usage(ctx, sku, 1)
+	}
+}
@@ -1,79 +1,91 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 
-	"github.com/johnnynu/Coffeehaus/internal/constants"
-	"github.com/supabase-community/auth-go"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
 )
 
+var errNoToken = errors.New("authorization header is missing")
+
 type AuthMiddleware struct {
-	client auth.Client
+	verifier *auth.Verifier
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware instance
-func NewAuthMiddleware(supabaseURL, supabaseKey string) *AuthMiddleware {
-	// Ensure URL is properly formatted
-	if !strings.HasPrefix(supabaseURL, "https://") {
-		supabaseURL = fmt.Sprintf("https://%s", supabaseURL)
-	}
-	// Remove any trailing slashes
-	supabaseURL = strings.TrimSuffix(supabaseURL, "/")
-
-	// Create auth client with custom auth URL
-	client := auth.New(supabaseURL, supabaseKey).WithCustomAuthURL(fmt.Sprintf("%s/auth/v1", supabaseURL))
-	log.Printf("Initializing auth middleware with URL: %s", supabaseURL)
-
-	return &AuthMiddleware{client: client}
+func NewAuthMiddleware(verifier *auth.Verifier) *AuthMiddleware {
+	return &AuthMiddleware{verifier: verifier}
 }
 
-// Authenticate middleware verifies the JWT token from the Authorization header
-func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
+// RequireAuth rejects requests without a valid access token and stores the
+// verified principal in the request context
+func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract JWT token
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			log.Println("Authorization header is missing")
-			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+		principal, err := am.authenticate(r)
+		if err != nil {
+			log.Printf("Authentication failed: %v", err)
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Get token from Authorization header
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" {
-			log.Println("Invalid token format")
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through but still authenticates
+// requests that carry a token. A token that fails verification is rejected
+// rather than ignored so clients know to refresh it.
+func (am *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := am.authenticate(r)
+		if errors.Is(err, errNoToken) {
+			next.ServeHTTP(w, r)
 			return
 		}
-
-		log.Printf("Attempting to verify token: %s...", token[:10])
-
-		// Create authenticated client with token
-		authedClient := am.client.WithToken(token)
-
-		// Get user data
-		user, err := authedClient.GetUser()
 		if err != nil {
-			log.Printf("Error getting user: %v", err)
+			log.Printf("Authentication failed: %v", err)
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Add user info to request context
-		ctx := context.WithValue(r.Context(), constants.UserKey, user)
-		
-		// Verify context was set correctly
-		if val := ctx.Value(constants.UserKey); val != nil {
-			log.Printf("Context value set successfully, type: %T", val)
-		} else {
-			log.Printf("Failed to set context value")
-		}
-		
-		// Call the next handler with the authenticated context
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 	})
 }
+
+// RequireRole only lets through principals with the given role. It must run
+// after RequireAuth.
+func (am *AuthMiddleware) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !principal.HasRole(role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate verifies the bearer token on the request
+func (am *AuthMiddleware) authenticate(r *http.Request) (*auth.Principal, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errNoToken
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" || token == authHeader {
+		return nil, errors.New("invalid token format")
+	}
+
+	return am.verifier.Verify(r.Context(), token)
+}
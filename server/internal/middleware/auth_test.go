@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+)
+
+const testSecret = "super-secret-jwt-token-with-at-least-32-characters"
+
+func newTestMiddleware(t *testing.T) *AuthMiddleware {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.VerifierConfig{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	return NewAuthMiddleware(verifier)
+}
+
+func bearer(t *testing.T, role string) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if role != "" {
+		claims["app_metadata"] = map[string]interface{}{"role": role}
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// echoPrincipal responds with the user ID in the context, or "anonymous"
+var echoPrincipal = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		w.Write([]byte(principal.UserID))
+		return
+	}
+	w.Write([]byte("anonymous"))
+})
+
+func TestAuthMiddleware(t *testing.T) {
+	am := newTestMiddleware(t)
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		authHeader string
+		wantStatus int
+		wantBody   string
+	}{
+		{"require auth with token", am.RequireAuth(echoPrincipal), bearer(t, ""), http.StatusOK, "user-1"},
+		{"require auth without token", am.RequireAuth(echoPrincipal), "", http.StatusUnauthorized, ""},
+		{"require auth malformed header", am.RequireAuth(echoPrincipal), "Token abc", http.StatusUnauthorized, ""},
+		{"optional auth anonymous", am.OptionalAuth(echoPrincipal), "", http.StatusOK, "anonymous"},
+		{"optional auth with token", am.OptionalAuth(echoPrincipal), bearer(t, ""), http.StatusOK, "user-1"},
+		{"optional auth bad token", am.OptionalAuth(echoPrincipal), "Bearer nope", http.StatusUnauthorized, ""},
+		{"require role admin", am.RequireAuth(am.RequireRole("admin")(echoPrincipal)), bearer(t, "admin"), http.StatusOK, "user-1"},
+		{"require role missing", am.RequireAuth(am.RequireRole("admin")(echoPrincipal)), bearer(t, ""), http.StatusForbidden, ""},
+		{"require role anonymous", am.RequireRole("admin")(echoPrincipal), "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+
+			tt.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package photos
+
+import (
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG, returning
+// 1 (no transform) when there is none or the data can't be parsed
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		size := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		// start of scan, no more metadata segments follow
+		if marker == 0xDA || size < 2 || pos+2+size > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation transforms img so it displays upright for the given EXIF
+// orientation value
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// orientations 5-8 swap width and height
+	rect := image.Rect(0, 0, w, h)
+	if orientation >= 5 {
+		rect = image.Rect(0, 0, h, w)
+	}
+
+	switch src := img.(type) {
+	case *image.NRGBA:
+		dst := image.NewNRGBA(rect)
+		orient(dst.Pix, dst.Stride, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, w, h, orientation)
+		return dst
+	case *image.RGBA:
+		dst := image.NewRGBA(rect)
+		orient(dst.Pix, dst.Stride, src.Pix[src.PixOffset(b.Min.X, b.Min.Y):], src.Stride, w, h, orientation)
+		return dst
+	default:
+		// decoded JPEGs are YCbCr, which draw converts in bulk
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+		return applyOrientation(rgba, orientation)
+	}
+}
+
+// orient copies the w x h pixels of src, 4 bytes each, to dst transformed for
+// orientation. Each source row is walked in order while the destination
+// offset moves by a fixed step per pixel and per row.
+func orient(dst []uint8, dstStride int, src []uint8, srcStride, w, h, orientation int) {
+	var origin, xStep, yStep int
+	switch orientation {
+	case 2: // mirrored horizontally
+		origin, xStep, yStep = (w-1)*4, -4, dstStride
+	case 3: // rotated 180
+		origin, xStep, yStep = (h-1)*dstStride+(w-1)*4, -4, -dstStride
+	case 4: // mirrored vertically
+		origin, xStep, yStep = (h-1)*dstStride, 4, -dstStride
+	case 5: // transposed
+		origin, xStep, yStep = 0, dstStride, 4
+	case 6: // rotated 90 clockwise
+		origin, xStep, yStep = (h-1)*4, dstStride, -4
+	case 7: // transversed
+		origin, xStep, yStep = (w-1)*dstStride+(h-1)*4, -dstStride, -4
+	case 8: // rotated 90 counter-clockwise
+		origin, xStep, yStep = (w-1)*dstStride, -dstStride, 4
+	}
+
+	for y := 0; y < h; y++ {
+		row := src[y*srcStride : y*srcStride+w*4]
+		d := origin + y*yStep
+		for x := 0; x < len(row); x += 4 {
+			copy(dst[d:d+4], row[x:x+4])
+			d += xStep
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package photos
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	phashSampleSize = 32
+	phashHashSize   = 8
+)
+
+// PerceptualHash returns a 64-bit DCT based perceptual hash of img as hex.
+// Visually similar images (re-encoded, resized, lightly edited) produce
+// hashes with a small Hamming distance, which lets us spot duplicate uploads.
+func PerceptualHash(img image.Image) string {
+	gray := image.NewGray(image.Rect(0, 0, phashSampleSize, phashSampleSize))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	pixels := make([][]float64, phashSampleSize)
+	for y := range pixels {
+		pixels[y] = make([]float64, phashSampleSize)
+		for x := range pixels[y] {
+			pixels[y][x] = float64(gray.GrayAt(x, y).Y)
+		}
+	}
+
+	coeffs := dct2D(pixels)
+
+	// keep the low frequencies, skipping the DC term which only carries
+	// overall brightness
+	low := make([]float64, 0, phashHashSize*phashHashSize)
+	for y := 0; y < phashHashSize; y++ {
+		for x := 0; x < phashHashSize; x++ {
+			low = append(low, coeffs[y][x])
+		}
+	}
+
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range low {
+		if c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+
+	return fmt.Sprintf("%016x", hash)
+}
+
+// HammingDistance returns the number of differing bits between two hashes
+// produced by PerceptualHash, or -1 if either can't be parsed
+func HammingDistance(a, b string) int {
+	var x, y uint64
+	if _, err := fmt.Sscanf(a, "%x", &x); err != nil {
+		return -1
+	}
+	if _, err := fmt.Sscanf(b, "%x", &y); err != nil {
+		return -1
+	}
+
+	diff := x ^ y
+	count := 0
+	for diff != 0 {
+		diff &= diff - 1
+		count++
+	}
+	return count
+}
+
+func dct2D(in [][]float64) [][]float64 {
+	n := len(in)
+
+	rows := make([][]float64, n)
+	for y := range in {
+		rows[y] = dct1D(in[y])
+	}
+
+	out := make([][]float64, n)
+	for y := range out {
+		out[y] = make([]float64, n)
+	}
+	col := make([]float64, n)
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			col[y] = rows[y][x]
+		}
+		transformed := dct1D(col)
+		for y := 0; y < n; y++ {
+			out[y][x] = transformed[y]
+		}
+	}
+
+	return out
+}
+
+func dct1D(in []float64) []float64 {
+	n := len(in)
+	out := make([]float64, n)
+	for k := 0; k < n; k++ {
+		var sum float64
+		for i, v := range in {
+			sum += v * math.Cos(math.Pi/float64(n)*(float64(i)+0.5)*float64(k))
+		}
+		out[k] = sum
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	// register the webp decoder alongside jpeg and png
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxUploadSize is the largest file accepted for upload
+	MaxUploadSize = 10 << 20
+	// maxPixels guards against decompression bombs that are small on disk
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrImageTooLarge   = errors.New("image is too large")
+)
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// extensions are the file extensions of the types versions are encoded as
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+}
+
+// Version describes one resized copy of an uploaded photo
+type Version struct {
+	Name    string
+	MaxSize int  // longest edge in pixels
+	Square  bool // center crop to a square before resizing
+}
+
+// Versions are generated for every upload and stored in photos.versions
+var Versions = []Version{
+	{Name: "thumbnail", MaxSize: 150, Square: true},
+	{Name: "medium", MaxSize: 640},
+	{Name: "full", MaxSize: 1600},
+}
+
+// ProcessedImage holds the encoded versions of an upload. Every version is
+// re-encoded from decoded pixels, so no EXIF data (GPS included) survives.
+// Versions are JPEGs unless the upload has transparency, which JPEG can't
+// hold, and then they are PNGs.
+type ProcessedImage struct {
+	Versions    map[string][]byte
+	ContentType string
+	Width       int
+	Height      int
+	PHash       string
+}
+
+// DetectType returns the content type of an upload if it is one we accept
+func DetectType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	return contentType, nil
+}
+
+// Process validates an uploaded image and generates all of its versions
+func Process(data []byte) (*ProcessedImage, error) {
+	if len(data) > MaxUploadSize {
+		return nil, ErrImageTooLarge
+	}
+
+	contentType, err := DetectType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// the orientation tag is lost with the rest of the EXIF data, so apply it
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	processed := &ProcessedImage{
+		Versions:    make(map[string][]byte, len(Versions)),
+		ContentType: "image/jpeg",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		PHash:       PerceptualHash(img),
+	}
+	if hasAlpha(img) {
+		processed.ContentType = "image/png"
+	}
+
+	for _, v := range Versions {
+		resized := resize(img, v)
+
+		var buf bytes.Buffer
+		if processed.ContentType == "image/png" {
+			err = png.Encode(&buf, resized)
+		} else {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s version: %w", v.Name, err)
+		}
+		processed.Versions[v.Name] = buf.Bytes()
+	}
+
+	return processed, nil
+}
+
+// hasAlpha reports whether img has any pixel that isn't fully opaque
+func hasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return true
+}
+
+// resize scales img so its longest edge is at most v.MaxSize, never upscaling
+func resize(img image.Image, v Version) image.Image {
+	src := img.Bounds()
+
+	if v.Square {
+		side := src.Dx()
+		if src.Dy() < side {
+			side = src.Dy()
+		}
+		x0 := src.Min.X + (src.Dx()-side)/2
+		y0 := src.Min.Y + (src.Dy()-side)/2
+		src = image.Rect(x0, y0, x0+side, y0+side)
+	}
+
+	w, h := src.Dx(), src.Dy()
+	if w > v.MaxSize || h > v.MaxSize {
+		if w >= h {
+			h = h * v.MaxSize / w
+			w = v.MaxSize
+		} else {
+			w = w * v.MaxSize / h
+			h = v.MaxSize
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
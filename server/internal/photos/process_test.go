@@ -0,0 +1,255 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage draws a horizontal gradient with a dark block in the top left so
+// orientation changes are detectable
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if x < w/4 && y < h/4 {
+				v = 0
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+// withExif inserts an APP1 segment carrying an orientation tag and a GPS IFD
+// pointer right after the JPEG SOI marker
+func withExif(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	// orientation, SHORT, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	// GPS IFD pointer, LONG, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x8825, 4})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPSLatitude 34.0522N")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("failed to encode test jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	data := withExif(t, encodeJPEG(t, testImage(2000, 1000)), 6)
+
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", got)
+	}
+
+	processed, err := Process(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// orientation 6 rotates the landscape source to portrait
+	if processed.Width != 1000 || processed.Height != 2000 {
+		t.Errorf("got %dx%d, want 1000x2000", processed.Width, processed.Height)
+	}
+
+	wantBounds := map[string]image.Point{
+		"thumbnail": {150, 150},
+		"medium":    {320, 640},
+		"full":      {800, 1600},
+	}
+
+	for name, want := range wantBounds {
+		encoded, ok := processed.Versions[name]
+		if !ok {
+			t.Errorf("missing %s version", name)
+			continue
+		}
+
+		if bytes.Contains(encoded, []byte("Exif")) || bytes.Contains(encoded, []byte("GPSLatitude")) {
+			t.Errorf("%s version still carries EXIF data", name)
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Errorf("failed to decode %s version: %v", name, err)
+			continue
+		}
+		if got := img.Bounds().Size(); got != want {
+			t.Errorf("%s version is %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestProcess_SmallImageIsNotUpscaled(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(100, 80)); err != nil {
+		t.Fatalf("failed to encode test png: %v", err)
+	}
+
+	processed, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(processed.Versions["full"]))
+	if err != nil {
+		t.Fatalf("failed to decode full version: %v", err)
+	}
+	if got := img.Bounds().Size(); got != (image.Point{100, 80}) {
+		t.Errorf("full version is %v, want 100x80", got)
+	}
+}
+
+func TestProcess_RejectsUnsupportedTypes(t *testing.T) {
+	_, err := Process([]byte("GIF89a not really a gif"))
+	if err == nil {
+		t.Fatal("expected error but got none")
+	}
+}
+
+func TestPerceptualHash(t *testing.T) {
+	original := testImage(800, 600)
+
+	// a re-encoded, downscaled copy should hash almost identically
+	reencoded, err := jpeg.Decode(bytes.NewReader(encodeJPEG(t, resize(original, Version{MaxSize: 200}))))
+	if err != nil {
+		t.Fatalf("failed to decode re-encoded image: %v", err)
+	}
+
+	// a different image should not
+	different := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 800; x++ {
+			v := uint8(y * 255 / 600)
+			if (x/100+y/100)%2 == 0 {
+				v = 255 - v
+			}
+			different.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	base := PerceptualHash(original)
+	if d := HammingDistance(base, PerceptualHash(reencoded)); d > 6 {
+		t.Errorf("re-encoded copy distance = %d, want <= 6", d)
+	}
+	if d := HammingDistance(base, PerceptualHash(different)); d < 16 {
+		t.Errorf("different image distance = %d, want >= 16", d)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// each orientation's upright pixel for the source pixel at x, y of a w x h
+	// image, as the EXIF spec defines them
+	upright := func(orientation, x, y, w, h int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return h - 1 - y, x
+		case 7:
+			return h - 1 - y, w - 1 - x
+		case 8:
+			return y, w - 1 - x
+		}
+		return x, y
+	}
+
+	// sub-images start away from the origin and have a stride wider than a row
+	rgba := testImage(9, 7).(*image.RGBA).SubImage(image.Rect(2, 1, 7, 4))
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 9, 7))
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 9; x++ {
+			nrgba.Set(x, y, color.NRGBA{R: uint8(x * 20), G: uint8(y * 30), B: 90, A: uint8(x*y*5 + 10)})
+		}
+	}
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 6, 4), image.YCbCrSubsampleRatio444)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 9)
+	}
+
+	for _, src := range []image.Image{rgba, nrgba.SubImage(image.Rect(1, 2, 8, 6)), ycbcr} {
+		b := src.Bounds()
+		for orientation := 1; orientation <= 8; orientation++ {
+			got := applyOrientation(src, orientation)
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					dx, dy := upright(orientation, x, y, b.Dx(), b.Dy())
+					want := color.RGBAModel.Convert(src.At(b.Min.X+x, b.Min.Y+y))
+					if c := color.RGBAModel.Convert(got.At(got.Bounds().Min.X+dx, got.Bounds().Min.Y+dy)); c != want {
+						t.Fatalf("%T orientation %d: pixel %d,%d = %v, want %v", src, orientation, x, y, c, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestProcess_KeepsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.NRGBA{R: 120, G: 80, B: 40, A: uint8(x)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode test png: %v", err)
+	}
+
+	processed, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if processed.ContentType != "image/png" {
+		t.Fatalf("ContentType = %q, want image/png", processed.ContentType)
+	}
+
+	full, err := png.Decode(bytes.NewReader(processed.Versions["full"]))
+	if err != nil {
+		t.Fatalf("failed to decode full version: %v", err)
+	}
+	if _, _, _, a := full.At(0, 50).RGBA(); a != 0 {
+		t.Errorf("left edge alpha = %d, want transparent", a)
+	}
+	if _, _, _, a := full.At(199, 50).RGBA(); a == 0 || a == 0xffff {
+		t.Errorf("right edge alpha = %d, want translucent", a)
+	}
+}
@@ -0,0 +1,104 @@
+package photos
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+)
+
+// Photo is a row of the photos table
+type Photo struct {
+	ID       string            `json:"id"`
+	UserID   string            `json:"user_id"`
+	Versions map[string]string `json:"versions"`
+	PHash    string            `json:"phash"`
+	Width    int               `json:"width"`
+	Height   int               `json:"height"`
+}
+
+// Service processes uploads and records them in the photos table
+type Service struct {
+	db      *database.Client
+	storage Storage
+}
+
+func NewService(db *database.Client, storage Storage) *Service {
+	return &Service{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Upload processes an uploaded image, stores every version and records the
+// photo. versions maps each version name to its URL, which is the shape the
+// profile query reads through photos!profile_photo_id(versions).
+func (s *Service) Upload(ctx context.Context, userID string, data []byte) (*Photo, error) {
+	processed, err := Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	photo := &Photo{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		Versions: make(map[string]string, len(processed.Versions)),
+		PHash:    processed.PHash,
+		Width:    processed.Width,
+		Height:   processed.Height,
+	}
+
+	var stored []string
+	for name, encoded := range processed.Versions {
+		key := fmt.Sprintf("%s/%s/%s.%s", userID, photo.ID, name, extensions[processed.ContentType])
+		url, err := s.storage.Put(ctx, key, encoded, processed.ContentType)
+		if err != nil {
+			s.cleanup(ctx, stored)
+			return nil, fmt.Errorf("failed to store %s version: %w", name, err)
+		}
+		stored = append(stored, key)
+		photo.Versions[name] = url
+	}
+
+	photoData := map[string]interface{}{
+		"id":       photo.ID,
+		"user_id":  photo.UserID,
+		"versions": photo.Versions,
+		"phash":    photo.PHash,
+		"width":    photo.Width,
+		"height":   photo.Height,
+		"position": 0,
+	}
+
+	if _, _, err := s.db.From("photos").Insert(photoData, false, "", "minimal", "").Execute(); err != nil {
+		s.cleanup(ctx, stored)
+		return nil, fmt.Errorf("failed to record photo: %w", err)
+	}
+
+	return photo, nil
+}
+
+// SetProfilePhoto makes the photo the user's profile photo
+func (s *Service) SetProfilePhoto(ctx context.Context, userID string, photoID string) error {
+	_ = ctx
+
+	_, _, err := s.db.From("users").
+		Update(map[string]interface{}{"profile_photo_id": photoID}, "minimal", "").
+		Eq("id", userID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to set profile photo: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) cleanup(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("Warning: failed to clean up stored photo %s: %v", key, err)
+		}
+	}
+}
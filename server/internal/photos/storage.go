@@ -0,0 +1,152 @@
+package photos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage persists encoded photo versions and returns the URL they are
+// served from
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStorage writes photos to a directory on disk, for development. The
+// directory is expected to be served at baseURL.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir string, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (l *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	_ = ctx
+	_ = contentType
+
+	path, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create photo directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write photo: %w", err)
+	}
+
+	return l.baseURL + "/" + key, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	_ = ctx
+
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete photo: %w", err)
+	}
+	return nil
+}
+
+// path maps a key to a file under dir, rejecting keys that would escape it
+func (l *LocalStorage) path(key string) (string, error) {
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(l.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key: %s", key)
+	}
+	return path, nil
+}
+
+// SupabaseStorage stores photos in a public Supabase Storage bucket
+type SupabaseStorage struct {
+	url        string
+	key        string
+	bucket     string
+	httpClient *http.Client
+}
+
+func NewSupabaseStorage(supabaseURL, serviceKey, bucket string) *SupabaseStorage {
+	if !strings.HasPrefix(supabaseURL, "https://") && !strings.HasPrefix(supabaseURL, "http://") {
+		supabaseURL = fmt.Sprintf("https://%s", supabaseURL)
+	}
+
+	return &SupabaseStorage{
+		url:        strings.TrimSuffix(supabaseURL, "/"),
+		key:        serviceKey,
+		bucket:     bucket,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *SupabaseStorage) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	endpoint := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	req.Header.Set("apikey", s.key)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", "max-age=31536000")
+	req.Header.Set("x-upsert", "true")
+
+	if err := s.do(req); err != nil {
+		return "", fmt.Errorf("failed to upload photo: %w", err)
+	}
+
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.url, s.bucket, key), nil
+}
+
+func (s *SupabaseStorage) Delete(ctx context.Context, key string) error {
+	endpoint := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	req.Header.Set("apikey", s.key)
+
+	if err := s.do(req); err != nil {
+		return fmt.Errorf("failed to delete photo: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) do(req *http.Request) error {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package profanity rejects text containing words from a block list. Words
+// are matched whole after folding case, compatibility characters and common
+// letter substitutions, so "Sh1t" matches "shit" but "Scunthorpe" is fine.
+package profanity
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultWords are rejected by Default. Deployments add their own with
+// PROFANITY_WORDS.
+var defaultWords = []string{
+	"arse", "arsehole", "asshole", "bastard", "bitch", "bollocks", "bullshit",
+	"cock", "cocksucker", "cunt", "dick", "dickhead", "fag", "faggot", "fuck",
+	"fucker", "fucking", "motherfucker", "nigga", "nigger", "piss", "prick",
+	"pussy", "retard", "shit", "shitty", "slut", "twat", "wanker", "whore",
+}
+
+// substitutions undo the digits and symbols used to dodge a word list
+var substitutions = strings.NewReplacer(
+	"0", "o",
+	"1", "i",
+	"3", "e",
+	"4", "a",
+	"5", "s",
+	"7", "t",
+	"@", "a",
+	"$", "s",
+)
+
+// Checker reports whether text contains a blocked word
+type Checker struct {
+	words map[string]bool
+}
+
+// New returns a checker blocking words
+func New(words ...string) *Checker {
+	c := &Checker{words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		if word = fold(word); word != "" {
+			c.words[word] = true
+		}
+	}
+	return c
+}
+
+// Default returns a checker blocking a built in list of English profanity
+// and slurs, and extra
+func Default(extra ...string) *Checker {
+	return New(append(append([]string{}, defaultWords...), extra...)...)
+}
+
+// Contains reports whether any word of text is blocked
+func (c *Checker) Contains(text string) bool {
+	for _, word := range strings.FieldsFunc(fold(text), isSeparator) {
+		if c.words[word] {
+			return true
+		}
+	}
+	return false
+}
+
+func fold(text string) string {
+	return substitutions.Replace(strings.ToLower(norm.NFKC.String(text)))
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r)
+}
@@ -0,0 +1,30 @@
+package profanity
+
+import "testing"
+
+func TestChecker_Contains(t *testing.T) {
+	checker := Default("latte")
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "Espresso enthusiast", want: false},
+		{text: "what the fuck", want: true},
+		{text: "SHIT coffee", want: true},
+		{text: "sh1t coffee", want: true},
+		{text: "fullwidth ｓｈｉｔ", want: true},
+		{text: "Scunthorpe roasters", want: false},
+		{text: "cocktail bar", want: false},
+		{text: "oat latte", want: true},
+		{text: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := checker.Contains(tt.text); got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+)
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the rate limit identity
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the rate limit identity stored in ctx
+func IdentityFrom(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok && identity != ""
+}
+
+// Identify returns the key a request is limited under: the user ID for
+// authenticated requests, otherwise the client IP
+func Identify(r *http.Request, trustedProxies []*net.IPNet) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return "user:" + principal.UserID
+	}
+	return "ip:" + ClientIP(r, trustedProxies)
+}
+
+// ClientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only believed when the request came from a
+// trusted proxy, and is walked right to left past any further trusted proxies
+// so a client can't spoof its address by sending the header itself.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	if !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed entry means we can't trust anything before it
+			break
+		}
+		if !isTrusted(hop, trustedProxies) {
+			return hop
+		}
+		remote = hop
+	}
+
+	return remote
+}
+
+func isTrusted(addr string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
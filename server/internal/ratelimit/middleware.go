@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware identifies the caller, stores the identity in the request
+// context for later Check calls and takes a token for each policy. It must
+// run after the auth middleware so users are limited by ID rather than IP.
+func (l *Limiter) Middleware(trustedProxies []*net.IPNet, policies ...Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := Identify(r, trustedProxies)
+			ctx := WithIdentity(r.Context(), identity)
+
+			for _, policy := range policies {
+				err := l.Take(ctx, policy, identity)
+				if limitErr, ok := IsLimited(err); ok {
+					WriteLimited(w, limitErr)
+					return
+				}
+				if err != nil {
+					// fail open, an unavailable redis shouldn't take search down
+					log.Printf("Failed to check rate limit %s: %v", policy.Name, err)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WriteLimited responds with 429 and a Retry-After header in whole seconds
+func WriteLimited(w http.ResponseWriter, err *LimitError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests, retry after "+(time.Duration(seconds)*time.Second).String(), http.StatusTooManyRequests)
+}
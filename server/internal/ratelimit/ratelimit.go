@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+// Policy is a token bucket budget. Each identity gets Burst tokens up front
+// which refill at PerMinute.
+type Policy struct {
+	Name      string
+	PerMinute float64
+	Burst     int
+}
+
+// LimitError is returned when an identity has used up a policy's budget
+type LimitError struct {
+	Policy     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s, retry after %s", e.Policy, e.RetryAfter)
+}
+
+// IsLimited reports whether err is, or wraps, a *LimitError and returns it
+func IsLimited(err error) (*LimitError, bool) {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr, true
+	}
+	return nil, false
+}
+
+// Limiter enforces policies per identity. Buckets live in redis so limits
+// hold across replicas.
+type Limiter struct {
+	redis   *redis.RedisClient
+	breaker *breaker.Breaker
+}
+
+func NewLimiter(redis *redis.RedisClient) *Limiter {
+	return &Limiter{redis: redis}
+}
+
+// SetBreaker sets the breaker buckets are taken from through, so requests
+// aren't held up by a hung redis
+func (l *Limiter) SetBreaker(b *breaker.Breaker) {
+	l.breaker = b
+}
+
+// Take takes one token from the identity's bucket for the policy, returning a
+// *LimitError when the bucket is empty
+func (l *Limiter) Take(ctx context.Context, policy Policy, identity string) error {
+	var res *redis.TokenBucketResult
+	take := func(ctx context.Context) error {
+		var err error
+		res, err = l.redis.TakeTokens(ctx, policy.Name+":"+identity, policy.PerMinute/60, policy.Burst, 1)
+		return err
+	}
+
+	var err error
+	if l.breaker == nil {
+		err = take(ctx)
+	} else {
+		err = l.breaker.Do(ctx, take)
+	}
+	if err != nil {
+		return err
+	}
+	if !res.Allowed {
+		return &LimitError{Policy: policy.Name, RetryAfter: res.RetryAfter}
+	}
+	return nil
+}
+
+// Check takes a token for the identity stored in ctx by Middleware. Requests
+// that didn't pass through the middleware aren't limited. Like Middleware it
+// fails open, so only a *LimitError is returned.
+func (l *Limiter) Check(ctx context.Context, policy Policy) error {
+	identity, ok := IdentityFrom(ctx)
+	if !ok {
+		return nil
+	}
+	err := l.Take(ctx, policy, identity)
+	if _, limited := IsLimited(err); err != nil && !limited {
+		log.Printf("Failed to check rate limit %s: %v", policy.Name, err)
+		return nil
+	}
+	return err
+}
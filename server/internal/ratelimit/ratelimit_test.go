@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/johnnynu/Coffeehaus/internal/auth"
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+	return NewLimiter(client), mr
+}
+
+func TestTake(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+	ctx := context.Background()
+	policy := Policy{Name: "test", PerMinute: 60, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.Take(ctx, policy, "ip:1.2.3.4"); err != nil {
+			t.Fatalf("take %d: unexpected error: %v", i, err)
+		}
+	}
+
+	err := limiter.Take(ctx, policy, "ip:1.2.3.4")
+	limitErr, ok := IsLimited(err)
+	if !ok {
+		t.Fatalf("expected a limit error after the burst, got %v", err)
+	}
+	if limitErr.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %s, want 1s", limitErr.RetryAfter)
+	}
+
+	// other identities have their own bucket
+	if err := limiter.Take(ctx, policy, "ip:5.6.7.8"); err != nil {
+		t.Errorf("unexpected error for another identity: %v", err)
+	}
+
+	// and so do other policies
+	if err := limiter.Take(ctx, Policy{Name: "other", PerMinute: 60, Burst: 1}, "ip:1.2.3.4"); err != nil {
+		t.Errorf("unexpected error for another policy: %v", err)
+	}
+
+	// one token refills per second
+	mr.SetTime(time.Date(2024, 1, 1, 12, 0, 1, 0, time.UTC))
+	if err := limiter.Take(ctx, policy, "ip:1.2.3.4"); err != nil {
+		t.Errorf("unexpected error after refill: %v", err)
+	}
+	if _, ok := IsLimited(limiter.Take(ctx, policy, "ip:1.2.3.4")); !ok {
+		t.Error("expected only one token to have refilled")
+	}
+}
+
+func TestCheckWithoutIdentity(t *testing.T) {
+	limiter, _ := newTestLimiter(t)
+	policy := Policy{Name: "test", PerMinute: 1, Burst: 1}
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.Check(context.Background(), policy); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	ctx := WithIdentity(context.Background(), "user:1")
+	if err := limiter.Check(ctx, policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := IsLimited(limiter.Check(ctx, policy)); !ok {
+		t.Error("expected the identity in the context to be limited")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, _ := newTestLimiter(t)
+	policy := Policy{Name: "search", PerMinute: 6, Burst: 1}
+
+	var gotIdentity string
+	handler := limiter.Middleware(nil, policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIdentity, _ = IdentityFrom(r.Context())
+	}))
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	anon := httptest.NewRequest(http.MethodGet, "/search", nil)
+	anon.RemoteAddr = "203.0.113.7:5555"
+	if rec := serve(anon); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if gotIdentity != "ip:203.0.113.7" {
+		t.Errorf("identity = %q, want ip:203.0.113.7", gotIdentity)
+	}
+
+	rec := serve(anon)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Retry-After = %q, want 10", got)
+	}
+
+	// a logged in user on the same address has their own budget
+	user := anon.WithContext(auth.WithPrincipal(anon.Context(), &auth.Principal{UserID: "user-1"}))
+	if rec := serve(user); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if gotIdentity != "user:user-1" {
+		t.Errorf("identity = %q, want user:user-1", gotIdentity)
+	}
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+	mr.Close()
+
+	called := false
+	handler := limiter.Middleware(nil, Policy{Name: "search", PerMinute: 1, Burst: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search", nil))
+	if !called || rec.Code != http.StatusOK {
+		t.Errorf("expected the request through when redis is down, status = %d", rec.Code)
+	}
+}
+
+func TestCheckFailsOpen(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+	mr.Close()
+
+	ctx := WithIdentity(context.Background(), "user:1")
+	if err := limiter.Check(ctx, Policy{Name: "places", PerMinute: 1, Burst: 1}); err != nil {
+		t.Errorf("Check() = %v, want nil when redis is down", err)
+	}
+}
+
+func TestTakeHungRedis(t *testing.T) {
+	limiter, mr := newTestLimiter(t)
+	redisBreaker := breaker.New("redis", breaker.Consecutive(2, time.Minute, 50*time.Millisecond))
+	limiter.SetBreaker(redisBreaker)
+
+	// redis takes every command and never answers
+	hung := make(chan struct{})
+	mr.Server().SetPreHook(func(*server.Peer, string, ...string) bool {
+		<-hung
+		return false
+	})
+	t.Cleanup(func() { close(hung) })
+
+	ctx := WithIdentity(context.Background(), "user:1")
+	policy := Policy{Name: "places", PerMinute: 1, Burst: 1}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := limiter.Check(ctx, policy); err != nil {
+			t.Fatalf("Check() = %v, want nil while redis is hung", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("checks took %s, want the breaker to stop waiting on redis", elapsed)
+	}
+	if state := redisBreaker.State(); state != breaker.Open {
+		t.Errorf("redis breaker %s, want open", state)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		trusted      []*net.IPNet
+		want         string
+	}{
+		{"direct", "203.0.113.7:1234", "", trusted, "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:1234", "1.1.1.1", trusted, "203.0.113.7"},
+		{"single trusted proxy", "10.0.0.2:1234", "198.51.100.9", trusted, "198.51.100.9"},
+		{"client prepends a fake hop", "10.0.0.2:1234", "1.1.1.1, 198.51.100.9", trusted, "198.51.100.9"},
+		{"proxy chain", "10.0.0.2:1234", "198.51.100.9, 10.0.0.5", trusted, "198.51.100.9"},
+		{"all hops trusted", "10.0.0.2:1234", "10.0.0.5", trusted, "10.0.0.5"},
+		{"malformed hop", "10.0.0.2:1234", "198.51.100.9, garbage", trusted, "10.0.0.2"},
+		{"no trusted proxies", "10.0.0.2:1234", "198.51.100.9", nil, "10.0.0.2"},
+		{"ipv6", "[2001:db8::1]:1234", "", trusted, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := ClientIP(r, tt.trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/cache"
+	redisClient "github.com/redis/go-redis/v9"
+)
+
+const cacheKeyPrefix = "cache:"
+
+// CacheGet returns a cached value, or cache.ErrMiss
+func (r *RedisClient) CacheGet(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, cacheKeyPrefix+key).Bytes()
+	if errors.Is(err, redisClient.Nil) {
+		return nil, cache.ErrMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// CacheSet caches a value for ttl
+func (r *RedisClient) CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, cacheKeyPrefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache %s: %w", key, err)
+	}
+	return nil
+}
+
+// CacheDelete drops cached values
+func (r *RedisClient) CacheDelete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = cacheKeyPrefix + key
+	}
+	if err := r.client.Del(ctx, prefixed...).Err(); err != nil {
+		return fmt.Errorf("failed to delete cached %v: %w", keys, err)
+	}
+	return nil
+}
+
+// Ping checks redis can be reached
+func (r *RedisClient) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const indexStateKeyPrefix = "index:"
+
+// searchIndex is a versioned RediSearch index. Queries go through its alias,
+// so a new version can be built next to the old one and swapped in.
+type searchIndex struct {
+	alias   string
+	prefix  string
+	version int
+	schema  []*redis.FieldSchema
+	// added maps a version to the fields it added, by alias. FT.ALTER can add
+	// them to an index built by an older version, any other change to the
+	// schema needs a reindex.
+	added map[int][]string
+}
+
+// indexState is the physical index an alias points at and the schema
+// version it was built or altered to
+type indexState struct {
+	index   string
+	version int
+}
+
+// indexAction is what bringing an index up to date takes
+type indexAction int
+
+const (
+	indexCurrent indexAction = iota
+	indexAlter
+	indexRebuild
+	// indexNewer is left alone, a newer build already migrated it
+	indexNewer
+)
+
+// plan works out how to bring the index described by state up to idx's
+// version. existing holds the names of every index in redis.
+func (idx searchIndex) plan(state indexState, existing map[string]bool) indexAction {
+	switch {
+	case state.index == "" || !existing[state.index]:
+		return indexRebuild
+	case state.version == idx.version:
+		return indexCurrent
+	case state.version > idx.version:
+		return indexNewer
+	}
+
+	for v := state.version + 1; v <= idx.version; v++ {
+		if _, ok := idx.added[v]; !ok {
+			return indexRebuild
+		}
+	}
+	return indexAlter
+}
+
+// name is the physical index built for this version
+func (idx searchIndex) name() string {
+	return fmt.Sprintf("%s_v%d", idx.alias, idx.version)
+}
+
+// addedSince returns the schema fields added after version
+func (idx searchIndex) addedSince(version int) []*redis.FieldSchema {
+	added := make(map[string]bool)
+	for v := version + 1; v <= idx.version; v++ {
+		for _, field := range idx.added[v] {
+			added[field] = true
+		}
+	}
+
+	var fields []*redis.FieldSchema
+	for _, field := range idx.schema {
+		if added[field.As] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ensureIndex creates idx or migrates an older version of it. It is safe to
+// call on every boot, replicas starting together leave it to whichever takes
+// the lock first.
+func (r *RedisClient) ensureIndex(ctx context.Context, idx searchIndex) error {
+	lock, err := r.TryLock(ctx, "index:"+idx.alias, time.Minute)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		log.Printf("Index %s is being migrated by another instance", idx.alias)
+		return nil
+	}
+	defer lock.Release(ctx)
+
+	state, err := r.indexState(ctx, idx.alias)
+	if err != nil {
+		return err
+	}
+	names, err := r.client.FT_List(ctx).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	switch idx.plan(state, existing) {
+	case indexCurrent:
+		return r.client.FTAliasUpdate(ctx, state.index, idx.alias).Err()
+	case indexNewer:
+		log.Printf("Index %s is at version %d, newer than %d", idx.alias, state.version, idx.version)
+		return nil
+	case indexAlter:
+		return r.alterIndex(ctx, idx, state)
+	default:
+		return r.rebuildIndex(ctx, idx, state, existing)
+	}
+}
+
+// alterIndex adds the fields of newer versions to the existing index
+func (r *RedisClient) alterIndex(ctx context.Context, idx searchIndex, state indexState) error {
+	for _, field := range idx.addedSince(state.version) {
+		if err := r.client.FTAlter(ctx, state.index, false, fieldArgs(field)).Err(); err != nil {
+			return fmt.Errorf("failed to add %s to index %s: %w", field.As, state.index, err)
+		}
+	}
+
+	if err := r.setIndexState(ctx, idx.alias, indexState{index: state.index, version: idx.version}); err != nil {
+		return err
+	}
+	log.Printf("Altered index %s from version %d to %d", state.index, state.version, idx.version)
+	return nil
+}
+
+// rebuildIndex builds a new index for this version and points the alias at
+// it. Documents are indexed by prefix so none have to be rewritten, but
+// searches only see all of them once the scan is done.
+func (r *RedisClient) rebuildIndex(ctx context.Context, idx searchIndex, state indexState, existing map[string]bool) error {
+	name := idx.name()
+	if !existing[name] {
+		err := r.client.FTCreate(ctx, name, &redis.FTCreateOptions{
+			OnJSON: true,
+			Prefix: []interface{}{idx.prefix},
+		}, idx.schema...).Err()
+		if err != nil {
+			return fmt.Errorf("failed to create index %s: %w", name, err)
+		}
+	}
+
+	// indexes from before versioning were named after what is now the alias
+	if existing[idx.alias] {
+		if err := r.client.FTDropIndex(ctx, idx.alias).Err(); err != nil {
+			return fmt.Errorf("failed to drop unversioned index %s: %w", idx.alias, err)
+		}
+	}
+
+	if err := r.client.FTAliasUpdate(ctx, name, idx.alias).Err(); err != nil {
+		return fmt.Errorf("failed to point %s at %s: %w", idx.alias, name, err)
+	}
+	if err := r.setIndexState(ctx, idx.alias, indexState{index: name, version: idx.version}); err != nil {
+		return err
+	}
+
+	// documents are shared with the new index, only the old index goes
+	if state.index != "" && state.index != name && existing[state.index] {
+		if err := r.client.FTDropIndex(ctx, state.index).Err(); err != nil {
+			log.Printf("Failed to drop old index %s: %v", state.index, err)
+		}
+	}
+
+	log.Printf("Built index %s for %s", name, idx.alias)
+	return nil
+}
+
+func (r *RedisClient) indexState(ctx context.Context, alias string) (indexState, error) {
+	values, err := r.client.HGetAll(ctx, indexStateKeyPrefix+alias).Result()
+	if err != nil {
+		return indexState{}, fmt.Errorf("failed to get index state: %w", err)
+	}
+
+	state := indexState{index: values["index"]}
+	if v, ok := values["version"]; ok {
+		if state.version, err = strconv.Atoi(v); err != nil {
+			return indexState{}, fmt.Errorf("invalid version %q for index %s", v, alias)
+		}
+	}
+	return state, nil
+}
+
+func (r *RedisClient) setIndexState(ctx context.Context, alias string, state indexState) error {
+	err := r.client.HSet(ctx, indexStateKeyPrefix+alias, "index", state.index, "version", state.version).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save index state: %w", err)
+	}
+	return nil
+}
+
+// fieldArgs is a schema field as FT.ALTER takes it. It covers the options
+// our schemas use.
+func fieldArgs(field *redis.FieldSchema) []interface{} {
+	args := []interface{}{field.FieldName}
+	if field.As != "" {
+		args = append(args, "AS", field.As)
+	}
+	args = append(args, field.FieldType.String())
+	if field.Weight > 0 {
+		args = append(args, "WEIGHT", field.Weight)
+	}
+	if field.Sortable {
+		args = append(args, "SORTABLE")
+	}
+	return args
+}
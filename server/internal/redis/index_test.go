@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestIndexPlan(t *testing.T) {
+	idx := searchIndex{
+		alias:   "shopIdx",
+		version: 4,
+		// 2 changed a field's type, 3 and 4 only added fields
+		added: map[int][]string{3: {"types"}, 4: {"hours"}},
+	}
+	existing := map[string]bool{"shopIdx_v2": true, "shopIdx_v4": true}
+
+	tests := []struct {
+		name  string
+		state indexState
+		want  indexAction
+	}{
+		{"never built", indexState{}, indexRebuild},
+		{"index was dropped", indexState{index: "shopIdx_v1", version: 1}, indexRebuild},
+		{"up to date", indexState{index: "shopIdx_v4", version: 4}, indexCurrent},
+		{"only fields added since", indexState{index: "shopIdx_v2", version: 2}, indexAlter},
+		{"a field changed since", indexState{index: "shopIdx_v2", version: 1}, indexRebuild},
+		{"newer build migrated it", indexState{index: "shopIdx_v4", version: 5}, indexNewer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idx.plan(tt.state, existing); got != tt.want {
+				t.Errorf("plan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexAddedSince(t *testing.T) {
+	name := &redis.FieldSchema{FieldName: "$.name", As: "name", FieldType: redis.SearchFieldTypeText}
+	types := &redis.FieldSchema{FieldName: "$.types[*]", As: "types", FieldType: redis.SearchFieldTypeTag}
+	rating := &redis.FieldSchema{FieldName: "$.rating", As: "rating", FieldType: redis.SearchFieldTypeNumeric, Sortable: true}
+
+	idx := searchIndex{
+		version: 3,
+		schema:  []*redis.FieldSchema{name, types, rating},
+		added:   map[int][]string{2: {"types"}, 3: {"rating"}},
+	}
+
+	if got := idx.addedSince(1); !reflect.DeepEqual(got, []*redis.FieldSchema{types, rating}) {
+		t.Errorf("addedSince(1) = %v", got)
+	}
+	if got := idx.addedSince(2); !reflect.DeepEqual(got, []*redis.FieldSchema{rating}) {
+		t.Errorf("addedSince(2) = %v", got)
+	}
+	if got := idx.addedSince(3); len(got) != 0 {
+		t.Errorf("addedSince(3) = %v, want none", got)
+	}
+
+	want := []interface{}{"$.rating", "AS", "rating", "NUMERIC", "SORTABLE"}
+	if got := fieldArgs(rating); !reflect.DeepEqual(got, want) {
+		t.Errorf("fieldArgs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,273 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+	"github.com/redis/go-redis/v9"
+)
+
+// job keys share the {jobs} hash tag, so scripts and transactions spanning
+// them run on one node in cluster mode
+const (
+	jobStreamKey  = "{jobs}:stream"
+	jobDelayedKey = "{jobs}:delayed"
+	jobDeadKey    = "{jobs}:dead"
+	jobGroup      = "workers"
+
+	// only the most recent dead letters are kept
+	maxDeadLetters = 1000
+	// how many due retries are moved back onto the stream per dequeue
+	promoteBatch = 100
+)
+
+// promoteJobsScript moves retries that have come due from the delayed set
+// back onto the stream
+var promoteJobsScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, job in ipairs(due) do
+	redis.call('XADD', KEYS[2], '*', 'job', job)
+	redis.call('ZREM', KEYS[1], job)
+end
+return #due
+`)
+
+// JobQueue is a jobs.Queue on a redis stream read by a consumer group, so
+// jobs survive restarts and each is delivered to one worker at a time.
+// Deliveries that aren't acked within the visibility timeout, e.g. because
+// the worker died, are claimed by the next worker to dequeue.
+type JobQueue struct {
+	client     *RedisClient
+	consumer   string
+	visibility time.Duration
+}
+
+// JobQueue creates the worker group if needed and returns a queue that reads
+// as a new consumer in it. Consumers left by workers that died are removed.
+func (r *RedisClient) JobQueue(ctx context.Context, visibility time.Duration) (*JobQueue, error) {
+	err := r.client.XGroupCreateMkStream(ctx, jobStreamKey, jobGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create job group: %w", err)
+	}
+
+	q := &JobQueue{
+		client:     r,
+		consumer:   uuid.NewString(),
+		visibility: visibility,
+	}
+	if err := q.removeIdleConsumers(ctx); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close removes the queue's consumer from the group. A consumer still holding
+// jobs is left for them to be claimed, removing it would drop them.
+func (q *JobQueue) Close(ctx context.Context) error {
+	pending, err := q.client.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   jobStreamKey,
+		Group:    jobGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    1,
+		Consumer: q.consumer,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to get pending jobs: %w", err)
+	}
+	if len(pending) > 0 {
+		return nil
+	}
+
+	if err := q.client.client.XGroupDelConsumer(ctx, jobStreamKey, jobGroup, q.consumer).Err(); err != nil {
+		return fmt.Errorf("failed to remove job consumer: %w", err)
+	}
+	return nil
+}
+
+// removeIdleConsumers removes consumers holding no jobs that haven't read
+// within the visibility timeout, left by workers that died without closing.
+// A live worker that was idle that long is added back by its next read.
+func (q *JobQueue) removeIdleConsumers(ctx context.Context) error {
+	consumers, err := q.client.client.XInfoConsumers(ctx, jobStreamKey, jobGroup).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list job consumers: %w", err)
+	}
+
+	for _, consumer := range consumers {
+		if consumer.Pending > 0 || consumer.Idle < q.visibility {
+			continue
+		}
+		if err := q.client.client.XGroupDelConsumer(ctx, jobStreamKey, jobGroup, consumer.Name).Err(); err != nil {
+			return fmt.Errorf("failed to remove job consumer %s: %w", consumer.Name, err)
+		}
+	}
+	return nil
+}
+
+func (q *JobQueue) Enqueue(ctx context.Context, job *jobs.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	if err := q.client.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: jobStreamKey,
+		Values: map[string]interface{}{"job": data},
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+func (q *JobQueue) Dequeue(ctx context.Context, wait time.Duration) (*jobs.Job, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := promoteJobsScript.Run(ctx, q.client.client, []string{jobDelayedKey, jobStreamKey}, now, promoteBatch).Err(); err != nil {
+		return nil, fmt.Errorf("failed to promote due jobs: %w", err)
+	}
+
+	// jobs abandoned by another worker come first
+	claimed, _, err := q.client.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   jobStreamKey,
+		Group:    jobGroup,
+		Consumer: q.consumer,
+		MinIdle:  q.visibility,
+		Start:    "0",
+		Count:    1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim stale jobs: %w", err)
+	}
+	if len(claimed) > 0 {
+		deliveries, err := q.deliveries(ctx, claimed[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		return q.decode(ctx, claimed[0], deliveries)
+	}
+
+	streams, err := q.client.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    jobGroup,
+		Consumer: q.consumer,
+		Streams:  []string{jobStreamKey, ">"},
+		Count:    1,
+		Block:    wait,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, nil
+	}
+	return q.decode(ctx, streams[0].Messages[0], 1)
+}
+
+// deliveries is how many times a stream entry has been delivered, counting
+// the claim that just took it
+func (q *JobQueue) deliveries(ctx context.Context, id string) (int64, error) {
+	pending, err := q.client.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: jobStreamKey,
+		Group:  jobGroup,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deliveries of job %s: %w", id, err)
+	}
+	if len(pending) == 0 {
+		return 1, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+// decode reads the job from a stream entry. An entry that isn't a job can
+// never be handled, so it is dropped. The attempts stored with a job only
+// count the ones that failed and were retried; every earlier delivery of
+// this entry was an attempt that never finished, e.g. because its worker
+// crashed or hung, so they are counted too.
+func (q *JobQueue) decode(ctx context.Context, msg redis.XMessage, deliveries int64) (*jobs.Job, error) {
+	data, _ := msg.Values["job"].(string)
+
+	var job jobs.Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		q.remove(ctx, q.client.client, msg.ID)
+		return nil, fmt.Errorf("failed to decode job %s: %w", msg.ID, err)
+	}
+	job.Receipt = msg.ID
+	job.Attempts += int(deliveries - 1)
+	return &job, nil
+}
+
+func (q *JobQueue) Ack(ctx context.Context, job *jobs.Job) error {
+	pipe := q.client.client.TxPipeline()
+	q.remove(ctx, pipe, job.Receipt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to ack job: %w", err)
+	}
+	return nil
+}
+
+func (q *JobQueue) Retry(ctx context.Context, job *jobs.Job, at time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	pipe := q.client.client.TxPipeline()
+	pipe.ZAdd(ctx, jobDelayedKey, redis.Z{Score: float64(at.UnixMilli()), Member: data})
+	q.remove(ctx, pipe, job.Receipt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return nil
+}
+
+func (q *JobQueue) DeadLetter(ctx context.Context, job *jobs.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	pipe := q.client.client.TxPipeline()
+	pipe.LPush(ctx, jobDeadKey, data)
+	pipe.LTrim(ctx, jobDeadKey, 0, maxDeadLetters-1)
+	q.remove(ctx, pipe, job.Receipt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to dead letter job: %w", err)
+	}
+	return nil
+}
+
+func (q *JobQueue) DeadLetters(ctx context.Context, limit int) ([]*jobs.Job, error) {
+	entries, err := q.client.client.LRange(ctx, jobDeadKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+
+	dead := make([]*jobs.Job, 0, len(entries))
+	for _, entry := range entries {
+		var job jobs.Job
+		if err := json.Unmarshal([]byte(entry), &job); err != nil {
+			continue
+		}
+		dead = append(dead, &job)
+	}
+	return dead, nil
+}
+
+// remove acks a delivery and deletes it from the stream
+func (q *JobQueue) remove(ctx context.Context, cmd redis.Cmdable, id string) {
+	cmd.XAck(ctx, jobStreamKey, jobGroup, id)
+	cmd.XDel(ctx, jobStreamKey, id)
+}
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const lockKeyPrefix = "lock:"
+
+// releaseLockScript only deletes the lock if we still hold it, so a holder
+// whose lock expired can't release the next holder's
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock is a lock held in redis until it is released or its ttl runs out
+type Lock struct {
+	client *RedisClient
+	key    string
+	token  string
+}
+
+// TryLock takes the named lock if nobody holds it. It returns nil without an
+// error when the lock is held elsewhere.
+func (r *RedisClient) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token := uuid.NewString()
+	ok, err := r.client.SetNX(ctx, lockKeyPrefix+name, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take lock %s: %w", name, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &Lock{client: r, key: lockKeyPrefix + name, token: token}, nil
+}
+
+// Release gives up the lock if it is still held
+func (l *Lock) Release(ctx context.Context) error {
+	if err := releaseLockScript.Run(ctx, l.client.client, []string{l.key}, l.token).Err(); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitKeyPrefix = "ratelimit:"
+
+// tokenBucketScript refills the bucket for the time elapsed since it was last
+// touched and takes cost tokens if there are enough. Time comes from the redis
+// server so replicas with skewed clocks agree on the bucket's state. Floats
+// are returned as strings since redis truncates lua numbers to integers.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	retry = (cost - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens), tostring(retry)}
+`)
+
+// TokenBucketResult is the outcome of taking tokens from a bucket
+type TokenBucketResult struct {
+	Allowed    bool
+	Remaining  float64
+	RetryAfter time.Duration
+}
+
+// TakeTokens takes cost tokens from the bucket stored at key, which refills at
+// rate tokens per second up to burst. The bucket expires once it would be full
+// again, so idle callers don't leave keys behind.
+func (r *RedisClient) TakeTokens(ctx context.Context, key string, rate float64, burst, cost int) (*TokenBucketResult, error) {
+	if rate <= 0 || burst <= 0 {
+		return nil, fmt.Errorf("invalid token bucket rate %v or burst %d", rate, burst)
+	}
+
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{rateLimitKeyPrefix + key}, rate, burst, cost).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take tokens: %w", err)
+	}
+	if len(res) != 3 {
+		return nil, fmt.Errorf("unexpected token bucket reply: %v", res)
+	}
+
+	allowed, _ := res[0].(int64)
+	remaining, err := parseScriptFloat(res[1])
+	if err != nil {
+		return nil, err
+	}
+	retry, err := parseScriptFloat(res[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenBucketResult{
+		Allowed:    allowed == 1,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(math.Ceil(retry*1000)) * time.Millisecond,
+	}, nil
+}
+
+func parseScriptFloat(v interface{}) (float64, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected token bucket value: %v", v)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected token bucket value: %w", err)
+	}
+	return f, nil
+}
@@ -2,41 +2,102 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"strings"
 
-	"github.com/RediSearch/redisearch-go/redisearch"
-	"github.com/gomodule/redigo/redis"
+	"github.com/johnnynu/Coffeehaus/internal/config"
 	redisClient "github.com/redis/go-redis/v9"
 )
 
 type RedisClient struct {
-	client *redisClient.Client
-	searchClient *redisearch.Client
+	client redisClient.UniversalClient
 }
 
-// NewRedisClient creates a new RedisClient
+// NewClient connects to the redis deployment described by cfg, failing if it
+// can't be reached
+func NewClient(cfg *config.RedisConfig) (*RedisClient, error) {
+	r := Open(cfg)
+	if err := r.Ping(context.Background()); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return r, nil
+}
+
+// Open returns a client of the redis deployment described by cfg without
+// connecting. Connections are made as they are needed, so callers that can
+// run without redis start while it is down.
+func Open(cfg *config.RedisConfig) *RedisClient {
+	opts := &redisClient.UniversalOptions{
+		Addrs:        cfg.Addrs,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		MasterName:   cfg.MasterName,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		PoolTimeout:  cfg.PoolTimeout,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		// callers' deadlines, like a breaker's timeout, cut hung calls short
+		ContextTimeoutEnabled: true,
+		// go-redis only parses search replies over RESP2
+		Protocol: 2,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: cfg.TLSServerName,
+		}
+	}
+
+	var client redisClient.UniversalClient
+	if cfg.Cluster {
+		// a single seed address would otherwise connect to one node only
+		client = redisClient.NewClusterClient(opts.Cluster())
+	} else {
+		client = redisClient.NewUniversalClient(opts)
+	}
+
+	return &RedisClient{client: client}
+}
+
+// NewRedisClient connects to a single redis server
 func NewRedisClient(addr string, password string, db int) (*RedisClient, error) {
-	client := redisClient.NewClient(&redisClient.Options{
-		Addr:     addr,
+	return NewClient(&config.RedisConfig{
+		Addrs:    []string{addr},
 		Password: password,
 		DB:       db,
 	})
+}
 
-	// Test connection
-	ctx := context.Background()
-	_, err := client.Ping(ctx).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
-	}
-
-	pool := &redis.Pool{Dial: func() (redis.Conn, error) {
-		return redis.Dial("tcp", addr, redis.DialPassword(password))
-	}}
+// Close closes every connection to redis
+func (r *RedisClient) Close() error {
+	return r.client.Close()
+}
 
-	// shop index
-	searchClient := redisearch.NewClientFromPool(pool, "shopIdx")
-	
-	// todo: search results index?
+// legacyKeys are the keys the job queue and tag counts had before they were
+// hash tagged, by their current name. Trending buckets aren't moved, they
+// are rebuilt as tags are used.
+var legacyKeys = map[string]string{
+	jobStreamKey:  "jobs:stream",
+	jobDelayedKey: "jobs:delayed",
+	jobDeadKey:    "jobs:dead",
+	tagPendingKey: "tags:pending",
+	tagBatchesKey: "tags:pending:batches",
+}
 
-	return &RedisClient{client: client, searchClient: searchClient}, nil
-}
\ No newline at end of file
+// MoveLegacyKeys renames keys written under their old names to their current
+// ones, so queued jobs and uncounted tag usage survive the rename. It must
+// run before the job queue is opened, which creates its stream.
+func (r *RedisClient) MoveLegacyKeys(ctx context.Context) error {
+	for key, legacy := range legacyKeys {
+		err := r.client.RenameNX(ctx, legacy, key).Err()
+		if err != nil && !strings.Contains(err.Error(), "no such key") {
+			return fmt.Errorf("failed to move %s to %s: %w", legacy, key, err)
+		}
+	}
+	return nil
+}
@@ -19,6 +19,13 @@ func TestMain(m *testing.M) {
 		log.Printf("Warning: Error loading .env file: %v", err)
 	}
 
+	// tests against a live redis are skipped without one, the rest run on
+	// miniredis
+	if os.Getenv("REDIS_ADDR") == "" {
+		log.Printf("REDIS_ADDR not set, skipping tests that need a live redis")
+		os.Exit(m.Run())
+	}
+
 	// Setup test Redis client using environment variables
 	client, err := NewRedisClient(
         os.Getenv("REDIS_ADDR"),
@@ -40,7 +47,16 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// requireLive skips a test that needs a live redis when none is configured
+func requireLive(t *testing.T) {
+	t.Helper()
+	if testClient == nil {
+		t.Skip("REDIS_ADDR not set")
+	}
+}
+
 func TestCacheShop(t *testing.T) {
+    requireLive(t)
     ctx := context.Background()
 
     testCases := []struct {
@@ -111,6 +127,7 @@ func TestCacheShop(t *testing.T) {
 }
 
 func TestGetCachedShop(t *testing.T) {
+    requireLive(t)
     ctx := context.Background()
 
     t.Run("Get existing shop", func(t *testing.T) {
@@ -137,6 +154,7 @@ func TestGetCachedShop(t *testing.T) {
 }
 
 func TestCreateIndex(t *testing.T) {
+    requireLive(t)
     t.Run("Creating index", func(t *testing.T) {
         err := testClient.InitializeShopIndex()
         assert.NoError(t, err, "Index created without errors")
@@ -144,6 +162,7 @@ func TestCreateIndex(t *testing.T) {
 }
 
 func TestSearchSpecific(t *testing.T) {
+    requireLive(t)
     ctx := context.Background()
     t.Run("Searching for a specific shop", func(t *testing.T) {
         shops, err := testClient.SearchSpecific(ctx, "Stereoscope")
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/johnnynu/Coffeehaus/internal/shop"
@@ -29,27 +28,22 @@ const (
 	searchTTL = 6 * time.Hour
 )
 
-// InitializeSearchIndex creates the search index for search results
-func (r *RedisClient) InitializeSearchIndex() error {
-	// Create search index for JSON documents
-	ctx := context.Background()
-
-	normalizedQueryField := &redis.FieldSchema{
-		FieldName: "$.normalized_query",
-		FieldType: redis.SearchFieldTypeText,
-		Sortable: true,
-		As: "normalized_query",
-	}
+// searchResultIndex indexes cached search results by their normalized query
+var searchResultIndex = searchIndex{
+	alias:   "searchIdx",
+	prefix:  searchKeyPrefix,
+	version: 1,
+	schema: []*redis.FieldSchema{
+		{FieldName: "$.normalized_query", As: "normalized_query", FieldType: redis.SearchFieldTypeText, Sortable: true},
+	},
+}
 
-	err := r.client.FTCreate(ctx, "searchIdx", &redis.FTCreateOptions{
-		OnJSON: true,
-		Prefix: []interface{}{searchKeyPrefix},
-	}, normalizedQueryField).Err(); 
-	
-	if err != nil {
-		log.Printf("Failed to create search index or already exists: %v", err)
+// InitializeSearchIndex creates the search index for search results, or
+// migrates it from an older schema
+func (r *RedisClient) InitializeSearchIndex() error {
+	if err := r.ensureIndex(context.Background(), searchResultIndex); err != nil {
+		return fmt.Errorf("failed to initialize search index: %w", err)
 	}
-
 	return nil
 }
 
@@ -4,68 +4,106 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 
-	"github.com/RediSearch/redisearch-go/redisearch"
 	"github.com/johnnynu/Coffeehaus/internal/shop"
 	redisClient "github.com/redis/go-redis/v9"
 )
 
 const shopKeyPrefix = "shop:"
 
+const shopIndex = "shopIdx"
+
+// indexedShop is a shop as stored for the index. RediSearch reads geo fields
+// as "lng,lat", which isn't how the db stores locations.
+type indexedShop struct {
+	*shop.Shop
+	Geo string `json:"geo,omitempty"`
+}
+
+// shopSearchIndex indexes cached shops. Bump its version when the schema
+// changes, listing added fields in added if that's all that changed.
+var shopSearchIndex = searchIndex{
+	alias:   shopIndex,
+	prefix:  shopKeyPrefix,
+	version: 1,
+	schema: []*redisClient.FieldSchema{
+		{FieldName: "$.name", As: "name", FieldType: redisClient.SearchFieldTypeText, Weight: 2},
+		{FieldName: "$.formatted_address", As: "formatted_address", FieldType: redisClient.SearchFieldTypeText},
+		{FieldName: "$.vicinity", As: "vicinity", FieldType: redisClient.SearchFieldTypeText},
+		{FieldName: "$.geo", As: "location", FieldType: redisClient.SearchFieldTypeGeo},
+		{FieldName: "$.google_rating", As: "google_rating", FieldType: redisClient.SearchFieldTypeNumeric, Sortable: true},
+		{FieldName: "$.price_level", As: "price_level", FieldType: redisClient.SearchFieldTypeNumeric},
+	},
+}
+
+// InitializeShopIndex creates the index over cached shops, or migrates it
+// from an older schema
 func (r *RedisClient) InitializeShopIndex() error {
-	shopSchema := redisearch.NewSchema(redisearch.DefaultOptions).
-		AddField(redisearch.NewTextField("name")).
-		AddField(redisearch.NewTextField("formatted_address")).
-		AddField(redisearch.NewTextField("vicinity")).
-		AddField(redisearch.NewGeoField("location")).
-		AddField(redisearch.NewNumericField("google_rating")).
-		AddField(redisearch.NewNumericField("price_level"))
-
-	if err := r.searchClient.CreateIndex(shopSchema); err != nil {
-		log.Printf("error creating index: %s", err)
-		return err
+	if err := r.ensureIndex(context.Background(), shopSearchIndex); err != nil {
+		return fmt.Errorf("failed to initialize shop index: %w", err)
 	}
-
-	log.Printf("Successfully created shop index")
 	return nil
 }
 
 func (r *RedisClient) CacheShop(ctx context.Context, shop *shop.Shop) error {
-    // Handle nil shop
-    if shop == nil {
-        return fmt.Errorf("cannot cache nil shop")
-    }
+	// Handle nil shop
+	if shop == nil {
+		return fmt.Errorf("cannot cache nil shop")
+	}
 
-    // Validate shop ID
-    if shop.ID == "" {
-        return fmt.Errorf("shop ID cannot be empty")
-    }
+	// Validate shop ID
+	if shop.ID == "" {
+		return fmt.Errorf("shop ID cannot be empty")
+	}
 
-    key := shopKeyPrefix + shop.ID
-    log.Printf("Attempting to cache shop with key: %s", key)
+	// the shop is indexed as soon as it is written
+	key := shopKeyPrefix + shop.ID
+	if err := r.client.JSONSet(ctx, key, "$", newIndexedShop(shop)).Err(); err != nil {
+		return fmt.Errorf("failed to cache shop: %w", err)
+	}
 
-    // Store the shop object directly as JSON
-    err := r.client.JSONSet(ctx, key, "$", shop).Err()
-    if err != nil {
-        return fmt.Errorf("failed to cache shop: %w", err)
-    }
+	return nil
+}
+
+// IndexShops caches and indexes shops in one round trip
+func (r *RedisClient) IndexShops(ctx context.Context, shops []*shop.Shop) error {
+	pipe := r.client.Pipeline()
+	for _, s := range shops {
+		if s == nil || s.ID == "" {
+			continue
+		}
+		pipe.JSONSet(ctx, shopKeyPrefix+s.ID, "$", newIndexedShop(s))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to index shops: %w", err)
+	}
+	return nil
+}
 
-	doc := redisearch.NewDocument(shop.ID, 1.0)
-	doc.Set("name", shop.Name).
-		Set("formatted_address", shop.FormattedAddress).
-		Set("vicinity", shop.Vicinity).
-		Set("location", shop.Location).
-		Set("google_rating", shop.GoogleRating).
-		Set("price_level", shop.PriceLevel)
+// RemoveShops drops shops from the cache and the index
+func (r *RedisClient) RemoveShops(ctx context.Context, shopIDs []string) error {
+	if len(shopIDs) == 0 {
+		return nil
+	}
 
-	if err = r.searchClient.Index([]redisearch.Document{doc}...); err != nil {
-		fmt.Printf("Failed to index shop: %s", err)
+	keys := make([]string, len(shopIDs))
+	for i, id := range shopIDs {
+		keys[i] = shopKeyPrefix + id
 	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to remove shops: %w", err)
+	}
+	return nil
+}
 
-	log.Printf("Successfully cached and indexed shop with ID: %s", shop.ID)
-    return nil
+func newIndexedShop(s *shop.Shop) indexedShop {
+	// locations that aren't in the db's format are assumed to be "lng,lat"
+	geo := s.Location
+	if location, ok := s.Coordinates(); ok {
+		geo = geoValue(location.Lat, location.Lng)
+	}
+	return indexedShop{Shop: s, Geo: geo}
 }
 
 func (r *RedisClient) GetCachedShop(ctx context.Context, shopID string) (*shop.Shop, error) {
@@ -98,26 +136,7 @@ func (r *RedisClient) GetCachedShop(ctx context.Context, shopID string) (*shop.S
     return &shop, nil
 }
 
+// SearchSpecific finds shops by name
 func (r *RedisClient) SearchSpecific(ctx context.Context, shopName string) ([]*shop.Shop, error) {
-	query := redisearch.NewQuery(fmt.Sprintf(`@name:%s*`, shopName)).Limit(0, 10)
-
-	docs, total, err := r.searchClient.Search(query)
-	if err != nil {
-		return nil, fmt.Errorf("search failed: %v", err)
-	}
-
-	log.Printf("Found %d shops matching the query", total)
-
-	var shops []*shop.Shop
-	for _, doc := range docs {
-		shopID := doc.Id
-		shop, err := r.GetCachedShop(ctx, shopID)
-		if err != nil {
-			log.Printf("Failed to retrieve shop from cache: %s", err)
-			continue
-		}
-		shops = append(shops, shop)
-	}
-
-	return shops, nil
-}
\ No newline at end of file
+	return r.SearchShops(ctx, shop.IndexQuery{Text: shopName})
+}
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+	redisClient "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultShopResults = 10
+	// fuzzyMinLength is the shortest term matched with a typo, shorter terms
+	// match too much
+	fuzzyMinLength = 4
+	// prefixMinLength is RediSearch's default MINPREFIX
+	prefixMinLength = 2
+)
+
+// SearchShops searches the shop index. Text matches names allowing a typo
+// per word and treats the last word as a prefix, since it may still be being
+// typed. Results without text are the nearest shops, nearest first.
+func (r *RedisClient) SearchShops(ctx context.Context, query shop.IndexQuery) ([]*shop.Shop, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultShopResults
+	}
+	if query.Text == "" && hasRadius(query) {
+		return r.nearestShops(ctx, query, limit)
+	}
+
+	res, err := r.client.FTSearchWithArgs(ctx, shopIndex, shopQuery(query), &redisClient.FTSearchOptions{
+		Return:         []redisClient.FTSearchReturn{{FieldName: "$"}},
+		Limit:          limit,
+		DialectVersion: 2,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	shops := make([]*shop.Shop, 0, len(res.Docs))
+	for _, doc := range res.Docs {
+		var s shop.Shop
+		if err := json.Unmarshal([]byte(doc.Fields["$"]), &s); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal shop %s: %w", doc.ID, err)
+		}
+		shops = append(shops, &s)
+	}
+	return shops, nil
+}
+
+// nearestShops returns the limit shops matching query nearest its location.
+// FT.SEARCH can't order by distance, so the index sorts every shop in the
+// radius with FT.AGGREGATE before the page is cut.
+func (r *RedisClient) nearestShops(ctx context.Context, query shop.IndexQuery, limit int) ([]*shop.Shop, error) {
+	cmd := redisClient.NewAggregateCmd(ctx, nearestArgs(query, limit)...)
+	if err := r.client.Process(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	res, err := cmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	shops := make([]*shop.Shop, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		doc, _ := row.Fields["shop"].(string)
+		var s shop.Shop
+		if err := json.Unmarshal([]byte(doc), &s); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal shop: %w", err)
+		}
+		shops = append(shops, &s)
+	}
+	return shops, nil
+}
+
+// nearestArgs builds the FT.AGGREGATE command for nearestShops. go-redis
+// puts SORTBY before APPLY, which can't sort on an applied field, so the
+// arguments are built here.
+func nearestArgs(query shop.IndexQuery, limit int) []interface{} {
+	return []interface{}{
+		"FT.AGGREGATE", shopIndex, shopQuery(query),
+		"LOAD", 4, "$", "AS", "shop", "@location",
+		"APPLY", fmt.Sprintf("geodistance(@location, %s, %s)", formatFloat(query.Lng), formatFloat(query.Lat)), "AS", "distance",
+		"SORTBY", 2, "@distance", "ASC", "MAX", limit,
+		"LIMIT", 0, limit,
+		"DIALECT", 2,
+	}
+}
+
+// shopQuery builds the RediSearch query for an index search
+func shopQuery(query shop.IndexQuery) string {
+	var clauses []string
+	if terms := nameTerms(query.Text); terms != "" {
+		clauses = append(clauses, "@name:("+terms+")")
+	}
+	if hasRadius(query) {
+		clauses = append(clauses, fmt.Sprintf("@location:[%s %s %d m]",
+			formatFloat(query.Lng), formatFloat(query.Lat), query.RadiusMeters))
+	}
+	if query.MinRating > 0 {
+		clauses = append(clauses, fmt.Sprintf("@google_rating:[%s +inf]", strconv.FormatFloat(float64(query.MinRating), 'f', -1, 32)))
+	}
+	if query.MaxPriceLevel > 0 {
+		clauses = append(clauses, fmt.Sprintf("@price_level:[-inf %d]", query.MaxPriceLevel))
+	}
+
+	if len(clauses) == 0 {
+		return "*"
+	}
+	return strings.Join(clauses, " ")
+}
+
+func hasRadius(query shop.IndexQuery) bool {
+	return query.RadiusMeters > 0 && (query.Lat != 0 || query.Lng != 0)
+}
+
+// nameTerms turns free text into terms that must all match. Text is split
+// the way RediSearch tokenizes names, so user input can't add query syntax.
+func nameTerms(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), isTokenSeparator)
+
+	terms := make([]string, 0, len(words))
+	for i, word := range words {
+		term := escapeTerm(word)
+		plain := term == word
+		length := len([]rune(word))
+
+		fuzzy := plain && length >= fuzzyMinLength
+		prefix := plain && length >= prefixMinLength && i == len(words)-1
+
+		switch {
+		case fuzzy && prefix:
+			term = fmt.Sprintf("(%%%s%%|%s*)", term, term)
+		case fuzzy:
+			term = fmt.Sprintf("%%%s%%", term)
+		case prefix:
+			term = term + "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// isTokenSeparator reports whether RediSearch splits text on r by default
+func isTokenSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~", r)
+}
+
+// escapeTerm backslash escapes anything in a term that isn't a letter, digit
+// or underscore, so it is matched literally
+func escapeTerm(term string) string {
+	var b strings.Builder
+	for _, r := range term {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// geoValue formats a point the way RediSearch geo fields expect
+func geoValue(lat, lng float64) string {
+	return formatFloat(lng) + "," + formatFloat(lat)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+func TestShopQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query shop.IndexQuery
+		want  string
+	}{
+		{name: "everything", want: "*"},
+		{
+			name:  "words of four letters or more allow a typo, the last is also a prefix",
+			query: shop.IndexQuery{Text: "Stereoscope Cof"},
+			want:  "@name:(%stereoscope% cof*)",
+		},
+		{
+			name:  "last word both fuzzy and a prefix",
+			query: shop.IndexQuery{Text: "blue bottle"},
+			want:  "@name:(%blue% (%bottle%|bottle*))",
+		},
+		{
+			name:  "single letters are matched exactly",
+			query: shop.IndexQuery{Text: "a"},
+			want:  "@name:(a)",
+		},
+		{
+			name:  "punctuation splits words like the tokenizer",
+			query: shop.IndexQuery{Text: "Philz' (Coffee) -@cafe"},
+			want:  "@name:(%philz% %coffee% (%cafe%|cafe*))",
+		},
+		{
+			name:  "query syntax is escaped",
+			query: shop.IndexQuery{Text: "a|b */ \\x"},
+			want:  "@name:(a\\|b \\/ \\\\x)",
+		},
+		{
+			name:  "only separators",
+			query: shop.IndexQuery{Text: " @(); "},
+			want:  "*",
+		},
+		{
+			name:  "geo radius",
+			query: shop.IndexQuery{Lat: 33.6186, Lng: -117.9294, RadiusMeters: 2000},
+			want:  "@location:[-117.9294 33.6186 2000 m]",
+		},
+		{
+			name:  "radius without a location",
+			query: shop.IndexQuery{RadiusMeters: 2000},
+			want:  "*",
+		},
+		{
+			name:  "filters",
+			query: shop.IndexQuery{Text: "latte", Lat: 34, Lng: -118, RadiusMeters: 500, MinRating: 4.5, MaxPriceLevel: 2},
+			want:  "@name:((%latte%|latte*)) @location:[-118 34 500 m] @google_rating:[4.5 +inf] @price_level:[-inf 2]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shopQuery(tt.query); got != tt.want {
+				t.Errorf("shopQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNearestArgs(t *testing.T) {
+	query := shop.IndexQuery{Lat: 33.6186, Lng: -117.9294, RadiusMeters: 2000, MinRating: 4}
+	got := fmt.Sprint(nearestArgs(query, 10))
+
+	// every shop in the radius is sorted by distance before the page is cut
+	want := "[FT.AGGREGATE shopIdx @location:[-117.9294 33.6186 2000 m] @google_rating:[4 +inf] " +
+		"LOAD 4 $ AS shop @location " +
+		"APPLY geodistance(@location, -117.9294, 33.6186) AS distance " +
+		"SORTBY 2 @distance ASC MAX 10 LIMIT 0 10 DIALECT 2]"
+	if got != want {
+		t.Errorf("nearestArgs() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SpendWindow is a rolling period spend is totalled over
+type SpendWindow string
+
+const (
+	SpendDay   SpendWindow = "day"
+	SpendMonth SpendWindow = "month"
+)
+
+// spend is recorded in hourly buckets for the rolling day and daily buckets
+// for the rolling month, each kept just past the window that reads it
+var spendWindows = map[SpendWindow]struct {
+	span   time.Duration
+	bucket time.Duration
+}{
+	SpendDay:   {span: 24 * time.Hour, bucket: time.Hour},
+	SpendMonth: {span: 30 * 24 * time.Hour, bucket: 24 * time.Hour},
+}
+
+const spendKeyPrefix = "spend:"
+
+func spendBucketKey(provider string, bucket time.Duration, start int64) string {
+	return spendKeyPrefix + provider + ":" + strconv.FormatInt(int64(bucket.Seconds()), 10) + ":" + strconv.FormatInt(start, 10)
+}
+
+// RecordSpend adds micros (millionths of a dollar) against the provider's sku
+func (r *RedisClient) RecordSpend(ctx context.Context, provider, sku string, micros int64, at time.Time) error {
+	// the buckets are in different slots in cluster mode, so they are
+	// written in a pipeline rather than a transaction
+	pipe := r.client.Pipeline()
+	for _, w := range spendWindows {
+		key := spendBucketKey(provider, w.bucket, at.Truncate(w.bucket).Unix())
+		pipe.HIncrBy(ctx, key, sku, micros)
+		pipe.Expire(ctx, key, w.span+w.bucket)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record spend: %w", err)
+	}
+
+	return nil
+}
+
+// Spend returns the provider's spend per sku, in micros, over the window
+// ending at the given time
+func (r *RedisClient) Spend(ctx context.Context, provider string, window SpendWindow, at time.Time) (map[string]int64, error) {
+	w, ok := spendWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("unknown spend window: %s", window)
+	}
+
+	pipe := r.client.Pipeline()
+	var cmds []*redis.MapStringStringCmd
+	newest := at.Truncate(w.bucket)
+	for start := newest; start.After(at.Add(-w.span)); start = start.Add(-w.bucket) {
+		cmds = append(cmds, pipe.HGetAll(ctx, spendBucketKey(provider, w.bucket, start.Unix())))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read spend: %w", err)
+	}
+
+	totals := make(map[string]int64)
+	for _, cmd := range cmds {
+		for sku, v := range cmd.Val() {
+			micros, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid spend value for %s: %w", sku, err)
+			}
+			totals[sku] += micros
+		}
+	}
+
+	return totals, nil
+}
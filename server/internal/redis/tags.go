@@ -0,0 +1,217 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// TrendingWindow is the period trending hashtags are computed over
+type TrendingWindow string
+
+const (
+	TrendingHour TrendingWindow = "1h"
+	TrendingDay  TrendingWindow = "24h"
+	TrendingWeek TrendingWindow = "7d"
+)
+
+type TrendingTag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+}
+
+// windowSpec describes how a trending window is assembled from usage buckets.
+// Each bucket's count is weighted by 0.5^(age/halfLife) so recent usage
+// counts for more than usage at the start of the window.
+type windowSpec struct {
+	span     time.Duration
+	bucket   time.Duration
+	halfLife time.Duration
+}
+
+var trendingWindows = map[TrendingWindow]windowSpec{
+	TrendingHour: {span: time.Hour, bucket: 5 * time.Minute, halfLife: 20 * time.Minute},
+	TrendingDay:  {span: 24 * time.Hour, bucket: time.Hour, halfLife: 6 * time.Hour},
+	TrendingWeek: {span: 7 * 24 * time.Hour, bucket: time.Hour, halfLife: 48 * time.Hour},
+}
+
+// tag usage is counted at these granularities, kept long enough for the
+// widest window that reads them
+var tagBucketTTLs = map[time.Duration]time.Duration{
+	5 * time.Minute: time.Hour + 5*time.Minute,
+	time.Hour:       7*24*time.Hour + time.Hour,
+}
+
+// tag keys share the {tags} hash tag, so the trending union and the pending
+// count scripts and transactions run on one node in cluster mode
+const (
+	tagKeyPrefix     = "{tags}:"
+	tagPendingKey    = tagKeyPrefix + "pending"
+	tagBatchesKey    = tagKeyPrefix + "pending:batches"
+	trendingCacheTTL = time.Minute
+	// tagFlushLease is how long a flush has to ack its batch before another
+	// flusher takes it to have failed and retries it
+	tagFlushLease = 5 * time.Minute
+)
+
+// IsValid reports whether w is a supported trending window
+func (w TrendingWindow) IsValid() bool {
+	_, ok := trendingWindows[w]
+	return ok
+}
+
+// Span is how far back the window reaches
+func (w TrendingWindow) Span() time.Duration {
+	return trendingWindows[w].span
+}
+
+func tagBucketKey(size time.Duration, start int64) string {
+	return fmt.Sprintf("%sbucket:%d:%d", tagKeyPrefix, int64(size.Seconds()), start)
+}
+
+// IncrementTagUsage records one use of each tag at the given time, both in the
+// time buckets used for trending and in the pending counts flushed to Postgres
+func (r *RedisClient) IncrementTagUsage(ctx context.Context, tags []string, at time.Time) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pipe := r.client.TxPipeline()
+	for size, ttl := range tagBucketTTLs {
+		key := tagBucketKey(size, at.Truncate(size).Unix())
+		for _, tag := range tags {
+			pipe.ZIncrBy(ctx, key, 1, tag)
+		}
+		pipe.Expire(ctx, key, ttl)
+	}
+	for _, tag := range tags {
+		pipe.HIncrBy(ctx, tagPendingKey, tag, 1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to increment tag usage: %w", err)
+	}
+
+	return nil
+}
+
+// TrendingTags returns the highest scoring tags in the window ending now.
+// Results are cached for a minute since every bucket but the newest is stable.
+func (r *RedisClient) TrendingTags(ctx context.Context, window TrendingWindow, limit int) ([]TrendingTag, error) {
+	spec, ok := trendingWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("unknown trending window: %s", window)
+	}
+
+	cacheKey := tagKeyPrefix + "trending:" + string(window)
+	exists, err := r.client.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check trending cache: %w", err)
+	}
+
+	if exists == 0 {
+		now := time.Now()
+		newest := now.Truncate(spec.bucket)
+		count := int(spec.span / spec.bucket)
+
+		keys := make([]string, 0, count)
+		weights := make([]float64, 0, count)
+		for i := 0; i < count; i++ {
+			start := newest.Add(-time.Duration(i) * spec.bucket)
+			age := now.Sub(start.Add(spec.bucket / 2))
+			if age < 0 {
+				age = 0
+			}
+			keys = append(keys, tagBucketKey(spec.bucket, start.Unix()))
+			weights = append(weights, math.Pow(0.5, float64(age)/float64(spec.halfLife)))
+		}
+
+		pipe := r.client.TxPipeline()
+		pipe.ZUnionStore(ctx, cacheKey, &redis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"})
+		pipe.Expire(ctx, cacheKey, trendingCacheTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to compute trending tags: %w", err)
+		}
+	}
+
+	res, err := r.client.ZRevRangeWithScores(ctx, cacheKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trending tags: %w", err)
+	}
+
+	trending := make([]TrendingTag, 0, len(res))
+	for _, z := range res {
+		tag, _ := z.Member.(string)
+		trending = append(trending, TrendingTag{Tag: tag, Score: z.Score})
+	}
+
+	return trending, nil
+}
+
+// takePendingScript claims a batch of pending counts in one step, so
+// replicas flushing at once never take the same counts. A batch whose flush
+// started more than ARGV[2] seconds ago is taken to be failed and claimed
+// again, otherwise the pending counts are renamed to the new batch key.
+var takePendingScript = redis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]), 'LIMIT', 0, 1)
+local batch
+if #stale > 0 then
+	batch = stale[1]
+elseif redis.call('EXISTS', KEYS[1]) == 1 then
+	batch = KEYS[3]
+	redis.call('RENAME', KEYS[1], batch)
+else
+	return false
+end
+redis.call('ZADD', KEYS[2], ARGV[1], batch)
+return {batch, redis.call('HGETALL', batch)}
+`)
+
+// TakePendingTagCounts moves the pending usage counts into a batch of their
+// own and returns the batch and its counts. A batch never acked by
+// AckPendingTagCounts is returned again once tagFlushLease has passed, so a
+// failed flush is retried rather than lost. The batch is empty when nothing
+// has been counted since the last flush.
+func (r *RedisClient) TakePendingTagCounts(ctx context.Context) (string, map[string]int64, error) {
+	keys := []string{tagPendingKey, tagBatchesKey, tagKeyPrefix + "pending:batch:" + uuid.NewString()}
+	res, err := takePendingScript.Run(ctx, r.client, keys, time.Now().Unix(), int64(tagFlushLease.Seconds())).Slice()
+	if errors.Is(err, redis.Nil) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to take pending tag counts: %w", err)
+	}
+
+	batch, _ := res[0].(string)
+	fields, _ := res[1].([]interface{})
+	counts := make(map[string]int64, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		tag, _ := fields[i].(string)
+		v, _ := fields[i+1].(string)
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid pending count for tag %s: %w", tag, err)
+		}
+		counts[tag] = n
+	}
+
+	return batch, counts, nil
+}
+
+// AckPendingTagCounts discards a batch returned by TakePendingTagCounts once
+// its counts have been written to Postgres
+func (r *RedisClient) AckPendingTagCounts(ctx context.Context, batch string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, batch)
+	pipe.ZRem(ctx, tagBatchesKey, batch)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to ack pending tag counts: %w", err)
+	}
+	return nil
+}
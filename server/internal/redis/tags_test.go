@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTakePendingTagCounts(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := &RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	ctx := context.Background()
+
+	batch, counts, err := client.TakePendingTagCounts(ctx)
+	if err != nil || batch != "" || counts != nil {
+		t.Fatalf("TakePendingTagCounts() = %q, %v, %v, want nothing pending", batch, counts, err)
+	}
+
+	if err := client.IncrementTagUsage(ctx, []string{"latte", "matcha"}, time.Now()); err != nil {
+		t.Fatalf("failed to count usage: %v", err)
+	}
+	first, counts, err := client.TakePendingTagCounts(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counts["latte"] != 1 || counts["matcha"] != 1 {
+		t.Errorf("counts = %v, want one of each", counts)
+	}
+
+	// a replica flushing at the same time only gets what was counted since
+	client.IncrementTagUsage(ctx, []string{"latte"}, time.Now())
+	second, counts, err := client.TakePendingTagCounts(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second == first || len(counts) != 1 || counts["latte"] != 1 {
+		t.Errorf("second take = %q %v, want only the new latte", second, counts)
+	}
+	if err := client.AckPendingTagCounts(ctx, second); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+
+	// the first flush never acked, so its batch is retried once its lease
+	// is up
+	if batch, _, _ := client.TakePendingTagCounts(ctx); batch != "" {
+		t.Errorf("took %q while the first flush still held it", batch)
+	}
+	client.client.ZAdd(ctx, tagBatchesKey, redis.Z{Score: float64(time.Now().Add(-2 * tagFlushLease).Unix()), Member: first})
+	retried, counts, err := client.TakePendingTagCounts(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if retried != first || counts["matcha"] != 1 {
+		t.Errorf("retry = %q %v, want the first batch again", retried, counts)
+	}
+}
+
+func TestMoveLegacyKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := &RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	ctx := context.Background()
+
+	// written before the keys were hash tagged
+	client.client.HIncrBy(ctx, "tags:pending", "latte", 2)
+	client.client.XAdd(ctx, &redis.XAddArgs{Stream: "jobs:stream", Values: map[string]interface{}{"job": `{"id":"job-1","type":"sync"}`}})
+
+	if err := client.MoveLegacyKeys(ctx); err != nil {
+		t.Fatalf("MoveLegacyKeys() = %v", err)
+	}
+	// moving again finds nothing left to move
+	if err := client.MoveLegacyKeys(ctx); err != nil {
+		t.Fatalf("second MoveLegacyKeys() = %v", err)
+	}
+
+	if _, counts, err := client.TakePendingTagCounts(ctx); err != nil || counts["latte"] != 2 {
+		t.Errorf("TakePendingTagCounts() = %v, %v, want the legacy latte counts", counts, err)
+	}
+	queue, err := client.JobQueue(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("JobQueue() = %v", err)
+	}
+	job, err := queue.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil || job == nil || job.ID != "job-1" {
+		t.Errorf("Dequeue() = %+v, %v, want the legacy job", job, err)
+	}
+}
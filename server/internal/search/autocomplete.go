@@ -0,0 +1,243 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/cache"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+	gmaps "googlemaps.github.io/maps"
+)
+
+// Kinds of suggestion
+const (
+	SuggestionShop = "shop"
+	SuggestionArea = "area"
+)
+
+const (
+	// DefaultAutocompleteTTL is how long suggestions for a prefix are cached.
+	// It only has to outlast a user retyping or a client sending the same
+	// keystroke twice.
+	DefaultAutocompleteTTL = 2 * time.Minute
+	// MinAutocompleteLength is the shortest text suggestions are looked up
+	// for, a letter or two matches too much to be worth a Places call
+	MinAutocompleteLength = 2
+	// defaultSuggestionLimit is how many suggestions are returned by default
+	defaultSuggestionLimit = 8
+)
+
+// coffeeTypes are the Places types of an establishment worth suggesting, so
+// typing "Wal" doesn't suggest a Walmart
+var coffeeTypes = []string{"cafe", "bakery"}
+
+// AutocompleteOptions is text typed into the search box so far
+type AutocompleteOptions struct {
+	Query string
+	// Lat and Lng bias suggestions towards the user, when set
+	Lat, Lng float64
+	// Session is the token of the user's autocomplete session, shared by
+	// every keystroke until they pick a suggestion
+	Session string
+	Limit   int
+}
+
+// Suggestion is a shop or area the user may be typing
+type Suggestion struct {
+	// Kind is SuggestionShop or SuggestionArea
+	Kind    string `json:"kind"`
+	PlaceID string `json:"place_id"`
+	Text    string `json:"text"`
+	// SecondaryText is where a suggestion is, like its address or city
+	SecondaryText string `json:"secondary_text,omitempty"`
+}
+
+type AutocompleteResult struct {
+	Suggestions []Suggestion `json:"suggestions"`
+	// Degraded is set when suggestions come from the db alone because Places
+	// was over budget or failing
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// ShopNames finds shops in the db by name
+type ShopNames interface {
+	SearchShopsByName(ctx context.Context, search database.NameSearch) ([]database.ShopMatch, error)
+	HiddenPlaceIDs(ctx context.Context, placeIDs []string) (map[string]bool, error)
+}
+
+// SetAutocompleteTTL sets how long suggestions are cached
+func (s *SearchService) SetAutocompleteTTL(ttl time.Duration) {
+	s.autocompleteTTL = ttl
+}
+
+// Autocomplete suggests shops and areas for text typed so far. Shops already
+// in the db come first, then Places predictions. Suggestions are cached by
+// prefix and rounded location, so repeated keystrokes don't each cost a
+// Places call.
+func (s *SearchService) Autocomplete(ctx context.Context, opts AutocompleteOptions) (*AutocompleteResult, error) {
+	opts.Query = strings.TrimSpace(opts.Query)
+	if len([]rune(opts.Query)) < MinAutocompleteLength {
+		return &AutocompleteResult{Suggestions: []Suggestion{}}, nil
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultSuggestionLimit
+	}
+
+	key := autocompleteKey(opts)
+	var cached AutocompleteResult
+	if cache.GetJSON(ctx, s.cache, key, &cached) {
+		return &cached, nil
+	}
+
+	local := s.suggestShops(ctx, opts)
+	result := &AutocompleteResult{Suggestions: local}
+
+	// keystrokes have their own rate limit, taking from the places one would
+	// leave a fast typist's next search throttled
+	var bias *maps.Bias
+	if opts.Lat != 0 || opts.Lng != 0 {
+		bias = &maps.Bias{Location: gmaps.LatLng{Lat: opts.Lat, Lng: opts.Lng}, RadiusMeters: DefaultRadius}
+	}
+	predictions, err := s.maps.Autocomplete(ctx, opts.Query, bias, opts.Session)
+	if err != nil {
+		// a missing suggestion is better than a broken search box
+		log.Printf("Places unavailable, suggesting db shops only: %v", err)
+		result.Degraded = true
+		return result, nil
+	}
+
+	result.Suggestions = mergeSuggestions(local, s.withoutHiddenPredictions(ctx, predictions), opts.Limit)
+	cache.SetJSON(ctx, s.cache, key, result, s.autocompleteTTL)
+	return result, nil
+}
+
+// autocompleteKey identifies typed text. Locations are rounded to about 1km,
+// predictions are only biased towards the user.
+func autocompleteKey(opts AutocompleteOptions) string {
+	id := fmt.Sprintf("%s|%.2f|%.2f|%d", normalizeQuery(opts.Query), opts.Lat, opts.Lng, opts.Limit)
+	sum := sha256.Sum256([]byte(id))
+	return "autocomplete:" + hex.EncodeToString(sum[:16])
+}
+
+// suggestShops finds shops by name in the index, else the db. Failures only
+// cost suggestions, so they are logged.
+func (s *SearchService) suggestShops(ctx context.Context, opts AutocompleteOptions) []Suggestion {
+	shops := s.searchIndex(ctx, shop.IndexQuery{Text: opts.Query, Limit: opts.Limit})
+	if len(shops) == 0 && s.names != nil {
+		matches, err := s.names.SearchShopsByName(ctx, database.NameSearch{
+			Query:         opts.Query,
+			Lat:           opts.Lat,
+			Lng:           opts.Lng,
+			Limit:         opts.Limit,
+			MinSimilarity: minMatchSimilarity,
+		})
+		if err != nil {
+			log.Printf("Failed to search db for %q: %v", opts.Query, err)
+		}
+		for _, match := range matches {
+			shops = append(shops, match.Shop)
+		}
+	}
+
+	suggestions := make([]Suggestion, len(shops))
+	for i, shop := range shops {
+		secondary := shop.Vicinity
+		if secondary == "" {
+			secondary = shop.FormattedAddress
+		}
+		suggestions[i] = Suggestion{
+			Kind:          SuggestionShop,
+			PlaceID:       shop.PlaceID,
+			Text:          shop.Name,
+			SecondaryText: secondary,
+		}
+	}
+	return suggestions
+}
+
+// withoutHiddenPredictions drops predictions of shops an admin has hidden
+func (s *SearchService) withoutHiddenPredictions(ctx context.Context, predictions []maps.Prediction) []maps.Prediction {
+	if s.names == nil || len(predictions) == 0 {
+		return predictions
+	}
+
+	placeIDs := make([]string, len(predictions))
+	for i, prediction := range predictions {
+		placeIDs[i] = prediction.PlaceID
+	}
+
+	hidden, err := s.names.HiddenPlaceIDs(ctx, placeIDs)
+	if err != nil {
+		log.Printf("Failed to check for hidden shops: %v", err)
+		return predictions
+	}
+
+	visible := make([]maps.Prediction, 0, len(predictions))
+	for _, prediction := range predictions {
+		if !hidden[prediction.PlaceID] {
+			visible = append(visible, prediction)
+		}
+	}
+	return visible
+}
+
+// mergeSuggestions puts shops from the db before Places predictions, deduped
+// by place ID. Predictions of establishments that aren't coffee shops are
+// dropped, other predictions are areas.
+func mergeSuggestions(local []Suggestion, predictions []maps.Prediction, limit int) []Suggestion {
+	merged := make([]Suggestion, 0, limit)
+	seen := make(map[string]bool, len(local)+len(predictions))
+	add := func(suggestion Suggestion) {
+		if len(merged) < limit && !seen[suggestion.PlaceID] {
+			seen[suggestion.PlaceID] = true
+			merged = append(merged, suggestion)
+		}
+	}
+
+	for _, suggestion := range local {
+		add(suggestion)
+	}
+	for _, prediction := range predictions {
+		kind, ok := predictionKind(prediction.Types)
+		if !ok {
+			continue
+		}
+		add(Suggestion{
+			Kind:          kind,
+			PlaceID:       prediction.PlaceID,
+			Text:          prediction.MainText,
+			SecondaryText: prediction.SecondaryText,
+		})
+	}
+	return merged
+}
+
+// predictionKind is whether a prediction is a shop or an area, and false for
+// any other establishment
+func predictionKind(types []string) (string, bool) {
+	if !hasType(types, "establishment") {
+		return SuggestionArea, true
+	}
+	for _, coffeeType := range coffeeTypes {
+		if hasType(types, coffeeType) {
+			return SuggestionShop, true
+		}
+	}
+	return "", false
+}
+
+func hasType(types []string, want string) bool {
+	for _, t := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
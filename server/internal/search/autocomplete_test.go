@@ -0,0 +1,235 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/ratelimit"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+func TestAutocomplete(t *testing.T) {
+	indexed := []*shop.Shop{{GooglePlaceID: "little-tokyo-roasters", Name: "Little Tokyo Roasters", Vicinity: "Los Angeles"}}
+	predictions := []maps.Prediction{
+		{PlaceID: "little-tokyo", MainText: "Little Tokyo", SecondaryText: "Los Angeles, CA", Types: []string{"neighborhood", "political", "geocode"}},
+		{PlaceID: "little-tokyo-roasters", MainText: "Little Tokyo Roasters", Types: []string{"cafe", "food", "establishment"}},
+		{PlaceID: "little-tokyo-market", MainText: "Little Tokyo Market", Types: []string{"grocery_or_supermarket", "store", "establishment"}},
+		{PlaceID: "little-tokyo-bakery", MainText: "Little Tokyo Bakery", Types: []string{"bakery", "food", "establishment"}},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		limit           int
+		index           []*shop.Shop
+		placesErr       error
+		placesLimit     RateCheck
+		want            []Suggestion
+		wantDegraded    bool
+		wantPlacesCalls int
+	}{
+		{
+			name:  "too short to look up",
+			query: " L ",
+			want:  []Suggestion{},
+		},
+		{
+			name:  "db shops first, then shops and areas from places",
+			query: "Little Tok",
+			index: indexed,
+			want: []Suggestion{
+				{Kind: SuggestionShop, PlaceID: "little-tokyo-roasters", Text: "Little Tokyo Roasters", SecondaryText: "Los Angeles"},
+				{Kind: SuggestionArea, PlaceID: "little-tokyo", Text: "Little Tokyo", SecondaryText: "Los Angeles, CA"},
+				{Kind: SuggestionShop, PlaceID: "little-tokyo-bakery", Text: "Little Tokyo Bakery"},
+			},
+			wantPlacesCalls: 1,
+		},
+		{
+			name:  "limit",
+			query: "Little Tok",
+			limit: 1,
+			index: indexed,
+			want: []Suggestion{
+				{Kind: SuggestionShop, PlaceID: "little-tokyo-roasters", Text: "Little Tokyo Roasters", SecondaryText: "Los Angeles"},
+			},
+			wantPlacesCalls: 1,
+		},
+		{
+			// keystrokes are limited on their own, the places limit is left
+			// to searches
+			name:  "over the places limit",
+			query: "Little Tok",
+			index: indexed,
+			placesLimit: func(ctx context.Context) error {
+				return &ratelimit.LimitError{Policy: "places"}
+			},
+			want: []Suggestion{
+				{Kind: SuggestionShop, PlaceID: "little-tokyo-roasters", Text: "Little Tokyo Roasters", SecondaryText: "Los Angeles"},
+				{Kind: SuggestionArea, PlaceID: "little-tokyo", Text: "Little Tokyo", SecondaryText: "Los Angeles, CA"},
+				{Kind: SuggestionShop, PlaceID: "little-tokyo-bakery", Text: "Little Tokyo Bakery"},
+			},
+			wantPlacesCalls: 1,
+		},
+		{
+			name:         "places over budget",
+			query:        "Little Tok",
+			placesErr:    budget.ErrUnavailable,
+			want:         []Suggestion{},
+			wantDegraded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			places := &fakePlaces{err: tt.placesErr, predictions: predictions}
+			service := NewSearchService(places, nil, nil, jobs.NewMemoryQueue())
+			service.SetIndex(&fakeIndex{shops: tt.index})
+			service.SetPlacesLimit(tt.placesLimit)
+
+			result, err := service.Autocomplete(context.Background(), AutocompleteOptions{Query: tt.query, Limit: tt.limit})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(result.Suggestions) != len(tt.want) {
+				t.Fatalf("got %d suggestions %+v, want %d", len(result.Suggestions), result.Suggestions, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if result.Suggestions[i] != want {
+					t.Errorf("suggestion %d = %+v, want %+v", i, result.Suggestions[i], want)
+				}
+			}
+			if result.Degraded != tt.wantDegraded {
+				t.Errorf("Degraded = %v, want %v", result.Degraded, tt.wantDegraded)
+			}
+			if len(places.autocompletes) != tt.wantPlacesCalls {
+				t.Errorf("called places %d times, want %d", len(places.autocompletes), tt.wantPlacesCalls)
+			}
+		})
+	}
+}
+
+func TestAutocomplete_Cache(t *testing.T) {
+	places := &fakePlaces{predictions: []maps.Prediction{{PlaceID: "little-tokyo", MainText: "Little Tokyo"}}}
+	service := NewSearchService(places, nil, nil, jobs.NewMemoryQueue())
+	service.SetCache(mapCache{}, DefaultCoverageTTL)
+	ctx := context.Background()
+
+	// the same prefix typed again, or sent twice, is only looked up once
+	for _, query := range []string{"Little Tok", "little tok ", "Little Tok"} {
+		result, err := service.Autocomplete(ctx, AutocompleteOptions{Query: query, Lat: 34.05, Lng: -118.24})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Suggestions) != 1 {
+			t.Fatalf("Autocomplete(%q) = %+v, want Little Tokyo", query, result.Suggestions)
+		}
+	}
+	if len(places.autocompletes) != 1 {
+		t.Errorf("called places %d times, want once", len(places.autocompletes))
+	}
+
+	// the next keystroke is new text
+	if _, err := service.Autocomplete(ctx, AutocompleteOptions{Query: "Little Toky", Lat: 34.05, Lng: -118.24}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(places.autocompletes) != 2 {
+		t.Errorf("called places %d times, want twice", len(places.autocompletes))
+	}
+
+	// suggestions from the db alone are retried
+	places.err = errors.New("places down")
+	for i := 0; i < 2; i++ {
+		result, err := service.Autocomplete(ctx, AutocompleteOptions{Query: "Philz"})
+		if err != nil || !result.Degraded {
+			t.Fatalf("Autocomplete() = %+v, %v, want degraded", result, err)
+		}
+	}
+	places.err = nil
+	if result, _ := service.Autocomplete(ctx, AutocompleteOptions{Query: "Philz"}); result.Degraded {
+		t.Error("degraded suggestions were cached")
+	}
+}
+
+func TestAutocomplete_LeavesPlacesLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedisClient(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("failed to create redis client: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(client)
+	placesPolicy := ratelimit.Policy{Name: "places", PerMinute: 5, Burst: 3}
+
+	places := &fakePlaces{predictions: []maps.Prediction{{PlaceID: "little-tokyo", MainText: "Little Tokyo"}}}
+	service := NewSearchService(places, nil, nil, jobs.NewMemoryQueue())
+	service.SetPlacesLimit(func(ctx context.Context) error {
+		return limiter.Check(ctx, placesPolicy)
+	})
+	ctx := ratelimit.WithIdentity(context.Background(), "ip:203.0.113.7")
+
+	// more uncached keystrokes than the places burst
+	for _, query := range []string{"Li", "Lit", "Litt", "Littl", "Little"} {
+		result, err := service.Autocomplete(ctx, AutocompleteOptions{Query: query})
+		if err != nil {
+			t.Fatalf("Autocomplete(%q) error = %v", query, err)
+		}
+		if result.Degraded || len(result.Suggestions) != 1 {
+			t.Errorf("Autocomplete(%q) = %+v, want the Places suggestion", query, result)
+		}
+	}
+
+	// the user's searches still have the whole places burst
+	for i := 0; i < placesPolicy.Burst; i++ {
+		if err := limiter.Check(ctx, placesPolicy); err != nil {
+			t.Fatalf("search %d after typing: %v", i+1, err)
+		}
+	}
+}
+
+// hiddenNames hides the shops of the place IDs it holds
+type hiddenNames struct {
+	ShopNames
+	hidden map[string]bool
+}
+
+func (n hiddenNames) HiddenPlaceIDs(ctx context.Context, placeIDs []string) (map[string]bool, error) {
+	return n.hidden, nil
+}
+
+func TestSearch_PickedSuggestion(t *testing.T) {
+	session := "6f1c1e3a-9d2b-4c55-8b1e-3f0e2a7d4c10"
+	places := &fakePlaces{}
+	// a picked suggestion is looked up, not analyzed
+	service := NewSearchService(places, nil, fakeAnalyzer{err: errors.New("analyzed")}, jobs.NewMemoryQueue())
+	service.SetCache(mapCache{}, DefaultCoverageTTL)
+	service.names = hiddenNames{hidden: map[string]bool{"hidden": true}}
+
+	// picked twice, each pick ends its own session so neither is cached
+	for i := 0; i < 2; i++ {
+		delete(places.sessions, "little-tokyo")
+		result, err := service.Search(context.Background(), SearchOptions{PlaceID: "little-tokyo", Session: session})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if len(result.Shops) != 1 || result.Shops[0].PlaceID != "little-tokyo" {
+			t.Errorf("got shops %+v, want the picked place", result.Shops)
+		}
+		if got := places.sessions["little-tokyo"]; got != session {
+			t.Errorf("pick %d fetched in session %q, want %q", i+1, got, session)
+		}
+	}
+
+	result, err := service.Search(context.Background(), SearchOptions{PlaceID: "hidden", Session: session})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(result.Shops) != 0 {
+		t.Errorf("got shops %+v, want the hidden shop left out", result.Shops)
+	}
+}
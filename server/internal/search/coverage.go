@@ -0,0 +1,190 @@
+package search
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/geo"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// DefaultCoverageTTL is how long after Places was searched in an area the db
+// is trusted to hold what it found
+const DefaultCoverageTTL = 7 * 24 * time.Hour
+
+const (
+	// NearbyPrecision buckets nearby searches into cells about 5km across
+	NearbyPrecision = 5
+	// maxNearbyCells caps the cells bookkept for one nearby search. Wider
+	// searches always ask Places, their 20 results say little per cell.
+	maxNearbyCells = 64
+	// nearbyMargin is how far past its circle a nearby search's sweep is
+	// recorded, in meters
+	nearbyMargin = 1000
+	// specificCoveragePrecision buckets searches for a shop by name into
+	// cells of about 40km by 20km, so branches of a chain across a city
+	// share one
+	specificCoveragePrecision = 4
+)
+
+// CoverageStore records where Places has been searched, by geohash cell
+type CoverageStore interface {
+	FindCoverage(ctx context.Context, query string, cells []string) (map[string]database.Coverage, error)
+	RecordCoverage(ctx context.Context, coverage []database.Coverage) error
+}
+
+// SetCoverage sets where Places searches are recorded and how long one of
+// an area is trusted
+func (s *SearchService) SetCoverage(store CoverageStore, ttl time.Duration) {
+	s.coverage = store
+	s.coverageTTL = ttl
+}
+
+// nearbyCells are the cells a nearby search overlaps. It is nil for a search
+// without a location or too wide to bookkeep.
+func nearbyCells(opts SearchOptions) []string {
+	if opts.Lat == 0 && opts.Lng == 0 {
+		return nil
+	}
+	cells := geo.CellsIntersecting(opts.Lat, opts.Lng, float64(opts.Radius), NearbyPrecision)
+	if len(cells) > maxNearbyCells {
+		return nil
+	}
+	return cells
+}
+
+// recordNearby records the cells a nearby search swept, those all within
+// swept meters of where it looked. Places found every shop that close, so
+// the cells are recorded past the search's circle too, for searches a short
+// way off.
+func (s *SearchService) recordNearby(ctx context.Context, opts SearchOptions, swept float64, shops []*maps.CoffeeShopDetails) {
+	if nearbyCells(opts) == nil {
+		return
+	}
+	reach := min(swept, float64(opts.Radius)+nearbyMargin)
+	cells := geo.CellsIntersecting(opts.Lat, opts.Lng, reach, NearbyPrecision)
+	s.recordCoverage(ctx, "", shopsPerCell(sweptCells(opts, swept, cells), shops))
+}
+
+// sweptCells are the cells entirely within swept meters of a nearby search.
+// Shops in cells it only reached part of may have been out of range.
+func sweptCells(opts SearchOptions, swept float64, cells []string) []string {
+	var within []string
+	for _, cell := range cells {
+		if geo.CellWithin(cell, opts.Lat, opts.Lng, swept) {
+			within = append(within, cell)
+		}
+	}
+	return within
+}
+
+// specificCell is the cell a search for a shop by name is bookkept under
+func specificCell(opts SearchOptions) string {
+	if opts.Lat == 0 && opts.Lng == 0 {
+		return ""
+	}
+	return geo.Encode(opts.Lat, opts.Lng, specificCoveragePrecision)
+}
+
+// covered reports whether local results answer a search without Places:
+// Places was searched for query in every cell within the coverage TTL, and
+// there are at least as many local results as it found there, up to the
+// limit. Coverage that can't be looked up counts as missing.
+func (s *SearchService) covered(ctx context.Context, query string, cells []string, local, limit int) bool {
+	if s.coverage == nil || len(cells) == 0 {
+		return false
+	}
+
+	found, err := s.coverage.FindCoverage(ctx, query, cells)
+	if err != nil {
+		log.Printf("Failed to look up search coverage: %v", err)
+		return false
+	}
+
+	shops := 0
+	for _, cell := range cells {
+		coverage, ok := found[cell]
+		if !ok || time.Since(coverage.SweptAt) > s.coverageTTL {
+			return false
+		}
+		shops += coverage.ShopCount
+	}
+	return local >= min(shops, limit)
+}
+
+// recordCoverage notes that Places was just searched for query in the cells,
+// with how many shops it found in each. Missing coverage only costs a Places
+// call, so failures are logged.
+func (s *SearchService) recordCoverage(ctx context.Context, query string, shopCounts map[string]int) {
+	if s.coverage == nil || len(shopCounts) == 0 {
+		return
+	}
+	if err := s.coverage.RecordCoverage(ctx, coverageRows(query, shopCounts, time.Now())); err != nil {
+		log.Printf("Failed to record search coverage: %v", err)
+	}
+}
+
+func coverageRows(query string, shopCounts map[string]int, sweptAt time.Time) []database.Coverage {
+	rows := make([]database.Coverage, 0, len(shopCounts))
+	for cell, count := range shopCounts {
+		rows = append(rows, database.Coverage{
+			Cell:      cell,
+			Query:     query,
+			SweptAt:   sweptAt,
+			ShopCount: count,
+		})
+	}
+	return rows
+}
+
+// shopsPerCell counts the shops in each cell
+func shopsPerCell(cells []string, shops []*maps.CoffeeShopDetails) map[string]int {
+	counts := make(map[string]int, len(cells))
+	for _, cell := range cells {
+		counts[cell] = 0
+	}
+	for _, shop := range shops {
+		cell := geo.Encode(shop.Location.Lat, shop.Location.Lng, NearbyPrecision)
+		if _, ok := counts[cell]; ok {
+			counts[cell]++
+		}
+	}
+	return counts
+}
+
+// mergeShops combines local results with Places results, deduped by place
+// ID. Places' copy of a shop is fresher, so it replaces the local one.
+func mergeShops(local, places []*maps.CoffeeShopDetails) []*maps.CoffeeShopDetails {
+	fromPlaces := make(map[string]*maps.CoffeeShopDetails, len(places))
+	for _, shop := range places {
+		fromPlaces[shop.PlaceID] = shop
+	}
+
+	merged := make([]*maps.CoffeeShopDetails, 0, len(local)+len(places))
+	seen := make(map[string]bool, len(local)+len(places))
+	for _, shop := range local {
+		if seen[shop.PlaceID] {
+			continue
+		}
+		seen[shop.PlaceID] = true
+		if fresher, ok := fromPlaces[shop.PlaceID]; ok {
+			shop = fresher
+		}
+		merged = append(merged, shop)
+	}
+	for _, shop := range places {
+		if !seen[shop.PlaceID] {
+			seen[shop.PlaceID] = true
+			merged = append(merged, shop)
+		}
+	}
+	return merged
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
@@ -0,0 +1,208 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/geo"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+)
+
+// coverageBatch caps the cells looked up at once, the list goes in the url
+const coverageBatch = 100
+
+// CrawlConfig is an area to sweep with Places before users search it
+type CrawlConfig struct {
+	Lat, Lng     float64
+	RadiusMeters float64
+	// MaxDepth is how many times a cell is split into quarters and swept
+	// again when Places returns a full page for it, which means shops were
+	// left out
+	MaxDepth int
+	// PerMinute paces Places searches
+	PerMinute float64
+	// Refresh sweeps cells that are still fresh too
+	Refresh bool
+	// DryRun only counts the cells that would be swept
+	DryRun bool
+	// Halt reports errors that should end the crawl early, such as the
+	// places budget running out
+	Halt func(error) bool
+}
+
+// CrawlReport counts what a crawl did
+type CrawlReport struct {
+	Cells    int    `json:"cells"`
+	Fresh    int    `json:"fresh"`
+	Swept    int    `json:"swept"`
+	Failed   int    `json:"failed"`
+	Searches int    `json:"searches"`
+	Shops    int    `json:"shops"`
+	Halted   string `json:"halted,omitempty"`
+}
+
+// ShopSync saves the shops a crawl finds
+type ShopSync func(ctx context.Context, inputs []shop.SyncInput) error
+
+// Crawler sweeps an area cell by cell with Places nearby searches, so
+// searches there are answered from the db from the start
+type Crawler struct {
+	places   PlacesClient
+	coverage CoverageStore
+	sync     ShopSync
+	ttl      time.Duration
+	cfg      CrawlConfig
+
+	pace *time.Ticker
+}
+
+func NewCrawler(places PlacesClient, coverage CoverageStore, sync ShopSync, ttl time.Duration, cfg CrawlConfig) *Crawler {
+	return &Crawler{places: places, coverage: coverage, sync: sync, ttl: ttl, cfg: cfg}
+}
+
+// Run sweeps every cell of the area not swept within the coverage TTL. A
+// cell that fails is left unrecorded, so running again picks it up.
+func (c *Crawler) Run(ctx context.Context) (*CrawlReport, error) {
+	cells := geo.CellsIntersecting(c.cfg.Lat, c.cfg.Lng, c.cfg.RadiusMeters, NearbyPrecision)
+	report := &CrawlReport{Cells: len(cells)}
+
+	if !c.cfg.Refresh {
+		stale, err := c.staleCells(ctx, cells)
+		if err != nil {
+			return nil, err
+		}
+		report.Fresh = len(cells) - len(stale)
+		cells = stale
+	}
+	if c.cfg.DryRun || len(cells) == 0 {
+		return report, nil
+	}
+
+	c.pace = time.NewTicker(time.Duration(float64(time.Minute) / c.cfg.PerMinute))
+	defer c.pace.Stop()
+
+	for _, cell := range cells {
+		shops, err := c.sweepCell(ctx, cell, report)
+		if err != nil {
+			if ctx.Err() != nil {
+				report.Halted = ctx.Err().Error()
+				return report, nil
+			}
+			if c.cfg.Halt != nil && c.cfg.Halt(err) {
+				report.Halted = err.Error()
+				return report, nil
+			}
+			log.Printf("Failed to sweep cell %s: %v", cell, err)
+			report.Failed++
+			continue
+		}
+		report.Swept++
+		report.Shops += len(shops)
+	}
+
+	return report, nil
+}
+
+// staleCells returns the cells not swept within the coverage TTL
+func (c *Crawler) staleCells(ctx context.Context, cells []string) ([]string, error) {
+	var stale []string
+	for start := 0; start < len(cells); start += coverageBatch {
+		batch := cells[start:min(start+coverageBatch, len(cells))]
+		found, err := c.coverage.FindCoverage(ctx, "", batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, cell := range batch {
+			if coverage, ok := found[cell]; !ok || time.Since(coverage.SweptAt) > c.ttl {
+				stale = append(stale, cell)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// sweepCell searches a cell, saves the shops found in it and records its
+// coverage
+func (c *Crawler) sweepCell(ctx context.Context, cell string, report *CrawlReport) ([]*maps.CoffeeShopDetails, error) {
+	box, ok := geo.Bounds(cell)
+	if !ok {
+		return nil, fmt.Errorf("invalid cell %q", cell)
+	}
+
+	found, err := c.sweep(ctx, box, 0, report)
+	if err != nil {
+		return nil, err
+	}
+
+	// searches are circles around the cell, so they find shops outside it
+	// too. Those are saved but only the cell's own are counted.
+	if len(found) > 0 {
+		inputs := make([]shop.SyncInput, len(found))
+		for i, placeShop := range found {
+			inputs[i] = shop.InputFromPlace(placeShop)
+		}
+		if err := c.sync(ctx, inputs); err != nil {
+			return nil, fmt.Errorf("failed to save shops: %w", err)
+		}
+	}
+
+	counts := shopsPerCell([]string{cell}, found)
+	if err := c.coverage.RecordCoverage(ctx, coverageRows("", counts, time.Now())); err != nil {
+		return nil, err
+	}
+
+	inCell := make([]*maps.CoffeeShopDetails, 0, counts[cell])
+	for _, placeShop := range found {
+		if geo.Encode(placeShop.Location.Lat, placeShop.Location.Lng, NearbyPrecision) == cell {
+			inCell = append(inCell, placeShop)
+		}
+	}
+	return inCell, nil
+}
+
+// sweep searches the circle around a box, and its quarters too when Places
+// returns a full page
+func (c *Crawler) sweep(ctx context.Context, box geo.Box, depth int, report *CrawlReport) ([]*maps.CoffeeShopDetails, error) {
+	if report.Searches > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.pace.C:
+		}
+	}
+
+	lat, lng := box.Center()
+	radius := maps.DistanceMeters(lat, lng, box.MaxLat, box.MaxLng)
+	report.Searches++
+	found, err := c.places.SearchCoffeeShops(ctx, lat, lng, uint(math.Ceil(radius)))
+	if err != nil {
+		return nil, err
+	}
+	if len(found) < maps.NearbyResultLimit || depth >= c.cfg.MaxDepth {
+		return found, nil
+	}
+
+	for _, quarter := range quarters(box) {
+		more, err := c.sweep(ctx, quarter, depth+1, report)
+		if err != nil {
+			return nil, err
+		}
+		found = mergeShops(found, more)
+	}
+	return found, nil
+}
+
+// quarters splits a box into four
+func quarters(box geo.Box) []geo.Box {
+	midLat, midLng := box.Center()
+	return []geo.Box{
+		{MinLat: box.MinLat, MaxLat: midLat, MinLng: box.MinLng, MaxLng: midLng},
+		{MinLat: box.MinLat, MaxLat: midLat, MinLng: midLng, MaxLng: box.MaxLng},
+		{MinLat: midLat, MaxLat: box.MaxLat, MinLng: box.MinLng, MaxLng: midLng},
+		{MinLat: midLat, MaxLat: box.MaxLat, MinLng: midLng, MaxLng: box.MaxLng},
+	}
+}
@@ -0,0 +1,173 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/geo"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	"github.com/johnnynu/Coffeehaus/internal/shop"
+	gmaps "googlemaps.github.io/maps"
+)
+
+// fakePlaces answers nearby searches with a full page the first time and a
+// single shop after, each at the point searched, geocodes every name to area
+// and predicts the same places for any text
+type fakePlaces struct {
+	PlacesClient
+	err      error
+	searches int
+	area     *maps.Area
+	geocodes int
+
+	predictions   []maps.Prediction
+	autocompletes []string
+	// sessions are those places were fetched in, by place ID
+	sessions map[string]string
+}
+
+func (p *fakePlaces) GetSuggestedPlace(ctx context.Context, placeID string, session string) (*maps.CoffeeShopDetails, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.sessions == nil {
+		p.sessions = make(map[string]string)
+	}
+	p.sessions[placeID] = session
+	return &maps.CoffeeShopDetails{PlaceID: placeID}, nil
+}
+
+func (p *fakePlaces) Autocomplete(ctx context.Context, input string, bias *maps.Bias, session string) ([]maps.Prediction, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.autocompletes = append(p.autocompletes, input)
+	return p.predictions, nil
+}
+
+func (p *fakePlaces) Geocode(ctx context.Context, address string) (*maps.Area, error) {
+	p.geocodes++
+	if p.area == nil {
+		return nil, maps.ErrNoResults
+	}
+	return p.area, nil
+}
+
+func (p *fakePlaces) SearchCoffeeShops(ctx context.Context, lat, lng float64, radiusMeters uint) ([]*maps.CoffeeShopDetails, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.searches++
+	count := 1
+	if p.searches == 1 {
+		count = maps.NearbyResultLimit
+	}
+
+	shops := make([]*maps.CoffeeShopDetails, count)
+	for i := range shops {
+		shops[i] = &maps.CoffeeShopDetails{
+			PlaceID:  fmt.Sprintf("place-%d-%d", p.searches, i),
+			Location: gmaps.LatLng{Lat: lat, Lng: lng},
+		}
+	}
+	return shops, nil
+}
+
+func TestCrawler(t *testing.T) {
+	const cell = "9mupk"
+	box, _ := geo.Bounds(cell)
+	lat, lng := box.Center()
+
+	tests := []struct {
+		name     string
+		coverage *fakeCoverage
+		cfg      CrawlConfig
+		err      error
+		want     CrawlReport
+		wantSync int
+	}{
+		{
+			// the full page is split into quarters, each swept once more
+			name:     "stale cell is swept",
+			coverage: &fakeCoverage{},
+			cfg:      CrawlConfig{MaxDepth: 1},
+			want:     CrawlReport{Cells: 1, Swept: 1, Searches: 5, Shops: 14},
+			wantSync: 14,
+		},
+		{
+			name:     "full pages aren't split past the depth",
+			coverage: &fakeCoverage{},
+			want:     CrawlReport{Cells: 1, Swept: 1, Searches: 1, Shops: 10},
+			wantSync: 10,
+		},
+		{
+			name:     "fresh cell is skipped",
+			coverage: freshCoverage(3),
+			want:     CrawlReport{Cells: 1, Fresh: 1},
+		},
+		{
+			name:     "refresh sweeps fresh cells",
+			coverage: freshCoverage(3),
+			cfg:      CrawlConfig{Refresh: true},
+			want:     CrawlReport{Cells: 1, Swept: 1, Searches: 1, Shops: 10},
+			wantSync: 10,
+		},
+		{
+			name:     "dry run only counts",
+			coverage: &fakeCoverage{},
+			cfg:      CrawlConfig{DryRun: true},
+			want:     CrawlReport{Cells: 1},
+		},
+		{
+			name:     "over budget halts",
+			coverage: &fakeCoverage{},
+			err:      budget.ErrUnavailable,
+			want:     CrawlReport{Cells: 1, Searches: 1, Halted: budget.ErrUnavailable.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			places := &fakePlaces{err: tt.err}
+			synced := 0
+			sync := func(ctx context.Context, inputs []shop.SyncInput) error {
+				synced += len(inputs)
+				return nil
+			}
+
+			cfg := tt.cfg
+			cfg.Lat, cfg.Lng, cfg.RadiusMeters = lat, lng, 10
+			cfg.PerMinute = float64(time.Minute / time.Millisecond)
+			cfg.Halt = func(err error) bool { return errors.Is(err, budget.ErrUnavailable) }
+
+			report, err := NewCrawler(places, tt.coverage, sync, DefaultCoverageTTL, cfg).Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if *report != tt.want {
+				t.Errorf("Run() = %+v, want %+v", *report, tt.want)
+			}
+			if synced != tt.wantSync {
+				t.Errorf("synced %d shops, want %d", synced, tt.wantSync)
+			}
+
+			wantRecorded := []database.Coverage(nil)
+			if tt.want.Swept > 0 {
+				wantRecorded = []database.Coverage{{Cell: cell, ShopCount: tt.want.Shops}}
+			}
+			if len(tt.coverage.recorded) != len(wantRecorded) {
+				t.Fatalf("recorded %+v, want %+v", tt.coverage.recorded, wantRecorded)
+			}
+			for i, got := range tt.coverage.recorded {
+				if got.Cell != wantRecorded[i].Cell || got.ShopCount != wantRecorded[i].ShopCount || got.SweptAt.IsZero() {
+					t.Errorf("recorded %+v, want %+v swept now", got, wantRecorded[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/cache"
+	"github.com/johnnynu/Coffeehaus/internal/claude"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+const (
+	// DefaultRadius is searched when neither the request nor the query says
+	// how far to look
+	DefaultRadius = 10000
+	// MinRadius and MaxRadius bound every search, Places searches at most
+	// 50km around a point
+	MinRadius = 250
+	MaxRadius = 50000
+
+	// geocodeTTL is how long a geocoded place name is cached, neighborhoods
+	// don't move
+	geocodeTTL = 24 * time.Hour
+)
+
+// withIntent points a proximity or area search where the query asked. A
+// named location is geocoded and searched around instead of the user, and
+// the radius is the request's, else the query's, else the named place's own
+// size, else DefaultRadius. The area is nil when the query named no place or
+// it couldn't be found.
+func (s *SearchService) withIntent(ctx context.Context, userIntent *claude.SearchIntent, opts SearchOptions) (SearchOptions, *maps.Area) {
+	var area *maps.Area
+	radius := float64(opts.Radius)
+
+	if location := userIntent.Location; location != nil {
+		if lat, lng, ok := parseCoordinates(location.Name); ok {
+			// the user's own location, echoed back
+			if opts.Lat == 0 && opts.Lng == 0 {
+				opts.Lat, opts.Lng = lat, lng
+			}
+		} else if named(location.Name) {
+			area = s.geocode(ctx, location.Name)
+		}
+
+		if radius == 0 {
+			radius = location.Radius * 1000
+		}
+	}
+
+	if area != nil {
+		opts.Lat, opts.Lng = area.Location.Lat, area.Location.Lng
+		if radius == 0 {
+			radius = area.RadiusMeters()
+		}
+	}
+
+	opts.Radius = searchRadius(radius)
+	return opts, area
+}
+
+// named reports whether a location from a query names a place, Claude echoes
+// back the user's location as "unknown" when it wasn't given
+func named(name string) bool {
+	name = strings.TrimSpace(name)
+	return name != "" && !strings.EqualFold(name, "unknown")
+}
+
+// searchRadius clamps a radius in meters, 0 is DefaultRadius
+func searchRadius(meters float64) uint {
+	if meters <= 0 {
+		return DefaultRadius
+	}
+	return uint(math.Round(math.Min(MaxRadius, math.Max(MinRadius, meters))))
+}
+
+// geocode finds a place named in a query. Place names are cached, and a
+// place that can't be found is logged and searched for as text instead.
+func (s *SearchService) geocode(ctx context.Context, name string) *maps.Area {
+	key := "geocode:" + normalizeQuery(name)
+	var area maps.Area
+	if cache.GetJSON(ctx, s.cache, key, &area) {
+		return &area
+	}
+
+	found, err := s.maps.Geocode(ctx, name)
+	if err != nil {
+		log.Printf("Failed to geocode %q: %v", name, err)
+		return nil
+	}
+
+	cache.SetJSON(ctx, s.cache, key, found, geocodeTTL)
+	return found
+}
+
+// parseCoordinates reads a "lat,lng" location, as the user's location is
+// passed to query analysis
+func parseCoordinates(location string) (lat, lng float64, ok bool) {
+	latText, lngText, found := strings.Cut(location, ",")
+	if !found {
+		return 0, 0, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(lngText), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// withinArea drops shops Places returned from outside a searched area, the
+// area only biases its text search
+func withinArea(shops []*maps.CoffeeShopDetails, opts SearchOptions) []*maps.CoffeeShopDetails {
+	within := make([]*maps.CoffeeShopDetails, 0, len(shops))
+	for _, shop := range shops {
+		if maps.DistanceMeters(opts.Lat, opts.Lng, shop.Location.Lat, shop.Location.Lng) <= float64(opts.Radius) {
+			within = append(within, shop)
+		}
+	}
+	return within
+}
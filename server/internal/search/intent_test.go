@@ -0,0 +1,163 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/johnnynu/Coffeehaus/internal/claude"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	gmaps "googlemaps.github.io/maps"
+)
+
+func TestWithIntent(t *testing.T) {
+	// about 1.5km from its center to the corners of its box
+	littleTokyo := &maps.Area{
+		Name:      "Little Tokyo, Los Angeles, CA, USA",
+		Location:  gmaps.LatLng{Lat: 34.0500, Lng: -118.2400},
+		Northeast: gmaps.LatLng{Lat: 34.0595, Lng: -118.2285},
+		Southwest: gmaps.LatLng{Lat: 34.0405, Lng: -118.2515},
+	}
+	user := SearchOptions{Query: "coffee", Lat: 33.6186, Lng: -117.9294}
+	intent := func(name string, radiusKm float64) *claude.SearchIntent {
+		return &claude.SearchIntent{Location: &claude.Location{Name: name, Radius: radiusKm}}
+	}
+
+	tests := []struct {
+		name         string
+		intent       *claude.SearchIntent
+		opts         SearchOptions
+		area         *maps.Area
+		wantLat      float64
+		wantRadius   uint
+		wantArea     bool
+		wantGeocodes int
+	}{
+		{
+			name:       "no location searches around the user",
+			intent:     &claude.SearchIntent{},
+			opts:       user,
+			wantLat:    user.Lat,
+			wantRadius: DefaultRadius,
+		},
+		{
+			name:       "the user's own location isn't geocoded",
+			intent:     intent("33.618600,-117.929400", 2),
+			opts:       user,
+			wantLat:    user.Lat,
+			wantRadius: 2000,
+		},
+		{
+			name:       "echoed coordinates locate a user without one",
+			intent:     intent("33.7,-117.9", 0),
+			opts:       SearchOptions{Query: "coffee"},
+			wantLat:    33.7,
+			wantRadius: DefaultRadius,
+		},
+		{
+			name:         "a named place is searched around at its own size",
+			intent:       intent("Little Tokyo", 0),
+			opts:         user,
+			area:         littleTokyo,
+			wantLat:      littleTokyo.Location.Lat,
+			wantRadius:   uint(littleTokyo.RadiusMeters() + 0.5),
+			wantArea:     true,
+			wantGeocodes: 1,
+		},
+		{
+			name:         "the query's radius beats the place's size",
+			intent:       intent("Little Tokyo", 0.5),
+			opts:         user,
+			area:         littleTokyo,
+			wantLat:      littleTokyo.Location.Lat,
+			wantRadius:   500,
+			wantArea:     true,
+			wantGeocodes: 1,
+		},
+		{
+			name:         "the request's radius beats the query's",
+			intent:       intent("Little Tokyo", 0.5),
+			opts:         SearchOptions{Lat: user.Lat, Lng: user.Lng, Radius: 3000},
+			area:         littleTokyo,
+			wantLat:      littleTokyo.Location.Lat,
+			wantRadius:   3000,
+			wantArea:     true,
+			wantGeocodes: 1,
+		},
+		{
+			name:         "a place that can't be found searches around the user",
+			intent:       intent("Atlantis", 0),
+			opts:         user,
+			wantLat:      user.Lat,
+			wantRadius:   DefaultRadius,
+			wantGeocodes: 1,
+		},
+		{
+			// Claude echoes back a user location it wasn't given
+			name:       "an unknown location isn't geocoded",
+			intent:     intent("unknown", 0),
+			opts:       user,
+			area:       littleTokyo,
+			wantLat:    user.Lat,
+			wantRadius: DefaultRadius,
+		},
+		{
+			name:       "radius is clamped",
+			intent:     intent("", 200),
+			opts:       user,
+			wantLat:    user.Lat,
+			wantRadius: MaxRadius,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			places := &fakePlaces{area: tt.area}
+			service := NewSearchService(places, nil, nil, jobs.NewMemoryQueue())
+
+			opts, area := service.withIntent(context.Background(), tt.intent, tt.opts)
+
+			if opts.Lat != tt.wantLat {
+				t.Errorf("Lat = %g, want %g", opts.Lat, tt.wantLat)
+			}
+			if opts.Radius != tt.wantRadius {
+				t.Errorf("Radius = %d, want %d", opts.Radius, tt.wantRadius)
+			}
+			if (area != nil) != tt.wantArea {
+				t.Errorf("area = %+v, want found = %v", area, tt.wantArea)
+			}
+			if places.geocodes != tt.wantGeocodes {
+				t.Errorf("geocoded %d times, want %d", places.geocodes, tt.wantGeocodes)
+			}
+		})
+	}
+}
+
+func TestWithIntent_CachesGeocoding(t *testing.T) {
+	places := &fakePlaces{area: &maps.Area{Location: gmaps.LatLng{Lat: 34.05, Lng: -118.24}}}
+	service := NewSearchService(places, nil, nil, jobs.NewMemoryQueue())
+	service.SetCache(mapCache{}, DefaultCoverageTTL)
+
+	for _, name := range []string{"Little Tokyo", "  little TOKYO"} {
+		opts, area := service.withIntent(context.Background(), &claude.SearchIntent{Location: &claude.Location{Name: name}}, SearchOptions{})
+		if area == nil || opts.Lat != 34.05 {
+			t.Fatalf("withIntent(%q) = %+v, %+v, want Little Tokyo", name, opts, area)
+		}
+	}
+	if places.geocodes != 1 {
+		t.Errorf("geocoded %d times, want once", places.geocodes)
+	}
+}
+
+func TestWithinArea(t *testing.T) {
+	opts := SearchOptions{Lat: 34.05, Lng: -118.24, Radius: 1000}
+	shops := []*maps.CoffeeShopDetails{
+		{PlaceID: "inside", Location: gmaps.LatLng{Lat: 34.051, Lng: -118.241}},
+		{PlaceID: "outside", Location: gmaps.LatLng{Lat: 34.10, Lng: -118.24}},
+	}
+
+	got := withinArea(shops, opts)
+	if len(got) != 1 || got[0].PlaceID != "inside" {
+		t.Errorf("withinArea() = %+v, want only the shop inside", got)
+	}
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+)
+
+// Personalization holds the extras returned to logged in users alongside
+// their search results, keyed by Google place ID
+type Personalization struct {
+	// Visited lists the result shops the user has posted from
+	Visited []string `json:"visited"`
+	// FollowingPosts counts posts from people the user follows at each shop
+	FollowingPosts map[string]int `json:"following_posts"`
+}
+
+type postShop struct {
+	Shops struct {
+		PlaceID string `json:"google_place_id"`
+	} `json:"shops"`
+}
+
+// Personalize adds the user's extras to a set of search results
+func (s *SearchService) Personalize(ctx context.Context, userID string, result *SearchResult) error {
+	placeIDs := make([]string, 0, len(result.Shops))
+	for _, shop := range result.Shops {
+		placeIDs = append(placeIDs, shop.PlaceID)
+	}
+
+	personal := &Personalization{
+		Visited:        []string{},
+		FollowingPosts: map[string]int{},
+	}
+	result.Personalized = personal
+	if len(placeIDs) == 0 {
+		return nil
+	}
+
+	visited, err := s.postsAtShops([]string{userID}, placeIDs)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, post := range visited {
+		if !seen[post.Shops.PlaceID] {
+			seen[post.Shops.PlaceID] = true
+			personal.Visited = append(personal.Visited, post.Shops.PlaceID)
+		}
+	}
+
+	res, _, err := s.db.From("follows").
+		Select("following_id", "", false).
+		Eq("follower_id", userID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fetch follows: %w", err)
+	}
+
+	var follows []struct {
+		FollowingID string `json:"following_id"`
+	}
+	if err := json.Unmarshal(res, &follows); err != nil {
+		return fmt.Errorf("failed to parse follows: %w", err)
+	}
+	if len(follows) == 0 {
+		return nil
+	}
+
+	followingIDs := make([]string, len(follows))
+	for i, f := range follows {
+		followingIDs[i] = f.FollowingID
+	}
+
+	posts, err := s.postsAtShops(followingIDs, placeIDs)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		personal.FollowingPosts[post.Shops.PlaceID]++
+	}
+
+	return nil
+}
+
+// postsAtShops returns the posts by any of the users at any of the places
+func (s *SearchService) postsAtShops(userIDs, placeIDs []string) ([]postShop, error) {
+	query := s.db.From("posts").Select("shops!inner(google_place_id)", "", false)
+	query = database.In(query, "user_id", userIDs)
+	res, _, err := database.In(query, "shops.google_place_id", placeIDs).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch posts at shops: %w", err)
+	}
+
+	var posts []postShop
+	if err := json.Unmarshal(res, &posts); err != nil {
+		return nil, fmt.Errorf("failed to parse posts at shops: %w", err)
+	}
+
+	return posts, nil
+}
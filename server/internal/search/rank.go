@@ -0,0 +1,290 @@
+package search
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	gmaps "googlemaps.github.io/maps"
+)
+
+// RankWeights is how much each signal counts towards a shop's score. Every
+// signal scores from 0 to 1 before it is weighted, a weight of 0 ignores it.
+type RankWeights struct {
+	// Distance favours shops near the user, when the search has a location
+	Distance float64
+	// Rating is the Google rating, trusted more the more ratings it has
+	Rating float64
+	// CoffeehausRating is the rating set by Coffeehaus admins
+	CoffeehausRating float64
+	OpenNow          float64
+	// Filters favours shops matching the filters in the query, like "matcha"
+	Filters float64
+	// Personal favours shops the user has posted from and ones people they
+	// follow have posted from. Shops can't be saved yet, so saved shops
+	// aren't a signal; they belong here once they can be.
+	Personal float64
+}
+
+// DefaultRankWeights rank mostly by distance and ratings
+var DefaultRankWeights = RankWeights{
+	Distance:         3,
+	Rating:           2,
+	CoffeehausRating: 1.5,
+	OpenNow:          1,
+	Filters:          1.5,
+	Personal:         1,
+}
+
+const (
+	// ratingPriorVotes and ratingPrior pull the ratings of shops with few
+	// reviews towards an average shop's
+	ratingPriorVotes = 20
+	ratingPrior      = 3.5
+	// followingPostsCap is how many posts by followed users score fully
+	followingPostsCap = 3
+
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+)
+
+// ScoreBreakdown is how a shop's score was made up, each signal already
+// weighted. Searches in debug mode return one for each shop.
+type ScoreBreakdown struct {
+	PlaceID string `json:"place_id"`
+	// DistanceMeters is nil when the search had no location
+	DistanceMeters   *float64 `json:"distance_meters,omitempty"`
+	Distance         float64  `json:"distance"`
+	Rating           float64  `json:"rating"`
+	CoffeehausRating float64  `json:"coffeehaus_rating"`
+	OpenNow          float64  `json:"open_now"`
+	Filters          float64  `json:"filters"`
+	Personal         float64  `json:"personal"`
+	Total            float64  `json:"total"`
+}
+
+// ShopRatings looks up what Coffeehaus knows about shops beyond Places data
+type ShopRatings interface {
+	CoffeehausRatings(ctx context.Context, placeIDs []string) (map[string]float64, error)
+}
+
+// rankSignals are the signals that don't come with the shops themselves
+type rankSignals struct {
+	// ratings are Coffeehaus ratings by place ID
+	ratings  map[string]float64
+	personal *Personalization
+}
+
+// SetRankWeights sets how results are ranked
+func (s *SearchService) SetRankWeights(weights RankWeights) {
+	s.weights = weights
+}
+
+// rank orders the result's shops best first. Ratings that can't be looked
+// up only make the ranking worse, so they are logged.
+func (s *SearchService) rank(ctx context.Context, opts SearchOptions, result *SearchResult) {
+	signals := rankSignals{personal: result.Personalized}
+	if s.ratings != nil && len(result.Shops) > 0 {
+		placeIDs := make([]string, len(result.Shops))
+		for i, shop := range result.Shops {
+			placeIDs[i] = shop.PlaceID
+		}
+
+		ratings, err := s.ratings.CoffeehausRatings(ctx, placeIDs)
+		if err != nil {
+			log.Printf("Failed to look up coffeehaus ratings: %v", err)
+		}
+		signals.ratings = ratings
+	}
+
+	ranking := rankShops(result.Shops, opts, result.Filters, signals, s.weights, time.Now())
+	if opts.Debug {
+		result.Ranking = ranking
+	}
+}
+
+// rankShops sorts shops by score, keeping the order they were found in for
+// equal scores, and returns the score of each in their new order
+func rankShops(shops []*maps.CoffeeShopDetails, opts SearchOptions, filters []string, signals rankSignals, weights RankWeights, now time.Time) []ScoreBreakdown {
+	scores := make(map[*maps.CoffeeShopDetails]ScoreBreakdown, len(shops))
+	for _, shop := range shops {
+		scores[shop] = scoreShop(shop, opts, filters, signals, weights, now)
+	}
+
+	sort.SliceStable(shops, func(i, j int) bool {
+		return scores[shops[i]].Total > scores[shops[j]].Total
+	})
+
+	ranking := make([]ScoreBreakdown, len(shops))
+	for i, shop := range shops {
+		ranking[i] = scores[shop]
+	}
+	return ranking
+}
+
+func scoreShop(shop *maps.CoffeeShopDetails, opts SearchOptions, filters []string, signals rankSignals, weights RankWeights, now time.Time) ScoreBreakdown {
+	score := ScoreBreakdown{PlaceID: shop.PlaceID}
+
+	if opts.Lat != 0 || opts.Lng != 0 {
+		distance := maps.DistanceMeters(opts.Lat, opts.Lng, shop.Location.Lat, shop.Location.Lng)
+		score.DistanceMeters = &distance
+		score.Distance = weights.Distance * distanceScore(distance, opts.Radius)
+	}
+
+	score.Rating = weights.Rating * ratingScore(shop.Rating, shop.UserRatingsTotal)
+
+	rating, rated := signals.ratings[shop.PlaceID]
+	score.CoffeehausRating = weights.CoffeehausRating * coffeehausScore(rating, rated)
+
+	score.OpenNow = weights.OpenNow * 0.5
+	if open, known := openAt(shop.OpeningHours, shop.UTCOffset, shop.Location.Lng, now); known {
+		score.OpenNow = weights.OpenNow * boolScore(open)
+	}
+
+	score.Filters = weights.Filters * filterScore(shop, filters)
+	score.Personal = weights.Personal * personalScore(shop.PlaceID, signals.personal)
+
+	score.Total = score.Distance + score.Rating + score.CoffeehausRating + score.OpenNow + score.Filters + score.Personal
+	return score
+}
+
+// distanceScore falls from 1 at the user to 0 at the edge of the search
+func distanceScore(meters float64, radius uint) float64 {
+	if radius == 0 {
+		return 0
+	}
+	return math.Max(0, 1-meters/float64(radius))
+}
+
+// ratingScore is the Google rating out of 5, averaged with a prior so a few
+// glowing reviews don't beat hundreds of good ones
+func ratingScore(rating float32, total int) float64 {
+	votes := float64(total)
+	if rating == 0 {
+		votes = 0
+	}
+	average := (votes*float64(rating) + ratingPriorVotes*ratingPrior) / (votes + ratingPriorVotes)
+	return average / 5
+}
+
+// coffeehausScore maps a rating from 1 to 5 onto 0 to 1. Unrated shops count
+// as middling rather than bad.
+func coffeehausScore(rating float64, rated bool) float64 {
+	if !rated {
+		return 0.5
+	}
+	return math.Min(1, math.Max(0, (rating-1)/4))
+}
+
+// filterScore is the share of filters the shop's name or types match
+func filterScore(shop *maps.CoffeeShopDetails, filters []string) float64 {
+	if len(filters) == 0 {
+		return 0
+	}
+
+	text := normalizeFilterText(shop.Name + " " + strings.Join(shop.Types, " "))
+	matched := 0
+	for _, filter := range filters {
+		if filter := normalizeFilterText(filter); filter != "" && strings.Contains(text, filter) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(filters))
+}
+
+// normalizeFilterText lowercases text and treats "pour-over", "pour_over"
+// and "pour over" alike
+func normalizeFilterText(text string) string {
+	text = strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(text))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// personalScore is half for a shop the user has posted from and up to half
+// for posts there by people they follow
+func personalScore(placeID string, personal *Personalization) float64 {
+	if personal == nil {
+		return 0
+	}
+
+	score := 0.0
+	for _, visited := range personal.Visited {
+		if visited == placeID {
+			score += 0.5
+			break
+		}
+	}
+	posts := math.Min(float64(personal.FollowingPosts[placeID]), followingPostsCap)
+	return score + 0.5*posts/followingPostsCap
+}
+
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// openAt reports whether a shop is open at now, and whether its hours say.
+// Opening periods are in the shop's local time, from the UTC offset Places
+// gave for it. Shops synced before offsets were kept have their offset
+// estimated from their longitude, which can be an hour out near time zone
+// borders or over daylight saving. Without periods Places' open now, from
+// when the shop was fetched, is used.
+func openAt(hours *gmaps.OpeningHours, utcOffset *int, lng float64, now time.Time) (open, known bool) {
+	if hours == nil {
+		return false, false
+	}
+	if len(hours.Periods) == 0 {
+		if hours.OpenNow == nil {
+			return false, false
+		}
+		return *hours.OpenNow, true
+	}
+
+	offset := time.Duration(math.Round(lng/15)) * time.Hour
+	if utcOffset != nil {
+		offset = time.Duration(*utcOffset) * time.Minute
+	}
+	local := now.UTC().Add(offset)
+	minute := int(local.Weekday())*minutesPerDay + local.Hour()*60 + local.Minute()
+
+	for _, period := range hours.Periods {
+		opens, ok := weekMinute(period.Open)
+		if !ok {
+			continue
+		}
+		// a period that never closes is a shop open around the clock
+		if period.Close.Time == "" {
+			return true, true
+		}
+		closes, ok := weekMinute(period.Close)
+		if !ok {
+			continue
+		}
+		// saturday night into sunday morning wraps around the week
+		if closes <= opens {
+			closes += minutesPerWeek
+		}
+		if (minute >= opens && minute < closes) || (minute+minutesPerWeek >= opens && minute+minutesPerWeek < closes) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// weekMinute is the minute of the week an opening time falls on
+func weekMinute(t gmaps.OpeningHoursOpenClose) (int, bool) {
+	if len(t.Time) != 4 {
+		return 0, false
+	}
+	hhmm, err := strconv.Atoi(t.Time)
+	if err != nil || hhmm/100 > 23 || hhmm%100 > 59 {
+		return 0, false
+	}
+	return int(t.Day)*minutesPerDay + (hhmm/100)*60 + hhmm%100, true
+}
@@ -0,0 +1,239 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	gmaps "googlemaps.github.io/maps"
+)
+
+func TestRankShops(t *testing.T) {
+	// monday noon at longitude 0, where local time is UTC
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	weekdays := &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{{
+		Open:  gmaps.OpeningHoursOpenClose{Day: time.Monday, Time: "0700"},
+		Close: gmaps.OpeningHoursOpenClose{Day: time.Monday, Time: "1500"},
+	}}}
+	shop := func(id string, lat float64, rating float32, total int) *maps.CoffeeShopDetails {
+		return &maps.CoffeeShopDetails{
+			PlaceID:          id,
+			Name:             id,
+			Location:         gmaps.LatLng{Lat: lat, Lng: -117.9},
+			Rating:           rating,
+			UserRatingsTotal: total,
+		}
+	}
+	near := SearchOptions{Lat: 33.6, Lng: -117.9, Radius: 10000}
+
+	tests := []struct {
+		name    string
+		shops   []*maps.CoffeeShopDetails
+		opts    SearchOptions
+		filters []string
+		signals rankSignals
+		weights RankWeights
+		want    []string
+	}{
+		{
+			name:    "closer shops first",
+			shops:   []*maps.CoffeeShopDetails{shop("far", 33.65, 4, 100), shop("near", 33.61, 4, 100)},
+			opts:    near,
+			weights: RankWeights{Distance: 1},
+			want:    []string{"near", "far"},
+		},
+		{
+			// 5 stars from 2 reviews shouldn't beat 4.7 from 2000
+			name:    "many good ratings beat a few great ones",
+			shops:   []*maps.CoffeeShopDetails{shop("few", 0, 5, 2), shop("many", 0, 4.7, 2000)},
+			weights: RankWeights{Rating: 1},
+			want:    []string{"many", "few"},
+		},
+		{
+			name:    "coffeehaus rating",
+			shops:   []*maps.CoffeeShopDetails{shop("unrated", 0, 0, 0), shop("poor", 0, 0, 0), shop("great", 0, 0, 0)},
+			signals: rankSignals{ratings: map[string]float64{"poor": 1.5, "great": 4.5}},
+			weights: RankWeights{CoffeehausRating: 1},
+			want:    []string{"great", "unrated", "poor"},
+		},
+		{
+			name: "open shops first",
+			shops: []*maps.CoffeeShopDetails{
+				{PlaceID: "closed", OpeningHours: &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{{
+					Open:  gmaps.OpeningHoursOpenClose{Day: time.Tuesday, Time: "0700"},
+					Close: gmaps.OpeningHoursOpenClose{Day: time.Tuesday, Time: "1500"},
+				}}}},
+				{PlaceID: "unknown"},
+				{PlaceID: "open", OpeningHours: weekdays},
+			},
+			weights: RankWeights{OpenNow: 1},
+			want:    []string{"open", "unknown", "closed"},
+		},
+		{
+			name: "filter matches",
+			shops: []*maps.CoffeeShopDetails{
+				{PlaceID: "plain", Name: "Corner Coffee", Types: []string{"cafe"}},
+				{PlaceID: "matcha", Name: "Matcha Pour-Over Bar", Types: []string{"cafe"}},
+				{PlaceID: "bakery", Name: "Sunrise", Types: []string{"cafe", "bakery"}},
+			},
+			filters: []string{"matcha", "pour over", "bakery"},
+			weights: RankWeights{Filters: 1},
+			want:    []string{"matcha", "bakery", "plain"},
+		},
+		{
+			name:  "personal signals",
+			shops: []*maps.CoffeeShopDetails{shop("none", 0, 0, 0), shop("followed", 0, 0, 0), shop("visited", 0, 0, 0)},
+			signals: rankSignals{personal: &Personalization{
+				Visited:        []string{"visited"},
+				FollowingPosts: map[string]int{"visited": 3, "followed": 1},
+			}},
+			weights: RankWeights{Personal: 1},
+			want:    []string{"visited", "followed", "none"},
+		},
+		{
+			name:    "ties keep the order shops were found in",
+			shops:   []*maps.CoffeeShopDetails{shop("first", 0, 4, 10), shop("second", 0, 4, 10)},
+			weights: DefaultRankWeights,
+			want:    []string{"first", "second"},
+		},
+		{
+			// a much better rated shop outweighs being a little further away
+			name:    "signals combine",
+			shops:   []*maps.CoffeeShopDetails{shop("near", 33.61, 3, 500), shop("better", 33.615, 4.8, 500)},
+			opts:    near,
+			weights: DefaultRankWeights,
+			want:    []string{"better", "near"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranking := rankShops(tt.shops, tt.opts, tt.filters, tt.signals, tt.weights, now)
+
+			for i, want := range tt.want {
+				if tt.shops[i].PlaceID != want {
+					t.Fatalf("shop %d = %s, want %s", i, tt.shops[i].PlaceID, want)
+				}
+				if ranking[i].PlaceID != want {
+					t.Errorf("ranking %d = %s, want %s", i, ranking[i].PlaceID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreShop_Breakdown(t *testing.T) {
+	shop := &maps.CoffeeShopDetails{PlaceID: "place-1", Name: "Matcha Cafe", Location: gmaps.LatLng{Lat: 33.645, Lng: -117.9}}
+	opts := SearchOptions{Lat: 33.6, Lng: -117.9, Radius: 10000}
+	weights := RankWeights{Distance: 2, CoffeehausRating: 1, OpenNow: 1, Filters: 1}
+
+	score := scoreShop(shop, opts, []string{"matcha"}, rankSignals{}, weights, time.Now())
+
+	if score.DistanceMeters == nil || *score.DistanceMeters < 4900 || *score.DistanceMeters > 5100 {
+		t.Fatalf("DistanceMeters = %v, want about 5000", score.DistanceMeters)
+	}
+	if score.Distance < 0.95 || score.Distance > 1.05 {
+		t.Errorf("Distance = %g, want about half the weight of 2", score.Distance)
+	}
+	// no weight, no score
+	if score.Rating != 0 || score.Personal != 0 {
+		t.Errorf("Rating = %g, Personal = %g, want 0 with no weight", score.Rating, score.Personal)
+	}
+	// unrated and unknown hours count as middling
+	if score.CoffeehausRating != 0.5 || score.OpenNow != 0.5 {
+		t.Errorf("CoffeehausRating = %g, OpenNow = %g, want 0.5", score.CoffeehausRating, score.OpenNow)
+	}
+	if score.Filters != 1 {
+		t.Errorf("Filters = %g, want 1", score.Filters)
+	}
+
+	total := score.Distance + score.Rating + score.CoffeehausRating + score.OpenNow + score.Filters + score.Personal
+	if score.Total != total {
+		t.Errorf("Total = %g, want the sum %g", score.Total, total)
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	period := func(openDay time.Weekday, opens string, closeDay time.Weekday, closes string) gmaps.OpeningHoursPeriod {
+		return gmaps.OpeningHoursPeriod{
+			Open:  gmaps.OpeningHoursOpenClose{Day: openDay, Time: opens},
+			Close: gmaps.OpeningHoursOpenClose{Day: closeDay, Time: closes},
+		}
+	}
+	open := true
+	arizona := -7 * 60
+	// saturday 2024-01-06 at 23:30 UTC
+	saturdayNight := time.Date(2024, time.January, 6, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		hours     *gmaps.OpeningHours
+		utcOffset *int
+		lng       float64
+		now       time.Time
+		wantOpen  bool
+		wantKnown bool
+	}{
+		{
+			name:  "no hours",
+			now:   saturdayNight,
+			hours: nil,
+		},
+		{
+			name:      "open now without periods",
+			hours:     &gmaps.OpeningHours{OpenNow: &open},
+			now:       saturdayNight,
+			wantOpen:  true,
+			wantKnown: true,
+		},
+		{
+			name:      "closed outside periods",
+			hours:     &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{period(time.Saturday, "0700", time.Saturday, "1500")}},
+			now:       saturdayNight,
+			wantKnown: true,
+		},
+		{
+			name:      "open past midnight into sunday",
+			hours:     &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{period(time.Saturday, "2000", time.Sunday, "0200")}},
+			now:       saturdayNight,
+			wantOpen:  true,
+			wantKnown: true,
+		},
+		{
+			name:      "open around the clock",
+			hours:     &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{{Open: gmaps.OpeningHoursOpenClose{Day: time.Sunday, Time: "0000"}}}},
+			now:       saturdayNight,
+			wantOpen:  true,
+			wantKnown: true,
+		},
+		{
+			// 23:30 UTC is 15:30 in california, before closing
+			name:      "periods are in the shop's time",
+			hours:     &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{period(time.Saturday, "0700", time.Saturday, "1600")}},
+			lng:       -117.9,
+			now:       saturdayNight,
+			wantOpen:  true,
+			wantKnown: true,
+		},
+		{
+			// longitude puts arizona at UTC-8 but Places says UTC-7, so 23:30
+			// UTC is 16:30 there, after closing
+			name:      "the offset from Places wins over longitude",
+			hours:     &gmaps.OpeningHours{Periods: []gmaps.OpeningHoursPeriod{period(time.Saturday, "0700", time.Saturday, "1600")}},
+			utcOffset: &arizona,
+			lng:       -114.6,
+			now:       saturdayNight,
+			wantOpen:  false,
+			wantKnown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOpen, gotKnown := openAt(tt.hours, tt.utcOffset, tt.lng, tt.now)
+			if gotOpen != tt.wantOpen || gotKnown != tt.wantKnown {
+				t.Errorf("openAt() = %v, %v, want %v, %v", gotOpen, gotKnown, tt.wantOpen, tt.wantKnown)
+			}
+		})
+	}
+}
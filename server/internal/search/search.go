@@ -2,42 +2,261 @@ package search
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/johnnynu/Coffeehaus/internal/budget"
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/cache"
 	"github.com/johnnynu/Coffeehaus/internal/claude"
 	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
 	"github.com/johnnynu/Coffeehaus/internal/maps"
 	"github.com/johnnynu/Coffeehaus/internal/shop"
 )
 
 type SearchService struct {
-	maps *maps.MapsClient
+	maps PlacesClient
 	db *database.Client
-	claude *claude.Service
-	shops *shop.SyncManager
+	claude QueryAnalyzer
+	jobs jobs.Queue
+	placesLimit RateCheck
+	matchConfidence float64
+	index ShopIndex
+	cache cache.Cache
+	cacheTTL time.Duration
+	breaker *breaker.Breaker
+	ratings ShopRatings
+	weights RankWeights
+	coverage CoverageStore
+	coverageTTL time.Duration
+	names ShopNames
+	autocompleteTTL time.Duration
 }
 
-func NewSearchService(maps *maps.MapsClient, db *database.Client, claude *claude.Service, shops *shop.SyncManager) *SearchService {
-	return &SearchService{
+// DefaultMatchConfidence is the name match score, from 0 to 1, at which a
+// specific search trusts the db and skips Places
+const DefaultMatchConfidence = 0.6
+
+// minMatchSimilarity is the loosest name match returned from the db
+const minMatchSimilarity = 0.3
+
+// PlacesClient is the part of the maps client search uses
+type PlacesClient interface {
+	SearchCoffeeShops(ctx context.Context, lat, lng float64, radiusMeters uint) ([]*maps.CoffeeShopDetails, error)
+	SearchNearestCoffeeShops(ctx context.Context, lat, lng float64) (*maps.Nearby, error)
+	SearchSpecificCoffeeShop(ctx context.Context, shopName string, location string) ([]*maps.CoffeeShopDetails, error)
+	SearchCoffeeShopsByArea(ctx context.Context, query string, bias *maps.Bias) ([]*maps.CoffeeShopDetails, error)
+	ReverseGeocode(ctx context.Context, lat, lng float64) (string, error)
+	Geocode(ctx context.Context, address string) (*maps.Area, error)
+	Autocomplete(ctx context.Context, input string, bias *maps.Bias, session string) ([]maps.Prediction, error)
+	GetSuggestedPlace(ctx context.Context, placeID string, session string) (*maps.CoffeeShopDetails, error)
+}
+
+// QueryAnalyzer works out what kind of search a query is
+type QueryAnalyzer interface {
+	AnalyzeSearchQuery(ctx context.Context, query string, userLocation string) (*claude.SearchIntent, error)
+}
+
+// ShopIndex is a search index of shops, faster than the db but only holding
+// shops synced since it was created
+type ShopIndex interface {
+	SearchShops(ctx context.Context, query shop.IndexQuery) ([]*shop.Shop, error)
+}
+
+// RateCheck is asked before a request costs a Places call and returns an
+// error when the caller has used up their budget
+type RateCheck func(ctx context.Context) error
+
+func NewSearchService(maps PlacesClient, db *database.Client, claude QueryAnalyzer, queue jobs.Queue) *SearchService {
+	s := &SearchService{
 		maps: maps,
 		db: db,
 		claude: claude,
-		shops: shops,
+		jobs: queue,
+		matchConfidence: DefaultMatchConfidence,
+		cache: cache.Noop{},
+		weights: DefaultRankWeights,
+		coverageTTL: DefaultCoverageTTL,
+		autocompleteTTL: DefaultAutocompleteTTL,
+	}
+	if db != nil {
+		s.ratings = db
+		s.coverage = db
+		s.names = db
+	}
+	return s
+}
+
+// SetCache sets where search results are cached and for how long
+func (s *SearchService) SetCache(c cache.Cache, ttl time.Duration) {
+	s.cache = c
+	s.cacheTTL = ttl
+}
+
+// SetBreaker sets the breaker index searches and job queueing go through, so
+// search carries on without them while redis is down
+func (s *SearchService) SetBreaker(b *breaker.Breaker) {
+	s.breaker = b
+}
+
+// guarded calls fn through the breaker, if one is set
+func (s *SearchService) guarded(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.breaker == nil {
+		return fn(ctx)
+	}
+	return s.breaker.Do(ctx, fn)
+}
+
+// SetMatchConfidence sets the name match score at which a specific search
+// answers from the db alone
+func (s *SearchService) SetMatchConfidence(confidence float64) {
+	s.matchConfidence = confidence
+}
+
+// SetIndex sets the index searched before the db
+func (s *SearchService) SetIndex(index ShopIndex) {
+	s.index = index
+}
+
+// SetPlacesLimit sets the check run before each Places search
+func (s *SearchService) SetPlacesLimit(check RateCheck) {
+	s.placesLimit = check
+}
+
+// checkPlaces runs the places limit, if one is set
+func (s *SearchService) checkPlaces(ctx context.Context) error {
+	if s.placesLimit == nil {
+		return nil
 	}
+	return s.placesLimit(ctx)
 }
 
-// Search is the entry point for the search service
+// Search is the entry point for the search service. Results are cached,
+// except degraded ones which should be retried, then personalized for the
+// user and ranked.
 func (s *SearchService) Search(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
+	// a picked suggestion is fetched as it is, uncached so its details call
+	// ends the autocomplete session every time
+	if opts.PlaceID != "" {
+		result, err := s.findPlace(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.personalize(ctx, opts, result)
+		return result, nil
+	}
+
 	// default values
 	if opts.Limit == 0 {
 		opts.Limit = 10
 	}
 
-	if opts.Radius == 0 {
-		opts.Radius = 10000 // 10km
+	// every shop up to the end of the page is found and ranked together, the
+	// page is cut from them once they are ranked
+	candidates := opts
+	candidates.Limit = max(opts.Offset, 0) + opts.Limit
+	candidates.Offset = 0
+
+	key := cacheKey(candidates)
+	var found searched
+	if !cache.GetJSON(ctx, s.cache, key, &found) || found.Result == nil {
+		var err error
+		if found.Result, found.Opts, err = s.search(ctx, candidates); err != nil {
+			return nil, err
+		}
+		if !found.Result.Degraded {
+			cache.SetJSON(ctx, s.cache, key, found, s.cacheTTL)
+		}
+	}
+	result := found.Result
+
+	s.personalize(ctx, opts, result)
+	// shops are ranked by their distance from where the search looked, which
+	// a query naming a place moves
+	opts.Lat, opts.Lng, opts.Radius = found.Opts.Lat, found.Opts.Lng, found.Opts.Radius
+	s.rank(ctx, opts, result)
+	page(result, opts.Offset, opts.Limit)
+	return result, nil
+}
+
+// personalize adds a logged in user's extras, which are best effort
+func (s *SearchService) personalize(ctx context.Context, opts SearchOptions, result *SearchResult) {
+	if opts.UserID == "" {
+		return
+	}
+	if err := s.Personalize(ctx, opts.UserID, result); err != nil {
+		log.Printf("Failed to personalize search results: %v", err)
+	}
+}
+
+// findPlace fetches the place of a picked autocomplete suggestion from
+// Places, passing on the session it was picked in
+func (s *SearchService) findPlace(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
+	if err := s.checkPlaces(ctx); err != nil {
+		return nil, err
+	}
+
+	place, err := s.maps.GetSuggestedPlace(ctx, opts.PlaceID, opts.Session)
+	if errors.Is(err, budget.ErrUnavailable) {
+		return degradedResult(nil, err), nil
+	}
+	if errors.Is(err, maps.ErrNoResults) {
+		return &SearchResult{Shops: []*maps.CoffeeShopDetails{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find place: %w", err)
+	}
+
+	// a shop an admin has hidden may still be suggested from a stale cache
+	if s.names != nil {
+		hidden, err := s.names.HiddenPlaceIDs(ctx, []string{place.PlaceID})
+		if err != nil {
+			log.Printf("Failed to check for hidden shops: %v", err)
+		}
+		if hidden[place.PlaceID] {
+			return &SearchResult{Shops: []*maps.CoffeeShopDetails{}}, nil
+		}
+	}
+
+	shops := []*maps.CoffeeShopDetails{place}
+	s.backgroundSyncShops(ctx, shops)
+	return &SearchResult{
+		Shops: shops,
+	}, nil
+}
+
+// page cuts ranked results down to limit shops from offset
+func page(result *SearchResult, offset, limit int) {
+	start := min(max(offset, 0), len(result.Shops))
+	end := min(start+max(limit, 0), len(result.Shops))
+	result.Shops = result.Shops[start:end]
+	if result.Ranking != nil {
+		result.Ranking = result.Ranking[start:end]
 	}
+}
+
+// searched is a search's results and the options it ran with
+type searched struct {
+	Result *SearchResult
+	Opts   SearchOptions
+}
 
+// cacheKey identifies a search. Locations are rounded to about 100m so
+// nearby users share results.
+func cacheKey(opts SearchOptions) string {
+	id := fmt.Sprintf("%s|%.3f|%.3f|%d|%d|%d", normalizeQuery(opts.Query), opts.Lat, opts.Lng, opts.Radius, opts.Limit, opts.Offset)
+	sum := sha256.Sum256([]byte(id))
+	return "search:" + hex.EncodeToString(sum[:16])
+}
+
+// search finds the shops a query asks for. The options returned are those
+// searched with, around the place the query named and within its radius.
+func (s *SearchService) search(ctx context.Context, opts SearchOptions) (*SearchResult, SearchOptions, error) {
 	// get user location
 	userLocation := "unknown"
 	if opts.Lat != 0 && opts.Lng != 0 {
@@ -46,30 +265,67 @@ func (s *SearchService) Search(ctx context.Context, opts SearchOptions) (*Search
 
 	// use claude to analyze search query
 	userIntent, err := s.claude.AnalyzeSearchQuery(ctx, opts.Query, userLocation)
+	if errors.Is(err, budget.ErrUnavailable) {
+		log.Printf("Query analysis unavailable, searching db only: %v", err)
+		opts.Radius = searchRadius(float64(opts.Radius))
+		result, err := s.dbOnlySearch(ctx, opts)
+		return result, opts, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to analyze search query: %w", err)
+		return nil, opts, fmt.Errorf("failed to analyze search query: %w", err)
 	}
 
 	// handle search based on intent type
+	var result *SearchResult
 	switch userIntent.SearchType {
 	case "specific":
-		return s.handleSpecificSearch(ctx, userIntent, opts)
+		opts.Radius = searchRadius(float64(opts.Radius))
+		result, err = s.handleSpecificSearch(ctx, userIntent, opts)
 	case "area":
-		return s.handleAreaSearch(ctx, opts)
+		var area *maps.Area
+		opts, area = s.withIntent(ctx, userIntent, opts)
+		result, err = s.handleAreaSearch(ctx, userIntent, opts, area)
 	default:
-		return s.handleProximitySearch(ctx, opts)
+		opts, _ = s.withIntent(ctx, userIntent, opts)
+		result, err = s.handleProximitySearch(ctx, opts)
+	}
+	if err != nil {
+		return nil, opts, err
 	}
+
+	result.Filters = userIntent.Terms.Filters
+	return result, opts, nil
 }
 
 func (s *SearchService) handleSpecificSearch(ctx context.Context, userIntent *claude.SearchIntent, opts SearchOptions) (*SearchResult, error) {
-	// try to find shop in db
-	dbShop, err := s.db.FindShopsByName(ctx, userIntent.Terms.Shop)
-	if err == nil && len(dbShop) > 0 {
+	name := shopName(userIntent, opts)
+
+	// every word of an index match is in the name, allowing a typo each,
+	// which is as sure as a confident db match
+	local := s.searchIndex(ctx, shop.IndexQuery{Text: name, Limit: opts.Limit})
+	confident := len(local) > 0
+	if !confident {
+		local, confident = s.findByName(ctx, userIntent, opts)
+	}
+
+	// a confident match may be one branch of a chain with others nearby, so
+	// Places is only skipped when it was asked recently around here
+	query := normalizeQuery(name)
+	cell := specificCell(opts)
+	if confident && s.covered(ctx, query, []string{cell}, len(local), opts.Limit) {
 		return &SearchResult{
-			Shops: dbShop,
+			Shops: local,
 		}, nil
 	}
 
+	// everything past here costs google api calls
+	if err := s.checkPlaces(ctx); err != nil {
+		if confident {
+			return degradedResult(local, err), nil
+		}
+		return nil, err
+	}
+
 	// determine location context for the search
 	var locationContext string
 
@@ -85,130 +341,279 @@ func (s *SearchService) handleSpecificSearch(ctx context.Context, userIntent *cl
 	}
 
 	// Case 2: fall back to location from claude's intent analysis
-	if locationContext == "" && userIntent.Location != nil && userIntent.Location.Name != "" {
+	if locationContext == "" && userIntent.Location != nil && named(userIntent.Location.Name) {
 		locationContext = userIntent.Location.Name
 	}
 
-	// if not found in DB, search using places api
+	// search places too, a weak db match is likely a different shop
 	shops, err := s.maps.SearchSpecificCoffeeShop(ctx, opts.Query, locationContext)
+	if errors.Is(err, budget.ErrUnavailable) {
+		return degradedResult(local, err), nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for specific coffee shop: %w", err)
 	}
 
-	s.backgroundSyncShops(shops)
+	shops = s.withoutHidden(ctx, shops)
+	s.backgroundSyncShops(ctx, shops)
+	s.recordCoverage(ctx, query, map[string]int{cell: len(shops)})
 
+	if confident {
+		shops = mergeShops(local, shops)
+	}
 	return &SearchResult{
 		Shops: shops,
 	}, nil
 }
 
-func (s *SearchService) handleAreaSearch(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
-	shops, err := s.maps.SearchCoffeeShopsByArea(ctx, opts.Query)
+// findByName searches the db for the shop named in the query. It reports
+// whether the best match is close enough to answer the search on its own.
+func (s *SearchService) findByName(ctx context.Context, userIntent *claude.SearchIntent, opts SearchOptions) ([]*maps.CoffeeShopDetails, bool) {
+	name := shopName(userIntent, opts)
+
+	matches, err := s.db.SearchShopsByName(ctx, database.NameSearch{
+		Query:         name,
+		Lat:           opts.Lat,
+		Lng:           opts.Lng,
+		Limit:         opts.Limit,
+		MinSimilarity: minMatchSimilarity,
+	})
+	if err != nil {
+		log.Printf("Failed to search db for %q: %v", name, err)
+		return nil, false
+	}
+	if len(matches) == 0 {
+		return nil, false
+	}
+
+	shops := make([]*maps.CoffeeShopDetails, len(matches))
+	for i, match := range matches {
+		shops[i] = match.Shop
+	}
+	return shops, confidentMatch(matches, s.matchConfidence)
+}
+
+// shopName is the shop a specific search is for
+func shopName(userIntent *claude.SearchIntent, opts SearchOptions) string {
+	if userIntent.Terms.Shop != "" {
+		return userIntent.Terms.Shop
+	}
+	return opts.Query
+}
+
+// confidentMatch reports whether any match's name, before the distance
+// penalty, scores at least the threshold. A far away branch is still the
+// shop that was asked for.
+func confidentMatch(matches []database.ShopMatch, threshold float64) bool {
+	for _, match := range matches {
+		if match.Similarity >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SearchService) handleAreaSearch(ctx context.Context, userIntent *claude.SearchIntent, opts SearchOptions, area *maps.Area) (*SearchResult, error) {
+	if err := s.checkPlaces(ctx); err != nil {
+		return nil, err
+	}
+
+	query := opts.Query
+	if userIntent.NormalizedQuery != "" {
+		query = userIntent.NormalizedQuery
+	}
+
+	// a named place that was found is searched around, otherwise google
+	// makes what it can of the text
+	var bias *maps.Bias
+	if area != nil {
+		bias = &maps.Bias{Location: area.Location, RadiusMeters: opts.Radius}
+	}
+
+	shops, err := s.maps.SearchCoffeeShopsByArea(ctx, query, bias)
+	if errors.Is(err, budget.ErrUnavailable) {
+		return degradedResult(nil, err), nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("area search failed: %w", err)
 	}
 
-	s.backgroundSyncShops(shops)
+	shops = s.withoutHidden(ctx, shops)
+	s.backgroundSyncShops(ctx, shops)
 
+	if area != nil {
+		shops = withinArea(shops, opts)
+	}
 	return &SearchResult{
-		Shops: shops,
+		Shops: nonNil(shops),
 	}, nil
 }
 
 func (s *SearchService) handleProximitySearch(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
-	// Try database first
-	dbShops, err := s.db.FindShopsByLocation(ctx, opts.Lat, opts.Lng, opts.Radius)
-	if err == nil && len(dbShops) > 0 {
+	local := s.searchNearby(ctx, opts)
+	if len(local) == 0 {
+		dbShops, err := s.db.FindShopsByLocation(ctx, opts.Lat, opts.Lng, opts.Radius)
+		if err != nil {
+			log.Printf("Failed to search db near %f,%f: %v", opts.Lat, opts.Lng, err)
+		}
+		local = dbShops
+	}
+
+	// a few shops seen before don't mean the area's others are known, the
+	// db answers alone only where Places searched every cell recently
+	cells := nearbyCells(opts)
+	if s.covered(ctx, "", cells, len(local), opts.Limit) {
 		return &SearchResult{
-			Shops: dbShops,
+			Shops: nonNil(local),
 		}, nil
 	}
 
-	// Fallback to Google Maps API if no results in database
-	shops, err := s.maps.SearchCoffeeShops(ctx, opts.Lat, opts.Lng, opts.Radius)
+	if err := s.checkPlaces(ctx); err != nil {
+		if len(local) > 0 {
+			return degradedResult(local, err), nil
+		}
+		return nil, err
+	}
+
+	nearby, err := s.maps.SearchNearestCoffeeShops(ctx, opts.Lat, opts.Lng)
+	if errors.Is(err, budget.ErrUnavailable) {
+		return degradedResult(local, err), nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("proximity search failed: %w", err)
 	}
 
-	s.backgroundSyncShops(shops)
+	shops := s.withoutHidden(ctx, nearby.Shops)
+	s.backgroundSyncShops(ctx, shops)
+	s.recordNearby(ctx, opts, nearby.SweptMeters, shops)
 
+	// the nearest shops may be further than the search asked for
 	return &SearchResult{
-		Shops: shops,
+		Shops: mergeShops(local, withinArea(shops, opts)),
 	}, nil
 }
 
-// backgroundSyncShops starts a goroutine to sync shop data to the database
-func (s *SearchService) backgroundSyncShops(shops []*maps.CoffeeShopDetails) {
-	if len(shops) == 0 {
-		return
+// searchIndex returns what the index finds for query. Any index failure
+// falls through to the db, so it is only logged.
+func (s *SearchService) searchIndex(ctx context.Context, query shop.IndexQuery) []*maps.CoffeeShopDetails {
+	if s.index == nil {
+		return nil
 	}
 
-	go func() {
-		inputs := make([]shop.SyncInput, 0, len(shops))
-		
-		for _, placeShop := range shops {
-			input := convertToSyncInput(placeShop)
-			inputs = append(inputs, input)
-		}
-		ctx := context.Background()
-		log.Printf("Starting batch sync of %d shops", len(inputs))
-		if err := s.shops.BatchSyncShopData(ctx, inputs); err != nil {
-			fmt.Printf("failed to batch sync shop data: %v\n", err)
-		}
-	}()
-}
-
-// convertToSyncInput converts a Google Maps CoffeeShopDetails to a SyncInput
-func convertToSyncInput(placeShop *maps.CoffeeShopDetails) shop.SyncInput {
-	photos := make([]maps.Photo, len(placeShop.Photos))
-	for i, photo := range placeShop.Photos {
-		photos[i] = maps.Photo{
-			PhotoReference: photo.PhotoReference,
-			Height: photo.Height,
-			Width: photo.Width,
-			HTMLAttributions: photo.HTMLAttributions,
-		}
+	var found []*shop.Shop
+	err := s.guarded(ctx, func(ctx context.Context) error {
+		var err error
+		found, err = s.index.SearchShops(ctx, query)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to search shop index: %v", err)
+		return nil
+	}
+
+	shops := make([]*maps.CoffeeShopDetails, len(found))
+	for i, indexed := range found {
+		shops[i] = shop.DetailsFromShop(indexed)
+	}
+	return shops
+}
+
+// searchNearby searches the index around the user, if they gave a location
+func (s *SearchService) searchNearby(ctx context.Context, opts SearchOptions) []*maps.CoffeeShopDetails {
+	if opts.Lat == 0 && opts.Lng == 0 {
+		return nil
 	}
+	return s.searchIndex(ctx, shop.IndexQuery{
+		Lat:          opts.Lat,
+		Lng:          opts.Lng,
+		RadiusMeters: opts.Radius,
+		Limit:        opts.Limit,
+	})
+}
 
-	// convert opening hours from Google Maps type to internal type
-	var openingHours *maps.OpeningHours
-	if placeShop.OpeningHours != nil {
-		periods := make([]maps.Period, len(placeShop.OpeningHours.Periods))
-		for i, p := range placeShop.OpeningHours.Periods {
-			periods[i] = maps.Period{
-				Open: maps.TimeOfDay{
-					Day: p.Open.Day,
-					Time: p.Open.Time,
-				},
-				Close: maps.TimeOfDay{
-					Day: p.Close.Day,
-					Time: p.Close.Time,
-				},
-			}
+// withoutHidden drops Places results for shops an admin has hidden
+func (s *SearchService) withoutHidden(ctx context.Context, shops []*maps.CoffeeShopDetails) []*maps.CoffeeShopDetails {
+	placeIDs := make([]string, len(shops))
+	for i, shop := range shops {
+		placeIDs[i] = shop.PlaceID
+	}
+
+	hidden, err := s.db.HiddenPlaceIDs(ctx, placeIDs)
+	if err != nil {
+		log.Printf("Failed to check for hidden shops: %v", err)
+		return shops
+	}
+	if len(hidden) == 0 {
+		return shops
+	}
+
+	visible := make([]*maps.CoffeeShopDetails, 0, len(shops))
+	for _, shop := range shops {
+		if !hidden[shop.PlaceID] {
+			visible = append(visible, shop)
 		}
-		openingHours = &maps.OpeningHours{
-			WeekdayText: placeShop.OpeningHours.WeekdayText,
-			Periods: periods,
+	}
+	return visible
+}
+
+// dbOnlySearch answers a query from the db alone, for when the query can't be
+// analyzed. Queries with a location search nearby, others search by name.
+func (s *SearchService) dbOnlySearch(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
+	opts.Radius = searchRadius(float64(opts.Radius))
+
+	var shops []*maps.CoffeeShopDetails
+	var err error
+	if opts.Lat != 0 && opts.Lng != 0 {
+		if indexed := s.searchNearby(ctx, opts); len(indexed) > 0 {
+			return &SearchResult{Shops: indexed, Degraded: true}, nil
 		}
+		shops, err = s.db.FindShopsByLocation(ctx, opts.Lat, opts.Lng, opts.Radius)
+	} else {
+		shops, err = s.db.FindShopsByName(ctx, opts.Query)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db only search failed: %w", err)
+	}
+
+	return &SearchResult{
+		Shops:    nonNil(shops),
+		Degraded: true,
+	}, nil
+}
+
+// degradedResult returns whatever the db found when places can't be called
+func degradedResult(dbShops []*maps.CoffeeShopDetails, err error) *SearchResult {
+	log.Printf("Places unavailable, returning db results only: %v", err)
+	return &SearchResult{
+		Shops:    nonNil(dbShops),
+		Degraded: true,
 	}
+}
 
-	return shop.SyncInput{
-		PlaceID: placeShop.PlaceID,
-		Name: placeShop.Name,
-		FormattedAddress: placeShop.FormattedAddress,
-		Vicinity: placeShop.Vicinity,
-		Location: maps.LatLng{
-			Lat: placeShop.Location.Lat,
-			Lng: placeShop.Location.Lng,
-		},
-		Rating: placeShop.Rating,
-		UserRatingsTotal: placeShop.UserRatingsTotal,
-		PriceLevel: placeShop.PriceLevel,
-		Types: placeShop.Types,
-		Photos: photos,
-		OpeningHours: openingHours,
-		Website: placeShop.Website,
-		FormattedPhone: placeShop.FormattedPhone,
-		BusinessStatus: placeShop.BusinessStatus,
+func nonNil(shops []*maps.CoffeeShopDetails) []*maps.CoffeeShopDetails {
+	if shops == nil {
+		return []*maps.CoffeeShopDetails{}
+	}
+	return shops
+}
+
+// backgroundSyncShops queues a job to sync shop data to the database
+func (s *SearchService) backgroundSyncShops(ctx context.Context, shops []*maps.CoffeeShopDetails) {
+	if len(shops) == 0 {
+		return
+	}
+
+	inputs := make([]shop.SyncInput, 0, len(shops))
+	for _, placeShop := range shops {
+		inputs = append(inputs, shop.InputFromPlace(placeShop))
+	}
+
+	// the search has its results already, a sync that can't be queued is
+	// picked up the next time the shops are searched for
+	err := s.guarded(ctx, func(ctx context.Context) error {
+		return jobs.Enqueue(ctx, s.jobs, shop.SyncJobType, shop.SyncJob{Inputs: inputs})
+	})
+	if err != nil {
+		log.Printf("Failed to queue sync of %d shops: %v", len(inputs), err)
 	}
 }
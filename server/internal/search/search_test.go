@@ -2,16 +2,23 @@ package search
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/johnnynu/Coffeehaus/internal/budget"
 	"github.com/johnnynu/Coffeehaus/internal/claude"
 	"github.com/johnnynu/Coffeehaus/internal/config"
 	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/geo"
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
 	"github.com/johnnynu/Coffeehaus/internal/maps"
 	"github.com/johnnynu/Coffeehaus/internal/shop"
 	"github.com/joho/godotenv"
+	gmaps "googlemaps.github.io/maps"
 )
 
 func init() {
@@ -42,10 +49,8 @@ func setupTestService(t *testing.T) *SearchService {
 	// Initialize Claude service
 	claudeService := claude.NewService(os.Getenv("CLAUDE_API_KEY"))
 
-	// Initialize Sync manager
-	syncManager := shop.NewSyncManager(dbClient)
-
-	return NewSearchService(mapsClient, dbClient, claudeService, syncManager)
+	// Syncs are queued in memory and not run
+	return NewSearchService(mapsClient, dbClient, claudeService, jobs.NewMemoryQueue())
 }
 
 func TestSearch_Specific(t *testing.T) {
@@ -290,4 +295,535 @@ func TestSearch_Proximity(t *testing.T) {
 			t.Log("Waited for background sync to complete")
 		})
 	}
-} 
\ No newline at end of file
+} 
+func TestConfidentMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		matches []database.ShopMatch
+		want    bool
+	}{
+		{name: "no matches"},
+		{
+			name:    "only weak matches",
+			matches: []database.ShopMatch{{Similarity: 0.45, Score: 0.45}, {Similarity: 0.3, Score: 0.3}},
+		},
+		{
+			name:    "strong match",
+			matches: []database.ShopMatch{{Similarity: 0.82, Score: 0.82}},
+			want:    true,
+		},
+		{
+			// a strong name match far away ranks below a weak one nearby
+			name:    "strong match ranked lower by distance",
+			matches: []database.ShopMatch{{Similarity: 0.5, Score: 0.5}, {Similarity: 0.9, Score: 0.63}},
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := confidentMatch(tt.matches, DefaultMatchConfidence); got != tt.want {
+				t.Errorf("confidentMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeAnalyzer struct {
+	intent *claude.SearchIntent
+	err    error
+}
+
+func (a fakeAnalyzer) AnalyzeSearchQuery(ctx context.Context, query string, userLocation string) (*claude.SearchIntent, error) {
+	return a.intent, a.err
+}
+
+type fakeIndex struct {
+	shops   []*shop.Shop
+	queries []shop.IndexQuery
+}
+
+func (i *fakeIndex) SearchShops(ctx context.Context, query shop.IndexQuery) ([]*shop.Shop, error) {
+	i.queries = append(i.queries, query)
+	return i.shops, nil
+}
+
+func TestSearch_Index(t *testing.T) {
+	stereoscope := &shop.Shop{
+		ID:            "stereoscope-newport",
+		GooglePlaceID: "place-1",
+		Name:          "Stereoscope Coffee",
+		Location:      "(33.6186,-117.9294)",
+		GoogleRating:  4.7,
+	}
+
+	tests := []struct {
+		name   string
+		intent *claude.SearchIntent
+		opts   SearchOptions
+		want   shop.IndexQuery
+	}{
+		{
+			name:   "specific search matches the shop name",
+			intent: &claude.SearchIntent{SearchType: "specific", Terms: claude.SearchTerms{Shop: "stereoscope"}},
+			opts:   SearchOptions{Query: "stereoscope coffee near me", Lat: 33.6, Lng: -117.9},
+			want:   shop.IndexQuery{Text: "stereoscope", Limit: 10},
+		},
+		{
+			name:   "specific search falls back to the query",
+			intent: &claude.SearchIntent{SearchType: "specific"},
+			opts:   SearchOptions{Query: "stereoscope"},
+			want:   shop.IndexQuery{Text: "stereoscope", Limit: 10},
+		},
+		{
+			name:   "proximity search looks around the user",
+			intent: &claude.SearchIntent{SearchType: "proximity"},
+			opts:   SearchOptions{Query: "coffee near me", Lat: 33.6, Lng: -117.9, Radius: 2000},
+			want:   shop.IndexQuery{Lat: 33.6, Lng: -117.9, RadiusMeters: 2000, Limit: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := &fakeIndex{shops: []*shop.Shop{stereoscope}}
+			// neither places nor the db are set, an index hit in an area
+			// searched recently mustn't reach them
+			service := NewSearchService(nil, nil, fakeAnalyzer{intent: tt.intent}, jobs.NewMemoryQueue())
+			service.SetIndex(index)
+			service.SetCoverage(freshCoverage(0), DefaultCoverageTTL)
+
+			result, err := service.Search(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if len(index.queries) != 1 || index.queries[0] != tt.want {
+				t.Errorf("index queries = %+v, want %+v", index.queries, tt.want)
+			}
+			if len(result.Shops) != 1 {
+				t.Fatalf("got %d shops, want 1", len(result.Shops))
+			}
+			got := result.Shops[0]
+			if got.PlaceID != "place-1" || got.Name != "Stereoscope Coffee" || got.Location.Lat != 33.6186 || got.Location.Lng != -117.9294 {
+				t.Errorf("unexpected shop %+v", got)
+			}
+		})
+	}
+}
+
+func TestSearch_Pages(t *testing.T) {
+	var shops []*shop.Shop
+	for i, rating := range []float32{3.0, 4.8, 3.5, 4.2, 4.5} {
+		shops = append(shops, &shop.Shop{
+			GooglePlaceID: fmt.Sprintf("place-%d", i),
+			Name:          "Stereoscope Coffee",
+			GoogleRating:  rating,
+			RatingsTotal:  200,
+		})
+	}
+	index := &fakeIndex{shops: shops}
+	intent := &claude.SearchIntent{SearchType: "specific", Terms: claude.SearchTerms{Shop: "stereoscope"}}
+	service := NewSearchService(nil, nil, fakeAnalyzer{intent: intent}, jobs.NewMemoryQueue())
+	service.SetIndex(index)
+	service.SetCoverage(freshCoverage(len(shops)), DefaultCoverageTTL)
+
+	result, err := service.Search(context.Background(), SearchOptions{Query: "stereoscope", Limit: 2, Offset: 2, Debug: true})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	// the shops before the page are found too, so the page is ranked against them
+	if want := (shop.IndexQuery{Text: "stereoscope", Limit: 4}); len(index.queries) != 1 || index.queries[0] != want {
+		t.Errorf("index queries = %+v, want %+v", index.queries, want)
+	}
+	var got []string
+	for _, found := range result.Shops {
+		got = append(got, found.PlaceID)
+	}
+	// ranked by rating the order is 1, 4, 3, 2, 0
+	if want := []string{"place-3", "place-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("page = %v, want %v", got, want)
+	}
+	if len(result.Ranking) != len(result.Shops) {
+		t.Errorf("got %d scores for %d shops", len(result.Ranking), len(result.Shops))
+	}
+}
+
+func TestSearch_RanksAroundNamedPlace(t *testing.T) {
+	littleTokyo := &maps.Area{Location: gmaps.LatLng{Lat: 34.05, Lng: -118.24}}
+	places := &fakePlaces{area: littleTokyo}
+	intent := &claude.SearchIntent{SearchType: "proximity", Location: &claude.Location{Name: "Little Tokyo"}}
+	service := NewSearchService(places, nil, fakeAnalyzer{intent: intent}, jobs.NewMemoryQueue())
+	service.SetIndex(&fakeIndex{shops: []*shop.Shop{{GooglePlaceID: "place-1", Location: "(34.05,-118.24)"}}})
+	service.SetCoverage(freshCoverage(0), DefaultCoverageTTL)
+	service.SetCache(mapCache{}, DefaultCoverageTTL)
+
+	// the user is in Newport Beach, about 60km away, and the second search
+	// is answered from the cache
+	opts := SearchOptions{Query: "coffee in little tokyo", Lat: 33.6186, Lng: -117.9294, Radius: 2000, Debug: true}
+	for i := 0; i < 2; i++ {
+		result, err := service.Search(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if len(result.Ranking) != 1 || result.Ranking[0].DistanceMeters == nil {
+			t.Fatalf("Ranking = %+v, want the shop's distance", result.Ranking)
+		}
+		if got := *result.Ranking[0].DistanceMeters; got > 1 {
+			t.Errorf("search %d ranked the shop %gm away, want it ranked from Little Tokyo", i+1, got)
+		}
+	}
+}
+
+type mapCache map[string][]byte
+
+func (c mapCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	v, ok := c[key]
+	return v, ok
+}
+
+func (c mapCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	c[key] = value
+}
+
+func (c mapCache) Delete(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		delete(c, key)
+	}
+}
+
+func TestSearch_Cache(t *testing.T) {
+	nearby := &shop.Shop{GooglePlaceID: "place-1", Name: "Stereoscope Coffee", Location: "(33.6186,-117.9294)"}
+	opts := SearchOptions{Query: "Coffee near me", Lat: 33.6186, Lng: -117.9294}
+
+	tests := []struct {
+		name       string
+		analyzer   fakeAnalyzer
+		wantCached bool
+	}{
+		{
+			name:       "results are cached",
+			analyzer:   fakeAnalyzer{intent: &claude.SearchIntent{SearchType: "proximity"}},
+			wantCached: true,
+		},
+		{
+			// the analysis was over budget, a retry may do better
+			name:     "degraded results aren't cached",
+			analyzer: fakeAnalyzer{err: budget.ErrUnavailable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := &fakeIndex{shops: []*shop.Shop{nearby}}
+			results := mapCache{}
+			service := NewSearchService(nil, nil, tt.analyzer, jobs.NewMemoryQueue())
+			service.SetIndex(index)
+			service.SetCoverage(freshCoverage(0), DefaultCoverageTTL)
+			service.SetCache(results, time.Minute)
+
+			first, err := service.Search(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			// the same search, worded a little differently, from next door
+			again := opts
+			again.Query = "  coffee NEAR me"
+			again.Lat += 0.0001
+			second, err := service.Search(context.Background(), again)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if cached := len(index.queries) == 1; cached != tt.wantCached {
+				t.Errorf("index searched %d times, want cached = %v", len(index.queries), tt.wantCached)
+			}
+			if len(results) == 0 == tt.wantCached {
+				t.Errorf("cache holds %d entries, want cached = %v", len(results), tt.wantCached)
+			}
+			if len(second.Shops) != 1 || second.Shops[0].PlaceID != first.Shops[0].PlaceID || second.Degraded != first.Degraded {
+				t.Errorf("second search = %+v, want the same as the first %+v", second, first)
+			}
+		})
+	}
+}
+
+// fakeCoverage holds the same coverage for every cell, keyed by query
+type fakeCoverage struct {
+	coverage map[string]database.Coverage
+	// only limits the coverage held to one cell, when set
+	only     string
+	cells    []string
+	recorded []database.Coverage
+}
+
+func (c *fakeCoverage) FindCoverage(ctx context.Context, query string, cells []string) (map[string]database.Coverage, error) {
+	c.cells = append(c.cells, cells...)
+	found := make(map[string]database.Coverage)
+	if coverage, ok := c.coverage[query]; ok {
+		for _, cell := range cells {
+			if c.only == "" || cell == c.only {
+				coverage.Cell = cell
+				found[cell] = coverage
+			}
+		}
+	}
+	return found, nil
+}
+
+func (c *fakeCoverage) RecordCoverage(ctx context.Context, coverage []database.Coverage) error {
+	c.recorded = append(c.recorded, coverage...)
+	return nil
+}
+
+// freshCoverage is coverage of every query and cell swept just now
+func freshCoverage(shops int) *fakeCoverage {
+	swept := database.Coverage{SweptAt: time.Now(), ShopCount: shops}
+	return &fakeCoverage{coverage: map[string]database.Coverage{
+		"":            swept,
+		"stereoscope": swept,
+	}}
+}
+
+func TestSearch_Coverage(t *testing.T) {
+	nearby := &shop.Shop{GooglePlaceID: "place-1", Name: "Stereoscope Coffee", Location: "(33.6186,-117.9294)"}
+	proximity := fakeAnalyzer{intent: &claude.SearchIntent{SearchType: "proximity"}}
+	specific := fakeAnalyzer{intent: &claude.SearchIntent{SearchType: "specific", Terms: claude.SearchTerms{Shop: "Stereoscope"}}}
+	opts := SearchOptions{Query: "stereoscope", Lat: 33.6186, Lng: -117.9294, Radius: 2000}
+	errLimited := errors.New("places limit reached")
+
+	tests := []struct {
+		name     string
+		analyzer fakeAnalyzer
+		coverage *fakeCoverage
+		wantCell string
+		// wantPlaces is whether the search went on to ask Places, which is
+		// over its limit here so the local results come back degraded
+		wantPlaces bool
+	}{
+		{
+			name:     "fresh area is answered locally",
+			analyzer: proximity,
+			coverage: freshCoverage(0),
+			wantCell: "9mupk",
+		},
+		{
+			// the search reaches past the one cell searched before
+			name:       "partly searched area asks places",
+			analyzer:   proximity,
+			coverage:   &fakeCoverage{coverage: freshCoverage(0).coverage, only: "9mupk"},
+			wantCell:   "9mupk",
+			wantPlaces: true,
+		},
+		{
+			name:       "never searched area asks places",
+			analyzer:   proximity,
+			coverage:   &fakeCoverage{},
+			wantCell:   "9mupk",
+			wantPlaces: true,
+		},
+		{
+			name:     "stale area asks places",
+			analyzer: proximity,
+			coverage: &fakeCoverage{coverage: map[string]database.Coverage{
+				"": {SweptAt: time.Now().Add(-2 * DefaultCoverageTTL), ShopCount: 1},
+			}},
+			wantCell:   "9mupk",
+			wantPlaces: true,
+		},
+		{
+			// places found more shops around here than are known locally
+			name:       "sparse area asks places",
+			analyzer:   proximity,
+			coverage:   freshCoverage(1),
+			wantCell:   "9mupk",
+			wantPlaces: true,
+		},
+		{
+			name:     "chain search answered locally where searched before",
+			analyzer: specific,
+			coverage: freshCoverage(1),
+			wantCell: "9mup",
+		},
+		{
+			// one known branch of a chain may hide others
+			name:       "chain search elsewhere asks places",
+			analyzer:   specific,
+			coverage:   &fakeCoverage{},
+			wantCell:   "9mup",
+			wantPlaces: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewSearchService(nil, nil, tt.analyzer, jobs.NewMemoryQueue())
+			service.SetIndex(&fakeIndex{shops: []*shop.Shop{nearby}})
+			service.SetCoverage(tt.coverage, DefaultCoverageTTL)
+			service.SetPlacesLimit(func(ctx context.Context) error { return errLimited })
+
+			result, err := service.Search(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			looked := false
+			for _, cell := range tt.coverage.cells {
+				looked = looked || cell == tt.wantCell
+			}
+			if !looked {
+				t.Errorf("coverage looked up for %v, want %s among them", tt.coverage.cells, tt.wantCell)
+			}
+			if result.Degraded != tt.wantPlaces {
+				t.Errorf("Degraded = %v, want %v", result.Degraded, tt.wantPlaces)
+			}
+			if len(result.Shops) != 1 || result.Shops[0].PlaceID != "place-1" {
+				t.Errorf("got shops %+v, want the local one", result.Shops)
+			}
+		})
+	}
+}
+
+func TestMergeShops(t *testing.T) {
+	local := []*maps.CoffeeShopDetails{
+		{PlaceID: "a", Name: "A (db)"},
+		{PlaceID: "b", Name: "B (db)"},
+		{PlaceID: "a", Name: "A again"},
+	}
+	places := []*maps.CoffeeShopDetails{
+		{PlaceID: "c", Name: "C"},
+		{PlaceID: "b", Name: "B (places)"},
+	}
+
+	merged := mergeShops(local, places)
+
+	want := []string{"A (db)", "B (places)", "C"}
+	if len(merged) != len(want) {
+		t.Fatalf("got %d shops, want %d", len(merged), len(want))
+	}
+	for i, name := range want {
+		if merged[i].Name != name {
+			t.Errorf("shop %d = %s, want %s", i, merged[i].Name, name)
+		}
+	}
+}
+
+func TestRecordNearby(t *testing.T) {
+	opts := SearchOptions{Lat: 33.6186, Lng: -117.9294, Radius: 10000}
+	shops := []*maps.CoffeeShopDetails{{PlaceID: "a", Location: gmaps.LatLng{Lat: opts.Lat, Lng: opts.Lng}}}
+
+	tests := []struct {
+		name     string
+		swept    float64
+		wantNone bool
+	}{
+		{name: "a full page of close shops proves no whole cell", swept: 800, wantNone: true},
+		{name: "a full page records the cells within its furthest shop", swept: 7000},
+		{name: "a short page records past the search's circle", swept: maps.NearbyReach},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage := &fakeCoverage{}
+			service := NewSearchService(nil, nil, nil, jobs.NewMemoryQueue())
+			service.SetCoverage(coverage, DefaultCoverageTTL)
+
+			service.recordNearby(context.Background(), opts, tt.swept, shops)
+
+			if tt.wantNone != (len(coverage.recorded) == 0) {
+				t.Fatalf("recorded %d cells, want none: %v", len(coverage.recorded), tt.wantNone)
+			}
+			for _, row := range coverage.recorded {
+				// cells the sweep only reached part of weren't swept
+				if !geo.CellWithin(row.Cell, opts.Lat, opts.Lng, tt.swept) {
+					t.Errorf("recorded %s, which reaches outside the sweep", row.Cell)
+				}
+			}
+		})
+	}
+}
+
+// cellCoverage holds the coverage recorded, by cell, as if it was recorded
+// age ago
+type cellCoverage struct {
+	age   time.Duration
+	cells map[string]database.Coverage
+}
+
+func (c *cellCoverage) FindCoverage(ctx context.Context, query string, cells []string) (map[string]database.Coverage, error) {
+	found := make(map[string]database.Coverage)
+	for _, cell := range cells {
+		if coverage, ok := c.cells[cell]; ok && coverage.Query == query {
+			found[cell] = coverage
+		}
+	}
+	return found, nil
+}
+
+func (c *cellCoverage) RecordCoverage(ctx context.Context, coverage []database.Coverage) error {
+	if c.cells == nil {
+		c.cells = make(map[string]database.Coverage)
+	}
+	for _, row := range coverage {
+		row.SweptAt = row.SweptAt.Add(-c.age)
+		c.cells[row.Cell] = row
+	}
+	return nil
+}
+
+func TestCoverage_SearchedNearby(t *testing.T) {
+	there := SearchOptions{Lat: 33.6186, Lng: -117.9294, Radius: DefaultRadius}
+	// 200 m north
+	here := SearchOptions{Lat: 33.6204, Lng: -117.9294, Radius: DefaultRadius}
+	shops := []*maps.CoffeeShopDetails{
+		{PlaceID: "a", Location: gmaps.LatLng{Lat: 33.6186, Lng: -117.9294}},
+		{PlaceID: "b", Location: gmaps.LatLng{Lat: 33.6250, Lng: -117.9300}},
+		{PlaceID: "c", Location: gmaps.LatLng{Lat: 33.6100, Lng: -117.9200}},
+	}
+
+	tests := []struct {
+		name  string
+		swept float64
+		want  bool
+	}{
+		{name: "every shop places reaches was found", swept: maps.NearbyReach, want: true},
+		{name: "a full page reaching past the search", swept: 20000, want: true},
+		{name: "a full page of closer shops", swept: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage := &cellCoverage{age: time.Hour}
+			service := NewSearchService(nil, nil, nil, jobs.NewMemoryQueue())
+			service.SetCoverage(coverage, DefaultCoverageTTL)
+
+			// searched there an hour ago, the shops found are local now
+			service.recordNearby(context.Background(), there, tt.swept, shops)
+
+			if got := service.covered(context.Background(), "", nearbyCells(here), len(shops), 10); got != tt.want {
+				t.Errorf("covered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShopsPerCell(t *testing.T) {
+	cells := []string{"9mupk", "9mups"}
+	shops := []*maps.CoffeeShopDetails{
+		{PlaceID: "a", Location: gmaps.LatLng{Lat: 33.6186, Lng: -117.9294}},
+		{PlaceID: "b", Location: gmaps.LatLng{Lat: 33.6190, Lng: -117.9290}},
+		// outside the cells searched
+		{PlaceID: "c", Location: gmaps.LatLng{Lat: 40.7, Lng: -74}},
+	}
+
+	got := shopsPerCell(cells, shops)
+
+	want := map[string]int{"9mupk": 2, "9mups": 0}
+	if len(got) != len(want) {
+		t.Fatalf("shopsPerCell() = %v, want %v", got, want)
+	}
+	for cell, count := range want {
+		if got[cell] != count {
+			t.Errorf("shopsPerCell()[%s] = %d, want %d", cell, got[cell], count)
+		}
+	}
+}
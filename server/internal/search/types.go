@@ -11,9 +11,23 @@ type SearchOptions struct {
     Radius    uint     `json:"radius,omitempty"` // radius of the search in meters
     Limit     int      `json:"limit,omitempty"` // number of results to return
     Offset    int      `json:"offset,omitempty"` // offset of the results to return
+    PlaceID   string   `json:"-"` // place of a picked autocomplete suggestion, fetched instead of searching
+    Session   string   `json:"-"` // autocomplete session token the suggestion was picked in
+    UserID    string   `json:"-"` // logged in user, whose results are personalized
+    Debug     bool     `json:"-"` // return each shop's score breakdown
 }
 
 type SearchResult struct {
 	Shops []*maps.CoffeeShopDetails
+	// Personalized is only set for logged in users
+	Personalized *Personalization `json:",omitempty"`
+	// Degraded is set when results come from the db alone because a paid
+	// provider was over budget or failing
+	Degraded bool `json:",omitempty"`
+	// Filters are what the query asked shops to have, like "matcha"
+	Filters []string `json:",omitempty"`
+	// Ranking is each shop's score breakdown, in the order of Shops, and is
+	// only set in debug mode
+	Ranking []ScoreBreakdown `json:",omitempty"`
 }
 
@@ -0,0 +1,44 @@
+package shop
+
+import (
+	"context"
+	"log"
+)
+
+// Sources of shop changes
+const (
+	SourceSearch = "search"
+	SourceResync = "resync"
+	SourceAdmin  = "admin"
+)
+
+// FieldChange is one field of a shop changed by a sync
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old_value"`
+	New   interface{} `json:"new_value"`
+}
+
+// recordChanges adds a shop's changes to its history. The shop is already
+// updated, so a failure here is logged rather than failing the sync.
+func (s *SyncManager) recordChanges(ctx context.Context, shopID, source string, changes []FieldChange) {
+	_ = ctx
+	if len(changes) == 0 {
+		return
+	}
+
+	rows := make([]map[string]interface{}, len(changes))
+	for i, change := range changes {
+		rows[i] = map[string]interface{}{
+			"shop_id":   shopID,
+			"field":     change.Field,
+			"old_value": change.Old,
+			"new_value": change.New,
+			"source":    source,
+		}
+	}
+
+	if _, _, err := s.db.From("shop_changes").Insert(rows, false, "", "minimal", "").Execute(); err != nil {
+		log.Printf("Failed to record %d changes to shop %s: %v", len(changes), shopID, err)
+	}
+}
@@ -0,0 +1,105 @@
+package shop
+
+import (
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+	gmaps "googlemaps.github.io/maps"
+)
+
+// InputFromPlace converts a Google Maps CoffeeShopDetails to a SyncInput
+func InputFromPlace(placeShop *maps.CoffeeShopDetails) SyncInput {
+	photos := make([]maps.Photo, len(placeShop.Photos))
+	for i, photo := range placeShop.Photos {
+		photos[i] = maps.Photo{
+			PhotoReference:   photo.PhotoReference,
+			Height:           photo.Height,
+			Width:            photo.Width,
+			HTMLAttributions: photo.HTMLAttributions,
+		}
+	}
+
+	// convert opening hours from Google Maps type to internal type
+	var openingHours *maps.OpeningHours
+	if placeShop.OpeningHours != nil {
+		periods := make([]maps.Period, len(placeShop.OpeningHours.Periods))
+		for i, p := range placeShop.OpeningHours.Periods {
+			periods[i] = maps.Period{
+				Open: maps.TimeOfDay{
+					Day:  p.Open.Day,
+					Time: p.Open.Time,
+				},
+				Close: maps.TimeOfDay{
+					Day:  p.Close.Day,
+					Time: p.Close.Time,
+				},
+			}
+		}
+		openingHours = &maps.OpeningHours{
+			WeekdayText: placeShop.OpeningHours.WeekdayText,
+			Periods:     periods,
+		}
+	}
+
+	return SyncInput{
+		PlaceID:          placeShop.PlaceID,
+		Name:             placeShop.Name,
+		FormattedAddress: placeShop.FormattedAddress,
+		Vicinity:         placeShop.Vicinity,
+		Location: maps.LatLng{
+			Lat: placeShop.Location.Lat,
+			Lng: placeShop.Location.Lng,
+		},
+		Rating:           placeShop.Rating,
+		UserRatingsTotal: placeShop.UserRatingsTotal,
+		PriceLevel:       placeShop.PriceLevel,
+		Types:            placeShop.Types,
+		Photos:           photos,
+		OpeningHours:     openingHours,
+		Website:          placeShop.Website,
+		FormattedPhone:   placeShop.FormattedPhone,
+		BusinessStatus:   placeShop.BusinessStatus,
+		UTCOffset:        placeShop.UTCOffset,
+	}
+}
+
+// DetailsFromShop converts a stored shop back to the shape search returns
+func DetailsFromShop(s *Shop) *maps.CoffeeShopDetails {
+	photos := make([]gmaps.Photo, len(s.PhotoRefs))
+	for i, ref := range s.PhotoRefs {
+		photos[i] = gmaps.Photo{PhotoReference: ref}
+	}
+
+	var openingHours *gmaps.OpeningHours
+	if s.OpeningHours != nil {
+		periods := make([]gmaps.OpeningHoursPeriod, len(s.OpeningHours.Periods))
+		for i, p := range s.OpeningHours.Periods {
+			periods[i] = gmaps.OpeningHoursPeriod{
+				Open:  gmaps.OpeningHoursOpenClose{Day: p.Open.Day, Time: p.Open.Time},
+				Close: gmaps.OpeningHoursOpenClose{Day: p.Close.Day, Time: p.Close.Time},
+			}
+		}
+		openingHours = &gmaps.OpeningHours{
+			WeekdayText: s.OpeningHours.WeekdayText,
+			Periods:     periods,
+		}
+	}
+
+	location, _ := s.Coordinates()
+
+	return &maps.CoffeeShopDetails{
+		PlaceID:          s.GooglePlaceID,
+		Name:             s.Name,
+		FormattedAddress: s.FormattedAddress,
+		Vicinity:         s.Vicinity,
+		Location:         gmaps.LatLng{Lat: location.Lat, Lng: location.Lng},
+		Rating:           s.GoogleRating,
+		UserRatingsTotal: s.RatingsTotal,
+		PriceLevel:       s.PriceLevel,
+		Types:            s.Types,
+		Photos:           photos,
+		OpeningHours:     openingHours,
+		Website:          s.Website,
+		FormattedPhone:   s.FormattedPhone,
+		BusinessStatus:   s.BusinessStatus,
+		UTCOffset:        s.UTCOffset,
+	}
+}
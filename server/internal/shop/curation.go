@@ -0,0 +1,266 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+var (
+	ErrShopNotFound = errors.New("shop not found")
+	ErrShopMerged   = errors.New("shop has been merged into another")
+	ErrInvalidMerge = errors.New("invalid merge")
+)
+
+// Audit log actions for admin changes to shops
+const (
+	ActionVerify   = "shop.verify"
+	ActionUnverify = "shop.unverify"
+	ActionUpdate   = "shop.update"
+	ActionHide     = "shop.hide"
+	ActionUnhide   = "shop.unhide"
+	ActionMerge    = "shop.merge"
+	ActionResync   = "shop.resync"
+)
+
+// PlaceFetcher looks up the current Places data for a single place
+type PlaceFetcher interface {
+	GetPlaceDetails(ctx context.Context, placeID string) (*maps.CoffeeShopDetails, error)
+}
+
+// FunctionCaller calls Postgres functions
+type FunctionCaller interface {
+	CallFunction(ctx context.Context, name string, params interface{}) ([]byte, error)
+}
+
+// Curator applies admin changes to shops and records each in the audit log
+type Curator struct {
+	db     *database.Client
+	places PlaceFetcher
+	sync   *SyncManager
+	// functions makes each change together with its audit entry
+	functions FunctionCaller
+}
+
+func NewCurator(db *database.Client, places PlaceFetcher, sync *SyncManager) *Curator {
+	return &Curator{db: db, places: places, sync: sync, functions: db}
+}
+
+// Errors raised by the curation functions
+const (
+	codeShopNotFound = "P0002"
+	codeShopMerged   = "CHM01"
+	codeInvalidMerge = "CHM02"
+)
+
+// curationState is the part of a shop curation decisions depend on
+type curationState struct {
+	ID            string  `json:"id"`
+	GooglePlaceID string  `json:"google_place_id"`
+	Hidden        bool    `json:"hidden"`
+	MergedInto    *string `json:"merged_into"`
+}
+
+// Get returns a shop by ID
+func (c *Curator) Get(ctx context.Context, shopID string) (json.RawMessage, error) {
+	_ = ctx
+	res, _, err := c.db.From("shops").Select("*", "", false).Eq("id", shopID).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+	return singleRow(res)
+}
+
+// SetVerified marks a shop as verified, or not, by a Coffeehaus admin
+func (c *Curator) SetVerified(ctx context.Context, actorID, shopID string, verified bool) (json.RawMessage, error) {
+	action := ActionVerify
+	if !verified {
+		action = ActionUnverify
+	}
+	return c.apply(ctx, actorID, shopID, action, map[string]interface{}{"verified": verified})
+}
+
+// Update sets Coffeehaus specific fields of a shop. Fields are validated by
+// the caller.
+func (c *Curator) Update(ctx context.Context, actorID, shopID string, fields map[string]interface{}) (json.RawMessage, error) {
+	return c.apply(ctx, actorID, shopID, ActionUpdate, fields)
+}
+
+// SetHidden hides a shop from search, e.g. because it is closed or isn't a
+// coffee shop, or makes it visible again
+func (c *Curator) SetHidden(ctx context.Context, actorID, shopID string, hidden bool, reason string) (json.RawMessage, error) {
+	state, err := c.state(shopID)
+	if err != nil {
+		return nil, err
+	}
+	// a merged shop stays hidden, it has been replaced
+	if !hidden && state.MergedInto != nil {
+		return nil, fmt.Errorf("%w: %s", ErrShopMerged, *state.MergedInto)
+	}
+
+	if hidden {
+		var reasonValue interface{}
+		if reason != "" {
+			reasonValue = reason
+		}
+		shop, err := c.apply(ctx, actorID, shopID, ActionHide, map[string]interface{}{
+			"hidden":        true,
+			"hidden_reason": reasonValue,
+		})
+		if err == nil {
+			c.sync.unindex(ctx, shopID)
+		}
+		return shop, err
+	}
+	// the shop is indexed again the next time it syncs
+	return c.apply(ctx, actorID, shopID, ActionUnhide, map[string]interface{}{
+		"hidden":        false,
+		"hidden_reason": nil,
+	})
+}
+
+// Merge folds a duplicate shop into the one that should remain. Posts move to
+// the target, anything previously merged into the duplicate now points at the
+// target, and the duplicate is hidden, all in one transaction with the audit
+// entry.
+func (c *Curator) Merge(ctx context.Context, actorID, sourceID, targetID string) (json.RawMessage, error) {
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: a shop can't be merged into itself", ErrInvalidMerge)
+	}
+
+	res, err := c.functions.CallFunction(ctx, "merge_shops", map[string]interface{}{
+		"source_id": sourceID,
+		"target_id": targetID,
+		"actor_id":  actorID,
+		"action":    ActionMerge,
+	})
+	if err != nil {
+		return nil, curationError(err)
+	}
+	target, err := singleRow(res)
+	if err != nil {
+		return nil, err
+	}
+	c.sync.unindex(ctx, sourceID)
+
+	return target, nil
+}
+
+// Resync refreshes a shop's Places data with what Places returns now. Only
+// the fields that changed are written, and recorded in its history.
+func (c *Curator) Resync(ctx context.Context, actorID, shopID string) (json.RawMessage, error) {
+	state, err := c.state(shopID)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := c.places.GetPlaceDetails(ctx, state.GooglePlaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := c.sync.refresh(ctx, InputFromPlace(details), SourceAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.audit(ctx, actorID, ActionResync, shopID, map[string]interface{}{
+		"google_place_id": state.GooglePlaceID,
+		"business_status": details.BusinessStatus,
+		"changed":         changes.Fields(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return c.Get(ctx, shopID)
+}
+
+// apply updates a shop's columns and records the change in one transaction
+func (c *Curator) apply(ctx context.Context, actorID, shopID, action string, fields map[string]interface{}) (json.RawMessage, error) {
+	res, err := c.functions.CallFunction(ctx, "curate_shop", map[string]interface{}{
+		"shop_id":  shopID,
+		"actor_id": actorID,
+		"action":   action,
+		"fields":   fields,
+	})
+	if err != nil {
+		return nil, curationError(err)
+	}
+	return singleRow(res)
+}
+
+// raisedMessage is the message a function raised with code, without the
+// PostgREST framing around it
+func raisedMessage(err error, code string) string {
+	msg := err.Error()
+	if _, after, found := strings.Cut(msg, "("+code+") "); found {
+		return after
+	}
+	return msg
+}
+
+// curationError maps the errors raised by the curation functions to ours
+func curationError(err error) error {
+	switch {
+	case database.HasCode(err, codeShopNotFound):
+		return ErrShopNotFound
+	case database.HasCode(err, codeShopMerged):
+		return fmt.Errorf("%w: %s", ErrShopMerged, raisedMessage(err, codeShopMerged))
+	case database.HasCode(err, codeInvalidMerge):
+		return fmt.Errorf("%w: %s", ErrInvalidMerge, raisedMessage(err, codeInvalidMerge))
+	default:
+		return fmt.Errorf("failed to update shop: %w", err)
+	}
+}
+
+func (c *Curator) audit(ctx context.Context, actorID, action, shopID string, details map[string]interface{}) error {
+	err := c.db.RecordAudit(ctx, database.AuditEntry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: "shop",
+		TargetID:   shopID,
+		Details:    details,
+	})
+	if err != nil {
+		// the change has been made, make sure it's traceable from the logs
+		log.Printf("Failed to audit %s on shop %s by %s: %v", action, shopID, actorID, err)
+	}
+	return err
+}
+
+func (c *Curator) state(shopID string) (*curationState, error) {
+	res, _, err := c.db.From("shops").
+		Select("id, google_place_id, hidden, merged_into", "", false).
+		Eq("id", shopID).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+
+	var rows []curationState
+	if err := json.Unmarshal(res, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse shop: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrShopNotFound
+	}
+	return &rows[0], nil
+}
+
+// singleRow returns the only row of a PostgREST array response
+func singleRow(res []byte) (json.RawMessage, error) {
+	var rows []json.RawMessage
+	if err := json.Unmarshal(res, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse shop: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrShopNotFound
+	}
+	return rows[0], nil
+}
@@ -0,0 +1,157 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeFunctions answers every function call with res or err
+type fakeFunctions struct {
+	res   string
+	err   error
+	calls []string
+	// params are the last call's
+	params map[string]interface{}
+}
+
+func (f *fakeFunctions) CallFunction(ctx context.Context, name string, params interface{}) ([]byte, error) {
+	f.calls = append(f.calls, name)
+	f.params, _ = params.(map[string]interface{})
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.res), nil
+}
+
+// fakeIndex records the shops removed from it
+type fakeIndex struct {
+	Index
+	removed []string
+}
+
+func (i *fakeIndex) RemoveShops(ctx context.Context, shopIDs []string) error {
+	i.removed = append(i.removed, shopIDs...)
+	return nil
+}
+
+func TestCuratorMerge(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		target      string
+		res         string
+		err         error
+		wantErr     error
+		wantCalled  bool
+		wantRemoved []string
+	}{
+		{
+			name:        "merged",
+			source:      "source",
+			target:      "target",
+			res:         `[{"id":"target"}]`,
+			wantCalled:  true,
+			wantRemoved: []string{"source"},
+		},
+		{
+			name:    "into itself",
+			source:  "source",
+			target:  "source",
+			wantErr: ErrInvalidMerge,
+		},
+		{
+			name:       "source already merged",
+			source:     "source",
+			target:     "target",
+			err:        errors.New("failed to call merge_shops: (CHM01) source was merged into other"),
+			wantErr:    ErrShopMerged,
+			wantCalled: true,
+		},
+		{
+			name:       "missing shop",
+			source:     "source",
+			target:     "target",
+			err:        errors.New("failed to call merge_shops: (P0002) shop target not found"),
+			wantErr:    ErrShopNotFound,
+			wantCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			functions := &fakeFunctions{res: tt.res, err: tt.err}
+			index := &fakeIndex{}
+			curator := &Curator{functions: functions, sync: &SyncManager{index: index}}
+
+			shop, err := curator.Merge(context.Background(), "admin", tt.source, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Merge() error = %v, want %v", err, tt.wantErr)
+			}
+			if (len(functions.calls) > 0) != tt.wantCalled {
+				t.Errorf("called %v, want called = %v", functions.calls, tt.wantCalled)
+			}
+			if !reflect.DeepEqual(index.removed, tt.wantRemoved) {
+				t.Errorf("removed %v from the index, want %v", index.removed, tt.wantRemoved)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			// the merge and its audit entry are one call
+			if !reflect.DeepEqual(functions.calls, []string{"merge_shops"}) {
+				t.Errorf("calls = %v, want merge_shops alone", functions.calls)
+			}
+			want := map[string]interface{}{"source_id": "source", "target_id": "target", "actor_id": "admin", "action": ActionMerge}
+			if !reflect.DeepEqual(functions.params, want) {
+				t.Errorf("params = %v, want %v", functions.params, want)
+			}
+			if string(shop) != `{"id":"target"}` {
+				t.Errorf("Merge() = %s, want the target", shop)
+			}
+		})
+	}
+}
+
+func TestCuratorApply(t *testing.T) {
+	fields := map[string]interface{}{"verified": true}
+
+	tests := []struct {
+		name         string
+		res          string
+		err          error
+		wantErr      bool
+		wantNotFound bool
+	}{
+		{name: "updated", res: `[{"id":"shop","verified":true}]`},
+		{name: "missing shop", err: errors.New("failed to call curate_shop: (P0002) shop shop not found"), wantErr: true, wantNotFound: true},
+		{name: "db down", err: errors.New("connection refused"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			functions := &fakeFunctions{res: tt.res, err: tt.err}
+			curator := &Curator{functions: functions}
+
+			shop, err := curator.SetVerified(context.Background(), "admin", "shop", true)
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrShopNotFound) != tt.wantNotFound {
+				t.Fatalf("SetVerified() error = %v, want error = %v, not found = %v", err, tt.wantErr, tt.wantNotFound)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// the update and its audit entry are one call
+			want := map[string]interface{}{"shop_id": "shop", "actor_id": "admin", "action": ActionVerify, "fields": fields}
+			if !reflect.DeepEqual(functions.calls, []string{"curate_shop"}) || !reflect.DeepEqual(functions.params, want) {
+				t.Errorf("called %v with %v, want curate_shop with %v", functions.calls, functions.params, want)
+			}
+			var got map[string]interface{}
+			if json.Unmarshal(shop, &got) != nil || got["verified"] != true {
+				t.Errorf("SetVerified() = %s, want the updated shop", shop)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package shop
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// locationTolerance is how far, in degrees, a location can move before it is
+// a change. Locations are stored to 6 decimal places.
+const locationTolerance = 1e-6
+
+// Changeset is what differs between a stored shop and fresh Places data
+type Changeset struct {
+	Changes []FieldChange
+	// columns holds the value to write to each changed column, fields are
+	// named after their column
+	columns map[string]interface{}
+}
+
+// Empty reports whether nothing changed
+func (c Changeset) Empty() bool {
+	return len(c.Changes) == 0
+}
+
+// Columns returns the columns to write for the changes, stamped with the sync
+// time
+func (c Changeset) Columns() map[string]interface{} {
+	columns := make(map[string]interface{}, len(c.columns)+1)
+	for column, value := range c.columns {
+		columns[column] = value
+	}
+	columns["last_sync"] = time.Now()
+	return columns
+}
+
+// Fields lists the changed fields
+func (c Changeset) Fields() []string {
+	fields := make([]string, len(c.Changes))
+	for i, change := range c.Changes {
+		fields[i] = change.Field
+	}
+	return fields
+}
+
+func (c *Changeset) add(field string, old, new, value interface{}) {
+	c.Changes = append(c.Changes, FieldChange{Field: field, Old: old, New: new})
+	if c.columns == nil {
+		c.columns = make(map[string]interface{})
+	}
+	c.columns[field] = value
+}
+
+// Diff compares a stored shop with fresh Places data. A field Places left
+// empty is not a change, the response may just have omitted it.
+func Diff(stored *Shop, input SyncInput) Changeset {
+	var cs Changeset
+	diffString := func(field, old, new string) {
+		if new != "" && old != new {
+			cs.add(field, old, new, new)
+		}
+	}
+	diffInt := func(field string, old, new int) {
+		if new > 0 && old != new {
+			cs.add(field, old, new, new)
+		}
+	}
+
+	diffString("name", stored.Name, input.Name)
+	diffString("formatted_address", stored.FormattedAddress, input.FormattedAddress)
+	diffString("vicinity", stored.Vicinity, input.Vicinity)
+
+	if input.Location != (maps.LatLng{}) {
+		old, ok := parseLocation(stored.Location)
+		if !ok || !sameLocation(old, input.Location) {
+			var oldValue interface{}
+			if ok {
+				oldValue = old
+			}
+			cs.add("location", oldValue, input.Location, pointValue(input.Location))
+		}
+	}
+
+	if input.Rating > 0 && stored.GoogleRating != input.Rating {
+		cs.add("google_rating", stored.GoogleRating, input.Rating, input.Rating)
+	}
+	diffInt("ratings_total", stored.RatingsTotal, input.UserRatingsTotal)
+	diffInt("price_level", stored.PriceLevel, input.PriceLevel)
+
+	// Places doesn't promise an order for types
+	if len(input.Types) > 0 && !sameSet(stored.Types, input.Types) {
+		cs.add("types", stored.Types, input.Types, input.Types)
+	}
+
+	if refs := photoRefs(input.Photos); len(refs) > 0 && !reflect.DeepEqual(stored.PhotoRefs, refs) {
+		cs.add("photo_refs", stored.PhotoRefs, refs, refs)
+	}
+
+	if input.OpeningHours != nil && !sameHours(stored.OpeningHours, input.OpeningHours) {
+		cs.add("hours", stored.OpeningHours, input.OpeningHours, input.OpeningHours)
+	}
+
+	diffString("website", stored.Website, input.Website)
+	diffString("formatted_phone", stored.FormattedPhone, input.FormattedPhone)
+	diffString("business_status", stored.BusinessStatus, input.BusinessStatus)
+
+	// offsets move with daylight saving
+	if input.UTCOffset != nil && (stored.UTCOffset == nil || *stored.UTCOffset != *input.UTCOffset) {
+		cs.add("utc_offset", stored.UTCOffset, *input.UTCOffset, *input.UTCOffset)
+	}
+
+	return cs
+}
+
+// placesColumns returns every Places column for input, for new shops
+func placesColumns(input SyncInput) map[string]interface{} {
+	return map[string]interface{}{
+		"name":              input.Name,
+		"formatted_address": input.FormattedAddress,
+		"vicinity":          input.Vicinity,
+		"location":          pointValue(input.Location),
+		"google_rating":     input.Rating,
+		"ratings_total":     input.UserRatingsTotal,
+		"price_level":       input.PriceLevel,
+		"types":             input.Types,
+		"photo_refs":        photoRefs(input.Photos),
+		"hours":             input.OpeningHours,
+		"website":           input.Website,
+		"formatted_phone":   input.FormattedPhone,
+		"business_status":   input.BusinessStatus,
+		"utc_offset":        input.UTCOffset,
+		"last_sync":         time.Now(),
+	}
+}
+
+func photoRefs(photos []maps.Photo) []string {
+	refs := make([]string, len(photos))
+	for i, photo := range photos {
+		refs[i] = photo.PhotoReference
+	}
+	return refs
+}
+
+// pointValue formats a location the way shops store it
+func pointValue(location maps.LatLng) string {
+	return fmt.Sprintf("(%f,%f)", location.Lat, location.Lng)
+}
+
+// parseLocation reads a stored location. Shops write it as a "(lat,lng)"
+// point, PostGIS columns come back as hex EWKB with x as the longitude.
+func parseLocation(stored string) (maps.LatLng, bool) {
+	if strings.HasPrefix(stored, "(") && strings.HasSuffix(stored, ")") {
+		parts := strings.Split(strings.Trim(stored, "()"), ",")
+		if len(parts) != 2 {
+			return maps.LatLng{}, false
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lng, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err1 != nil || err2 != nil {
+			return maps.LatLng{}, false
+		}
+		return maps.LatLng{Lat: lat, Lng: lng}, true
+	}
+
+	return parseEWKBPoint(stored)
+}
+
+// parseEWKBPoint reads a 2D point in hex (E)WKB
+func parseEWKBPoint(stored string) (maps.LatLng, bool) {
+	data, err := hex.DecodeString(stored)
+	if err != nil || len(data) < 21 {
+		return maps.LatLng{}, false
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if data[0] == 1 {
+		order = binary.LittleEndian
+	}
+	geomType := order.Uint32(data[1:5])
+	offset := 5
+	// the srid flag puts a 4 byte srid before the coordinates
+	if geomType&0x20000000 != 0 {
+		offset += 4
+	}
+	if geomType&0xffff != 1 || len(data) < offset+16 {
+		return maps.LatLng{}, false
+	}
+
+	x := math.Float64frombits(order.Uint64(data[offset : offset+8]))
+	y := math.Float64frombits(order.Uint64(data[offset+8 : offset+16]))
+	return maps.LatLng{Lat: y, Lng: x}, true
+}
+
+func sameLocation(a, b maps.LatLng) bool {
+	return math.Abs(a.Lat-b.Lat) <= locationTolerance && math.Abs(a.Lng-b.Lng) <= locationTolerance
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	return reflect.DeepEqual(as, bs)
+}
+
+// sameHours compares opening hours, treating missing and empty lists alike
+func sameHours(a, b *maps.OpeningHours) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.WeekdayText) != len(b.WeekdayText) || len(a.Periods) != len(b.Periods) {
+		return false
+	}
+	for i := range a.WeekdayText {
+		if a.WeekdayText[i] != b.WeekdayText[i] {
+			return false
+		}
+	}
+	for i := range a.Periods {
+		if a.Periods[i] != b.Periods[i] {
+			return false
+		}
+	}
+	return true
+}
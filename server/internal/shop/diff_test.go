@@ -0,0 +1,183 @@
+package shop
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+func TestDiff(t *testing.T) {
+	hours := &maps.OpeningHours{
+		WeekdayText: []string{"Monday: 7:00 AM – 5:00 PM"},
+		Periods:     []maps.Period{{Open: maps.TimeOfDay{Day: time.Monday, Time: "0700"}, Close: maps.TimeOfDay{Day: time.Monday, Time: "1700"}}},
+	}
+	stored := &Shop{
+		ID:             "shop-1",
+		Name:           "Verve Coffee",
+		Location:       "(34.052200,-118.243700)",
+		GoogleRating:   4.5,
+		RatingsTotal:   120,
+		PriceLevel:     2,
+		Types:          []string{"cafe", "food"},
+		PhotoRefs:      []string{"ref-1"},
+		OpeningHours:   hours,
+		BusinessStatus: "OPERATIONAL",
+	}
+	same := SyncInput{
+		Name:             "Verve Coffee",
+		Location:         maps.LatLng{Lat: 34.0522, Lng: -118.2437},
+		Rating:           4.5,
+		UserRatingsTotal: 120,
+		PriceLevel:       2,
+		Types:            []string{"food", "cafe"},
+		Photos:           []maps.Photo{{PhotoReference: "ref-1"}},
+		OpeningHours: &maps.OpeningHours{
+			WeekdayText: []string{"Monday: 7:00 AM – 5:00 PM"},
+			Periods:     []maps.Period{{Open: maps.TimeOfDay{Day: time.Monday, Time: "0700"}, Close: maps.TimeOfDay{Day: time.Monday, Time: "1700"}}},
+		},
+		BusinessStatus: "OPERATIONAL",
+	}
+
+	tests := []struct {
+		name       string
+		input      func(SyncInput) SyncInput
+		wantFields []string
+	}{
+		{
+			name:  "nothing changed",
+			input: func(in SyncInput) SyncInput { return in },
+		},
+		{
+			name:  "empty fields aren't changes",
+			input: func(SyncInput) SyncInput { return SyncInput{Name: "Verve Coffee"} },
+		},
+		{
+			name: "renamed and rerated",
+			input: func(in SyncInput) SyncInput {
+				in.Name = "Verve Coffee Roasters"
+				in.Rating = 4.6
+				in.UserRatingsTotal = 121
+				return in
+			},
+			wantFields: []string{"google_rating", "name", "ratings_total"},
+		},
+		{
+			name: "hours changed",
+			input: func(in SyncInput) SyncInput {
+				in.OpeningHours = &maps.OpeningHours{
+					WeekdayText: []string{"Monday: 8:00 AM – 5:00 PM"},
+					Periods:     []maps.Period{{Open: maps.TimeOfDay{Day: time.Monday, Time: "0800"}, Close: maps.TimeOfDay{Day: time.Monday, Time: "1700"}}},
+				}
+				return in
+			},
+			wantFields: []string{"hours"},
+		},
+		{
+			name: "types and photos changed",
+			input: func(in SyncInput) SyncInput {
+				in.Types = []string{"cafe", "bakery"}
+				in.Photos = []maps.Photo{{PhotoReference: "ref-1"}, {PhotoReference: "ref-2"}}
+				return in
+			},
+			wantFields: []string{"photo_refs", "types"},
+		},
+		{
+			name: "moved",
+			input: func(in SyncInput) SyncInput {
+				in.Location = maps.LatLng{Lat: 34.0530, Lng: -118.2437}
+				return in
+			},
+			wantFields: []string{"location"},
+		},
+		{
+			name: "location within rounding",
+			input: func(in SyncInput) SyncInput {
+				in.Location = maps.LatLng{Lat: 34.0522004, Lng: -118.2436996}
+				return in
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := Diff(stored, tt.input(same))
+
+			var gotFields []string
+			for _, change := range cs.Changes {
+				gotFields = append(gotFields, change.Field)
+			}
+			sort.Strings(gotFields)
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Fatalf("changed fields = %v, want %v", gotFields, tt.wantFields)
+			}
+
+			if cs.Empty() != (len(tt.wantFields) == 0) {
+				t.Errorf("Empty() = %v", cs.Empty())
+			}
+
+			// only the changed columns are written, with the sync time
+			columns := cs.Columns()
+			if _, ok := columns["last_sync"]; !ok {
+				t.Error("columns are missing last_sync")
+			}
+			if len(columns) != len(tt.wantFields)+1 {
+				t.Errorf("columns = %v, want only %v and last_sync", columns, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	want := maps.LatLng{Lat: 34.0522, Lng: -118.2437}
+
+	tests := []struct {
+		name   string
+		stored string
+		ok     bool
+	}{
+		{name: "point", stored: "(34.052200,-118.243700)", ok: true},
+		{name: "ewkb", stored: "0101000020E61000004182E2C7988F5DC0F46C567DAE064140", ok: true},
+		{name: "empty", stored: ""},
+		{name: "garbage", stored: "(north,west)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLocation(tt.stored)
+			if ok != tt.ok {
+				t.Fatalf("parseLocation() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !sameLocation(got, want) {
+				t.Errorf("parseLocation() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffStored(t *testing.T) {
+	stored := []Shop{
+		{ID: "shop-1", GooglePlaceID: "same", Name: "Verve Coffee"},
+		{ID: "shop-2", GooglePlaceID: "renamed", Name: "Old Name"},
+	}
+	inputs := []SyncInput{
+		{PlaceID: "same", Name: "Verve Coffee"},
+		{PlaceID: "renamed", Name: "New Name"},
+		{PlaceID: "new", Name: "Blue Bottle"},
+	}
+
+	report := newSyncReport()
+	toCreate, toUpdate := diffStored(inputs, stored, report)
+
+	if want := []SyncInput{{PlaceID: "new", Name: "Blue Bottle"}}; !reflect.DeepEqual(toCreate, want) {
+		t.Errorf("toCreate = %+v, want %+v", toCreate, want)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].shopID != "shop-2" || !reflect.DeepEqual(toUpdate[0].changes.Fields(), []string{"name"}) {
+		t.Errorf("toUpdate = %+v, want only the rename of shop-2", toUpdate)
+	}
+	if want := []SyncResult{{PlaceID: "same", ShopID: "shop-1", Status: StatusUnchanged}}; !reflect.DeepEqual(report.Unchanged, want) {
+		t.Errorf("Unchanged = %+v, want %+v", report.Unchanged, want)
+	}
+}
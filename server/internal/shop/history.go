@@ -0,0 +1,186 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// ChangeKind picks out a kind of notable change across all shops
+type ChangeKind string
+
+const (
+	ChangeRenamed ChangeKind = "renamed"
+	ChangeClosed  ChangeKind = "closed"
+)
+
+func (k ChangeKind) IsValid() bool {
+	return k == ChangeRenamed || k == ChangeClosed
+}
+
+// ShopChange is a recorded change to one field of a shop
+type ShopChange struct {
+	ShopID    string          `json:"shop_id"`
+	Field     string          `json:"field"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+	Source    string          `json:"source"`
+	ChangedAt time.Time       `json:"changed_at"`
+	// Shop is set on changes listed across shops
+	Shop *ChangedShop `json:"shop,omitempty"`
+}
+
+// ChangedShop identifies the shop a change was made to
+type ChangedShop struct {
+	Name             string `json:"name"`
+	FormattedAddress string `json:"formatted_address"`
+	GooglePlaceID    string `json:"google_place_id"`
+}
+
+// RatingPoint is a shop's Google rating from a point in time
+type RatingPoint struct {
+	Rating float32   `json:"rating"`
+	At     time.Time `json:"at"`
+}
+
+// RatingHistory is how a shop's Google rating has moved over time
+type RatingHistory struct {
+	ShopID  string        `json:"shop_id"`
+	Current float32       `json:"current"`
+	Points  []RatingPoint `json:"points"`
+}
+
+type ratingChange struct {
+	Old       *float32  `json:"old_value"`
+	New       *float32  `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// History reads the change history recorded by syncs
+type History struct {
+	db *database.Client
+}
+
+func NewHistory(db *database.Client) *History {
+	return &History{db: db}
+}
+
+// Changes returns a shop's recorded changes, newest first
+func (h *History) Changes(ctx context.Context, shopID string, limit int) ([]ShopChange, error) {
+	_ = ctx
+	res, _, err := h.db.From("shop_changes").
+		Select("shop_id, field, old_value, new_value, source, changed_at", "", false).
+		Eq("shop_id", shopID).
+		Order("changed_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shop changes: %w", err)
+	}
+
+	changes := []ShopChange{}
+	if err := json.Unmarshal(res, &changes); err != nil {
+		return nil, fmt.Errorf("failed to parse shop changes: %w", err)
+	}
+	return changes, nil
+}
+
+// RatingHistory returns a shop's Google rating after each change since the
+// given time, oldest first. The rating going into the window is the first
+// point so the trend has somewhere to start.
+func (h *History) RatingHistory(ctx context.Context, shopID string, since time.Time) (*RatingHistory, error) {
+	_ = ctx
+	res, _, err := h.db.From("shops").
+		Select("id, google_rating, last_sync", "", false).
+		Eq("id", shopID).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+	var shops []struct {
+		GoogleRating float32   `json:"google_rating"`
+		LastSync     time.Time `json:"last_sync"`
+	}
+	if err := json.Unmarshal(res, &shops); err != nil {
+		return nil, fmt.Errorf("failed to parse shop: %w", err)
+	}
+	if len(shops) == 0 {
+		return nil, ErrShopNotFound
+	}
+
+	res, _, err = h.db.From("shop_changes").
+		Select("old_value, new_value, changed_at", "", false).
+		Eq("shop_id", shopID).
+		Eq("field", "google_rating").
+		Gte("changed_at", since.UTC().Format(time.RFC3339)).
+		Order("changed_at", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rating changes: %w", err)
+	}
+	var changes []ratingChange
+	if err := json.Unmarshal(res, &changes); err != nil {
+		return nil, fmt.Errorf("failed to parse rating changes: %w", err)
+	}
+
+	return &RatingHistory{
+		ShopID:  shopID,
+		Current: shops[0].GoogleRating,
+		Points:  ratingPoints(shops[0].GoogleRating, since, changes),
+	}, nil
+}
+
+// ratingPoints turns rating changes, oldest first, into a series starting at
+// since. With no changes the current rating held for the whole window.
+func ratingPoints(current float32, since time.Time, changes []ratingChange) []RatingPoint {
+	if len(changes) == 0 {
+		return []RatingPoint{{Rating: current, At: since}}
+	}
+
+	points := make([]RatingPoint, 0, len(changes)+1)
+	// an unrated shop (0) has no rating to chart
+	if first := changes[0].Old; first != nil && *first > 0 {
+		points = append(points, RatingPoint{Rating: *first, At: since})
+	}
+	for _, change := range changes {
+		if change.New != nil {
+			points = append(points, RatingPoint{Rating: *change.New, At: change.ChangedAt})
+		}
+	}
+	return points
+}
+
+// Recent returns the latest changes of a kind across all shops, newest first
+func (h *History) Recent(ctx context.Context, kind ChangeKind, limit int) ([]ShopChange, error) {
+	_ = ctx
+	query := h.db.From("shop_changes").
+		Select("shop_id, field, old_value, new_value, source, changed_at, shop:shops(name, formatted_address, google_place_id)", "", false)
+
+	switch kind {
+	case ChangeRenamed:
+		query = query.Eq("field", "name")
+	case ChangeClosed:
+		// values are stored as json, so the status is compared as a json string
+		query = query.Eq("field", "business_status").Eq("new_value", `"`+statusClosedPermanently+`"`)
+	default:
+		return nil, fmt.Errorf("unknown change kind %q", kind)
+	}
+
+	res, _, err := query.
+		Order("changed_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent changes: %w", err)
+	}
+
+	changes := []ShopChange{}
+	if err := json.Unmarshal(res, &changes); err != nil {
+		return nil, fmt.Errorf("failed to parse recent changes: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,43 @@
+package shop
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRatingPoints(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := since.Add(48 * time.Hour)
+	rating := func(r float32) *float32 { return &r }
+
+	tests := []struct {
+		name    string
+		changes []ratingChange
+		want    []RatingPoint
+	}{
+		{
+			name: "no changes holds the current rating",
+			want: []RatingPoint{{Rating: 4.4, At: since}},
+		},
+		{
+			name:    "starts from the rating going into the window",
+			changes: []ratingChange{{Old: rating(4.2), New: rating(4.4), ChangedAt: at}},
+			want:    []RatingPoint{{Rating: 4.2, At: since}, {Rating: 4.4, At: at}},
+		},
+		{
+			name:    "first rating of an unrated shop",
+			changes: []ratingChange{{Old: rating(0), New: rating(4.4), ChangedAt: at}},
+			want:    []RatingPoint{{Rating: 4.4, At: at}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ratingPoints(4.4, since, tt.changes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ratingPoints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
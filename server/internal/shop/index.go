@@ -0,0 +1,115 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// indexedShopColumns are the columns of a shop written to the index
+const indexedShopColumns = "*, opening_hours:hours"
+
+// IndexQuery searches the shop index. Zero values don't filter.
+type IndexQuery struct {
+	// Text is matched loosely against shop names
+	Text string
+	// RadiusMeters limits results to a circle around Lat, Lng
+	Lat          float64
+	Lng          float64
+	RadiusMeters uint
+	MinRating    float32
+	// MaxPriceLevel is the most expensive price level, 1 to 4
+	MaxPriceLevel int
+	Limit         int
+}
+
+// Index is a search index of visible shops kept next to the db. It is fed by
+// syncs, so it only holds shops synced since it was created.
+type Index interface {
+	IndexShops(ctx context.Context, shops []*Shop) error
+	RemoveShops(ctx context.Context, shopIDs []string) error
+	SearchShops(ctx context.Context, query IndexQuery) ([]*Shop, error)
+}
+
+// SetIndex sets the index synced shops are written to
+func (s *SyncManager) SetIndex(index Index) {
+	s.index = index
+}
+
+// indexShops writes shops to the index. The db is the source of truth, a
+// shop missing from the index is found there instead.
+func (s *SyncManager) indexShops(ctx context.Context, shops []*Shop) {
+	if s.index == nil || len(shops) == 0 {
+		return
+	}
+	if err := s.index.IndexShops(ctx, shops); err != nil {
+		log.Printf("Failed to index %d shops: %v", len(shops), err)
+	}
+}
+
+// unindex removes shops that should no longer show in search
+func (s *SyncManager) unindex(ctx context.Context, shopIDs ...string) {
+	if s.index == nil || len(shopIDs) == 0 {
+		return
+	}
+	if err := s.index.RemoveShops(ctx, shopIDs); err != nil {
+		log.Printf("Failed to remove shops %v from the index: %v", shopIDs, err)
+	}
+}
+
+// indexReport indexes every shop the sync wrote or confirmed
+func (s *SyncManager) indexReport(ctx context.Context, report *SyncReport) {
+	if s.index == nil {
+		return
+	}
+
+	var shopIDs []string
+	for _, results := range [][]SyncResult{report.Created, report.Updated, report.Unchanged} {
+		for _, result := range results {
+			shopIDs = append(shopIDs, result.ShopID)
+		}
+	}
+	s.indexStored(ctx, shopIDs)
+}
+
+// indexStored indexes shops as they are stored, so the index has their
+// Coffeehaus fields as well as what Places returned. Shops an admin has
+// hidden or merged away are left out.
+func (s *SyncManager) indexStored(ctx context.Context, shopIDs []string) {
+	if s.index == nil || len(shopIDs) == 0 {
+		return
+	}
+
+	query := s.db.From("shops").Select(indexedShopColumns, "", false)
+	res, _, err := database.In(query, "id", shopIDs).Execute()
+	if err != nil {
+		log.Printf("Failed to get %d shops to index: %v", len(shopIDs), err)
+		return
+	}
+	var stored []*Shop
+	if err := json.Unmarshal(res, &stored); err != nil {
+		log.Printf("Failed to parse %d shops to index: %v", len(shopIDs), err)
+		return
+	}
+
+	s.indexShops(ctx, visibleShops(stored))
+}
+
+// visibleShops drops shops that should not show in search
+func visibleShops(shops []*Shop) []*Shop {
+	visible := make([]*Shop, 0, len(shops))
+	for _, shop := range shops {
+		if !shop.Hidden && shop.MergedInto == nil {
+			visible = append(visible, shop)
+		}
+	}
+	return visible
+}
+
+// Coordinates parses the shop's stored location
+func (s *Shop) Coordinates() (maps.LatLng, bool) {
+	return parseLocation(s.Location)
+}
@@ -0,0 +1,35 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/johnnynu/Coffeehaus/internal/jobs"
+)
+
+// SyncJobType is the job that saves Places results to the db
+const SyncJobType = "shop.sync"
+
+// SyncJob is the payload of a SyncJobType job
+type SyncJob struct {
+	Inputs []SyncInput `json:"inputs"`
+}
+
+// HandleSyncJob syncs the shops in a SyncJobType job
+func (s *SyncManager) HandleSyncJob(ctx context.Context, job *jobs.Job) error {
+	var payload SyncJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		// retrying won't make the payload readable
+		return jobs.Permanent(fmt.Errorf("failed to decode sync job: %w", err))
+	}
+
+	log.Printf("Starting batch sync of %d shops", len(payload.Inputs))
+	report, err := s.BatchSyncShopData(ctx, payload.Inputs)
+	if err != nil {
+		return err
+	}
+	// the whole batch is retried, shops synced the first time are unchanged
+	return report.Err()
+}
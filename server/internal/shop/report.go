@@ -0,0 +1,84 @@
+package shop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyncStatus is what a sync did to one shop
+type SyncStatus string
+
+const (
+	StatusCreated   SyncStatus = "created"
+	StatusUpdated   SyncStatus = "updated"
+	StatusUnchanged SyncStatus = "unchanged"
+	StatusFailed    SyncStatus = "failed"
+)
+
+// SyncResult is the outcome of syncing one shop
+type SyncResult struct {
+	PlaceID string `json:"place_id"`
+	// ShopID is empty when a new shop failed to be created
+	ShopID string     `json:"shop_id,omitempty"`
+	Status SyncStatus `json:"status"`
+	// Changed lists the fields an update changed
+	Changed []string `json:"changed,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// SyncReport lists what a batch sync did to each shop. A shop that fails
+// doesn't stop the rest of the batch.
+type SyncReport struct {
+	Created   []SyncResult `json:"created"`
+	Updated   []SyncResult `json:"updated"`
+	Unchanged []SyncResult `json:"unchanged"`
+	Failed    []SyncResult `json:"failed"`
+}
+
+func newSyncReport() *SyncReport {
+	return &SyncReport{
+		Created:   []SyncResult{},
+		Updated:   []SyncResult{},
+		Unchanged: []SyncResult{},
+		Failed:    []SyncResult{},
+	}
+}
+
+func (r *SyncReport) add(result SyncResult) {
+	switch result.Status {
+	case StatusCreated:
+		r.Created = append(r.Created, result)
+	case StatusUpdated:
+		r.Updated = append(r.Updated, result)
+	case StatusUnchanged:
+		r.Unchanged = append(r.Unchanged, result)
+	default:
+		r.Failed = append(r.Failed, result)
+	}
+}
+
+func (r *SyncReport) fail(placeID, shopID string, err error) {
+	r.add(SyncResult{PlaceID: placeID, ShopID: shopID, Status: StatusFailed, Error: err.Error()})
+}
+
+// Total is the number of shops in the report
+func (r *SyncReport) Total() int {
+	return len(r.Created) + len(r.Updated) + len(r.Unchanged) + len(r.Failed)
+}
+
+// Err returns an error naming the shops that failed, or nil if none did
+func (r *SyncReport) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	failures := make([]string, len(r.Failed))
+	for i, result := range r.Failed {
+		failures[i] = fmt.Sprintf("%s: %s", result.PlaceID, result.Error)
+	}
+	return fmt.Errorf("failed to sync %d of %d shops: %s", len(r.Failed), r.Total(), strings.Join(failures, "; "))
+}
+
+func (r *SyncReport) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d unchanged, %d failed",
+		len(r.Created), len(r.Updated), len(r.Unchanged), len(r.Failed))
+}
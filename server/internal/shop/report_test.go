@@ -0,0 +1,61 @@
+package shop
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordUpserts(t *testing.T) {
+	inputs := []SyncInput{{PlaceID: "new"}, {PlaceID: "raced"}, {PlaceID: "missing"}}
+	upserted := []upsertedShop{
+		{ID: "shop-1", GooglePlaceID: "new", Created: true},
+		{ID: "shop-2", GooglePlaceID: "raced", Created: false},
+	}
+
+	report := newSyncReport()
+	raced := recordUpserts(inputs, upserted, report)
+
+	if want := []SyncResult{{PlaceID: "new", ShopID: "shop-1", Status: StatusCreated}}; !reflect.DeepEqual(report.Created, want) {
+		t.Errorf("Created = %+v, want %+v", report.Created, want)
+	}
+	// a shop another sync inserted first is left to be diffed, not duplicated
+	// or overwritten
+	if want := []SyncInput{{PlaceID: "raced"}}; !reflect.DeepEqual(raced, want) {
+		t.Errorf("raced = %+v, want %+v", raced, want)
+	}
+	if len(report.Updated) != 0 {
+		t.Errorf("Updated = %+v, want the raced shop left to its diff", report.Updated)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].PlaceID != "missing" {
+		t.Errorf("Failed = %+v, want the shop missing from the upsert", report.Failed)
+	}
+
+	err := report.Err()
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Err() = %v", err)
+	}
+	if got := report.String(); got != "1 created, 0 updated, 0 unchanged, 1 failed" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSyncReport_NoFailures(t *testing.T) {
+	report := newSyncReport()
+	report.add(SyncResult{PlaceID: "a", Status: StatusUnchanged})
+	if err := report.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestUniqueInputs(t *testing.T) {
+	got := uniqueInputs([]SyncInput{
+		{PlaceID: "a", Name: "First"},
+		{PlaceID: "b", Name: "Other"},
+		{PlaceID: "a", Name: "Second"},
+	})
+	want := []SyncInput{{PlaceID: "a", Name: "Second"}, {PlaceID: "b", Name: "Other"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueInputs() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,244 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// ResyncOutcome is the result of re-syncing one shop
+type ResyncOutcome string
+
+const (
+	OutcomeUpdated   ResyncOutcome = "updated"
+	OutcomeUnchanged ResyncOutcome = "unchanged"
+	OutcomeClosed    ResyncOutcome = "closed"
+	OutcomeNotFound  ResyncOutcome = "not_found"
+	OutcomeFailed    ResyncOutcome = "failed"
+)
+
+const statusClosedPermanently = "CLOSED_PERMANENTLY"
+
+type ResyncConfig struct {
+	// Interval between passes
+	Interval time.Duration
+	// StaleAfter is how long after its last sync a shop is due again
+	StaleAfter time.Duration
+	// BatchSize caps the shops refreshed per pass, PerMinute paces them
+	BatchSize int
+	PerMinute float64
+	// Halt reports errors that should end a pass early, such as the places
+	// budget running out
+	Halt func(error) bool
+}
+
+// LockFunc takes a lock for the duration of a pass so replicas don't refresh
+// the same shops. ok is false when another replica holds it.
+type LockFunc func(ctx context.Context) (release func(), ok bool, err error)
+
+// ResyncReport counts what happened to each shop in a pass
+type ResyncReport struct {
+	Selected int                   `json:"selected"`
+	Outcomes map[ResyncOutcome]int `json:"outcomes"`
+	Halted   string                `json:"halted,omitempty"`
+}
+
+// Resyncer refreshes stale shops from Place Details on a schedule, since
+// searches only refresh the shops they happen to return
+type Resyncer struct {
+	db     *database.Client
+	places PlaceFetcher
+	sync   *SyncManager
+	cfg    ResyncConfig
+	lock   LockFunc
+}
+
+func NewResyncer(db *database.Client, places PlaceFetcher, sync *SyncManager, cfg ResyncConfig) *Resyncer {
+	return &Resyncer{db: db, places: places, sync: sync, cfg: cfg}
+}
+
+// SetLock sets the lock each pass runs under
+func (r *Resyncer) SetLock(lock LockFunc) {
+	r.lock = lock
+}
+
+type staleShop struct {
+	ID            string `json:"id"`
+	GooglePlaceID string `json:"google_place_id"`
+	RecentPosts   int    `json:"recent_posts"`
+}
+
+// Run calls RunOnce every interval until ctx is cancelled
+func (r *Resyncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.RunOnce(ctx)
+			if err != nil {
+				log.Printf("Failed to resync stale shops: %v", err)
+				continue
+			}
+			if report != nil {
+				log.Printf("Resynced %d stale shops: %v %s", report.Selected, report.Outcomes, report.Halted)
+			}
+		}
+	}
+}
+
+// RunOnce refreshes the stalest, most popular shops. It returns a nil report
+// when another replica is already running a pass.
+func (r *Resyncer) RunOnce(ctx context.Context) (*ResyncReport, error) {
+	// a pass never outlasts its interval, so passes can't overlap
+	if r.cfg.Interval > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.Interval)
+		defer cancel()
+	}
+
+	if r.lock != nil {
+		release, ok, err := r.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, nil
+		}
+		defer release()
+	}
+
+	res, err := r.db.CallFunction(ctx, "stale_shops", map[string]interface{}{
+		"stale_after_seconds": int(r.cfg.StaleAfter.Seconds()),
+		"max_shops":           r.cfg.BatchSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var shops []staleShop
+	if err := json.Unmarshal(res, &shops); err != nil {
+		return nil, fmt.Errorf("failed to parse stale shops: %w", err)
+	}
+
+	report := &ResyncReport{Selected: len(shops), Outcomes: make(map[ResyncOutcome]int)}
+	if len(shops) == 0 {
+		return report, nil
+	}
+
+	pace := time.NewTicker(time.Duration(float64(time.Minute) / r.cfg.PerMinute))
+	defer pace.Stop()
+
+	for i, shop := range shops {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				report.Halted = ctx.Err().Error()
+				return report, nil
+			case <-pace.C:
+			}
+		}
+
+		outcome, err := r.resyncShop(ctx, shop)
+		if err != nil && r.cfg.Halt != nil && r.cfg.Halt(err) {
+			// nothing was attempted, so the shop isn't marked
+			report.Halted = err.Error()
+			return report, nil
+		}
+
+		report.Outcomes[outcome]++
+		r.record(ctx, shop, outcome, err)
+	}
+
+	return report, nil
+}
+
+func (r *Resyncer) resyncShop(ctx context.Context, shop staleShop) (ResyncOutcome, error) {
+	details, err := r.places.GetPlaceDetails(ctx, shop.GooglePlaceID)
+	if errors.Is(err, maps.ErrNoResults) {
+		return OutcomeNotFound, err
+	}
+	if err != nil {
+		return OutcomeFailed, err
+	}
+
+	input := InputFromPlace(details)
+
+	changes, err := r.sync.refresh(ctx, input, SourceResync)
+	if err != nil {
+		return OutcomeFailed, err
+	}
+
+	if details.BusinessStatus == statusClosedPermanently {
+		if err := r.markClosed(shop.ID); err != nil {
+			return OutcomeFailed, err
+		}
+		r.sync.unindex(ctx, shop.ID)
+		return OutcomeClosed, nil
+	}
+
+	if !changes.Empty() {
+		return OutcomeUpdated, nil
+	}
+
+	// nothing changed but the data is confirmed current
+	_, _, err = r.db.From("shops").
+		Update(map[string]interface{}{"last_sync": time.Now()}, "minimal", "").
+		Eq("id", shop.ID).
+		Execute()
+	if err != nil {
+		return OutcomeFailed, fmt.Errorf("failed to touch last sync: %w", err)
+	}
+	return OutcomeUnchanged, nil
+}
+
+// markClosed hides a permanently closed shop so it stops showing in search
+func (r *Resyncer) markClosed(shopID string) error {
+	_, _, err := r.db.From("shops").
+		Update(map[string]interface{}{
+			"hidden":        true,
+			"hidden_reason": "closed_permanently",
+			"closed_at":     time.Now(),
+		}, "minimal", "").
+		Eq("id", shopID).
+		Eq("hidden", "false").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to mark shop closed: %w", err)
+	}
+	return nil
+}
+
+// record logs the attempt and stamps the shop so failures aren't retried on
+// every pass
+func (r *Resyncer) record(ctx context.Context, shop staleShop, outcome ResyncOutcome, syncErr error) {
+	_ = ctx
+	entry := map[string]interface{}{
+		"shop_id": shop.ID,
+		"outcome": outcome,
+	}
+	if syncErr != nil {
+		entry["error"] = syncErr.Error()
+		log.Printf("Failed to resync shop %s: %v", shop.ID, syncErr)
+	}
+
+	if _, _, err := r.db.From("shop_sync_log").Insert(entry, false, "", "minimal", "").Execute(); err != nil {
+		log.Printf("Failed to record sync outcome for shop %s: %v", shop.ID, err)
+	}
+
+	if _, _, err := r.db.From("shops").
+		Update(map[string]interface{}{"last_sync_attempt": time.Now()}, "minimal", "").
+		Eq("id", shop.ID).
+		Execute(); err != nil {
+		log.Printf("Failed to stamp sync attempt for shop %s: %v", shop.ID, err)
+	}
+}
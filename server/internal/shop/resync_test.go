@@ -0,0 +1,176 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/johnnynu/Coffeehaus/internal/database/databasetest"
+	"github.com/johnnynu/Coffeehaus/internal/maps"
+)
+
+// fakePlaces answers details lookups by place ID, with err for the others
+type fakePlaces struct {
+	details map[string]*maps.CoffeeShopDetails
+	err     error
+	fetched []string
+}
+
+func (p *fakePlaces) GetPlaceDetails(ctx context.Context, placeID string) (*maps.CoffeeShopDetails, error) {
+	p.fetched = append(p.fetched, placeID)
+	if details, ok := p.details[placeID]; ok {
+		return details, nil
+	}
+	return nil, p.err
+}
+
+// fakeLock is a resync lock held by another replica when held is set
+type fakeLock struct {
+	held     bool
+	err      error
+	taken    int
+	released int
+}
+
+func (l *fakeLock) lock(ctx context.Context) (func(), bool, error) {
+	if l.err != nil || l.held {
+		return nil, false, l.err
+	}
+	l.taken++
+	return func() { l.released++ }, true, nil
+}
+
+func TestResyncerRunOnce(t *testing.T) {
+	errBudget := errors.New("places budget spent")
+	stale := `[
+		{"id": "shop-open", "google_place_id": "open"},
+		{"id": "shop-closed", "google_place_id": "closed"},
+		{"id": "shop-gone", "google_place_id": "gone"}
+	]`
+	details := map[string]*maps.CoffeeShopDetails{
+		"open":   {PlaceID: "open", BusinessStatus: "OPERATIONAL"},
+		"closed": {PlaceID: "closed", BusinessStatus: statusClosedPermanently},
+	}
+
+	tests := []struct {
+		name        string
+		lock        *fakeLock
+		placesErr   error
+		wantErr     bool
+		wantNil     bool
+		want        map[ResyncOutcome]int
+		wantHalted  string
+		wantFetched []string
+		// wantRecorded are the shops whose attempt was logged
+		wantRecorded []string
+	}{
+		{
+			name:         "every outcome",
+			lock:         &fakeLock{},
+			placesErr:    maps.ErrNoResults,
+			want:         map[ResyncOutcome]int{OutcomeUnchanged: 1, OutcomeClosed: 1, OutcomeNotFound: 1},
+			wantFetched:  []string{"open", "closed", "gone"},
+			wantRecorded: []string{"shop-open", "shop-closed", "shop-gone"},
+		},
+		{
+			name:         "failures are recorded too",
+			lock:         &fakeLock{},
+			placesErr:    errors.New("places down"),
+			want:         map[ResyncOutcome]int{OutcomeUnchanged: 1, OutcomeClosed: 1, OutcomeFailed: 1},
+			wantFetched:  []string{"open", "closed", "gone"},
+			wantRecorded: []string{"shop-open", "shop-closed", "shop-gone"},
+		},
+		{
+			// the shop that ran out of budget wasn't attempted, so it isn't
+			// stamped and is picked again next pass
+			name:         "halts when places says so",
+			lock:         &fakeLock{},
+			placesErr:    errBudget,
+			want:         map[ResyncOutcome]int{OutcomeUnchanged: 1, OutcomeClosed: 1},
+			wantHalted:   errBudget.Error(),
+			wantFetched:  []string{"open", "closed", "gone"},
+			wantRecorded: []string{"shop-open", "shop-closed"},
+		},
+		{
+			name:    "another replica is running a pass",
+			lock:    &fakeLock{held: true},
+			wantNil: true,
+		},
+		{
+			name:    "lock unavailable",
+			lock:    &fakeLock{err: errors.New("redis down")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := databasetest.NewServer(t)
+			server.Respond("POST rpc/stale_shops", stale)
+			db := server.Client()
+
+			places := &fakePlaces{details: details, err: tt.placesErr}
+			resyncer := NewResyncer(db, places, NewSyncManager(db), ResyncConfig{
+				BatchSize: 10,
+				PerMinute: 6000000,
+				Halt:      func(err error) bool { return errors.Is(err, errBudget) },
+			})
+			resyncer.SetLock(tt.lock.lock)
+
+			report, err := resyncer.RunOnce(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunOnce() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr || tt.wantNil {
+				if report != nil {
+					t.Errorf("RunOnce() = %+v, want no report", report)
+				}
+				if calls := server.Requests("POST rpc/stale_shops"); len(calls) != 0 {
+					t.Errorf("looked for stale shops without the lock")
+				}
+				return
+			}
+
+			if tt.lock.released != tt.lock.taken {
+				t.Errorf("lock taken %d times, released %d", tt.lock.taken, tt.lock.released)
+			}
+			if report.Selected != 3 {
+				t.Errorf("Selected = %d, want 3", report.Selected)
+			}
+			if !reflect.DeepEqual(report.Outcomes, tt.want) {
+				t.Errorf("Outcomes = %v, want %v", report.Outcomes, tt.want)
+			}
+			if report.Halted != tt.wantHalted {
+				t.Errorf("Halted = %q, want %q", report.Halted, tt.wantHalted)
+			}
+			if !reflect.DeepEqual(places.fetched, tt.wantFetched) {
+				t.Errorf("fetched %v, want %v", places.fetched, tt.wantFetched)
+			}
+
+			var recorded []string
+			for _, request := range server.Requests("POST shop_sync_log") {
+				var entry struct {
+					ShopID string `json:"shop_id"`
+				}
+				if err := json.Unmarshal(request.Body, &entry); err != nil {
+					t.Fatalf("failed to parse sync log entry: %v", err)
+				}
+				recorded = append(recorded, entry.ShopID)
+			}
+			if !reflect.DeepEqual(recorded, tt.wantRecorded) {
+				t.Errorf("recorded %v, want %v", recorded, tt.wantRecorded)
+			}
+
+			// the closed shop is hidden
+			hidden := false
+			for _, request := range server.Requests("PATCH shops") {
+				hidden = hidden || (request.Query.Get("id") == "eq.shop-closed" && request.Query.Get("hidden") == "eq.false")
+			}
+			if !hidden {
+				t.Error("closed shop wasn't hidden")
+			}
+		})
+	}
+}
@@ -5,15 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
-	"time"
 
 	"github.com/johnnynu/Coffeehaus/internal/database"
 )
 
 // SyncManager handles synchronization of shop data between Plces API and db
 type SyncManager struct {
-	db *database.Client
+	db    *database.Client
+	index Index
 }
 
 // NewSyncManager creates a new SyncManager
@@ -21,35 +20,27 @@ func NewSyncManager(db *database.Client) *SyncManager {
 	return &SyncManager{db: db}
 }
 
+// storedShopColumns are the columns of a shop Places data is diffed against
+const storedShopColumns = "id, google_place_id, name, formatted_address, vicinity, location, google_rating, ratings_total, price_level, types, photo_refs, opening_hours:hours, website, formatted_phone, business_status, utc_offset, hidden"
+
 // SyncShopData syncs shop data from Places API to db
 func (s *SyncManager) SyncShopData(ctx context.Context, input SyncInput) error {
-	// check if shop exists in db
-	exists, err := s.shopExists(ctx, input.PlaceID)
+	report, err := s.BatchSyncShopData(ctx, []SyncInput{input})
 	if err != nil {
-		return fmt.Errorf("failed to check if shop exists: %w", err)
-	}
-
-	if !exists {
-		// create new shop
-		return s.createShop(ctx, input)
-	}
-
-	// check if shop needs to be updated
-	update, err := s.checkForUpdate(ctx, input)
-	if err != nil {
-		return fmt.Errorf("failed to check for update: %w", err)
-	}
-
-	if update {
-		return s.updateShop(ctx, input)
+		return err
 	}
-
-	return nil
+	return report.Err()
 }
 
-func (s *SyncManager) BatchSyncShopData(ctx context.Context, inputs []SyncInput) error {
+// BatchSyncShopData creates or updates a shop for each input. New shops are
+// upserted on their place ID, so a concurrent sync of the same place updates
+// it rather than failing. The error is only for failures of the whole batch,
+// each shop's outcome is in the report.
+func (s *SyncManager) BatchSyncShopData(ctx context.Context, inputs []SyncInput) (*SyncReport, error) {
+	report := newSyncReport()
+	inputs = uniqueInputs(inputs)
 	if len(inputs) == 0 {
-		return nil
+		return report, nil
 	}
 
 	// extract all place ids to check if a shop exists
@@ -59,22 +50,32 @@ func (s *SyncManager) BatchSyncShopData(ctx context.Context, inputs []SyncInput)
 	}
 
 	// find all existing shops
-	existingShops, err := s.getExistingShops(ctx, placeIDs)
+	existingShops, err := s.getStoredShops(ctx, placeIDs)
 	if err != nil {
-		return fmt.Errorf("failed to check existing shops: %w", err)
+		return nil, fmt.Errorf("failed to check existing shops: %w", err)
 	}
-	fmt.Printf("Existing shops count: %d\n", len(existingShops))
 
-	// separate shops that need to be created vs updated
-	var toCreate []SyncInput
-	var toUpdate []SyncInput
+	toCreate, toUpdate := diffStored(inputs, existingShops, report)
+
+	s.batchCreateShops(ctx, toCreate, report)
+	s.batchUpdateShops(ctx, toUpdate, SourceSearch, report)
+	s.indexReport(ctx, report)
+
+	log.Printf("Synced %d shops: %s", report.Total(), report)
+	return report, nil
+}
 
+// diffStored sorts inputs into shops to create and changes to write to stored
+// shops. Stored shops that are up to date are reported unchanged.
+func diffStored(inputs []SyncInput, stored []Shop, report *SyncReport) ([]SyncInput, []shopUpdate) {
 	// map of placeID -> existing shop
-	existingMap := make(map[string]ExistingShop)
-	for _, shop := range existingShops {
-		existingMap[shop.GooglePlaceID] = shop
+	existingMap := make(map[string]*Shop, len(stored))
+	for i := range stored {
+		existingMap[stored[i].GooglePlaceID] = &stored[i]
 	}
 
+	var toCreate []SyncInput
+	var toUpdate []shopUpdate
 	for _, input := range inputs {
 		existing, exists := existingMap[input.PlaceID]
 		if !exists {
@@ -83,45 +84,44 @@ func (s *SyncManager) BatchSyncShopData(ctx context.Context, inputs []SyncInput)
 		}
 
 		// check if shop needs update
-		if needsUpdate(existing, input) {
-			toUpdate = append(toUpdate, input)
-		}
-	}
-
-	fmt.Printf("Shops to create: %d\n", len(toCreate))
-	fmt.Printf("Shops to update: %d\n", len(toUpdate))
-	// create new shops in batch
-	if len(toCreate) > 0 {
-		if err := s.batchCreateShops(ctx, toCreate); err != nil {
-			return fmt.Errorf("failed to batch create shops: %w", err)
+		changes := Diff(existing, input)
+		if changes.Empty() {
+			report.add(SyncResult{PlaceID: input.PlaceID, ShopID: existing.ID, Status: StatusUnchanged})
+			continue
 		}
+		toUpdate = append(toUpdate, shopUpdate{placeID: input.PlaceID, shopID: existing.ID, changes: changes})
 	}
+	return toCreate, toUpdate
+}
 
-	// update existing shops in batch
-	if len(toUpdate) > 0  {
-		if err := s.batchUpdateShops(ctx, toUpdate); err != nil {
-			return fmt.Errorf("failed to batch update shops: %w", err)
+// uniqueInputs drops repeats of a place, the last one wins. An upsert can't
+// touch the same row twice.
+func uniqueInputs(inputs []SyncInput) []SyncInput {
+	index := make(map[string]int, len(inputs))
+	unique := make([]SyncInput, 0, len(inputs))
+	for _, input := range inputs {
+		if i, ok := index[input.PlaceID]; ok {
+			unique[i] = input
+			continue
 		}
+		index[input.PlaceID] = len(unique)
+		unique = append(unique, input)
 	}
-
-	return nil
+	return unique
 }
 
-func (s *SyncManager) getExistingShops(ctx context.Context, placeIDs []string) ([]ExistingShop, error) {
+func (s *SyncManager) getStoredShops(ctx context.Context, placeIDs []string) ([]Shop, error) {
 	_ = ctx
 
 	// this query uses the "in" filter to find all shops with the given place IDs
-	placeIDsStr := fmt.Sprintf("(%s)", strings.Join(placeIDs, ","))
-
-	query := "id, google_place_id, name, formatted_address, vicinity, google_rating, ratings_total, price_level, website, formatted_phone, business_status"
-
-	res, _, err := s.db.From("shops").Select(query, "", false).Filter("google_place_id", "in", placeIDsStr).Execute()
+	query := s.db.From("shops").Select(storedShopColumns, "", false)
+	res, _, err := database.In(query, "google_place_id", placeIDs).Execute()
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get existing shops: %w", err)
 	}
 
-	var existingShops []ExistingShop
+	var existingShops []Shop
 	if err := json.Unmarshal(res, &existingShops); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal existing shops: %w", err)
 	}
@@ -129,122 +129,183 @@ func (s *SyncManager) getExistingShops(ctx context.Context, placeIDs []string) (
 	return existingShops, nil
 }
 
-// needsUpdate checks if a shop needs to be updated
-func needsUpdate(existing ExistingShop, input SyncInput) bool {
-	return (input.Name != "" && existing.Name != input.Name) ||
-	(input.FormattedAddress != "" && existing.FormattedAddress != input.FormattedAddress) ||
-	(input.Vicinity != "" && existing.Vicinity != input.Vicinity) ||
-	(input.Rating > 0 && existing.GoogleRating != input.Rating) ||
-	(input.UserRatingsTotal > 0 && existing.RatingsTotal != input.UserRatingsTotal) ||
-	(input.PriceLevel > 0 && existing.PriceLevel != input.PriceLevel) ||
-	(input.Website != "" && existing.Website != input.Website) ||
-	(input.FormattedPhone != "" && existing.FormattedPhone != input.FormattedPhone) ||
-	(input.BusinessStatus != "" && existing.BusinessStatus != input.BusinessStatus)
+// shopUpdate is an existing shop and the changes to write to it
+type shopUpdate struct {
+	placeID string
+	shopID  string
+	changes Changeset
 }
 
-func (s *SyncManager) batchCreateShops(ctx context.Context, inputs []SyncInput) error {
-	_ = ctx
+// upsertedShop is a row returned by upsert_shops
+type upsertedShop struct {
+	ID            string `json:"id"`
+	GooglePlaceID string `json:"google_place_id"`
+	Created       bool   `json:"created"`
+}
 
+// batchCreateShops upserts new shops in one statement. If the batch fails,
+// each shop is retried alone so one bad shop doesn't fail the rest. Shops
+// another sync created first are left as they are by the upsert and updated
+// from their diff instead.
+func (s *SyncManager) batchCreateShops(ctx context.Context, inputs []SyncInput, report *SyncReport) {
 	if len(inputs) == 0 {
-		return nil
+		return
 	}
 
-	shopDataBatch := make([]map[string]interface{}, len(inputs))
-
-	for i, input := range inputs {
-		photoRefs := make([]string, len(input.Photos))
-		for j, photo := range input.Photos {
-			photoRefs[j] = photo.PhotoReference
+	log.Printf("Batch upserting %d shops", len(inputs))
+	var raced []SyncInput
+	upserted, err := s.upsertShops(ctx, inputs)
+	switch {
+	case err == nil:
+		raced = recordUpserts(inputs, upserted, report)
+	case len(inputs) == 1:
+		report.fail(inputs[0].PlaceID, "", err)
+	default:
+		log.Printf("Batch upsert failed, upserting shops one at a time: %v", err)
+		for _, input := range inputs {
+			upserted, err := s.upsertShops(ctx, []SyncInput{input})
+			if err != nil {
+				report.fail(input.PlaceID, "", err)
+				continue
+			}
+			raced = append(raced, recordUpserts([]SyncInput{input}, upserted, report)...)
 		}
+	}
+
+	s.updateRaced(ctx, raced, report)
+}
 
-		// Create point from location
-		point := fmt.Sprintf("(%f,%f)", input.Location.Lat, input.Location.Lng)
-		
-		shopDataBatch[i] = map[string]interface{}{
-			"google_place_id":    input.PlaceID,
-			"name":               input.Name,
-			"formatted_address":  input.FormattedAddress,
-			"vicinity":           input.Vicinity,
-			"location":           point,
-			"google_rating":      input.Rating,
-			"ratings_total":      input.UserRatingsTotal,
-			"price_level":        input.PriceLevel,
-			"types":              input.Types,
-			"photo_refs":         photoRefs,
-			"hours":              input.OpeningHours,
-			"website":            input.Website,
-			"formatted_phone":    input.FormattedPhone,
-			"business_status":    input.BusinessStatus,
-			"last_sync":          time.Now(),
-			"coffeehaus_rating":  nil,
-			"verified":           false,
-		}		
+func (s *SyncManager) upsertShops(ctx context.Context, inputs []SyncInput) ([]upsertedShop, error) {
+	rows := make([]map[string]interface{}, len(inputs))
+	for i, input := range inputs {
+		rows[i] = newShopColumns(input)
 	}
 
-	// batch insert
-	log.Printf("Batch inserting %d shops", len(shopDataBatch))
-	_, _, err := s.db.From("shops").Insert(shopDataBatch, false, "", "", "").Execute()
+	res, err := s.db.CallFunction(ctx, "upsert_shops", map[string]interface{}{"shop_rows": rows})
 	if err != nil {
-		return fmt.Errorf("failed to batch create shops: %w", err)
+		return nil, fmt.Errorf("failed to upsert shops: %w", err)
 	}
-	return nil
+
+	var upserted []upsertedShop
+	if err := json.Unmarshal(res, &upserted); err != nil {
+		return nil, fmt.Errorf("failed to parse upserted shops: %w", err)
+	}
+	return upserted, nil
 }
 
-// batchUpdateShops updates multiple shops
-// Note: Postgrest doesnt support true batch updates so multiple requests are required
-func (s *SyncManager) batchUpdateShops(ctx context.Context, inputs []SyncInput) error {
-	_ = ctx
+// recordUpserts adds the result of each created shop to the report and
+// returns the inputs of shops another sync created first
+func recordUpserts(inputs []SyncInput, upserted []upsertedShop, report *SyncReport) []SyncInput {
+	byPlace := make(map[string]upsertedShop, len(upserted))
+	for _, row := range upserted {
+		byPlace[row.GooglePlaceID] = row
+	}
 
-	if len(inputs) == 0 {
-		return nil
+	var raced []SyncInput
+	for _, input := range inputs {
+		row, ok := byPlace[input.PlaceID]
+		switch {
+		case !ok:
+			report.fail(input.PlaceID, "", fmt.Errorf("shop was not returned by the upsert"))
+		case row.Created:
+			report.add(SyncResult{PlaceID: input.PlaceID, ShopID: row.ID, Status: StatusCreated})
+		default:
+			raced = append(raced, input)
+		}
 	}
+	return raced
+}
 
-	// Group shops by update pattern to minimize requests
-	log.Printf("Processing batch update for %d shops", len(inputs))
+// updateRaced writes the changes to shops another sync created while this
+// one was creating them, recording them like any other update
+func (s *SyncManager) updateRaced(ctx context.Context, raced []SyncInput, report *SyncReport) {
+	if len(raced) == 0 {
+		return
+	}
 
-	batchSize := 25
-	for i := 0; i < len(inputs); i += batchSize {
-		end := i + batchSize
-		if end > len(inputs) {
-			end = len(inputs)
+	placeIDs := make([]string, len(raced))
+	for i, input := range raced {
+		placeIDs[i] = input.PlaceID
+	}
+	stored, err := s.getStoredShops(ctx, placeIDs)
+	if err != nil {
+		for _, input := range raced {
+			report.fail(input.PlaceID, "", err)
 		}
-		batch := inputs[i:end]
+		return
+	}
 
-		// process for each batch
-		for _, input := range batch {
-			photoRefs := make([]string, len(input.Photos))
-			for j, photo := range input.Photos {
-				photoRefs[j] = photo.PhotoReference
-			}
+	missing, updates := diffStored(raced, stored, report)
+	for _, input := range missing {
+		report.fail(input.PlaceID, "", fmt.Errorf("shop disappeared after the upsert"))
+	}
+	s.batchUpdateShops(ctx, updates, SourceSearch, report)
+}
 
-			point := fmt.Sprintf("(%f,%f)", input.Location.Lat, input.Location.Lng)
-
-			updateData := map[string]interface{}{
-				"name":              input.Name,
-				"formatted_address": input.FormattedAddress,
-				"vicinity":          input.Vicinity,
-				"location":          point,
-				"google_rating":     input.Rating,
-				"ratings_total":     input.UserRatingsTotal,
-				"price_level":       input.PriceLevel,
-				"types":             input.Types,
-				"photo_refs":        photoRefs,
-				"hours":             input.OpeningHours,
-				"website":           input.Website,
-				"formatted_phone":   input.FormattedPhone,
-				"business_status":   input.BusinessStatus,
-				"last_sync":         time.Now(),
-			}
+// batchUpdateShops writes the changed columns of multiple shops
+// Note: Postgrest doesnt support true batch updates so multiple requests are required
+func (s *SyncManager) batchUpdateShops(ctx context.Context, updates []shopUpdate, source string, report *SyncReport) {
+	if len(updates) == 0 {
+		return
+	}
 
-			_, _, err := s.db.From("shops").Update(updateData, "", "").Eq("google_place_id", input.PlaceID).Execute()
-			if err != nil {
-				return fmt.Errorf("failed to update shop %s: %w", input.PlaceID, err)
-			}
+	log.Printf("Processing batch update for %d shops", len(updates))
+
+	for _, update := range updates {
+		if err := s.applyChanges(ctx, update.shopID, update.changes, source); err != nil {
+			report.fail(update.placeID, update.shopID, err)
+			continue
 		}
+		report.add(SyncResult{
+			PlaceID: update.placeID,
+			ShopID:  update.shopID,
+			Status:  StatusUpdated,
+			Changed: update.changes.Fields(),
+		})
+	}
+}
+
+// applyChanges writes only the changed columns of a shop and records the
+// changes in its history
+func (s *SyncManager) applyChanges(ctx context.Context, shopID string, changes Changeset, source string) error {
+	_, _, err := s.db.From("shops").Update(changes.Columns(), "minimal", "").Eq("id", shopID).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update shop %s: %w", shopID, err)
 	}
+	s.recordChanges(ctx, shopID, source, changes.Changes)
 	return nil
 }
 
+// refresh diffs input against the stored shop and writes what changed. The
+// changeset is empty when the shop is up to date or doesn't exist.
+func (s *SyncManager) refresh(ctx context.Context, input SyncInput, source string) (Changeset, error) {
+	stored, err := s.getStoredShops(ctx, []string{input.PlaceID})
+	if err != nil {
+		return Changeset{}, err
+	}
+	if len(stored) == 0 {
+		return Changeset{}, nil
+	}
+
+	changes := Diff(&stored[0], input)
+	if changes.Empty() {
+		return changes, nil
+	}
+	if err := s.applyChanges(ctx, stored[0].ID, changes, source); err != nil {
+		return changes, err
+	}
+	s.indexStored(ctx, []string{stored[0].ID})
+	return changes, nil
+}
+
+// newShopColumns returns the columns of a shop being created from input.
+// Coffeehaus specific fields are left to their defaults.
+func newShopColumns(input SyncInput) map[string]interface{} {
+	columns := placesColumns(input)
+	columns["google_place_id"] = input.PlaceID
+	return columns
+}
+
 /*
 
 
@@ -269,124 +330,3 @@ func (s *SyncManager) shopExists(ctx context.Context, placeID string) (bool, err
 
 	return len(results) > 0, nil
 }
-
-func (s *SyncManager) createShop(ctx context.Context, input SyncInput) error {
-	_ = ctx
-	// extract photo references from Photos slice
-	photoRefs := make([]string, len(input.Photos))
-	for i, photo := range input.Photos {
-		photoRefs[i] = photo.PhotoReference
-	}
-
-	// create the point from the Location (PostgreSQL point format)
-	point := fmt.Sprintf("(%f,%f)", input.Location.Lat, input.Location.Lng)
-
-	shopData := map[string]interface{}{
-		"google_place_id": input.PlaceID,
-		"name": input.Name,
-		"formatted_address": input.FormattedAddress,
-		"vicinity": input.Vicinity,
-		"location": point,
-		"google_rating": input.Rating,
-		"ratings_total": input.UserRatingsTotal,
-		"price_level": input.PriceLevel,
-		"types": input.Types,
-		"photo_refs": photoRefs,
-		"hours": input.OpeningHours,
-		"website": input.Website,
-		"formatted_phone": input.FormattedPhone,
-		"business_status": input.BusinessStatus,
-		"last_sync": time.Now(),
-		
-		// coffeehaus specific fields
-		"coffeehaus_rating": nil,
-		"verified": false,
-	}
-
-	_, _, err := s.db.From("shops").Insert(shopData, false, "", "", "").Execute()
-
-	if err != nil {
-		return fmt.Errorf("failed to create shop: %w", err)
-	}
-
-	return nil
-}
-
-func (s *SyncManager) checkForUpdate(ctx context.Context, input SyncInput) (bool, error) {
-	_ = ctx
-	res, _, err := s.db.From("shops").Select(`name, formatted_address, vicinity, google_rating, ratings_total, price_level, website, formatted_phone, business_status`, "", false).Eq("google_place_id", input.PlaceID).Execute()
-
-	if err != nil {
-		return false, fmt.Errorf("failed to check for update: %w", err)
-	}
-
-    var existingShops []struct {
-        Name            string  `json:"name"`
-        FormattedAddress string `json:"formatted_address"`
-        Vicinity        string  `json:"vicinity"`
-        GoogleRating    float32 `json:"google_rating"`
-        RatingsTotal    int     `json:"ratings_total"`
-        PriceLevel      int     `json:"price_level"`
-        Website         string  `json:"website"`
-        FormattedPhone  string  `json:"formatted_phone"`
-        BusinessStatus  string  `json:"business_status"`
-    }
-
-	if err := json.Unmarshal(res, &existingShops); err != nil {
-		return false, fmt.Errorf("failed to unmarshal existing shop: %w", err)
-	}
-
-	// If no shops found, return false without error
-	if len(existingShops) == 0 {
-		return false, nil
-	}
-
-	shop := existingShops[0]
-
-	return (input.Name != "" && shop.Name != input.Name) ||
-		(input.FormattedAddress != "" && shop.FormattedAddress != input.FormattedAddress) ||
-		(input.Vicinity != "" && shop.Vicinity != input.Vicinity) ||
-		(input.Rating > 0 && shop.GoogleRating != input.Rating) ||
-		(input.UserRatingsTotal > 0 && shop.RatingsTotal != input.UserRatingsTotal) ||
-		(input.PriceLevel > 0 && shop.PriceLevel != input.PriceLevel) ||
-		(input.Website != "" && shop.Website != input.Website) ||
-		(input.FormattedPhone != "" && shop.FormattedPhone != input.FormattedPhone) ||
-		(input.BusinessStatus != "" && shop.BusinessStatus != input.BusinessStatus), nil
-}
-
-func (s *SyncManager) updateShop(ctx context.Context, input SyncInput) error {
-	_ = ctx
-	// extract photo refs from Photos slice
-	photoRefs := make([]string, len(input.Photos))
-	for i, photo := range input.Photos {
-		photoRefs[i] = photo.PhotoReference
-	}
-
-	// create the point from the Location
-	point := fmt.Sprintf("(%f,%f)", input.Location.Lat, input.Location.Lng)
-
-	updateData := map[string]interface{}{
-		"name": input.Name,
-		"formatted_address": input.FormattedAddress,
-		"vicinity": input.Vicinity,
-		"location": point,
-		"google_rating": input.Rating,
-		"ratings_total": input.UserRatingsTotal,
-		"price_level": input.PriceLevel,
-		"types": input.Types,
-		"photo_refs": photoRefs,
-		"hours": input.OpeningHours,
-		"website": input.Website,
-		"formatted_phone": input.FormattedPhone,
-		"business_status": input.BusinessStatus,
-		"last_sync": time.Now(),
-	}
-
-	_, _, err := s.db.From("shops").Update(updateData, "", "").Eq("google_place_id", input.PlaceID).Execute()
-
-	if err != nil {
-		return fmt.Errorf("failed to update shop: %w", err)
-	}
-
-	return nil
-}
\ No newline at end of file
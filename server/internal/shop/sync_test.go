@@ -177,75 +177,3 @@ func TestShopExists(t *testing.T) {
 		})
 	}
 }
-
-func TestCheckForUpdate(t *testing.T) {
-	db := setupTestDB(t)
-	syncManager := NewSyncManager(db)
-
-	// Create initial shop
-	initialShop := SyncInput{
-		PlaceID:          "test_update_" + time.Now().Format("20060102150405"),
-		Name:             "Initial Shop Name",
-		FormattedAddress: "Initial Address",
-		Rating:           4.0,
-		UserRatingsTotal: 100,
-	}
-
-	err := syncManager.SyncShopData(context.Background(), initialShop)
-	if err != nil {
-		t.Fatalf("Failed to create initial shop: %v", err)
-	}
-
-	tests := []struct {
-		name    string
-		input   SyncInput
-		want    bool
-		wantErr bool
-	}{
-		{
-			name: "shop needs update",
-			input: SyncInput{
-				PlaceID:          initialShop.PlaceID,
-				Name:             "Updated Shop Name",
-				FormattedAddress: "Updated Address",
-				Rating:           4.5,
-				UserRatingsTotal: 150,
-			},
-			want:    true,
-			wantErr: false,
-		},
-		{
-			name: "no update needed",
-			input: SyncInput{
-				PlaceID:          initialShop.PlaceID,
-				Name:             "Updated Shop Name",
-				FormattedAddress: "Updated Address",
-				Rating:           4.5,
-				UserRatingsTotal: 150,
-			},
-			want:    false,
-			wantErr: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := syncManager.checkForUpdate(context.Background(), tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("checkForUpdate() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("checkForUpdate() = %v, want %v", got, tt.want)
-			}
-
-			// If an update was needed, apply it for the next test
-			if got {
-				err = syncManager.SyncShopData(context.Background(), tt.input)
-				if err != nil {
-					t.Errorf("Failed to apply update: %v", err)
-				}
-			}
-		})
-	}
-} 
\ No newline at end of file
@@ -24,11 +24,18 @@ type Shop struct {
     Website          string     `json:"website"`
     FormattedPhone   string     `json:"formatted_phone"`
     BusinessStatus   string     `json:"business_status"`
+    UTCOffset        *int       `json:"utc_offset"` // minutes ahead of UTC
     
     // Coffeehaus-specific fields
     CoffeehausRating *float32   `json:"coffeehaus_rating"`
+    Description      *string    `json:"description"`
     LastSync         time.Time  `json:"last_sync"`
     Verified         bool       `json:"verified"`
+
+    // Curation, hidden shops are left out of search
+    Hidden           bool       `json:"hidden"`
+    HiddenReason     *string    `json:"hidden_reason"`
+    MergedInto       *string    `json:"merged_into"`
 }
 
 // SyncInput represents the data we receive from the Places API
@@ -47,19 +54,5 @@ type SyncInput struct {
 	Website          string
 	FormattedPhone   string
 	BusinessStatus   string
+	UTCOffset        *int
 }
-
-// ExistingShop represents the minimal data needed to check for updates
-type ExistingShop struct {
-	ID              string  `json:"id"`
-	GooglePlaceID   string  `json:"google_place_id"`
-	Name            string  `json:"name"`
-	FormattedAddress string  `json:"formatted_address"`
-	Vicinity        string  `json:"vicinity"`
-	GoogleRating    float32 `json:"google_rating"`
-	RatingsTotal    int     `json:"ratings_total"`
-	PriceLevel      int     `json:"price_level"`
-	Website         string  `json:"website"`
-	FormattedPhone  string  `json:"formatted_phone"`
-	BusinessStatus  string  `json:"business_status"`
-}
\ No newline at end of file
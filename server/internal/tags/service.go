@@ -0,0 +1,192 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/johnnynu/Coffeehaus/internal/breaker"
+	"github.com/johnnynu/Coffeehaus/internal/database"
+	"github.com/johnnynu/Coffeehaus/internal/redis"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Service indexes hashtags on posts. Usage is counted in Redis as it happens
+// and flushed to the tags table periodically by RunFlusher.
+type Service struct {
+	db      *database.Client
+	redis   *redis.RedisClient
+	breaker *breaker.Breaker
+}
+
+func NewService(db *database.Client, redis *redis.RedisClient) *Service {
+	return &Service{
+		db:    db,
+		redis: redis,
+	}
+}
+
+// SetBreaker sets the breaker request path calls to redis go through, so
+// posting and trending carry on while redis is down
+func (s *Service) SetBreaker(b *breaker.Breaker) {
+	s.breaker = b
+}
+
+// guarded calls fn through the breaker, if one is set
+func (s *Service) guarded(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.breaker == nil {
+		return fn(ctx)
+	}
+	return s.breaker.Do(ctx, fn)
+}
+
+// IndexPost extracts the hashtags from a post caption and links them to the
+// post. It returns the tags that were indexed.
+func (s *Service) IndexPost(ctx context.Context, postID string, caption string) ([]string, error) {
+	tags := Extract(caption)
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	// make sure every tag exists before linking it, usage_count is left
+	// alone so the flushed counts aren't overwritten
+	tagRows := make([]map[string]interface{}, len(tags))
+	postTagRows := make([]map[string]interface{}, len(tags))
+	for i, tag := range tags {
+		tagRows[i] = map[string]interface{}{"name": tag}
+		postTagRows[i] = map[string]interface{}{"post_id": postID, "tag": tag}
+	}
+
+	_, _, err := s.db.From("tags").Upsert(tagRows, "name", "minimal", "").Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert tags: %w", err)
+	}
+
+	_, _, err = s.db.From("post_tags").Upsert(postTagRows, "post_id,tag", "minimal", "").Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to link tags to post: %w", err)
+	}
+
+	err = s.guarded(ctx, func(ctx context.Context) error {
+		return s.redis.IncrementTagUsage(ctx, tags, time.Now())
+	})
+	if err != nil {
+		// the post is tagged either way, only the counters fall behind
+		log.Printf("Warning: failed to count tag usage for post %s: %v", postID, err)
+	}
+
+	return tags, nil
+}
+
+// PostsForTag returns the newest posts carrying the tag
+func (s *Service) PostsForTag(ctx context.Context, tag string, limit, offset int) (json.RawMessage, error) {
+	_ = ctx
+
+	res, _, err := s.db.From("posts").
+		Select("*, post_tags!inner(tag)", "", false).
+		Eq("post_tags.tag", tag).
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		Range(offset, offset+limit-1, "").
+		Execute()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find posts for tag %s: %w", tag, err)
+	}
+
+	return res, nil
+}
+
+// Trending returns the top tags for the window. Without redis it falls back
+// to the all time counts of tags used in the window, as of the last flush.
+func (s *Service) Trending(ctx context.Context, window redis.TrendingWindow, limit int) ([]redis.TrendingTag, error) {
+	if !window.IsValid() {
+		return nil, fmt.Errorf("unknown trending window: %s", window)
+	}
+
+	var trending []redis.TrendingTag
+	err := s.guarded(ctx, func(ctx context.Context) error {
+		var err error
+		trending, err = s.redis.TrendingTags(ctx, window, limit)
+		return err
+	})
+	if err == nil {
+		return trending, nil
+	}
+
+	log.Printf("Trending tags unavailable, using db counts: %v", err)
+	return s.trendingFromDB(ctx, window, limit)
+}
+
+// trendingFromDB returns the most used tags that were used in the window
+func (s *Service) trendingFromDB(ctx context.Context, window redis.TrendingWindow, limit int) ([]redis.TrendingTag, error) {
+	_ = ctx
+	since := time.Now().Add(-window.Span()).UTC().Format(time.RFC3339)
+
+	res, _, err := s.db.From("tags").
+		Select("name, usage_count", "", false).
+		Gte("last_used_at", since).
+		Order("usage_count", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag counts: %w", err)
+	}
+
+	var rows []struct {
+		Name       string  `json:"name"`
+		UsageCount float64 `json:"usage_count"`
+	}
+	if err := json.Unmarshal(res, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse tag counts: %w", err)
+	}
+
+	trending := make([]redis.TrendingTag, len(rows))
+	for i, row := range rows {
+		trending[i] = redis.TrendingTag{Tag: row.Name, Score: row.UsageCount}
+	}
+	return trending, nil
+}
+
+// FlushCounts writes the usage counted in Redis since the last flush to the
+// tags table. Each batch is added at most once, however often it is flushed.
+func (s *Service) FlushCounts(ctx context.Context) error {
+	batch, counts, err := s.redis.TakePendingTagCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	if batch == "" {
+		return nil
+	}
+	if len(counts) == 0 {
+		return s.redis.AckPendingTagCounts(ctx, batch)
+	}
+
+	// a batch flushed before but never acked is skipped by the db, so its
+	// counts aren't added twice
+	if _, err := s.db.CallFunction(ctx, "increment_tag_usage", map[string]interface{}{"counts": counts, "batch": batch}); err != nil {
+		return fmt.Errorf("failed to flush tag counts: %w", err)
+	}
+
+	log.Printf("Flushed usage counts for %d tags", len(counts))
+	return s.redis.AckPendingTagCounts(ctx, batch)
+}
+
+// RunFlusher calls FlushCounts every interval until ctx is cancelled
+func (s *Service) RunFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.FlushCounts(ctx); err != nil {
+				log.Printf("Failed to flush tag counts: %v", err)
+			}
+		}
+	}
+}
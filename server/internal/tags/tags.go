@@ -0,0 +1,87 @@
+package tags
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxTagLength is the longest hashtag we index, not counting the '#'
+	maxTagLength = 50
+	// maxTagsPerPost caps how many hashtags a single caption can contribute
+	maxTagsPerPost = 30
+)
+
+// Extract returns the unique hashtags in a post caption, normalized and in the
+// order they first appear. A hashtag is a '#' that does not follow a letter or
+// digit, followed by letters, digits or underscores with at least one letter.
+func Extract(caption string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	runes := []rune(caption)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' {
+			continue
+		}
+
+		// skip things like "abc#def" and url fragments
+		if i > 0 && (isTagRune(runes[i-1]) || runes[i-1] == '/' || runes[i-1] == '&') {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isTagRune(runes[j]) {
+			j++
+		}
+
+		tag, ok := normalize(string(runes[i+1 : j]))
+		i = j - 1
+		if !ok || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerPost {
+			break
+		}
+	}
+
+	return tags
+}
+
+// Normalize converts user input such as "#MatchaLatte" into the stored form of
+// a tag. It returns false if the input is not a valid hashtag.
+func Normalize(tag string) (string, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+	}
+	return normalize(tag)
+}
+
+func normalize(tag string) (string, bool) {
+	if tag == "" || len([]rune(tag)) > maxTagLength {
+		return "", false
+	}
+
+	hasLetter := false
+	for _, r := range tag {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			break
+		}
+	}
+	if !hasLetter {
+		return "", false
+	}
+
+	return strings.ToLower(tag), true
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,80 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		caption string
+		want    []string
+	}{
+		{
+			name:    "no tags",
+			caption: "just a flat white",
+			want:    nil,
+		},
+		{
+			name:    "tags are lowercased and deduplicated",
+			caption: "#Matcha latte at #matcha heaven #PourOver",
+			want:    []string{"matcha", "pourover"},
+		},
+		{
+			name:    "tags end at punctuation",
+			caption: "love this place!#cortado, #flat_white.",
+			want:    []string{"cortado", "flat_white"},
+		},
+		{
+			name:    "hashes inside words and urls are ignored",
+			caption: "email me at a#b or see https://example.com/#menu &#39;",
+			want:    nil,
+		},
+		{
+			name:    "numeric only tags are ignored",
+			caption: "order #42 and #2024coffee",
+			want:    []string{"2024coffee"},
+		},
+		{
+			name:    "unicode letters are kept",
+			caption: "#コーヒー #Café",
+			want:    []string{"コーヒー", "café"},
+		},
+		{
+			name:    "lone hash",
+			caption: "# nothing here ##",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Extract(tt.caption)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q) = %v, want %v", tt.caption, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{input: "#ColdBrew", want: "coldbrew", wantOK: true},
+		{input: "coldbrew", want: "coldbrew", wantOK: true},
+		{input: "cold brew", wantOK: false},
+		{input: "#123", wantOK: false},
+		{input: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Normalize(tt.input)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
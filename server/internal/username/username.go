@@ -0,0 +1,131 @@
+// Package username holds the rules usernames must follow and the folding used
+// to decide when two usernames are too similar to coexist.
+package username
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+var (
+	ErrTooShort     = fmt.Errorf("username must be at least %d characters", MinLength)
+	ErrTooLong      = fmt.Errorf("username must be at most %d characters", MaxLength)
+	ErrInvalidChars = errors.New("username may only contain letters, numbers, periods and underscores")
+	ErrBadPeriods   = errors.New("username cannot start or end with a period or contain consecutive periods")
+	ErrReserved     = errors.New("username is reserved")
+)
+
+// reserved names can't be registered, and neither can anything that folds to
+// the same key
+var reserved = []string{
+	"admin", "administrator", "api", "search", "root", "system", "support",
+	"help", "settings", "login", "logout", "signup", "signin", "register",
+	"user", "users", "me", "tags", "posts", "photos", "shops", "feed",
+	"explore", "coffeehaus", "staff", "moderator", "mod", "official",
+	"www", "null", "undefined", "anonymous",
+}
+
+var reservedKeys = func() map[string]bool {
+	keys := make(map[string]bool, len(reserved))
+	for _, name := range reserved {
+		keys[Key(name)] = true
+	}
+	return keys
+}()
+
+// lookalikes maps non-Latin letters that render like Latin ones to the Latin
+// letter, so a username typed with a Cyrillic "а" folds to a plain "a"
+var lookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i',
+	'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S', 'І': 'I',
+	'Ј': 'J',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'ρ': 'p', 'τ': 't', 'ι': 'i', 'κ': 'k',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K',
+	'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// Normalize folds user input into the form we store and validates it against
+// the username policy. Compatibility characters (fullwidth letters, ligatures)
+// and Cyrillic/Greek lookalikes are folded to ASCII first, so they are
+// accepted as the ASCII name they imitate rather than registered separately.
+func Normalize(input string) (string, error) {
+	folded := norm.NFKC.String(strings.TrimSpace(input))
+	folded = strings.Map(func(r rune) rune {
+		if l, ok := lookalikes[r]; ok {
+			return l
+		}
+		return r
+	}, folded)
+
+	if err := Validate(folded); err != nil {
+		return "", err
+	}
+
+	return folded, nil
+}
+
+// Validate checks a username against the character, length and reserved word
+// rules
+func Validate(name string) error {
+	if len(name) < MinLength {
+		return ErrTooShort
+	}
+	if len(name) > MaxLength {
+		return ErrTooLong
+	}
+
+	for _, r := range name {
+		if !isAllowed(r) {
+			return ErrInvalidChars
+		}
+	}
+
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return ErrBadPeriods
+	}
+
+	if reservedKeys[Key(name)] {
+		return ErrReserved
+	}
+
+	return nil
+}
+
+// Key returns the uniqueness key for a valid username. Usernames with the
+// same key are considered the same name: the key is case-insensitive and
+// folds characters that are easily confused for one another, so "Johnny",
+// "johnny" and "j0hnny" all collide. The db's username_key function keys
+// rows written without the API, it folds like Normalize followed by Key.
+func Key(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer(
+		"rn", "m",
+		"vv", "w",
+		"0", "o",
+		"5", "s",
+		// "I", "l", "1" and "i" are indistinguishable in many fonts
+		"1", "l",
+		"i", "l",
+		".", "_",
+	).Replace(name)
+}
+
+func isAllowed(r rune) bool {
+	return (r >= 'a' && r <= 'z') ||
+		(r >= 'A' && r <= 'Z') ||
+		(r >= '0' && r <= '9') ||
+		r == '_' || r == '.'
+}
@@ -0,0 +1,76 @@
+package username
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "plain", input: "johnny", want: "johnny"},
+		{name: "case is kept", input: "Johnny_Nu", want: "Johnny_Nu"},
+		{name: "surrounding space trimmed", input: "  latte.lover ", want: "latte.lover"},
+		{name: "fullwidth folds to ascii", input: "ｊｏｈｎｎｙ", want: "johnny"},
+		{name: "cyrillic lookalikes fold to latin", input: "jоhnny", want: "johnny"},
+		{name: "too short", input: "jo", wantErr: ErrTooShort},
+		{name: "too long", input: "abcdefghijklmnopqrstuvwxyz12345", wantErr: ErrTooLong},
+		{name: "spaces", input: "john nu", wantErr: ErrInvalidChars},
+		{name: "emoji", input: "coffee☕", wantErr: ErrInvalidChars},
+		{name: "leading period", input: ".johnny", wantErr: ErrBadPeriods},
+		{name: "double period", input: "john..nu", wantErr: ErrBadPeriods},
+		{name: "reserved", input: "admin", wantErr: ErrReserved},
+		{name: "reserved case-insensitive", input: "API", wantErr: ErrReserved},
+		{name: "reserved lookalike", input: "adm1n", wantErr: ErrReserved},
+		{name: "reserved cyrillic lookalike", input: "sеаrch", wantErr: ErrReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Normalize(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	collide := [][2]string{
+		{"Johnny", "johnny"},
+		{"johnny", "j0hnny"},
+		{"Bill", "BiII"},
+		{"admin", "adm1n"},
+		{"barn", "bam"},
+		{"latte.lover", "latte_lover"},
+	}
+	for _, pair := range collide {
+		if Key(pair[0]) != Key(pair[1]) {
+			t.Errorf("Key(%q) = %q and Key(%q) = %q, want equal", pair[0], Key(pair[0]), pair[1], Key(pair[1]))
+		}
+	}
+
+	distinct := [][2]string{
+		{"johnny", "johnnie"},
+		{"latte", "lattes"},
+		{"latte", "iatte.x"},
+	}
+	for _, pair := range distinct {
+		if Key(pair[0]) == Key(pair[1]) {
+			t.Errorf("Key(%q) == Key(%q) = %q, want different", pair[0], pair[1], Key(pair[0]))
+		}
+	}
+}
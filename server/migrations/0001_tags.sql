@@ -0,0 +1,30 @@
+-- Hashtags extracted from post captions.
+create table if not exists tags (
+    name          text primary key,
+    usage_count   bigint not null default 0,
+    created_at    timestamptz not null default now(),
+    last_used_at  timestamptz
+);
+
+create table if not exists post_tags (
+    post_id    uuid not null references posts(id) on delete cascade,
+    tag        text not null references tags(name) on delete cascade,
+    created_at timestamptz not null default now(),
+    primary key (post_id, tag)
+);
+
+create index if not exists post_tags_tag_created_idx on post_tags (tag, created_at desc);
+
+-- increment_tag_usage adds the counts flushed from the Redis hot counters
+-- ({"tag": count, ...}) to tags.usage_count.
+create or replace function increment_tag_usage(counts jsonb)
+returns void
+language sql
+as $$
+    insert into tags (name, usage_count, last_used_at)
+    select key, value::bigint, now()
+    from jsonb_each_text(counts)
+    on conflict (name) do update
+        set usage_count  = tags.usage_count + excluded.usage_count,
+            last_used_at = now();
+$$;
@@ -0,0 +1,9 @@
+-- Photos uploaded through POST /photos record their owner, dimensions and a
+-- perceptual hash next to the versions json ({"thumbnail": url, "medium":
+-- url, "full": url}).
+alter table photos add column if not exists user_id uuid references users(id) on delete cascade;
+alter table photos add column if not exists phash text;
+alter table photos add column if not exists width integer;
+alter table photos add column if not exists height integer;
+
+create index if not exists photos_user_id_idx on photos (user_id);
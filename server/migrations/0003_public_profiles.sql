@@ -0,0 +1,12 @@
+-- Private accounts only show their posts to followers.
+alter table users add column if not exists is_private boolean not null default false;
+
+create table if not exists follows (
+    follower_id  uuid not null references users(id) on delete cascade,
+    following_id uuid not null references users(id) on delete cascade,
+    created_at   timestamptz not null default now(),
+    primary key (follower_id, following_id)
+);
+
+create index if not exists follows_following_id_idx on follows (following_id);
+create index if not exists posts_user_id_created_idx on posts (user_id, created_at desc);
@@ -0,0 +1,84 @@
+-- username_key mirrors username.Normalize then username.Key in the Go code:
+-- compatibility characters and Cyrillic/Greek lookalikes folded to ASCII,
+-- lowercased and easily confused characters folded, so "Johnny", "johnny",
+-- "j0hnny" and a Cyrillic "jоhnny" collide. Keep the lookalikes in step with
+-- the Go map.
+create or replace function username_key(name text)
+returns text
+language sql
+immutable
+as $$
+    select replace(replace(replace(replace(replace(replace(replace(
+        lower(translate(normalize(name, NFKC),
+            'авекмнорстухѕіјԁԛԝАВЕКМНОРСТУХЅІЈαονρτικΑΒΕΖΗΙΚΜΝΟΡΤΥΧ',
+            'abekmhopctyxsijdqwABEKMHOPCTYXSIJaovptikABEZHIKMNOPTYX')),
+        'rn', 'm'), 'vv', 'w'), '0', 'o'), '5', 's'), '1', 'l'), 'i', 'l'), '.', '_');
+$$;
+
+alter table users add column if not exists username_key text;
+update users set username_key = username_key(username) where username is not null;
+
+-- Usernames were only unique as typed, so "Johnny" and "johnny" may both
+-- exist. The oldest keeps the name, the others get a suffixed one and their
+-- old name goes to username_history below, as a rename would.
+create temporary table username_collisions as
+select id, username, username_key
+from (
+    select id, username, username_key,
+           row_number() over (partition by username_key order by created_at, id) as n
+    from users
+    where username_key is not null
+) ranked
+where n > 1;
+
+update users u
+set username = left(c.username, 23) || '_' || left(md5(c.id::text), 6)
+from username_collisions c
+where u.id = c.id;
+update users u
+set username_key = username_key(u.username)
+from username_collisions c
+where u.id = c.id;
+
+create unique index if not exists users_username_lower_idx on users (lower(username));
+create unique index if not exists users_username_key_idx on users (username_key);
+
+-- Old usernames keep redirecting to their owner, and can't be claimed by
+-- anyone else, until expires_at.
+create table if not exists username_history (
+    id           bigserial primary key,
+    user_id      uuid not null references users(id) on delete cascade,
+    username     text not null,
+    username_key text not null,
+    changed_at   timestamptz not null default now(),
+    expires_at   timestamptz not null default now() + interval '30 days'
+);
+
+create index if not exists username_history_key_idx on username_history (username_key, expires_at);
+
+insert into username_history (user_id, username, username_key)
+select id, username, username_key from username_collisions;
+
+drop table username_collisions;
+
+create or replace function record_username_change()
+returns trigger
+language plpgsql
+as $$
+begin
+    -- rows written without a key (e.g. straight from the client) still get one
+    new.username_key := username_key(new.username);
+
+    if tg_op = 'UPDATE' and old.username is not null and old.username is distinct from new.username then
+        insert into username_history (user_id, username, username_key)
+        values (old.id, old.username, username_key(old.username));
+    end if;
+
+    return new;
+end;
+$$;
+
+drop trigger if exists users_username_change on users;
+create trigger users_username_change
+    before insert or update of username on users
+    for each row execute function record_username_change();
@@ -0,0 +1,22 @@
+-- Admin curation of shops. Hidden shops are left out of every search; a shop
+-- merged into another is hidden and points at the shop that replaced it.
+alter table shops add column if not exists description text;
+alter table shops add column if not exists hidden boolean not null default false;
+alter table shops add column if not exists hidden_reason text;
+alter table shops add column if not exists merged_into uuid references shops(id);
+
+create index if not exists shops_hidden_idx on shops (hidden) where hidden;
+
+-- Every admin change, who made it and what changed.
+create table if not exists admin_audit_log (
+    id          bigserial primary key,
+    actor_id    uuid not null references users(id),
+    action      text not null,
+    target_type text not null,
+    target_id   text not null,
+    details     jsonb not null default '{}'::jsonb,
+    created_at  timestamptz not null default now()
+);
+
+create index if not exists admin_audit_log_target_idx on admin_audit_log (target_type, target_id, created_at desc);
+create index if not exists admin_audit_log_actor_idx on admin_audit_log (actor_id, created_at desc);
@@ -0,0 +1,40 @@
+-- Scheduled re-sync of stale shops. last_sync_attempt stops a shop that keeps
+-- failing from being picked on every pass, and every attempt is logged.
+alter table shops add column if not exists last_sync_attempt timestamptz;
+alter table shops add column if not exists closed_at timestamptz;
+
+create table if not exists shop_sync_log (
+    id              bigserial primary key,
+    shop_id         uuid not null references shops(id) on delete cascade,
+    outcome         text not null, -- updated, unchanged, closed, not_found, failed
+    error           text,
+    synced_at       timestamptz not null default now()
+);
+
+create index if not exists shop_sync_log_shop_idx on shop_sync_log (shop_id, synced_at desc);
+create index if not exists shop_sync_log_outcome_idx on shop_sync_log (outcome, synced_at desc);
+
+-- stale_shops picks the visible shops not synced or attempted within
+-- stale_after_seconds. Staleness is scaled up by popularity, recent posts and
+-- Google review count, so busy shops are refreshed first.
+create or replace function stale_shops(stale_after_seconds integer, max_shops integer)
+returns table (id uuid, google_place_id text, last_sync timestamptz, recent_posts bigint)
+language sql
+stable
+as $$
+    select s.id, s.google_place_id, s.last_sync, coalesce(p.recent_posts, 0)
+    from shops s
+    left join (
+        select shop_id, count(*) as recent_posts
+        from posts
+        where created_at > now() - interval '90 days'
+        group by shop_id
+    ) p on p.shop_id = s.id
+    where not s.hidden
+      and greatest(s.last_sync, coalesce(s.last_sync_attempt, s.last_sync))
+          < now() - make_interval(secs => stale_after_seconds)
+    order by
+        extract(epoch from now() - s.last_sync) / stale_after_seconds
+            * (1 + ln(1 + coalesce(p.recent_posts, 0)) + ln(1 + coalesce(s.ratings_total, 0)) / 4) desc
+    limit max_shops;
+$$;
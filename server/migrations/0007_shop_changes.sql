@@ -0,0 +1,14 @@
+-- Field level history of shop data. Each sync that changes a shop records the
+-- fields it changed with their old and new values, and what made the change.
+create table if not exists shop_changes (
+    id              bigserial primary key,
+    shop_id         uuid not null references shops(id) on delete cascade,
+    field           text not null,
+    old_value       jsonb,
+    new_value       jsonb,
+    source          text not null, -- search, resync, admin
+    changed_at      timestamptz not null default now()
+);
+
+create index if not exists shop_changes_shop_idx on shop_changes (shop_id, field, changed_at);
+create index if not exists shop_changes_field_idx on shop_changes (field, changed_at desc);
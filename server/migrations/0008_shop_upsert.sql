@@ -0,0 +1,73 @@
+-- Shops are created with an upsert on google_place_id so concurrent syncs of
+-- the same place can't insert duplicates or fail on the unique constraint.
+
+-- Syncs that raced before may have inserted a place more than once. The
+-- oldest row of each place is kept: posts and merges of the others move to
+-- it, then they are deleted along with their sync history.
+alter table shops add column if not exists created_at timestamptz not null default now();
+
+create temporary table duplicate_shops as
+select id, keep_id
+from (
+    select id,
+           first_value(id) over (partition by google_place_id order by created_at, id) as keep_id
+    from shops
+    where google_place_id is not null
+) ranked
+where id <> keep_id;
+
+update posts p
+set shop_id = d.keep_id
+from duplicate_shops d
+where p.shop_id = d.id;
+-- a kept row merged into its own duplicate isn't merged at all
+update shops s
+set merged_into = nullif(d.keep_id, s.id)
+from duplicate_shops d
+where s.merged_into = d.id;
+delete from shops s
+using duplicate_shops d
+where s.id = d.id;
+
+drop table duplicate_shops;
+
+create unique index if not exists shops_google_place_id_key on shops (google_place_id);
+
+-- the upsert leaves Coffeehaus columns of new shops to their defaults
+alter table shops alter column verified set default false;
+
+-- upsert_shops inserts shop_rows, a json array of shops, in one statement.
+-- Places columns of shops that already exist are overwritten; Coffeehaus
+-- columns keep their values. created is false for rows that already existed.
+create or replace function upsert_shops(shop_rows jsonb)
+returns table (id uuid, google_place_id text, created boolean)
+language sql
+volatile
+as $$
+    insert into shops as s (
+        google_place_id, name, formatted_address, vicinity, location,
+        google_rating, ratings_total, price_level, types, photo_refs, hours,
+        website, formatted_phone, business_status, last_sync
+    )
+    select
+        r.google_place_id, r.name, r.formatted_address, r.vicinity, r.location,
+        r.google_rating, r.ratings_total, r.price_level, r.types, r.photo_refs, r.hours,
+        r.website, r.formatted_phone, r.business_status, coalesce(r.last_sync, now())
+    from jsonb_populate_recordset(null::shops, shop_rows) r
+    on conflict (google_place_id) do update set
+        name              = excluded.name,
+        formatted_address = excluded.formatted_address,
+        vicinity          = excluded.vicinity,
+        location          = excluded.location,
+        google_rating     = excluded.google_rating,
+        ratings_total     = excluded.ratings_total,
+        price_level       = excluded.price_level,
+        types             = excluded.types,
+        photo_refs        = excluded.photo_refs,
+        hours             = excluded.hours,
+        website           = excluded.website,
+        formatted_phone   = excluded.formatted_phone,
+        business_status   = excluded.business_status,
+        last_sync         = excluded.last_sync
+    returning s.id, s.google_place_id, (s.xmax = 0) as created;
+$$;
@@ -0,0 +1,64 @@
+-- Typo tolerant shop name search. Names are compared lowercased and without
+-- accents using trigram similarity, so "stereoscope cofee" finds
+-- "Stereoscope Coffee" and "cafe" finds "Café".
+create extension if not exists pg_trgm;
+create extension if not exists unaccent;
+
+-- unaccent is only stable, an index expression needs an immutable function
+create or replace function immutable_unaccent(value text)
+returns text
+language sql
+immutable
+parallel safe
+strict
+as $$
+    select public.unaccent('public.unaccent'::regdictionary, value);
+$$;
+
+create index if not exists shops_name_trgm_idx
+    on shops using gin (immutable_unaccent(lower(name)) gin_trgm_ops);
+
+-- search_shops_by_name ranks visible shops by how well their name matches
+-- query: the better of whole name similarity and the best matching run of
+-- words in the name, so a partial name like "blue bottle" still scores
+-- highly against "Blue Bottle Coffee". Given a location, matches up to 50km
+-- away lose up to 30% of their score, so the nearest branch of a chain wins.
+create or replace function search_shops_by_name(
+    query text,
+    lat double precision default null,
+    lng double precision default null,
+    max_results integer default 10,
+    min_similarity real default 0.3
+)
+returns table (shop jsonb, similarity real, distance_meters double precision, score real)
+language sql
+stable
+as $$
+    with q as (
+        select immutable_unaccent(lower(query)) as term
+    ),
+    matches as (
+        select
+            s,
+            greatest(
+                similarity(immutable_unaccent(lower(s.name)), q.term),
+                word_similarity(q.term, immutable_unaccent(lower(s.name)))
+            ) as similarity,
+            case when lat is null or lng is null then null
+                 else ST_Distance(s.location::geography, ST_SetSRID(ST_MakePoint(lng, lat), 4326)::geography)
+            end as distance_meters
+        from shops s, q
+        where not s.hidden
+          and (immutable_unaccent(lower(s.name)) % q.term
+               or q.term <% immutable_unaccent(lower(s.name)))
+    )
+    select
+        to_jsonb(m.s),
+        m.similarity,
+        m.distance_meters,
+        (m.similarity * (1 - 0.3 * least(coalesce(m.distance_meters, 0) / 50000, 1)))::real as score
+    from matches m
+    where m.similarity >= min_similarity
+    order by score desc
+    limit max_results;
+$$;
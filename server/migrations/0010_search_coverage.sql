@@ -0,0 +1,11 @@
+-- Where Places has been searched, so searches there can be answered from the
+-- db. cell is a geohash, empty for a search without a location. query is
+-- empty for nearby searches and the normalized shop name for searches for a
+-- specific shop.
+create table if not exists search_coverage (
+    cell        text not null,
+    query       text not null default '',
+    swept_at    timestamptz not null default now(),
+    shop_count  integer not null default 0,
+    primary key (cell, query)
+);
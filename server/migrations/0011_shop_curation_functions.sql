@@ -0,0 +1,92 @@
+-- Admin changes to shops and their audit entries are written by one function
+-- call each, so a change is never made without being audited and a merge
+-- never stops halfway. Errors carry their own codes for the API to map:
+-- P0002 the shop doesn't exist, CHM01 it has been merged away, CHM02 the
+-- merge makes no sense.
+
+-- curate_shop sets the columns in fields, a json object of column to value,
+-- on a shop and audits the change as action with fields as its details.
+create or replace function curate_shop(
+    shop_id uuid,
+    actor_id uuid,
+    action text,
+    fields jsonb
+)
+returns setof shops
+language plpgsql
+volatile
+as $$
+declare
+    assignments text;
+begin
+    select string_agg(format('%I = ($2).%I', key, key), ', ')
+    into assignments
+    from jsonb_object_keys(fields) as key;
+    if assignments is null then
+        raise exception 'no fields to update' using errcode = 'CHM02';
+    end if;
+
+    return query execute format('update shops set %s where id = $1 returning *', assignments)
+        using curate_shop.shop_id, jsonb_populate_record(null::shops, fields);
+    if not found then
+        raise exception 'shop % not found', curate_shop.shop_id using errcode = 'P0002';
+    end if;
+
+    insert into admin_audit_log (actor_id, action, target_type, target_id, details)
+    values (curate_shop.actor_id, curate_shop.action, 'shop', curate_shop.shop_id::text, fields);
+end;
+$$;
+
+-- merge_shops folds source into target: posts move to target, shops merged
+-- into source now point at target, source is hidden and the merge audited.
+-- It returns target.
+create or replace function merge_shops(
+    source_id uuid,
+    target_id uuid,
+    actor_id uuid,
+    action text
+)
+returns setof shops
+language plpgsql
+volatile
+as $$
+declare
+    source shops;
+    target shops;
+begin
+    if source_id = target_id then
+        raise exception 'a shop can''t be merged into itself' using errcode = 'CHM02';
+    end if;
+
+    -- lock both in a fixed order so opposite merges can't deadlock
+    perform 1 from shops where id in (source_id, target_id) order by id for update;
+
+    select * into source from shops where id = merge_shops.source_id;
+    if source.id is null then
+        raise exception 'shop % not found', merge_shops.source_id using errcode = 'P0002';
+    end if;
+    select * into target from shops where id = merge_shops.target_id;
+    if target.id is null then
+        raise exception 'shop % not found', merge_shops.target_id using errcode = 'P0002';
+    end if;
+    if source.merged_into is not null then
+        raise exception '% was merged into %', source.id, source.merged_into using errcode = 'CHM01';
+    end if;
+    if target.merged_into is not null then
+        raise exception 'target % was merged into %', target.id, target.merged_into using errcode = 'CHM01';
+    end if;
+
+    update posts set shop_id = target.id where shop_id = source.id;
+    update shops set merged_into = target.id where merged_into = source.id;
+    update shops set hidden = true, hidden_reason = 'merged', merged_into = target.id where id = source.id;
+
+    insert into admin_audit_log (actor_id, action, target_type, target_id, details)
+    values (merge_shops.actor_id, merge_shops.action, 'shop', source.id::text, jsonb_build_object(
+        'merged_into', target.id,
+        'source_place_id', source.google_place_id,
+        'target_place_id', target.google_place_id
+    ));
+
+    return query select * from shops where id = target.id;
+end;
+$$;
@@ -0,0 +1,39 @@
+-- upsert_shops no longer overwrites a shop another sync created first. Those
+-- shops are returned with created false and the caller diffs them like any
+-- other existing shop, so only what changed is written and the changes are
+-- recorded in shop_changes.
+create or replace function upsert_shops(shop_rows jsonb)
+returns table (id uuid, google_place_id text, created boolean)
+language plpgsql
+volatile
+as $$
+#variable_conflict use_column
+declare
+    inserted text[];
+begin
+    with rows as (
+        insert into shops as s (
+            google_place_id, name, formatted_address, vicinity, location,
+            google_rating, ratings_total, price_level, types, photo_refs, hours,
+            website, formatted_phone, business_status, last_sync
+        )
+        select
+            r.google_place_id, r.name, r.formatted_address, r.vicinity, r.location,
+            r.google_rating, r.ratings_total, r.price_level, r.types, r.photo_refs, r.hours,
+            r.website, r.formatted_phone, r.business_status, coalesce(r.last_sync, now())
+        from jsonb_populate_recordset(null::shops, shop_rows) r
+        on conflict (google_place_id) do nothing
+        returning s.google_place_id
+    )
+    select coalesce(array_agg(rows.google_place_id), '{}') into inserted from rows;
+
+    -- a new statement, so it sees shops a concurrent sync committed while the
+    -- insert waited on them
+    return query
+    select s.id, s.google_place_id, s.google_place_id = any(inserted)
+    from shops s
+    where s.google_place_id in (
+        select r.google_place_id from jsonb_populate_recordset(null::shops, shop_rows) r
+    );
+end;
+$$;
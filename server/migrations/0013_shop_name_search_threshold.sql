@@ -0,0 +1,51 @@
+-- search_shops_by_name filtered candidates with pg_trgm's % and <% operators,
+-- which use the session's similarity thresholds rather than min_similarity,
+-- so the loosest matches asked for never came back. The thresholds are now
+-- set to min_similarity for the rest of the transaction before searching,
+-- keeping the trigram index in use.
+create or replace function search_shops_by_name(
+    query text,
+    lat double precision default null,
+    lng double precision default null,
+    max_results integer default 10,
+    min_similarity real default 0.3
+)
+returns table (shop jsonb, similarity real, distance_meters double precision, score real)
+language plpgsql
+volatile
+as $$
+#variable_conflict use_column
+begin
+    perform set_config('pg_trgm.similarity_threshold', min_similarity::text, true);
+    perform set_config('pg_trgm.word_similarity_threshold', min_similarity::text, true);
+
+    return query
+    with q as (
+        select immutable_unaccent(lower(search_shops_by_name.query)) as term
+    ),
+    matches as (
+        select
+            s,
+            greatest(
+                similarity(immutable_unaccent(lower(s.name)), q.term),
+                word_similarity(q.term, immutable_unaccent(lower(s.name)))
+            ) as similarity,
+            case when search_shops_by_name.lat is null or search_shops_by_name.lng is null then null
+                 else ST_Distance(s.location::geography, ST_SetSRID(ST_MakePoint(search_shops_by_name.lng, search_shops_by_name.lat), 4326)::geography)
+            end as distance_meters
+        from shops s, q
+        where not s.hidden
+          and (immutable_unaccent(lower(s.name)) % q.term
+               or q.term <% immutable_unaccent(lower(s.name)))
+    )
+    select
+        to_jsonb(m.s),
+        m.similarity::real,
+        m.distance_meters,
+        (m.similarity * (1 - 0.3 * least(coalesce(m.distance_meters, 0) / 50000, 1)))::real
+    from matches m
+    where m.similarity >= search_shops_by_name.min_similarity
+    order by 4 desc
+    limit search_shops_by_name.max_results;
+end;
+$$;
@@ -0,0 +1,40 @@
+-- The UTC offset Places gives a shop, in minutes, so opening hours are read
+-- in the shop's own time. It is null for shops synced before it was kept.
+alter table shops add column if not exists utc_offset integer;
+
+-- upsert_shops writes the offset of new shops too
+create or replace function upsert_shops(shop_rows jsonb)
+returns table (id uuid, google_place_id text, created boolean)
+language plpgsql
+volatile
+as $$
+#variable_conflict use_column
+declare
+    inserted text[];
+begin
+    with rows as (
+        insert into shops as s (
+            google_place_id, name, formatted_address, vicinity, location,
+            google_rating, ratings_total, price_level, types, photo_refs, hours,
+            website, formatted_phone, business_status, utc_offset, last_sync
+        )
+        select
+            r.google_place_id, r.name, r.formatted_address, r.vicinity, r.location,
+            r.google_rating, r.ratings_total, r.price_level, r.types, r.photo_refs, r.hours,
+            r.website, r.formatted_phone, r.business_status, r.utc_offset, coalesce(r.last_sync, now())
+        from jsonb_populate_recordset(null::shops, shop_rows) r
+        on conflict (google_place_id) do nothing
+        returning s.google_place_id
+    )
+    select coalesce(array_agg(rows.google_place_id), '{}') into inserted from rows;
+
+    -- a new statement, so it sees shops a concurrent sync committed while the
+    -- insert waited on them
+    return query
+    select s.id, s.google_place_id, s.google_place_id = any(inserted)
+    from shops s
+    where s.google_place_id in (
+        select r.google_place_id from jsonb_populate_recordset(null::shops, shop_rows) r
+    );
+end;
+$$;
@@ -0,0 +1,33 @@
+-- A tag count batch whose ack to Redis is lost, or whose flush outlives its
+-- lease, is flushed again. Batches already added are recorded so a repeat
+-- flush of one is skipped rather than counted twice.
+create table if not exists tag_flush_batches (
+    batch      text primary key,
+    flushed_at timestamptz not null default now()
+);
+
+drop function if exists increment_tag_usage(jsonb);
+
+create or replace function increment_tag_usage(counts jsonb, batch text)
+returns void
+language plpgsql
+as $$
+#variable_conflict use_column
+begin
+    insert into tag_flush_batches (batch) values (increment_tag_usage.batch)
+    on conflict do nothing;
+    if not found then
+        return;
+    end if;
+
+    insert into tags (name, usage_count, last_used_at)
+    select key, value::bigint, now()
+    from jsonb_each_text(counts)
+    on conflict (name) do update
+        set usage_count  = tags.usage_count + excluded.usage_count,
+            last_used_at = now();
+
+    -- batches are retried within minutes, a day of them is plenty to check
+    delete from tag_flush_batches where flushed_at < now() - interval '1 day';
+end;
+$$;
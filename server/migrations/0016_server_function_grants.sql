@@ -0,0 +1,15 @@
+-- Functions in public are executable by anon and authenticated by default,
+-- which exposes them to anyone through PostgREST rpc. These curate, sync and
+-- count shops and tags for the server alone, which calls them with the
+-- service role key. Functions like them added later need the same grants.
+revoke execute on function curate_shop(uuid, uuid, text, jsonb) from public, anon, authenticated;
+revoke execute on function merge_shops(uuid, uuid, uuid, text) from public, anon, authenticated;
+revoke execute on function upsert_shops(jsonb) from public, anon, authenticated;
+revoke execute on function stale_shops(integer, integer) from public, anon, authenticated;
+revoke execute on function increment_tag_usage(jsonb, text) from public, anon, authenticated;
+
+grant execute on function curate_shop(uuid, uuid, text, jsonb) to service_role;
+grant execute on function merge_shops(uuid, uuid, uuid, text) to service_role;
+grant execute on function upsert_shops(jsonb) to service_role;
+grant execute on function stale_shops(integer, integer) to service_role;
+grant execute on function increment_tag_usage(jsonb, text) to service_role;
@@ -0,0 +1,25 @@
+-- stale_shops compared greatest(last_sync, last_sync_attempt) against the
+-- cutoff, which is null for a shop that was never synced or attempted, so
+-- those shops were never picked. They now count as synced at -infinity and,
+-- having no age to scale, are picked first.
+create or replace function stale_shops(stale_after_seconds integer, max_shops integer)
+returns table (id uuid, google_place_id text, last_sync timestamptz, recent_posts bigint)
+language sql
+stable
+as $$
+    select s.id, s.google_place_id, s.last_sync, coalesce(p.recent_posts, 0)
+    from shops s
+    left join (
+        select shop_id, count(*) as recent_posts
+        from posts
+        where created_at > now() - interval '90 days'
+        group by shop_id
+    ) p on p.shop_id = s.id
+    where not s.hidden
+      and coalesce(greatest(s.last_sync, s.last_sync_attempt), '-infinity')
+          < now() - make_interval(secs => stale_after_seconds)
+    order by
+        extract(epoch from now() - s.last_sync) / stale_after_seconds
+            * (1 + ln(1 + coalesce(p.recent_posts, 0)) + ln(1 + coalesce(s.ratings_total, 0)) / 4) desc nulls first
+    limit max_shops;
+$$;